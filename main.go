@@ -1,12 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"time"
 
 	"github.com/Nerzal/gocloak/v13"
 	"github.com/gin-gonic/gin"
@@ -16,7 +16,19 @@ import (
 	"github.com/remiges-tech/alya/router"
 	"github.com/remiges-tech/alya/service"
 	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/middleware"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/idshield/webservices/capabilityservice"
+	"github.com/remiges-tech/idshield/webservices/eventservice"
 	"github.com/remiges-tech/idshield/webservices/groupservice"
+	"github.com/remiges-tech/idshield/webservices/jobservice"
+	"github.com/remiges-tech/idshield/webservices/metricsservice"
+	"github.com/remiges-tech/idshield/webservices/orgservice"
+	"github.com/remiges-tech/idshield/webservices/realmservice"
+	"github.com/remiges-tech/idshield/webservices/scopeservice"
+	"github.com/remiges-tech/idshield/webservices/searchservice"
+	"github.com/remiges-tech/idshield/webservices/tokenservice"
+	"github.com/remiges-tech/idshield/webservices/userservice"
 	"github.com/remiges-tech/logharbour/logharbour"
 )
 
@@ -27,6 +39,97 @@ type AppConfig struct {
 	KeycloakClientSecret string `json:"keycloak_client_secret"`
 	ProviderURL          string `json:"provider_url"`
 	Realm                string `json:"realm"`
+	// DefaultRealm is used when a request does not name a realm; it defaults to Realm
+	DefaultRealm string `json:"default_realm"`
+	// AllowedRealms lists the realms, besides the default one, that requests may target
+	AllowedRealms []string `json:"allowed_realms"`
+	// ErrorStatusCodes overrides the HTTP status code sent for specific error codes
+	ErrorStatusCodes map[string]int `json:"error_status_codes"`
+	// CircuitBreaker holds the thresholds of the circuit breaker wrapping Keycloak calls
+	CircuitBreaker utils.CircuitBreakerConfig `json:"circuit_breaker"`
+	// KeycloakRateLimitMaxWait is the longest wait, in seconds, honoured before retrying a Keycloak
+	// call that was rate limited; 5 by default, and -1 to never retry
+	KeycloakRateLimitMaxWait int `json:"keycloak_rate_limit_max_wait_seconds"`
+	// CapabilitiesGroup is the name of the top level group holding all capabilities
+	CapabilitiesGroup string `json:"capabilities_group"`
+	// CapabilityCategories lists the categories capabilities may be given; any category is allowed when empty
+	CapabilityCategories []string `json:"capability_categories"`
+	// AttributeSchemas maps a group type (group or capability) to the JSON schema file its
+	// attributes must conform to
+	AttributeSchemas map[string]string `json:"attribute_schemas"`
+	// RequestTimeout is the default timeout, in seconds, of the Keycloak calls made for a request
+	RequestTimeout int `json:"request_timeout"`
+	// RouteTimeouts overrides RequestTimeout for specific routes, keyed by route path
+	RouteTimeouts map[string]int `json:"route_timeouts"`
+	// ClientTimeoutMinMs and ClientTimeoutMaxMs bound, in milliseconds, the timeouts clients may ask
+	// for in the X-Request-Timeout-Ms header; 1 second and 5 minutes by default
+	ClientTimeoutMinMs int `json:"client_timeout_min_ms"`
+	ClientTimeoutMaxMs int `json:"client_timeout_max_ms"`
+	// DuplicateAttributeValues is "dedupe" (the default) to drop values repeated within an
+	// attribute, or "reject" to fail such requests
+	DuplicateAttributeValues string `json:"duplicate_attribute_values"`
+	// IdempotentDeletes makes deleting a resource that does not exist succeed, unless a request
+	// says otherwise through its idempotent query parameter
+	IdempotentDeletes bool `json:"idempotent_deletes"`
+	// Webhooks are notified after groups, capabilities and users are created
+	Webhooks utils.WebhookConfig `json:"webhooks"`
+	// MessageCatalogs is the directory holding translations of validation messages
+	MessageCatalogs string `json:"message_catalogs"`
+	// Tracing configures the export of OpenTelemetry traces; tracing is off without an endpoint
+	Tracing utils.TracingConfig `json:"tracing"`
+	// Compression configures gzip compression of large responses
+	Compression middleware.CompressionConfig `json:"compression"`
+	// Endpoints selects the endpoints this deployment exposes; all are exposed by default
+	Endpoints middleware.EndpointsConfig `json:"endpoints"`
+	// TokenExpiryWarning is how many seconds before its token expires a caller is warned; 60 by default
+	TokenExpiryWarning int `json:"token_expiry_warning"`
+	// Concurrency limits the number of requests served at once; requests are unlimited by default
+	Concurrency utils.ConcurrencyConfig `json:"concurrency"`
+	// Onboarding configures the links emailed to users invited through /user-onboard-link
+	Onboarding userservice.OnboardingConfig `json:"onboarding"`
+	// DefaultGroups maps a realm to the paths of the groups idshield adds its new users to
+	DefaultGroups map[string][]string `json:"default_groups"`
+	// CorrelationHeader is the header through which calling services pass their correlation ID;
+	// X-Correlation-ID by default
+	CorrelationHeader string `json:"correlation_header"`
+	// TrailingSlash is "redirect" (the default), "rewrite" or "strict", and decides how requests
+	// to a route's path with a trailing slash added are treated
+	TrailingSlash string `json:"trailing_slash"`
+	// DiscoveryBaseURL, when set, replaces the Keycloak base URL in the OIDC discovery documents
+	// served by idshield, for clients that reach Keycloak through it
+	DiscoveryBaseURL string `json:"discovery_base_url"`
+	// UniqueAttributes maps a realm to the group attributes whose values no two of its groups may share
+	UniqueAttributes map[string][]string `json:"unique_attributes"`
+	// LogBodies logs request and response bodies, with secrets redacted, for debugging integrations
+	LogBodies bool `json:"log_bodies"`
+	// Jobs configures the background jobs bulk requests given async=true are run as
+	Jobs utils.JobConfig `json:"jobs"`
+	// Redaction lists the attributes whose values are withheld from callers lacking a capability
+	Redaction middleware.RedactionConfig `json:"redaction"`
+	// WaitForKeycloak holds startup back until Keycloak is reachable; startup does not wait by default
+	WaitForKeycloak utils.KeycloakWaitConfig `json:"wait_for_keycloak"`
+	// SlowRequestThresholdMs is the duration, in milliseconds, past which requests are logged as
+	// warnings rather than at debug level; 1000 by default
+	SlowRequestThresholdMs int `json:"slow_request_threshold_ms"`
+}
+
+// redacted returns a copy of the configuration with its secrets withheld, for logging.
+func (cfg AppConfig) redacted() AppConfig {
+	const withheld = "[redacted]"
+	if cfg.KeycloakClientSecret != "" {
+		cfg.KeycloakClientSecret = withheld
+	}
+	if cfg.Webhooks.Secret != "" {
+		cfg.Webhooks.Secret = withheld
+	}
+	if len(cfg.Tracing.Headers) > 0 {
+		headers := make(map[string]string, len(cfg.Tracing.Headers))
+		for name := range cfg.Tracing.Headers {
+			headers[name] = withheld
+		}
+		cfg.Tracing.Headers = headers
+	}
+	return cfg
 }
 
 func main() {
@@ -35,6 +138,7 @@ func main() {
 	rigelConfigName := flag.String("configName", "C1", "The name of the configuration")
 	rigelSchemaName := flag.String("schemaName", "S1", "The name of the schema")
 	etcdEndpoints := flag.String("etcdEndpoints", "localhost:2379", "Comma-separated list of etcd endpoints")
+	strictStartup := flag.Bool("strict-startup", false, "Refuse to start if the startup self-test finds a missing Keycloak permission")
 
 	flag.Parse()
 
@@ -54,7 +158,14 @@ func main() {
 		log.Fatalf("Unknown configuration system: %s", *configSystem)
 	}
 
-	fmt.Printf("Loaded configuration: %+v\n", appConfig)
+	fmt.Printf("Loaded configuration: %+v\n", appConfig.redacted())
+
+	if appConfig.DefaultRealm == "" {
+		appConfig.DefaultRealm = appConfig.Realm
+	}
+	if appConfig.CapabilitiesGroup == "" {
+		appConfig.CapabilitiesGroup = "capabilities"
+	}
 
 	// Open the error types file
 	file, err := os.Open("./errortypes.yaml")
@@ -66,6 +177,51 @@ func main() {
 	// Load the error types
 	wscutils.LoadErrorTypes(file)
 
+	// Apply any configured overrides of the error code to HTTP status mapping
+	utils.SetErrorStatusCodes(appConfig.ErrorStatusCodes)
+
+	// Load the attribute schemas, if any are configured
+	if err := utils.LoadAttributeSchemas(appConfig.AttributeSchemas); err != nil {
+		log.Fatalf("Failed to load attribute schemas: %v", err)
+	}
+
+	// Choose how values repeated within an attribute are handled
+	if err := utils.SetDuplicateAttributeValues(appConfig.DuplicateAttributeValues); err != nil {
+		log.Fatalf("Invalid duplicate attribute values setting: %v", err)
+	}
+
+	// Choose whether deleting a resource that does not exist succeeds by default
+	utils.SetIdempotentDeletes(appConfig.IdempotentDeletes)
+
+	// Load the translations of validation messages, if any are configured
+	if err := utils.LoadMessageCatalogs(appConfig.MessageCatalogs); err != nil {
+		log.Fatalf("Failed to load message catalogs: %v", err)
+	}
+
+	// Apply the configured request timeouts
+	if err := utils.SetRequestTimeouts(appConfig.RequestTimeout, appConfig.RouteTimeouts); err != nil {
+		log.Fatalf("Invalid request timeouts: %v", err)
+	}
+	if err := utils.SetClientTimeoutBounds(appConfig.ClientTimeoutMinMs, appConfig.ClientTimeoutMaxMs); err != nil {
+		log.Fatalf("Invalid client timeout bounds: %v", err)
+	}
+
+	// Apply the configured default groups of new users
+	if err := utils.SetDefaultGroups(appConfig.DefaultGroups); err != nil {
+		log.Fatalf("Invalid default groups: %v", err)
+	}
+
+	// Apply the configured unique group attributes
+	utils.SetUniqueAttributes(appConfig.UniqueAttributes)
+
+	// Drop cached member counts and capability holders when group membership changes
+	utils.OnGroupMembershipChange(groupservice.InvalidateGroupMemberCount)
+	utils.OnGroupMembershipChange(capabilityservice.InvalidateCapabilityHolders)
+
+	// Drop cached group trees and capabilities catalogs when groups or capabilities change
+	utils.OnGroupsChange(groupservice.InvalidateGroupTree)
+	utils.OnGroupsChange(capabilityservice.InvalidateCapabilitiesCatalog)
+
 	// logger
 	// Open a file for logging.
 	logFile, err := os.OpenFile("log.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -83,7 +239,10 @@ func main() {
 
 	// auth middleware
 
-	cache := router.NewRedisTokenCache("localhost:6379", "", 0, 0)
+	// Verify tokens directly, rather than failing requests, whenever Redis is unreachable
+	cache := utils.NewFallbackTokenCache(router.NewRedisTokenCache("localhost:6379", "", 0, 0))
+	cache.Check()
+	utils.RegisterMetric("token_cache_available", func() any { return cache.Available() })
 	authMiddleware, err := router.LoadAuthMiddleware(appConfig.KeycloakClientID, appConfig.ProviderURL, cache, fl)
 	if err != nil {
 		log.Fatalf("Failed to create new auth middleware: %v", err)
@@ -91,31 +250,372 @@ func main() {
 
 	// router
 
-	r, err := router.SetupRouter(true, fl, authMiddleware)
+	r, err := router.SetupRouter(false, fl, authMiddleware)
 	if err != nil {
 		log.Fatalf("Failed to setup router: %v", err)
 	}
 
-	// Logging middleware
-	r.Use(func(c *gin.Context) {
-		log.Printf("[request] %s - %s %s\n", c.Request.RemoteAddr, c.Request.Method, c.Request.URL.Path)
-		start := time.Now()
-		c.Next()
-		duration := time.Since(start)
-		log.Printf("[request] %s - %s %s %s\n", c.Request.RemoteAddr, c.Request.Method, c.Request.URL.Path, duration)
-	})
+	// Answer panics with the standard error envelope instead of a bare 500
+	r.Use(middleware.Recover(lh))
+
+	// Log authorization denials as security events, including those of the auth middleware.
+	// The OIDC discovery document is public, as clients fetch it before they have a token.
+	r.Use(middleware.LogDenials(lh), middleware.AllowAnonymous(authMiddleware.MiddlewareFunc(),
+		"/.well-known/openid-configuration", "/:realm/.well-known/openid-configuration"))
+
+	// Answer unknown routes and methods with the standard error envelope
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(middleware.NotFound)
+	r.NoMethod(middleware.MethodNotAllowed)
+
+	// Treat paths with a trailing slash the same way on every route
+	handler, err := middleware.TrailingSlash(r, appConfig.TrailingSlash)
+	if err != nil {
+		log.Fatalf("Invalid trailing slash configuration: %v", err)
+	}
+
+	// Trace every request, continuing traces started by the caller
+	tracer := utils.NewTracer(appConfig.Tracing)
+	utils.RegisterMetric("trace_spans_dropped", func() any { return tracer.Dropped() })
+	r.Use(middleware.Tracing(tracer))
+
+	// Take the correlation ID of the calling service, echoing it back
+	r.Use(middleware.Correlate(appConfig.CorrelationHeader))
+
+	// Let clients opt into experimental behaviour request by request
+	r.Use(middleware.FeatureFlags(lh))
+
+	// Log requests, as warnings with their Keycloak calls when slower than the threshold
+	r.Use(middleware.LogRequests(lh, appConfig.SlowRequestThresholdMs))
+
+	// Compress large responses for clients that accept it
+	r.Use(middleware.Compress(appConfig.Compression))
+
+	// Tell callers how long their token remains valid
+	r.Use(middleware.TokenExpiry(appConfig.TokenExpiryWarning))
+
+	// Refuse requests to endpoints this deployment does not expose
+	r.Use(middleware.RestrictEndpoints(appConfig.Endpoints))
+
+	// Reject mutating requests that do not carry a JSON body, except for file uploads and job
+	// cancellations, which carry no body. Snapshots being restored may hold a whole realm's groups.
+	bodyLimits := map[string]int64{
+		"/realm-groups-restore":        groupservice.MaxRestoreBodyBytes,
+		"/:realm/realm-groups-restore": groupservice.MaxRestoreBodyBytes,
+	}
+	r.Use(middleware.RequireJSONContentType(bodyLimits, "/user-csv-import", "/:realm/user-csv-import", "/jobs/:id/cancel", "/:realm/jobs/:id/cancel"))
+
+	// Log request and response bodies when debugging integrations
+	if appConfig.LogBodies {
+		r.Use(middleware.LogBodies(lh))
+	}
+
+	// Resolve the realm each request targets
+	r.Use(middleware.ResolveRealm(appConfig.DefaultRealm, appConfig.AllowedRealms))
+
+	// Let clients give their request a timeout of their own
+	r.Use(middleware.RequestDeadline(lh))
+
+	// Bound the number of requests reaching Keycloak at once
+	limiter := utils.NewConcurrencyLimiter(appConfig.Concurrency)
+	utils.RegisterMetric("requests_in_flight", func() any { return limiter.InFlight() })
+	r.Use(middleware.LimitConcurrency(limiter, "/metrics"))
 
 	// create keycloak client
 	client := gocloak.NewClient(appConfig.KeycloakURL)
 
+	// Wait for Keycloak to come up, when started along with it
+	if err := utils.WaitForKeycloak(client, appConfig.Realm, appConfig.WaitForKeycloak); err != nil {
+		log.Fatalf("Startup failed: %v", err)
+	}
+
+	// Every default group must exist
+	if len(appConfig.DefaultGroups) > 0 {
+		validateDefaultGroups(client, appConfig)
+	}
+
+	// Check that the service account can do what the service needs
+	runSelfTest(client, appConfig, *strictStartup)
+
+	// Withhold sensitive attribute values from callers not entitled to them
+	r.Use(middleware.RedactAttributes(appConfig.Redaction, client, appConfig.CapabilitiesGroup, lh))
+
+	// Trace Keycloak calls as part of the request making them
+	tracer.Attach(client.RestyClient())
+
+	// Time Keycloak calls for the slow request log
+	utils.AttachKeycloakTimings(client.RestyClient())
+
+	// Fail Keycloak calls fast while Keycloak is unhealthy
+	breaker := utils.NewCircuitBreaker(appConfig.CircuitBreaker)
+	breaker.Attach(client.RestyClient())
+	utils.RegisterMetric("keycloak_circuit_breaker_state", func() any { return breaker.State() })
+
+	// Retry Keycloak calls once when Keycloak rate limits them, if its wait is short enough
+	rateLimitRetry := utils.NewRateLimitRetry(appConfig.KeycloakRateLimitMaxWait)
+	rateLimitRetry.Attach(client.RestyClient())
+	utils.RegisterMetric("keycloak_rate_limit_retried", func() any { return rateLimitRetry.Retried() })
+	utils.RegisterMetric("keycloak_rate_limit_rejected", func() any { return rateLimitRetry.Rejected() })
+
+	// Notify external systems of mutations
+	webhooks := utils.NewWebhookNotifier(appConfig.Webhooks)
+	utils.RegisterMetric("webhook_deliveries_failed", func() any { return webhooks.Failed() })
+	utils.RegisterMetric("webhook_deliveries_dropped", func() any { return webhooks.Dropped() })
+
+	// Run bulk requests in the background when asked to, keeping job states in Redis
+	jobs := utils.NewJobRunner(appConfig.Jobs)
+	utils.RegisterMetric("jobs_running", func() any { return jobs.Running() })
+
 	// Create a new service for /groups
-	userService := service.NewService(r).WithLogHarbour(lh).WithDependency("goclock", client).WithDependency("realm", appConfig.Realm)
+	userService := service.NewService(r).WithLogHarbour(lh).WithDependency("goclock", client).WithDependency("realm", appConfig.DefaultRealm).
+		WithDependency("capabilitiesGroup", appConfig.CapabilitiesGroup).
+		WithDependency("capabilityCategories", appConfig.CapabilityCategories).
+		WithDependency("keycloakURL", appConfig.KeycloakURL).
+		WithDependency("keycloakClientID", appConfig.KeycloakClientID).
+		WithDependency("keycloakClientSecret", appConfig.KeycloakClientSecret).
+		WithDependency("discoveryBaseURL", appConfig.DiscoveryBaseURL).
+		WithDependency("onboarding", appConfig.Onboarding).
+		WithDependency("webhooks", webhooks).
+		WithDependency("jobs", jobs)
 
 	// Register a route for handling group creation requests
-	userService.RegisterRoute(http.MethodPost, "/group", groupservice.HandleGroupCreationRequest)
+	registerRealmRoute(userService, http.MethodPost, "/group", groupservice.HandleGroupCreationRequest)
+
+	// Register a route for handling capability creation requests
+	registerRealmRoute(userService, http.MethodPost, "/capability", capabilityservice.HandleCapabilityCreationRequest)
+
+	// Register a route for creating many capabilities at once
+	registerRealmRoute(userService, http.MethodPost, "/capability-bulk-import", jobservice.Async(capabilityservice.HandleCapabilityBulkImportRequest))
+
+	// Register a route for granting a capability to many users at once
+	registerRealmRoute(userService, http.MethodPost, "/capability-bulk-assign", jobservice.Async(capabilityservice.HandleCapabilityBulkAssignRequest))
+
+	// Register a route for listing every capability defined
+	registerRealmRoute(userService, http.MethodGet, "/capabilities-catalog", capabilityservice.HandleCapabilitiesCatalogRequest)
+
+	// Register a route for listing the users holding a capability
+	registerRealmRoute(userService, http.MethodGet, "/capability-users", capabilityservice.HandleCapabilityUsersRequest)
+
+	// Register a route for explaining which group memberships grant a user their capabilities
+	registerRealmRoute(userService, http.MethodGet, "/user-capability-tree", capabilityservice.HandleUserCapabilityTreeRequest)
+
+	// Register a route for counting the users holding each capability
+	registerRealmRoute(userService, http.MethodGet, "/capability-usage-report", capabilityservice.HandleCapabilityUsageReportRequest)
+
+	// Register a route for listing the capabilities nobody holds
+	registerRealmRoute(userService, http.MethodGet, "/orphan-capabilities", capabilityservice.HandleOrphanCapabilitiesRequest)
+
+	// Register a route for checking whether a capability name is available
+	registerRealmRoute(userService, http.MethodGet, "/capability-name-available", capabilityservice.HandleCapabilityNameCheckRequest)
+
+	// Register a route for fetching the group hierarchy as a tree
+	registerRealmRoute(userService, http.MethodGet, "/group-tree", groupservice.HandleGroupTreeRequest)
+
+	// Register routes for exporting a group as portable JSON and importing it again
+	registerRealmRoute(userService, http.MethodGet, "/group-export", groupservice.HandleGroupExportRequest)
+	registerRealmRoute(userService, http.MethodPost, "/group-import", jobservice.Async(groupservice.HandleGroupImportRequest))
+
+	// Register routes for snapshotting every group of a realm and restoring the snapshot
+	registerRealmRoute(userService, http.MethodGet, "/realm-groups-snapshot", groupservice.HandleRealmGroupsSnapshotRequest)
+	registerRealmRoute(userService, http.MethodPost, "/realm-groups-restore", jobservice.Async(groupservice.HandleRealmGroupsRestoreRequest))
+
+	// Register a route for deleting every group under a path prefix
+	registerRealmRoute(userService, http.MethodPost, "/group-bulk-delete", jobservice.Async(groupservice.HandleGroupBulkDeleteRequest))
+
+	// Register a route for polling background jobs started by bulk requests
+	registerRealmRoute(userService, http.MethodGet, "/jobs/:id", jobservice.HandleJobGetRequest)
+
+	// Register a route for cancelling a background job
+	registerRealmRoute(userService, http.MethodPost, "/jobs/:id/cancel", jobservice.HandleJobCancelRequest)
+
+	// Register a route for comparing the configuration of two groups
+	registerRealmRoute(userService, http.MethodGet, "/group-diff", groupservice.HandleGroupDiffRequest)
+
+	// Register a route for updating a group with a JSON merge patch
+	registerRealmRoute(userService, http.MethodPatch, "/group-update", groupservice.HandleGroupUpdateRequest)
+
+	// Register a route for checking whether a group name is free under a parent
+	registerRealmRoute(userService, http.MethodGet, "/group-name-check", groupservice.HandleGroupNameCheckRequest)
+
+	// Register a route for fetching a group by its path
+	registerRealmRoute(userService, http.MethodGet, "/group-by-path", groupservice.HandleGroupGetByPathRequest)
+
+	// Register a route for fetching the roles membership of a group grants
+	registerRealmRoute(userService, http.MethodGet, "/group-roles", groupservice.HandleGroupRolesRequest)
+
+	// Register a route for bringing a group's role mappings in line with its roles attribute
+	registerRealmRoute(userService, http.MethodPost, "/group-reconcile-roles", groupservice.HandleGroupReconcileRolesRequest)
+
+	// Register a route for bringing a group in line with a desired state
+	registerRealmRoute(userService, http.MethodPost, "/group-reconcile", groupservice.HandleGroupReconcileRequest)
+
+	// Register a route for counting the members of a group
+	registerRealmRoute(userService, http.MethodGet, "/group-member-count", groupservice.HandleGroupMemberCountRequest)
+
+	// Register a route for exporting every member of a group
+	registerRealmRoute(userService, http.MethodGet, "/group-member-export", groupservice.HandleGroupMemberExportRequest)
+
+	// Register a route for setting the complete member list of a group
+	registerRealmRoute(userService, http.MethodPut, "/group-members", groupservice.HandleGroupMembersSetRequest)
+
+	// Register a route for moving members from one group to another
+	registerRealmRoute(userService, http.MethodPost, "/group-members-move", groupservice.HandleGroupMembersMoveRequest)
+
+	// Register a route for importing users from an uploaded CSV file
+	registerRealmRoute(userService, http.MethodPost, "/user-csv-import", jobservice.Async(userservice.HandleUserCsvImportRequest))
+
+	// Register a route for finding a user by their exact username or email
+	registerRealmRoute(userService, http.MethodGet, "/user-lookup", userservice.HandleUserLookupRequest)
+
+	// Register a route for finding the users lacking an attribute
+	registerRealmRoute(userService, http.MethodGet, "/users-missing-attribute", userservice.HandleUsersMissingAttributeRequest)
+
+	// Register a route for inviting a user through an emailed onboarding link
+	registerRealmRoute(userService, http.MethodPost, "/user-onboard-link", userservice.HandleUserOnboardLinkRequest)
+
+	// Register a route for assigning client roles to a user
+	registerRealmRoute(userService, http.MethodPost, "/user-client-role-add", userservice.HandleAssignClientRoleRequest)
+
+	// Register a route for clearing a user's required actions
+	registerRealmRoute(userService, http.MethodPost, "/user-clear-required-actions", userservice.HandleUserClearRequiredActionsRequest)
+
+	// Register routes for linking, unlinking and listing a user's federated identities
+	registerRealmRoute(userService, http.MethodPost, "/user-federated-identity-add", userservice.HandleUserFederatedIdentityAddRequest)
+	registerRealmRoute(userService, http.MethodPost, "/user-federated-identity-remove", userservice.HandleUserFederatedIdentityRemoveRequest)
+	registerRealmRoute(userService, http.MethodGet, "/user-federated-identities", userservice.HandleUserFederatedIdentityListRequest)
+
+	// Register a route for fetching a user's credentials metadata
+	registerRealmRoute(userService, http.MethodGet, "/user-credentials", userservice.HandleUserCredentialsRequest)
+
+	// Register a route for removing a credential from a user
+	registerRealmRoute(userService, http.MethodPost, "/user-credential-delete", userservice.HandleUserCredentialDeleteRequest)
+
+	// Register a route for listing the clients a user has sessions with
+	registerRealmRoute(userService, http.MethodGet, "/user-client-sessions", userservice.HandleUserClientSessionsRequest)
+
+	// Register a route for previewing what adding a user to a group would grant
+	registerRealmRoute(userService, http.MethodGet, "/membership-preview", userservice.HandleMembershipPreviewRequest)
+
+	// Register a route for fetching the groups a user belongs to
+	registerRealmRoute(userService, http.MethodGet, "/user-groups", userservice.HandleUserGroupsRequest)
+
+	// Register a route for fetching a user's effective roles
+	registerRealmRoute(userService, http.MethodGet, "/user-effective-roles", userservice.HandleUserEffectiveRolesRequest)
+
+	// Register a route for fetching keycloak admin events
+	registerRealmRoute(userService, http.MethodGet, "/admin-events", eventservice.HandleAdminEventsRequest)
+
+	// Register a route for aggregating keycloak login events into statistics
+	registerRealmRoute(userService, http.MethodGet, "/login-stats", eventservice.HandleLoginStatsRequest)
+
+	// Register a route for deciding whether users hold capabilities, in bulk
+	registerRealmRoute(userService, http.MethodPost, "/authorize-batch", capabilityservice.HandleBatchAuthorizeRequest)
+
+	// Register routes for managing keycloak organizations and their members
+	registerRealmRoute(userService, http.MethodPost, "/organization", orgservice.HandleOrganizationCreationRequest)
+	registerRealmRoute(userService, http.MethodGet, "/organization", orgservice.HandleOrganizationGetRequest)
+	registerRealmRoute(userService, http.MethodGet, "/organizations", orgservice.HandleOrganizationListRequest)
+	registerRealmRoute(userService, http.MethodPost, "/organization-member-add", orgservice.HandleOrganizationMemberAddRequest)
+	registerRealmRoute(userService, http.MethodPost, "/organization-member-remove", orgservice.HandleOrganizationMemberRemoveRequest)
+	registerRealmRoute(userService, http.MethodGet, "/organization-members", orgservice.HandleOrganizationMembersRequest)
+
+	// Register routes for managing keycloak client scopes and the clients they are given to
+	registerRealmRoute(userService, http.MethodGet, "/client-scopes", scopeservice.HandleClientScopesListRequest)
+	registerRealmRoute(userService, http.MethodPost, "/client-scope", scopeservice.HandleClientScopeCreationRequest)
+	registerRealmRoute(userService, http.MethodPost, "/client-scope-assign", scopeservice.HandleClientScopeAssignRequest)
+
+	// Register a route for searching groups, capabilities and users at once
+	registerRealmRoute(userService, http.MethodGet, "/search", searchservice.HandleGlobalSearchRequest)
+
+	// Register routes for fetching and replacing the realm password policy
+	registerRealmRoute(userService, http.MethodGet, "/realm-password-policy", realmservice.HandleRealmPasswordPolicyGetRequest)
+	registerRealmRoute(userService, http.MethodPost, "/realm-password-policy-set", realmservice.HandleRealmPasswordPolicySetRequest)
+
+	// Register routes for fetching and updating the realm token lifespans and session timeouts
+	registerRealmRoute(userService, http.MethodGet, "/realm-token-lifespans", realmservice.HandleRealmTokenLifespansGetRequest)
+	registerRealmRoute(userService, http.MethodPost, "/realm-token-lifespans-set", realmservice.HandleRealmTokenLifespansSetRequest)
+
+	// Register a route for fetching the realm's OIDC discovery document
+	registerRealmRoute(userService, http.MethodGet, "/.well-known/openid-configuration", realmservice.HandleDiscoveryRequest)
+
+	// Register a route for revoking a single token
+	registerRealmRoute(userService, http.MethodPost, "/token-revoke", tokenservice.HandleTokenRevokeRequest)
+
+	// Register a route for validating many tokens at once
+	registerRealmRoute(userService, http.MethodPost, "/token-validate-batch", tokenservice.HandleTokenValidateBatchRequest)
+
+	// Register a route for reporting runtime metrics
+	userService.RegisterRoute(http.MethodGet, "/metrics", metricsservice.HandleMetricsRequest)
+
+	// Register a route for timing a call to Keycloak
+	userService.RegisterRoute(http.MethodGet, "/keycloak-ping", metricsservice.HandleKeycloakPingRequest)
+
+	// Every route with a configured timeout must exist
+	if err := utils.ValidateRouteTimeouts(r); err != nil {
+		log.Fatalf("Invalid request timeouts: %v", err)
+	}
+
+	// Every enabled or disabled endpoint must exist
+	if err := middleware.ValidateEndpoints(r, appConfig.Endpoints); err != nil {
+		log.Fatalf("Invalid endpoints configuration: %v", err)
+	}
 
 	// Start the service
-	if err := r.Run(":" + appConfig.AppServerPort); err != nil {
+	if err := http.ListenAndServe(":"+appConfig.AppServerPort, handler); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// registerRealmRoute registers a route both at path and under a leading :realm path
+// parameter, so that requests may either name their realm or use the default one.
+func registerRealmRoute(s *service.Service, method, path string, handler service.HandlerFunc) {
+	if method == http.MethodPatch {
+		// alya registers no PATCH routes, so hand them to the router directly
+		wrapped := func(c *gin.Context) { handler(c, s) }
+		s.Router.PATCH(path, wrapped)
+		s.Router.PATCH("/:realm"+path, wrapped)
+		return
+	}
+	s.RegisterRoute(method, path, handler)
+	s.RegisterRoute(method, "/:realm"+path, handler)
+}
+
+// validateDefaultGroups checks that the configured default groups exist, logging in with the
+// service's own client credentials. The service refuses to start if one does not exist; if
+// Keycloak cannot be asked, the check is skipped with a warning.
+func validateDefaultGroups(client *gocloak.GoCloak, appConfig AppConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), utils.DefaultRequestTimeout())
+	defer cancel()
+	jwt, err := client.LoginClient(ctx, appConfig.KeycloakClientID, appConfig.KeycloakClientSecret, appConfig.Realm)
+	if err != nil {
+		log.Printf("Warning: could not log in to check the default groups: %v", err)
+		return
+	}
+	if err := utils.ValidateDefaultGroups(ctx, client, jwt.AccessToken); err != nil {
+		if utils.IsNotFound(err) {
+			log.Fatalf("Invalid default groups: %v", err)
+		}
+		log.Printf("Warning: could not check the default groups: %v", err)
+	}
+}
+
+// runSelfTest logs in with the service's own client credentials and logs every Keycloak
+// permission the service account lacks. With strict set, the service refuses to start if the
+// self-test finds a problem; otherwise it starts anyway.
+func runSelfTest(client *gocloak.GoCloak, appConfig AppConfig, strict bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), utils.DefaultRequestTimeout())
+	defer cancel()
+	var problems []string
+	jwt, err := client.LoginClient(ctx, appConfig.KeycloakClientID, appConfig.KeycloakClientSecret, appConfig.Realm)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("cannot log in as client %s: %v", appConfig.KeycloakClientID, err))
+	} else {
+		problems = utils.SelfTest(ctx, client, jwt.AccessToken, appConfig.Realm)
+	}
+	for _, problem := range problems {
+		log.Printf("Startup self-test: %s", problem)
+	}
+	if len(problems) > 0 && strict {
+		log.Fatalf("Startup self-test failed with %d problems", len(problems))
+	}
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompressionConfig holds the gzip response compression settings. Zero values are replaced by defaults.
+type CompressionConfig struct {
+	// Enabled turns response compression on.
+	Enabled bool `json:"enabled"`
+	// MinSizeBytes is the smallest response body that is compressed.
+	MinSizeBytes int `json:"min_size_bytes"`
+	// Level is the gzip compression level, from 1 (fastest) to 9 (smallest).
+	Level int `json:"level"`
+	// ExemptPaths lists route paths whose responses are never compressed.
+	ExemptPaths []string `json:"exempt_paths"`
+}
+
+// Compress returns a middleware that gzips response bodies of at least cfg.MinSizeBytes for
+// clients accepting gzip. Bodies are held back until they reach that size; a handler that
+// flushes earlier, as streaming handlers do, gets its response sent uncompressed. Event
+// streams and responses that are already encoded are never compressed.
+func Compress(cfg CompressionConfig) gin.HandlerFunc {
+	if cfg.MinSizeBytes <= 0 {
+		cfg.MinSizeBytes = 1024
+	}
+	if cfg.Level < gzip.BestSpeed || cfg.Level > gzip.BestCompression {
+		cfg.Level = gzip.DefaultCompression
+	}
+	exempt := make(map[string]bool, len(cfg.ExemptPaths))
+	for _, path := range cfg.ExemptPaths {
+		exempt[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if !cfg.Enabled || c.Request.Method == http.MethodHead || exempt[c.FullPath()] || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+		w := &gzipResponseWriter{ResponseWriter: c.Writer, minSize: cfg.MinSizeBytes, level: cfg.Level}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows a gzip encoded response.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the start of a response body until it is known whether the
+// body is large enough to be compressed, then writes it either through gzip or as is.
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minSize int
+	level   int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what has been written so far, deciding against compression if the body has
+// not yet reached the minimum size.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide settles whether the body is compressed and writes out what was held back.
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// Content sniffing would otherwise see the compressed bytes
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if compress && header.Get("Content-Encoding") == "" && mediaType != "text/event-stream" {
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		w.gz, _ = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish writes out a body that never reached the minimum size, and completes a compressed one.
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// LimitConcurrency returns a middleware that serves a request only once it holds a slot of
+// limiter, refusing it with server_busy otherwise. GET and HEAD requests take read slots and
+// all others write slots. Requests matching no route and those to the exempt paths, which do
+// not reach Keycloak, are let through untouched.
+func LimitConcurrency(limiter *utils.ConcurrencyLimiter, exemptPaths ...string) gin.HandlerFunc {
+	exempt := make(map[string]bool, len(exemptPaths))
+	for _, path := range exemptPaths {
+		exempt[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if limiter == nil || c.FullPath() == "" || exempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+		write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead
+		release, err := limiter.Acquire(c.Request.Context(), write)
+		if err != nil {
+			c.Header("Retry-After", "1")
+			utils.SendErrorResponse(c, utils.ErrorResponse("server_busy", ""))
+			c.Abort()
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireJSONContentTypeBodyLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequireJSONContentType(map[string]int64{"/realm-groups-restore": 4 * MaxJSONBodyBytes}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/realm-groups-restore", ok)
+	r.POST("/group", ok)
+
+	tests := []struct {
+		name       string
+		target     string
+		size       int
+		wantStatus int
+	}{
+		{name: "within the default limit", target: "/group", size: MaxJSONBodyBytes, wantStatus: http.StatusOK},
+		{name: "beyond the default limit", target: "/group", size: MaxJSONBodyBytes + 1, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "beyond the default limit on a route with its own", target: "/realm-groups-restore", size: 2 * MaxJSONBodyBytes, wantStatus: http.StatusOK},
+		{name: "beyond a route's own limit", target: "/realm-groups-restore", size: 4*MaxJSONBodyBytes + 1, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, bytes.NewReader(make([]byte, tt.size)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// maxCorrelationIDLength is the longest correlation ID accepted from a caller.
+const maxCorrelationIDLength = 128
+
+// Correlate returns a middleware that takes the correlation ID a calling service gives a request
+// in header, echoes it in the same header of the response, and stores it for the request and
+// body logs and the request's trace span. IDs that are too long or hold anything but printable
+// ASCII are ignored, so that they cannot forge log lines.
+func Correlate(header string) gin.HandlerFunc {
+	if header == "" {
+		header = utils.DefaultCorrelationHeader
+	}
+
+	return func(c *gin.Context) {
+		if id := c.GetHeader(header); validCorrelationID(id) {
+			c.Header(header, id)
+			utils.SetCorrelationID(c, id)
+		}
+		c.Next()
+	}
+}
+
+// validCorrelationID reports whether id is a non-empty correlation ID that may be logged as is.
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
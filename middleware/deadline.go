@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// RequestTimeoutHeader is the request header through which a client may give, in milliseconds,
+// the timeout of its request's Keycloak calls instead of the one configured for the route.
+const RequestTimeoutHeader = "X-Request-Timeout-Ms"
+
+// RequestDeadline returns a middleware that applies the timeout a client asks for in the
+// RequestTimeoutHeader header, brought within the configured bounds, and logs it through lh.
+// A header that is not a number of milliseconds is rejected with invalid_request.
+func RequestDeadline(lh *logharbour.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(RequestTimeoutHeader)
+		if header == "" {
+			c.Next()
+			return
+		}
+		ms, err := strconv.ParseInt(header, 10, 64)
+		if err != nil {
+			utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", RequestTimeoutHeader))
+			c.Abort()
+			return
+		}
+		timeout := utils.ClampClientTimeout(ms)
+		utils.SetClientTimeout(c, timeout)
+		lh.LogActivity("Client request timeout applied", map[string]any{
+			"path":        c.Request.URL.Path,
+			"requestedMs": ms,
+			"appliedMs":   timeout.Milliseconds(),
+			"clamped":     timeout.Milliseconds() != ms,
+		})
+		c.Next()
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// EndpointsConfig selects the endpoints a deployment exposes, by route path (e.g. "/group").
+// Routes registered under a leading realm segment follow their plain path.
+type EndpointsConfig struct {
+	// Enabled lists the only endpoints exposed. Every endpoint is exposed when it is empty.
+	Enabled []string `json:"enabled"`
+	// Disabled lists endpoints that are never exposed, even when listed in Enabled.
+	Disabled []string `json:"disabled"`
+}
+
+// endpointRoute returns the plain route path of the route matched by c.
+func endpointRoute(c *gin.Context) string {
+	return strings.TrimPrefix(c.FullPath(), "/:realm")
+}
+
+// RestrictEndpoints returns a middleware that rejects requests to endpoints cfg does not
+// expose with endpoint_disabled.
+func RestrictEndpoints(cfg EndpointsConfig) gin.HandlerFunc {
+	enabled := make(map[string]bool, len(cfg.Enabled))
+	for _, route := range cfg.Enabled {
+		enabled[route] = true
+	}
+	disabled := make(map[string]bool, len(cfg.Disabled))
+	for _, route := range cfg.Disabled {
+		disabled[route] = true
+	}
+
+	return func(c *gin.Context) {
+		route := endpointRoute(c)
+		// Leave requests matching no route to the not found handler
+		if c.FullPath() == "" || (len(enabled) == 0 || enabled[route]) && !disabled[route] {
+			c.Next()
+			return
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse("endpoint_disabled", ""))
+		c.Abort()
+	}
+}
+
+// ValidateEndpoints checks that every endpoint cfg names is registered on r, so that a
+// misspelt path does not silently leave an endpoint exposed.
+func ValidateEndpoints(r *gin.Engine, cfg EndpointsConfig) error {
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		registered[route.Path] = true
+	}
+	for _, route := range append(append([]string{}, cfg.Enabled...), cfg.Disabled...) {
+		if !registered[route] {
+			return fmt.Errorf("unknown endpoint %s", route)
+		}
+	}
+	return nil
+}
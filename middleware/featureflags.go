@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// FeatureFlags returns a middleware that reads the feature flags a request sets in the
+// X-Feature-Flags header and records the known ones for handlers to check through
+// utils.FeatureEnabled. The flags that took effect are echoed in the same header of the
+// response. Unknown flags are ignored with a warning, so that clients can send flags this
+// version does not have yet.
+func FeatureFlags(lh *logharbour.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(utils.FeatureFlagsHeader)
+		if header == "" {
+			c.Next()
+			return
+		}
+		flags := map[string]bool{}
+		var unknown []string
+		for _, flag := range strings.Split(header, ",") {
+			flag = strings.ToLower(strings.TrimSpace(flag))
+			switch {
+			case flag == "":
+			case utils.KnownFeatureFlags[flag] != "":
+				flags[flag] = true
+			default:
+				unknown = append(unknown, flag)
+			}
+		}
+		if len(unknown) > 0 {
+			lh.Warn().LogActivity("Unknown feature flags ignored", map[string]any{"flags": unknown, "path": c.Request.URL.Path})
+		}
+		utils.SetFeatureFlags(c, flags)
+		if len(flags) > 0 {
+			c.Header(utils.FeatureFlagsHeader, strings.Join(utils.EnabledFeatureFlags(c), ", "))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxLoggedBodyBytes is the largest part of a request or response body that is logged.
+const maxLoggedBodyBytes = 4096
+
+// redactedKeys are the substrings of the JSON keys whose values are never logged.
+var redactedKeys = []string{"password", "secret", "token", "authorization"}
+
+// redactedValuePattern matches a JSON string value under a key to redact, for bodies that cannot
+// be parsed, e.g. because they were truncated.
+var redactedValuePattern = regexp.MustCompile(`(?i)("[^"]*(?:` + strings.Join(redactedKeys, "|") + `)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// LogBodies returns a middleware that logs the request and response bodies of every request through
+// lh, for debugging integrations. Bodies are logged as far as maxLoggedBodyBytes, and the values of
+// keys that look like passwords, secrets or tokens are redacted. Only JSON and text bodies are
+// logged. The request body is captured as the handler reads it, so limits on its size still apply.
+func LogBodies(lh *logharbour.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request := &bodyCapture{}
+		logRequest := loggableBody(c.GetHeader("Content-Type"))
+		if logRequest && c.Request.Body != nil {
+			c.Request.Body = &capturingReadCloser{ReadCloser: c.Request.Body, capture: request}
+		}
+		w := &capturingResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+
+		fields := map[string]any{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"status": w.Status(),
+		}
+		if id := utils.GetCorrelationID(c); id != "" {
+			fields["correlationID"] = id
+		}
+		fields["request"] = describeBody(request, logRequest, c.GetHeader("Content-Type"))
+		fields["response"] = describeBody(&w.capture, loggableBody(w.Header().Get("Content-Type")), w.Header().Get("Content-Type"))
+		lh.LogActivity("Request and response bodies", fields)
+	}
+}
+
+// loggableBody reports whether a body of contentType is JSON or text, and so may be logged.
+func loggableBody(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || strings.HasPrefix(mediaType, "text/")
+}
+
+// describeBody returns what is logged of a captured body: the redacted body, marked when
+// truncated, or a note of why it was not logged.
+func describeBody(capture *bodyCapture, loggable bool, contentType string) string {
+	switch {
+	case !loggable && contentType == "":
+		return ""
+	case !loggable:
+		return "[" + contentType + " body not logged]"
+	}
+	body := redactBody(capture.data)
+	if capture.total > len(capture.data) {
+		body += "...[truncated]"
+	}
+	return body
+}
+
+// redactBody replaces the values of keys to redact in a JSON body. Bodies that cannot be
+// parsed have the string values of such keys replaced instead.
+func redactBody(data []byte) string {
+	var value any
+	if err := json.Unmarshal(data, &value); err == nil {
+		redacted, err := json.Marshal(redactValue(value))
+		if err == nil {
+			return string(redacted)
+		}
+	}
+	return redactedValuePattern.ReplaceAllString(string(data), `$1"[REDACTED]"`)
+}
+
+// redactValue returns value with the values of keys to redact replaced, descending into
+// objects and arrays.
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if isRedactedKey(key) {
+				v[key] = "[REDACTED]"
+				continue
+			}
+			v[key] = redactValue(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
+
+// isRedactedKey reports whether the value of a JSON key is never logged.
+func isRedactedKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, redacted := range redactedKeys {
+		if strings.Contains(key, redacted) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyCapture keeps the start of a body, up to maxLoggedBodyBytes, and counts its full length.
+type bodyCapture struct {
+	data  []byte
+	total int
+}
+
+func (b *bodyCapture) add(data []byte) {
+	b.total += len(data)
+	if room := maxLoggedBodyBytes - len(b.data); room > 0 {
+		b.data = append(b.data, data[:min(room, len(data))]...)
+	}
+}
+
+// capturingReadCloser captures a request body as it is read.
+type capturingReadCloser struct {
+	io.ReadCloser
+	capture *bodyCapture
+}
+
+func (r *capturingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture.add(p[:n])
+	return n, err
+}
+
+// capturingResponseWriter captures a response body as it is written.
+type capturingResponseWriter struct {
+	gin.ResponseWriter
+	capture bodyCapture
+}
+
+func (w *capturingResponseWriter) Write(data []byte) (int, error) {
+	w.capture.add(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingResponseWriter) WriteString(s string) (int, error) {
+	w.capture.add([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
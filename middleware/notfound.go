@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// NotFound is the handler for requests matching no route. It responds with the standard
+// error envelope instead of gin's plain text 404.
+func NotFound(c *gin.Context) {
+	utils.SendErrorResponse(c, utils.ErrorResponse("not_found", ""))
+}
+
+// MethodNotAllowed is the handler for requests whose path matches a route registered only
+// for other methods. It takes effect once the engine's HandleMethodNotAllowed is set.
+func MethodNotAllowed(c *gin.Context) {
+	utils.SendErrorResponse(c, utils.ErrorResponse("method_not_allowed", ""))
+}
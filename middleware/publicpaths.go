@@ -0,0 +1,21 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// AllowAnonymous wraps the auth middleware auth so that requests to the public paths, which
+// must be reachable without a token, such as the OIDC discovery document, skip it. Paths are
+// matched against the route a request matched.
+func AllowAnonymous(auth gin.HandlerFunc, publicPaths ...string) gin.HandlerFunc {
+	public := make(map[string]bool, len(publicPaths))
+	for _, path := range publicPaths {
+		public[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if public[c.FullPath()] {
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAllowAnonymous(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deny := func(c *gin.Context) { c.AbortWithStatus(http.StatusUnauthorized) }
+
+	r := gin.New()
+	r.Use(AllowAnonymous(deny, "/.well-known/openid-configuration", "/:realm/.well-known/openid-configuration"))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/.well-known/openid-configuration", ok)
+	r.GET("/:realm/.well-known/openid-configuration", ok)
+	r.GET("/group-tree", ok)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{target: "/.well-known/openid-configuration", wantStatus: http.StatusOK},
+		{target: "/sales/.well-known/openid-configuration", wantStatus: http.StatusOK},
+		{target: "/group-tree", wantStatus: http.StatusUnauthorized},
+		{target: "/no-such-route", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
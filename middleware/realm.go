@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// RealmHeader is the request header through which a client may name the realm it targets
+// instead of using the :realm path parameter.
+const RealmHeader = "X-Realm"
+
+// ResolveRealm returns a middleware that determines the realm a request targets and stores
+// it for utils.GetRealm. An explicit :realm path parameter takes precedence over the
+// RealmHeader header, which takes precedence over defaultRealm.
+// The resolved realm must be defaultRealm or one of allowedRealms, otherwise the request is
+// rejected with realm_not_allowed.
+func ResolveRealm(defaultRealm string, allowedRealms []string) gin.HandlerFunc {
+	allowed := map[string]bool{defaultRealm: true}
+	for _, realm := range allowedRealms {
+		allowed[realm] = true
+	}
+
+	return func(c *gin.Context) {
+		realm := defaultRealm
+		if param := c.Param("realm"); param != "" {
+			realm = param
+		} else if header := c.GetHeader(RealmHeader); header != "" {
+			realm = header
+		}
+		if !allowed[realm] {
+			utils.SendErrorResponse(c, utils.ErrorResponse("realm_not_allowed", ""))
+			c.Abort()
+			return
+		}
+		utils.SetRealm(c, realm)
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// Recover returns a middleware that answers a request whose handling panics with the standard
+// error envelope and internal_error, rather than gin's bare 500, so that clients get the usual
+// JSON response even when a bug is hit. The panic is logged through lh along with its stack.
+// Nothing is sent when part of the response was already written, or when the client has gone
+// away.
+func Recover(lh *logharbour.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		lh.Crit().LogActivity("Panic while handling request", map[string]any{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"panic":  fmt.Sprint(recovered),
+			"stack":  string(debug.Stack()),
+		})
+		if !c.Writer.Written() {
+			utils.SendErrorResponse(c, utils.ErrorResponse("internal_error", ""))
+		}
+		c.Abort()
+	})
+}
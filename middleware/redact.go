@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// RedactedValue replaces the values of redacted attributes.
+	RedactedValue = "***"
+	// defaultRedactionCapability is the capability whose holders see redacted attributes,
+	// unless configured otherwise.
+	defaultRedactionCapability = "view_sensitive_attributes"
+	// representationKey is the key of fields carrying a keyclock representation as a JSON string,
+	// such as that of an admin event, whose attributes are redacted as well.
+	representationKey = "representation"
+)
+
+// RedactionConfig holds the attributes whose values are withheld from responses. Zero values
+// are replaced by defaults.
+type RedactionConfig struct {
+	// Attributes lists the group and user attribute keys whose values are redacted. Nothing is
+	// redacted when empty.
+	Attributes []string `json:"attributes"`
+	// Capability is the capability whose holders are given the values as they are;
+	// view_sensitive_attributes by default.
+	Capability string `json:"capability"`
+}
+
+// RedactAttributes returns a middleware that replaces the values of the configured attributes with
+// RedactedValue in JSON responses, wherever an "attributes" object carries them, including within
+// the JSON string of a "representation" field, unless the caller holds cfg.Capability. The
+// capability is only checked, through client, for responses that carry such attributes, and is
+// taken as not held if it cannot be checked. Redactions are logged through lh, naming the
+// attributes but never their values. Responses are held back until the handler is done, except for
+// those of handlers that flush, which are left untouched.
+func RedactAttributes(cfg RedactionConfig, client utils.KeycloakClient, capabilitiesGroup string, lh *logharbour.Logger) gin.HandlerFunc {
+	if cfg.Capability == "" {
+		cfg.Capability = defaultRedactionCapability
+	}
+	sensitive := make(map[string]bool, len(cfg.Attributes))
+	for _, key := range cfg.Attributes {
+		sensitive[key] = true
+	}
+
+	return func(c *gin.Context) {
+		if len(sensitive) == 0 {
+			c.Next()
+			return
+		}
+		w := &bufferingResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+
+		if w.flushed || len(w.buf) == 0 {
+			return
+		}
+		body := w.buf
+		if value, ok := decodeJSONBody(w.Header().Get("Content-Type"), body); ok {
+			if keys := sensitiveAttributes(value, sensitive, map[string]bool{}); len(keys) > 0 && !mayViewSensitive(c, client, capabilitiesGroup, cfg.Capability) {
+				redactAttributes(value, sensitive)
+				if redacted, err := json.Marshal(value); err == nil {
+					body = redacted
+					w.Header().Del("Content-Length")
+					lh.LogActivity("Sensitive attributes redacted", map[string]any{"path": c.Request.URL.Path, "attributes": sortedKeys(keys), "caller": utils.SubjectFromToken(bearerToken(c))})
+				}
+			}
+		}
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// decodeJSONBody decodes a JSON response body, keeping numbers as they were written.
+func decodeJSONBody(contentType string, body []byte) (any, bool) {
+	if !loggableBody(contentType) {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// decodeRepresentation decodes the JSON string held by a representation field.
+func decodeRepresentation(key string, item any) (any, bool) {
+	representation, ok := item.(string)
+	if !ok || key != representationKey {
+		return nil, false
+	}
+	return decodeJSONBody("application/json", []byte(representation))
+}
+
+// sensitiveAttributes adds to found the sensitive attributes held by any "attributes" object
+// within value, and returns found.
+func sensitiveAttributes(value any, sensitive, found map[string]bool) map[string]bool {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if representation, ok := decodeRepresentation(key, item); ok {
+				sensitiveAttributes(representation, sensitive, found)
+				continue
+			}
+			if attributes, ok := item.(map[string]any); ok && key == "attributes" {
+				for name := range attributes {
+					if sensitive[name] {
+						found[name] = true
+					}
+				}
+			}
+			sensitiveAttributes(item, sensitive, found)
+		}
+	case []any:
+		for _, item := range v {
+			sensitiveAttributes(item, sensitive, found)
+		}
+	}
+	return found
+}
+
+// redactAttributes replaces the values of the sensitive attributes held by any "attributes"
+// object within value.
+func redactAttributes(value any, sensitive map[string]bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if representation, ok := decodeRepresentation(key, item); ok {
+				redactAttributes(representation, sensitive)
+				if redacted, err := json.Marshal(representation); err == nil {
+					v[key] = string(redacted)
+				} else {
+					v[key] = RedactedValue
+				}
+				continue
+			}
+			if attributes, ok := item.(map[string]any); ok && key == "attributes" {
+				for name, values := range attributes {
+					if !sensitive[name] {
+						continue
+					}
+					if _, isList := values.([]any); isList {
+						attributes[name] = []any{RedactedValue}
+					} else {
+						attributes[name] = RedactedValue
+					}
+				}
+			}
+			redactAttributes(item, sensitive)
+		}
+	case []any:
+		for _, item := range v {
+			redactAttributes(item, sensitive)
+		}
+	}
+}
+
+// mayViewSensitive reports whether the caller of c holds capability. Callers whose capability
+// cannot be checked are taken not to hold it.
+func mayViewSensitive(c *gin.Context, client utils.KeycloakClient, capabilitiesGroup, capability string) bool {
+	token := bearerToken(c)
+	if token == "" {
+		return false
+	}
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+	capable, err := utils.HasCapability(ctx, client, token, capabilitiesGroup, capability)
+	return err == nil && capable
+}
+
+// bearerToken returns the bearer token of the request, or an empty string if it carries none.
+func bearerToken(c *gin.Context) string {
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		return ""
+	}
+	return token
+}
+
+// sortedKeys returns the keys of set in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// bufferingResponseWriter holds back a response body until the handler is done, so that it can
+// be rewritten. A handler that flushes has what it wrote so far, and all it writes from then on,
+// passed through instead.
+type bufferingResponseWriter struct {
+	gin.ResponseWriter
+	buf     []byte
+	flushed bool
+}
+
+func (w *bufferingResponseWriter) Write(data []byte) (int, error) {
+	if w.flushed {
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	return len(data), nil
+}
+
+func (w *bufferingResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush gives up holding back the body, writing out what was held so far.
+func (w *bufferingResponseWriter) Flush() {
+	if !w.flushed {
+		w.flushed = true
+		if len(w.buf) > 0 {
+			w.ResponseWriter.Write(w.buf)
+			w.buf = nil
+		}
+	}
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils/keycloakmock"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+func TestRedactAttributesInRepresentation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	lh := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "idshield-test", io.Discard)
+
+	representation := `{"username":"asha","attributes":{"pan":["ABCDE1234F"],"region":["emea"]}}`
+	r := gin.New()
+	// Requests without a token cannot hold the capability to see sensitive attributes
+	r.Use(RedactAttributes(RedactionConfig{Attributes: []string{"pan"}}, &keycloakmock.Client{}, "capabilities", lh))
+	r.GET("/admin-events", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": []gin.H{
+			{"operationType": "UPDATE", "representation": representation},
+			{"operationType": "DELETE", "representation": "not json"},
+		}})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin-events", nil))
+
+	var response struct {
+		Data []struct {
+			Representation string `json:"representation"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || len(response.Data) != 2 {
+		t.Fatalf("unexpected response: %v: %s", err, w.Body.String())
+	}
+	var redacted struct {
+		Username   string              `json:"username"`
+		Attributes map[string][]string `json:"attributes"`
+	}
+	if err := json.Unmarshal([]byte(response.Data[0].Representation), &redacted); err != nil {
+		t.Fatalf("representation is no longer JSON: %v: %s", err, response.Data[0].Representation)
+	}
+	if got := redacted.Attributes["pan"]; len(got) != 1 || got[0] != RedactedValue {
+		t.Errorf("pan = %v, want it redacted", got)
+	}
+	if got := redacted.Attributes["region"]; len(got) != 1 || got[0] != "emea" {
+		t.Errorf("region = %v, want it kept", got)
+	}
+	if redacted.Username != "asha" {
+		t.Errorf("username = %q, want it kept", redacted.Username)
+	}
+	if response.Data[1].Representation != "not json" {
+		t.Errorf("representation = %q, want a representation that is not JSON kept", response.Data[1].Representation)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// DefaultSlowRequestThresholdMs is the duration, in milliseconds, past which a request is logged
+// as slow when no threshold is configured.
+const DefaultSlowRequestThresholdMs = 1000
+
+// LogRequests returns a middleware that logs every request once it is served. Requests served
+// within thresholdMs milliseconds are logged at debug priority; slower ones are logged as warnings,
+// along with their status, realm, correlation ID and a summary of the Keycloak calls made for
+// them, naming the slowest. A threshold of zero or less means DefaultSlowRequestThresholdMs.
+func LogRequests(lh *logharbour.Logger, thresholdMs int) gin.HandlerFunc {
+	if thresholdMs <= 0 {
+		thresholdMs = DefaultSlowRequestThresholdMs
+	}
+	threshold := time.Duration(thresholdMs) * time.Millisecond
+	return func(c *gin.Context) {
+		timings := utils.StartKeycloakTimings(c)
+		start := time.Now()
+		c.Next()
+		duration := time.Since(start)
+
+		if duration <= threshold {
+			lh.Debug0().LogActivity("Request served", map[string]any{
+				"method":        c.Request.Method,
+				"path":          c.Request.URL.Path,
+				"status":        c.Writer.Status(),
+				"durationMs":    duration.Milliseconds(),
+				"correlationID": utils.GetCorrelationID(c),
+			})
+			return
+		}
+		lh.Warn().LogActivity("Slow request", map[string]any{
+			"method":        c.Request.Method,
+			"route":         c.FullPath(),
+			"path":          c.Request.URL.Path,
+			"remoteAddr":    c.Request.RemoteAddr,
+			"status":        c.Writer.Status(),
+			"errorCode":     utils.ResponseErrorCode(c),
+			"realm":         utils.GetRealm(c),
+			"correlationID": utils.GetCorrelationID(c),
+			"durationMs":    duration.Milliseconds(),
+			"thresholdMs":   thresholdMs,
+			"keycloak":      timings.Summary(),
+		})
+	}
+}
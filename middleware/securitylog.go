@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// LogDenials returns a middleware that logs every request answered with 401 Unauthorized or
+// 403 Forbidden as an authorization_denied security event, whether the auth middleware, another
+// middleware or a handler denied it. It must come before the auth middleware to see its denials.
+func LogDenials(lh *logharbour.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		if status != http.StatusUnauthorized && status != http.StatusForbidden {
+			return
+		}
+		details := map[string]any{"status": status}
+		if code := utils.ResponseErrorCode(c); code != "" {
+			details["errorCode"] = code
+		}
+		utils.SecurityLog(c, lh, utils.SecurityEventAuthorizationDenied, details)
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// TokenExpiresInHeader carries the number of whole seconds left before the caller's token expires.
+const TokenExpiresInHeader = "X-Token-Expires-In"
+
+// TokenExpiry returns a middleware that tells callers how long their token remains valid
+// through the X-Token-Expires-In header, and adds a token_expiring_soon warning to the response
+// once fewer than warnSeconds are left, so that clients can refresh their token in time.
+// warnSeconds defaults to 60.
+func TokenExpiry(warnSeconds int) gin.HandlerFunc {
+	if warnSeconds <= 0 {
+		warnSeconds = 60
+	}
+	threshold := time.Duration(warnSeconds) * time.Second
+
+	return func(c *gin.Context) {
+		token, err := router.ExtractToken(c.GetHeader("Authorization"))
+		if err != nil {
+			c.Next()
+			return
+		}
+		if expiresIn, ok := utils.TokenExpiresIn(token); ok {
+			if expiresIn < 0 {
+				expiresIn = 0
+			}
+			c.Header(TokenExpiresInHeader, strconv.Itoa(int(expiresIn/time.Second)))
+			if expiresIn < threshold {
+				utils.AddWarning(c, wscutils.BuildErrorMessage("token_expiring_soon", nil, strconv.Itoa(int(expiresIn/time.Second))))
+			}
+		}
+		c.Next()
+	}
+}
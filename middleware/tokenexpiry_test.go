@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestTokenExpiryWarning(t *testing.T) {
+	tests := []struct {
+		name        string
+		expiresIn   time.Duration
+		wantWarning bool
+	}{
+		{name: "plenty of time left", expiresIn: 10 * time.Minute},
+		{name: "about to expire", expiresIn: 30 * time.Second, wantWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"exp": time.Now().Add(tt.expiresIn).Unix(),
+			}).SignedString([]byte("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(TokenExpiry(60))
+			r.GET("/group", func(c *gin.Context) { utils.SendSuccessResponse(c, "ok") })
+			req := httptest.NewRequest(http.MethodGet, "/group", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Header().Get(TokenExpiresInHeader) == "" {
+				t.Errorf("%s header missing", TokenExpiresInHeader)
+			}
+			if w.Header().Get("Warning") != "" {
+				t.Errorf("deprecated Warning header sent: %q", w.Header().Get("Warning"))
+			}
+			var response utils.ResponseWithMeta
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			warned := len(response.Warnings) == 1 && response.Warnings[0].ErrCode == "token_expiring_soon"
+			if warned != tt.wantWarning || (!tt.wantWarning && len(response.Warnings) > 0) {
+				t.Errorf("warnings = %+v, want token_expiring_soon: %v", response.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
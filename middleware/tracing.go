@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/idshield/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Tracing returns a middleware that starts a server span for every request, continuing
+// the trace given in its traceparent and tracestate headers. Failed requests mark the span
+// as an error carrying the error code they were answered with.
+func Tracing(tracer *utils.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Request.Method
+		if route := c.FullPath(); route != "" {
+			name += " " + route
+		}
+		span := tracer.StartServerSpan(c.Request, name)
+		if span == nil {
+			c.Next()
+			return
+		}
+		utils.SetRequestSpan(c, span)
+		span.SetAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", c.FullPath()),
+			attribute.String("url.path", c.Request.URL.Path),
+		)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if realm := utils.GetRealm(c); realm != "" {
+			span.SetAttributes(attribute.String("idshield.realm", realm))
+		}
+		if id := utils.GetCorrelationID(c); id != "" {
+			span.SetAttributes(attribute.String("idshield.correlation_id", id))
+		}
+		switch code := utils.ResponseErrorCode(c); {
+		case code != "":
+			span.SetAttributes(attribute.String("idshield.error_code", code))
+			span.SetStatus(codes.Error, code)
+		case status >= http.StatusInternalServerError:
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+	"github.com/remiges-tech/idshield/utils"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentSpanID = "00f067aa0ba902b7"
+)
+
+// keptSpansExporter keeps its spans when the tracer is shut down to flush them.
+type keptSpansExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+// Shutdown does nothing, leaving the exported spans in place.
+func (keptSpansExporter) Shutdown(context.Context) error { return nil }
+
+// tracedRequest serves a request carrying the given trace context headers through the Tracing
+// middleware to a handler making one Keycloak call, answered with keycloakStatus. It returns the
+// spans exported and the trace context headers Keycloak received.
+func tracedRequest(t *testing.T, traceparent, tracestate string, keycloakStatus int) ([]tracetest.SpanStub, http.Header) {
+	t.Helper()
+	var received http.Header
+	keycloak := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(keycloakStatus)
+	}))
+	defer keycloak.Close()
+
+	exporter := keptSpansExporter{tracetest.NewInMemoryExporter()}
+	tracer := utils.NewTracerWithExporter(utils.TracingConfig{}, exporter)
+	client := resty.New()
+	tracer.Attach(client)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Tracing(tracer))
+	r.GET("/groups", func(c *gin.Context) {
+		ctx, cancel := utils.RequestContext(c)
+		defer cancel()
+		resp, err := client.R().SetContext(ctx).Get(keycloak.URL + "/admin/realms/test/groups")
+		if err != nil || resp.IsError() {
+			utils.SendErrorResponse(c, utils.ErrorResponse("Forbidden", ""))
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/groups", nil)
+	if traceparent != "" {
+		req.Header.Set("traceparent", traceparent)
+	}
+	if tracestate != "" {
+		req.Header.Set("tracestate", tracestate)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("flushing spans: %v", err)
+	}
+	return exporter.GetSpans(), received
+}
+
+// spanOfKind returns the single exported span of the given kind.
+func spanOfKind(t *testing.T, spans []tracetest.SpanStub, kind trace.SpanKind) tracetest.SpanStub {
+	t.Helper()
+	var found []tracetest.SpanStub
+	for _, span := range spans {
+		if span.SpanKind == kind {
+			found = append(found, span)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("got %d %s spans, want 1", len(found), kind)
+	}
+	return found[0]
+}
+
+func TestTracingContinuesCallerTrace(t *testing.T) {
+	spans, received := tracedRequest(t, "00-"+testTraceID+"-"+testParentSpanID+"-01", "vendor=opaque", http.StatusOK)
+
+	server := spanOfKind(t, spans, trace.SpanKindServer)
+	client := spanOfKind(t, spans, trace.SpanKindClient)
+	if got := server.SpanContext.TraceID().String(); got != testTraceID {
+		t.Errorf("server span trace ID = %s, want the caller's %s", got, testTraceID)
+	}
+	if got := server.Parent.SpanID().String(); got != testParentSpanID {
+		t.Errorf("server span parent = %s, want the caller's span %s", got, testParentSpanID)
+	}
+	if server.Name != "GET /groups" {
+		t.Errorf("server span name = %q, want GET /groups", server.Name)
+	}
+	if client.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("Keycloak call span is not a child of the request span")
+	}
+
+	// Keycloak continues the trace from the call's span, keeping the caller's trace state
+	want := "00-" + testTraceID + "-" + client.SpanContext.SpanID().String() + "-01"
+	if got := received.Get("traceparent"); got != want {
+		t.Errorf("traceparent sent to Keycloak = %q, want %q", got, want)
+	}
+	if got := received.Get("tracestate"); got != "vendor=opaque" {
+		t.Errorf("tracestate sent to Keycloak = %q, want vendor=opaque", got)
+	}
+}
+
+func TestTracingStartsNewTrace(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+	}{
+		{name: "no trace context"},
+		{name: "extra fields in version 00", traceparent: "00-" + testTraceID + "-" + testParentSpanID + "-01-extra"},
+		{name: "invalid trace ID", traceparent: "00-" + strings.Repeat("0", 32) + "-" + testParentSpanID + "-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans, _ := tracedRequest(t, tt.traceparent, "", http.StatusOK)
+			server := spanOfKind(t, spans, trace.SpanKindServer)
+			if server.Parent.IsValid() {
+				t.Errorf("server span has parent %s, want a new trace", server.Parent.SpanID())
+			}
+			if server.SpanContext.TraceID().String() == testTraceID {
+				t.Error("server span continued the rejected trace")
+			}
+		})
+	}
+}
+
+func TestTracingPropagatesUnsampledTrace(t *testing.T) {
+	spans, received := tracedRequest(t, "00-"+testTraceID+"-"+testParentSpanID+"-00", "", http.StatusOK)
+	if len(spans) != 0 {
+		t.Errorf("exported %d spans of a trace the caller did not sample", len(spans))
+	}
+	if got := received.Get("traceparent"); !strings.HasPrefix(got, "00-"+testTraceID+"-") || !strings.HasSuffix(got, "-00") {
+		t.Errorf("traceparent sent to Keycloak = %q, want the unsampled trace %s", got, testTraceID)
+	}
+}
+
+func TestTracingMarksFailedRequests(t *testing.T) {
+	spans, _ := tracedRequest(t, "", "", http.StatusForbidden)
+
+	server := spanOfKind(t, spans, trace.SpanKindServer)
+	if server.Status.Code != codes.Error || server.Status.Description != "Forbidden" {
+		t.Errorf("server span status = %+v, want an error with the error code", server.Status)
+	}
+	found := false
+	for _, attr := range server.Attributes {
+		if attr.Key == "idshield.error_code" && attr.Value.AsString() == "Forbidden" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("server span attributes %v lack idshield.error_code", server.Attributes)
+	}
+	if client := spanOfKind(t, spans, trace.SpanKindClient); client.Status.Code != codes.Error {
+		t.Errorf("Keycloak call span status = %+v, want an error", client.Status)
+	}
+}
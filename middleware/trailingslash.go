@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ways of treating a request path that differs from a route only by a trailing slash.
+const (
+	// TrailingSlashRedirect redirects the request to the route's path, with 301 for GET
+	// requests and 307 for all others so that the method and body are kept.
+	TrailingSlashRedirect = "redirect"
+	// TrailingSlashRewrite serves the request as if it had been made without trailing slashes.
+	TrailingSlashRewrite = "rewrite"
+	// TrailingSlashStrict answers the request with not_found.
+	TrailingSlashStrict = "strict"
+)
+
+// TrailingSlash configures how r treats request paths ending in a slash, according to mode
+// (redirect when empty), and returns the handler r is to be served through. Paths are rewritten
+// before r routes them, so routes under a leading realm segment are treated like any other.
+func TrailingSlash(r *gin.Engine, mode string) (http.Handler, error) {
+	switch mode {
+	case "", TrailingSlashRedirect:
+		r.RedirectTrailingSlash = true
+		return r, nil
+	case TrailingSlashStrict:
+		r.RedirectTrailingSlash = false
+		return r, nil
+	case TrailingSlashRewrite:
+		r.RedirectTrailingSlash = false
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.URL.Path = trimTrailingSlashes(req.URL.Path)
+			if req.URL.RawPath != "" {
+				req.URL.RawPath = trimTrailingSlashes(req.URL.RawPath)
+			}
+			r.ServeHTTP(w, req)
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown trailing slash mode %q", mode)
+}
+
+// trimTrailingSlashes removes the slashes ending path, leaving the root path alone.
+func trimTrailingSlashes(path string) string {
+	if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+		return trimmed
+	}
+	return path
+}
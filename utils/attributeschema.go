@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// AttributeSchema is the subset of JSON schema that applies to a group attributes map, i.e.
+// an object whose properties are arrays of strings. For example:
+//
+//	{
+//	  "required": ["department"],
+//	  "additionalProperties": false,
+//	  "properties": {
+//	    "department": {"minItems": 1, "maxItems": 1, "items": {"enum": ["sales", "ops"]}},
+//	    "costCentre": {"items": {"pattern": "^[0-9]{4}$"}}
+//	  }
+//	}
+type AttributeSchema struct {
+	Required             []string                     `json:"required"`
+	Properties           map[string]AttributeProperty `json:"properties"`
+	AdditionalProperties *bool                        `json:"additionalProperties"`
+}
+
+// AttributeProperty constrains the values of a single attribute.
+type AttributeProperty struct {
+	MinItems *int                 `json:"minItems"`
+	MaxItems *int                 `json:"maxItems"`
+	Items    AttributeItemsSchema `json:"items"`
+}
+
+// AttributeItemsSchema constrains each value of an attribute.
+type AttributeItemsSchema struct {
+	Pattern   string   `json:"pattern"`
+	Enum      []string `json:"enum"`
+	MinLength *int     `json:"minLength"`
+	MaxLength *int     `json:"maxLength"`
+
+	pattern *regexp.Regexp
+}
+
+// attributeSchemas holds the configured schema of each idshield group type.
+var attributeSchemas = map[string]*AttributeSchema{}
+
+// LoadAttributeSchemas reads the schema file configured for each group type. Types with no
+// schema file are not validated.
+func LoadAttributeSchemas(files map[string]string) error {
+	schemas := make(map[string]*AttributeSchema, len(files))
+	for groupType, path := range files {
+		if !ValidGroupType(groupType) {
+			return fmt.Errorf("attribute schema configured for unknown group type %q", groupType)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading attribute schema for %s: %w", groupType, err)
+		}
+		var schema AttributeSchema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return fmt.Errorf("parsing attribute schema for %s: %w", groupType, err)
+		}
+		for key, property := range schema.Properties {
+			if property.Items.Pattern == "" {
+				continue
+			}
+			if property.Items.pattern, err = regexp.Compile(property.Items.Pattern); err != nil {
+				return fmt.Errorf("attribute schema for %s: invalid pattern for %s: %w", groupType, key, err)
+			}
+			schema.Properties[key] = property
+		}
+		schemas[groupType] = &schema
+	}
+	attributeSchemas = schemas
+	return nil
+}
+
+// ValidateAttributes checks attributes against the schema configured for groupType and
+// returns one attribute_schema_violation error per problem found. The idshield type
+// attribute is managed by idshield itself and is never checked.
+func ValidateAttributes(groupType string, attributes *map[string][]string) []wscutils.ErrorMessage {
+	schema, ok := attributeSchemas[groupType]
+	if !ok {
+		return nil
+	}
+	var attrs map[string][]string
+	if attributes != nil {
+		attrs = *attributes
+	}
+
+	var errs []wscutils.ErrorMessage
+	violation := func(key string, vals ...string) {
+		field := "attributes." + key
+		errs = append(errs, wscutils.BuildErrorMessage("attribute_schema_violation", &field, vals...))
+	}
+
+	for _, key := range schema.Required {
+		if _, ok := attrs[key]; !ok {
+			violation(key, "required")
+		}
+	}
+
+	// Check keys in a fixed order so that errors are reported deterministically
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		// Attributes reserved by idshield are not subject to the schema
+		if key == TypeAttribute || key == RolesAttribute || key == CreatedAtAttribute || key == UpdatedAtAttribute {
+			continue
+		}
+		values := attrs[key]
+		property, ok := schema.Properties[key]
+		if !ok {
+			if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				violation(key, "not allowed")
+			}
+			continue
+		}
+		if property.MinItems != nil && len(values) < *property.MinItems {
+			violation(key, "minItems", strconv.Itoa(*property.MinItems))
+		}
+		if property.MaxItems != nil && len(values) > *property.MaxItems {
+			violation(key, "maxItems", strconv.Itoa(*property.MaxItems))
+		}
+		for _, value := range values {
+			items := property.Items
+			if len(items.Enum) > 0 && !containsString(items.Enum, value) {
+				violation(key, "enum", value)
+			}
+			if items.pattern != nil && !items.pattern.MatchString(value) {
+				violation(key, "pattern", value, items.Pattern)
+			}
+			if items.MinLength != nil && len(value) < *items.MinLength {
+				violation(key, "minLength", value, strconv.Itoa(*items.MinLength))
+			}
+			if items.MaxLength != nil && len(value) > *items.MaxLength {
+				violation(key, "maxLength", value, strconv.Itoa(*items.MaxLength))
+			}
+		}
+	}
+	return errs
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// How duplicate values within an attribute are handled.
+const (
+	// DuplicateValuesDedupe removes repeated values, keeping the first occurrence of each.
+	DuplicateValuesDedupe = "dedupe"
+	// DuplicateValuesReject fails validation with duplicate_attribute_value.
+	DuplicateValuesReject = "reject"
+)
+
+// duplicateValuesMode is the configured handling of duplicate attribute values.
+var duplicateValuesMode = DuplicateValuesDedupe
+
+// SetDuplicateAttributeValues sets how duplicate values within an attribute are handled. An
+// empty mode keeps the default, DuplicateValuesDedupe.
+func SetDuplicateAttributeValues(mode string) error {
+	switch mode {
+	case "":
+		duplicateValuesMode = DuplicateValuesDedupe
+	case DuplicateValuesDedupe, DuplicateValuesReject:
+		duplicateValuesMode = mode
+	default:
+		return fmt.Errorf("unknown duplicate attribute values mode %q", mode)
+	}
+	return nil
+}
+
+// DedupeAttributes checks attributes for values repeated within a key. It returns the
+// attributes to store, the keys that held duplicates, and, when duplicates are rejected,
+// one duplicate_attribute_value error per repeated value. In dedupe mode the returned
+// attributes have the duplicates removed and no errors are returned.
+func DedupeAttributes(attributes *map[string][]string) (*map[string][]string, []string, []wscutils.ErrorMessage) {
+	if attributes == nil {
+		return nil, nil, nil
+	}
+	keys := make([]string, 0, len(*attributes))
+	for key := range *attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string][]string, len(*attributes))
+	var duplicated []string
+	var errs []wscutils.ErrorMessage
+	for _, key := range keys {
+		values := (*attributes)[key]
+		seen := make(map[string]bool, len(values))
+		unique := make([]string, 0, len(values))
+		for _, value := range values {
+			if !seen[value] {
+				seen[value] = true
+				unique = append(unique, value)
+				continue
+			}
+			if len(duplicated) == 0 || duplicated[len(duplicated)-1] != key {
+				duplicated = append(duplicated, key)
+			}
+			if duplicateValuesMode == DuplicateValuesReject {
+				field := "attributes." + key
+				errs = append(errs, wscutils.BuildErrorMessage("duplicate_attribute_value", &field, value))
+			}
+		}
+		result[key] = unique
+	}
+	if len(duplicated) == 0 || duplicateValuesMode == DuplicateValuesReject {
+		return attributes, duplicated, errs
+	}
+	return &result, duplicated, nil
+}
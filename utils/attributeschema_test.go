@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// withDuplicateValuesMode runs the test with the given handling of duplicate values, restoring
+// the previous one afterwards.
+func withDuplicateValuesMode(t *testing.T, mode string) {
+	t.Helper()
+	previous := duplicateValuesMode
+	if err := SetDuplicateAttributeValues(mode); err != nil {
+		t.Fatalf("SetDuplicateAttributeValues(%q): %v", mode, err)
+	}
+	t.Cleanup(func() { duplicateValuesMode = previous })
+}
+
+func TestDedupeAttributesDedupeMode(t *testing.T) {
+	withDuplicateValuesMode(t, DuplicateValuesDedupe)
+
+	tests := []struct {
+		name           string
+		attributes     map[string][]string
+		want           map[string][]string
+		wantDuplicated []string
+	}{
+		{
+			name:       "no duplicates",
+			attributes: map[string][]string{"region": {"eu", "us"}},
+			want:       map[string][]string{"region": {"eu", "us"}},
+		},
+		{
+			name:           "first occurrence kept in order",
+			attributes:     map[string][]string{"region": {"us", "eu", "us", "apac", "eu"}},
+			want:           map[string][]string{"region": {"us", "eu", "apac"}},
+			wantDuplicated: []string{"region"},
+		},
+		{
+			name: "keys reported once each, sorted",
+			attributes: map[string][]string{
+				"zone":   {"a", "a", "a"},
+				"region": {"eu", "eu"},
+				"tier":   {"gold"},
+			},
+			want: map[string][]string{
+				"zone":   {"a"},
+				"region": {"eu"},
+				"tier":   {"gold"},
+			},
+			wantDuplicated: []string{"region", "zone"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, duplicated, errs := DedupeAttributes(&tt.attributes)
+			if len(errs) != 0 {
+				t.Errorf("errors = %+v, want none in dedupe mode", errs)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("attributes = %v, want %v", *got, tt.want)
+			}
+			if !reflect.DeepEqual(duplicated, tt.wantDuplicated) {
+				t.Errorf("duplicated keys = %v, want %v", duplicated, tt.wantDuplicated)
+			}
+		})
+	}
+
+	if got, duplicated, errs := DedupeAttributes(nil); got != nil || duplicated != nil || errs != nil {
+		t.Errorf("DedupeAttributes(nil) = %v, %v, %v, want nothing", got, duplicated, errs)
+	}
+}
+
+func TestDedupeAttributesRejectMode(t *testing.T) {
+	withDuplicateValuesMode(t, DuplicateValuesReject)
+
+	attributes := map[string][]string{
+		"region": {"eu", "eu", "us", "eu"},
+		"tier":   {"gold"},
+		"zone":   {"a", "b", "b"},
+	}
+	got, duplicated, errs := DedupeAttributes(&attributes)
+
+	// The attributes are left as they are, as the request is to be refused
+	if !reflect.DeepEqual(*got, attributes) {
+		t.Errorf("attributes = %v, want them unchanged", *got)
+	}
+	if want := []string{"region", "zone"}; !reflect.DeepEqual(duplicated, want) {
+		t.Errorf("duplicated keys = %v, want %v", duplicated, want)
+	}
+
+	// One error per repeated value, so region's eu is reported twice
+	type reported struct{ field, value string }
+	want := []reported{{"attributes.region", "eu"}, {"attributes.region", "eu"}, {"attributes.zone", "b"}}
+	var gotErrs []reported
+	for _, err := range errs {
+		if err.ErrCode != "duplicate_attribute_value" {
+			t.Errorf("error code = %q, want duplicate_attribute_value", err.ErrCode)
+		}
+		if err.Field == nil || len(err.Vals) != 1 {
+			t.Fatalf("error %+v does not name the attribute and value", err)
+		}
+		gotErrs = append(gotErrs, reported{*err.Field, err.Vals[0]})
+	}
+	if !reflect.DeepEqual(gotErrs, want) {
+		t.Errorf("errors = %v, want %v", gotErrs, want)
+	}
+}
+
+func TestSetDuplicateAttributeValues(t *testing.T) {
+	withDuplicateValuesMode(t, DuplicateValuesReject)
+
+	if err := SetDuplicateAttributeValues(""); err != nil || duplicateValuesMode != DuplicateValuesDedupe {
+		t.Errorf("empty mode gave %q, %v, want the dedupe default", duplicateValuesMode, err)
+	}
+	if err := SetDuplicateAttributeValues("ignore"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+// HasCapability reports whether the user a token was issued to holds the named capability,
+// that is, whether the user is a member of the capability's group under capabilitiesGroup.
+// The user is looked up in the realm that issued the token.
+func HasCapability(ctx context.Context, client KeycloakClient, token, capabilitiesGroup, capability string) (bool, error) {
+	claims, err := TokenClaims(token)
+	if err != nil {
+		return false, err
+	}
+	userID, _ := claims["sub"].(string)
+	issuer, _ := claims["iss"].(string)
+	_, realm, found := strings.Cut(issuer, "/realms/")
+	if userID == "" || !found || realm == "" {
+		return false, fmt.Errorf("token has no subject or issuing realm")
+	}
+
+	groups, err := client.GetUserGroups(ctx, token, realm, userID, gocloak.GetGroupsParams{Search: gocloak.StringP(capability)})
+	if err != nil {
+		return false, err
+	}
+	path := "/" + capabilitiesGroup + "/" + capability
+	for _, group := range groups {
+		if group != nil && gocloak.PString(group.Path) == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UserCapabilities returns the names of the capabilities a user holds in realm, that is,
+// of the groups directly under capabilitiesGroup the user is a member of.
+func UserCapabilities(ctx context.Context, client KeycloakClient, token, realm, userID, capabilitiesGroup string) (map[string]bool, error) {
+	grants, err := UserCapabilityGrants(ctx, client, token, realm, userID, capabilitiesGroup)
+	if err != nil {
+		return nil, err
+	}
+	capabilities := make(map[string]bool, len(grants))
+	for name := range grants {
+		capabilities[name] = true
+	}
+	return capabilities, nil
+}
+
+// UserCapabilityGrants maps the names of the capabilities a user holds in realm to the path
+// of the group whose membership grants each of them.
+func UserCapabilityGrants(ctx context.Context, client KeycloakClient, token, realm, userID, capabilitiesGroup string) (map[string]string, error) {
+	groups, err := CollectPages(MaxPageSize, 0, func(first, max int) ([]*gocloak.Group, error) {
+		return client.GetUserGroups(ctx, token, realm, userID, gocloak.GetGroupsParams{
+			First: gocloak.IntP(first),
+			Max:   gocloak.IntP(max),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	prefix := "/" + capabilitiesGroup + "/"
+	grants := map[string]string{}
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		path := gocloak.PString(group.Path)
+		if name, ok := strings.CutPrefix(path, prefix); ok && !strings.Contains(name, "/") {
+			grants[name] = path
+		}
+	}
+	return grants, nil
+}
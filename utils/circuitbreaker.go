@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ErrCircuitOpen is returned for Keycloak calls rejected because the circuit breaker is open.
+var ErrCircuitOpen = errors.New("keycloak circuit breaker is open")
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreakerConfig holds the thresholds of the Keycloak circuit breaker.
+// Zero values are replaced by defaults.
+type CircuitBreakerConfig struct {
+	// FailureRatio is the share of failed calls within an interval that opens the breaker.
+	FailureRatio float64 `json:"failure_ratio"`
+	// MinRequests is the minimum number of calls within an interval before the breaker may open.
+	MinRequests int `json:"min_requests"`
+	// IntervalSeconds is how often the call counts are reset while the breaker is closed.
+	IntervalSeconds int `json:"interval_seconds"`
+	// OpenTimeoutSeconds is how long the breaker stays open before letting a probe call through.
+	OpenTimeoutSeconds int `json:"open_timeout_seconds"`
+}
+
+// CircuitBreaker fails Keycloak calls fast once their error rate crosses a threshold,
+// and half-opens after a timeout to probe whether Keycloak has recovered.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	cfg         CircuitBreakerConfig
+	state       string
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probing     bool
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker with the given thresholds.
+func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.FailureRatio <= 0 {
+		cfg.FailureRatio = 0.5
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.IntervalSeconds <= 0 {
+		cfg.IntervalSeconds = 60
+	}
+	if cfg.OpenTimeoutSeconds <= 0 {
+		cfg.OpenTimeoutSeconds = 30
+	}
+	return &CircuitBreaker{cfg: cfg, state: CircuitClosed, windowStart: time.Now()}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	return b.state
+}
+
+// Allow reports whether a call may proceed, returning ErrCircuitOpen if not.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+
+	switch b.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		// only a single probe call is let through while half-open
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record registers the outcome of a call that was allowed through.
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.advance(now)
+
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+		if success {
+			b.reset(CircuitClosed, now)
+		} else {
+			b.state = CircuitOpen
+			b.openedAt = now
+		}
+		return
+	}
+
+	b.requests++
+	if !success {
+		b.failures++
+	}
+	if b.requests >= b.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= b.cfg.FailureRatio {
+		b.state = CircuitOpen
+		b.openedAt = now
+	}
+}
+
+// Release gives up the half-open probe without an outcome, for a call abandoned by its caller,
+// so that the next call may probe instead.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+	}
+}
+
+// advance moves the breaker between states based on elapsed time.
+func (b *CircuitBreaker) advance(now time.Time) {
+	switch b.state {
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= time.Duration(b.cfg.IntervalSeconds)*time.Second {
+			b.reset(CircuitClosed, now)
+		}
+	case CircuitOpen:
+		if now.Sub(b.openedAt) >= time.Duration(b.cfg.OpenTimeoutSeconds)*time.Second {
+			b.state = CircuitHalfOpen
+			b.probing = false
+		}
+	}
+}
+
+// reset clears the call counts and moves the breaker to state.
+func (b *CircuitBreaker) reset(state string, now time.Time) {
+	b.state = state
+	b.requests = 0
+	b.failures = 0
+	b.windowStart = now
+}
+
+// Attach installs the breaker on a resty client, such as the one used by gocloak,
+// so that every Keycloak call passes through it. Network errors and 5xx responses
+// count as failures; calls cancelled by their caller do not, and hand the half-open
+// probe on to the next call if they held it.
+func (b *CircuitBreaker) Attach(client *resty.Client) {
+	client.OnBeforeRequest(func(_ *resty.Client, _ *resty.Request) error {
+		return b.Allow()
+	})
+	client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		b.Record(resp.StatusCode() < http.StatusInternalServerError)
+		return nil
+	})
+	client.OnError(func(_ *resty.Request, err error) {
+		var respErr *resty.ResponseError
+		switch {
+		case errors.Is(err, ErrCircuitOpen):
+			// rejected by the breaker itself
+		case errors.Is(err, context.Canceled):
+			// given up by the caller, which says nothing of Keycloak, but may have been the probe
+			b.Release()
+		case errors.As(err, &respErr) && respErr.Response.RawResponse != nil:
+			// already recorded as a response
+		default:
+			b.Record(false)
+		}
+	})
+}
+
+// IsCircuitOpen reports whether err was caused by the Keycloak circuit breaker rejecting
+// the call. gocloak flattens errors into strings, so the message is matched.
+func IsCircuitOpen(err error) bool {
+	return err != nil && (errors.Is(err, ErrCircuitOpen) || strings.Contains(err.Error(), ErrCircuitOpen.Error()))
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+func TestCircuitBreakerCancelledProbe(t *testing.T) {
+	var calls atomic.Int64
+	probing := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case 2:
+			// the probe hangs until its caller gives up
+			close(probing)
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+
+	client := gocloak.NewClient(server.URL)
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{MinRequests: 1})
+	breaker.Attach(client.RestyClient())
+
+	if _, err := client.GetGroups(context.Background(), "token", "test", gocloak.GetGroupsParams{}); err == nil {
+		t.Fatal("GetGroups() succeeded, want the Keycloak failure")
+	}
+	if got := breaker.State(); got != CircuitOpen {
+		t.Fatalf("state = %q after a failure, want %q", got, CircuitOpen)
+	}
+
+	// let the open timeout pass
+	breaker.mu.Lock()
+	breaker.openedAt = time.Now().Add(-time.Hour)
+	breaker.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-probing
+		cancel()
+	}()
+	if _, err := client.GetGroups(ctx, "token", "test", gocloak.GetGroupsParams{}); err == nil {
+		t.Fatal("cancelled probe succeeded, want an error")
+	}
+	if got := breaker.State(); got != CircuitHalfOpen {
+		t.Fatalf("state = %q after the probe was cancelled, want %q", got, CircuitHalfOpen)
+	}
+
+	if _, err := client.GetGroups(context.Background(), "token", "test", gocloak.GetGroupsParams{}); err != nil {
+		t.Fatalf("GetGroups() after the cancelled probe failed: %v", err)
+	}
+	if got := breaker.State(); got != CircuitClosed {
+		t.Errorf("state = %q after a successful probe, want %q", got, CircuitClosed)
+	}
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerBusy is returned when a request found no free slot before its queue timeout.
+var ErrServerBusy = errors.New("too many requests in flight")
+
+// ConcurrencyConfig holds the limits on concurrently served Keycloak-bound requests, set
+// separately for reads (GET and HEAD requests) and writes (all others). A limit of 0 leaves
+// that kind of request unlimited. Other zero values are replaced by defaults.
+type ConcurrencyConfig struct {
+	// MaxReads is the largest number of read requests served at once.
+	MaxReads int `json:"max_reads"`
+	// MaxWrites is the largest number of write requests served at once.
+	MaxWrites int `json:"max_writes"`
+	// MaxQueued is how many requests of each kind may wait for a slot; it defaults to the limit itself.
+	MaxQueued int `json:"max_queued"`
+	// QueueTimeoutMillis is how long a waiting request is held before being refused; 1000 by default.
+	QueueTimeoutMillis int `json:"queue_timeout_millis"`
+}
+
+// ConcurrencyLimiter bounds the number of requests served at once, holding requests beyond
+// the limit in a bounded queue for a short while and refusing the rest. A nil
+// ConcurrencyLimiter lets every request through.
+type ConcurrencyLimiter struct {
+	reads        *concurrencyPool
+	writes       *concurrencyPool
+	queueTimeout time.Duration
+}
+
+// concurrencyPool is a counting semaphore with a bounded number of waiters.
+type concurrencyPool struct {
+	slots     chan struct{}
+	maxQueued int64
+	queued    atomic.Int64
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter with the given limits. It returns nil
+// when neither reads nor writes are limited.
+func NewConcurrencyLimiter(cfg ConcurrencyConfig) *ConcurrencyLimiter {
+	if cfg.MaxReads <= 0 && cfg.MaxWrites <= 0 {
+		return nil
+	}
+	if cfg.QueueTimeoutMillis <= 0 {
+		cfg.QueueTimeoutMillis = 1000
+	}
+	return &ConcurrencyLimiter{
+		reads:        newConcurrencyPool(cfg.MaxReads, cfg.MaxQueued),
+		writes:       newConcurrencyPool(cfg.MaxWrites, cfg.MaxQueued),
+		queueTimeout: time.Duration(cfg.QueueTimeoutMillis) * time.Millisecond,
+	}
+}
+
+// newConcurrencyPool creates a pool of limit slots, or returns nil for an unlimited pool.
+func newConcurrencyPool(limit, maxQueued int) *concurrencyPool {
+	if limit <= 0 {
+		return nil
+	}
+	if maxQueued <= 0 {
+		maxQueued = limit
+	}
+	return &concurrencyPool{slots: make(chan struct{}, limit), maxQueued: int64(maxQueued)}
+}
+
+// Acquire takes a read or write slot, waiting for one to free up if the queue has room.
+// It returns ErrServerBusy if none was free in time, and otherwise a function that gives
+// the slot back, to be called once the request is served.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, write bool) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if write {
+		return l.writes.acquire(ctx, l.queueTimeout)
+	}
+	return l.reads.acquire(ctx, l.queueTimeout)
+}
+
+// InFlight reports the number of read and write requests being served and waiting.
+func (l *ConcurrencyLimiter) InFlight() map[string]int {
+	if l == nil {
+		return map[string]int{}
+	}
+	return map[string]int{
+		"reads":        l.reads.inFlight(),
+		"readsQueued":  l.reads.waiting(),
+		"writes":       l.writes.inFlight(),
+		"writesQueued": l.writes.waiting(),
+	}
+}
+
+func (p *concurrencyPool) acquire(ctx context.Context, timeout time.Duration) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	default:
+	}
+
+	if p.queued.Add(1) > p.maxQueued {
+		p.queued.Add(-1)
+		return nil, ErrServerBusy
+	}
+	defer p.queued.Add(-1)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	case <-timer.C:
+		return nil, ErrServerBusy
+	case <-ctx.Done():
+		return nil, ErrServerBusy
+	}
+}
+
+func (p *concurrencyPool) release() {
+	<-p.slots
+}
+
+func (p *concurrencyPool) inFlight() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.slots)
+}
+
+func (p *concurrencyPool) waiting() int {
+	if p == nil {
+		return 0
+	}
+	return int(p.queued.Load())
+}
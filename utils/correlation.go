@@ -0,0 +1,22 @@
+package utils
+
+import "github.com/gin-gonic/gin"
+
+const (
+	// DefaultCorrelationHeader is the header carrying the correlation ID of the calling service
+	// unless another is configured.
+	DefaultCorrelationHeader = "X-Correlation-ID"
+	// correlationContextKey is the gin context key under which the correlation ID of a request is stored.
+	correlationContextKey = "correlationID"
+)
+
+// SetCorrelationID records the correlation ID the caller gave a request in its context.
+func SetCorrelationID(c *gin.Context, id string) {
+	c.Set(correlationContextKey, id)
+}
+
+// GetCorrelationID returns the correlation ID the caller gave a request, or an empty string
+// if it gave none.
+func GetCorrelationID(c *gin.Context) string {
+	return c.GetString(correlationContextKey)
+}
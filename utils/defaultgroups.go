@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+// defaultGroups maps a realm to the paths of the groups idshield adds new users of that realm to.
+var defaultGroups = map[string][]string{}
+
+// SetDefaultGroups sets the groups new users are added to, as group paths keyed by realm.
+func SetDefaultGroups(groups map[string][]string) error {
+	for realm, paths := range groups {
+		for _, path := range paths {
+			if !strings.HasPrefix(path, "/") || len(path) < 2 {
+				return fmt.Errorf("default group %q of realm %s is not a group path", path, realm)
+			}
+		}
+	}
+	defaultGroups = groups
+	return nil
+}
+
+// DefaultGroups returns the paths of the groups new users of realm are added to.
+func DefaultGroups(realm string) []string {
+	return defaultGroups[realm]
+}
+
+// ValidateDefaultGroups checks that every configured default group exists, using a token
+// allowed to view the groups of every realm listed.
+func ValidateDefaultGroups(ctx context.Context, client KeycloakClient, token string) error {
+	for realm, paths := range defaultGroups {
+		for _, path := range paths {
+			if _, err := client.GetGroupByPath(ctx, token, realm, path); err != nil {
+				return fmt.Errorf("default group %s of realm %s: %w", path, realm, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveDefaultGroups looks up the default groups of realm, returning them keyed by path.
+func ResolveDefaultGroups(ctx context.Context, client KeycloakClient, token, realm string) (map[string]string, error) {
+	ids := map[string]string{}
+	for _, path := range defaultGroups[realm] {
+		group, err := client.GetGroupByPath(ctx, token, realm, path)
+		if err != nil {
+			return nil, err
+		}
+		ids[path] = gocloak.PString(group.ID)
+	}
+	return ids, nil
+}
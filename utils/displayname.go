@@ -0,0 +1,39 @@
+package utils
+
+import "strings"
+
+// DisplayNameAttributePrefix prefixes the attributes holding the display name of a group in a
+// language, e.g. displayName_fr or displayName_pt-BR.
+const DisplayNameAttributePrefix = "displayName_"
+
+// DisplayName returns the display name of a group with the given name and attributes in the
+// first of langs, as returned by RequestLanguages, it has a display name attribute for. Each
+// language is tried as given (e.g. "pt-br") and then by its primary subtag (e.g. "pt"), ignoring
+// case. The name itself is returned when no language matches.
+func DisplayName(langs []string, name string, attributes *map[string][]string) string {
+	if attributes == nil || len(langs) == 0 {
+		return name
+	}
+	displayNames := map[string]string{}
+	for key, values := range *attributes {
+		if len(key) <= len(DisplayNameAttributePrefix) || !strings.EqualFold(key[:len(DisplayNameAttributePrefix)], DisplayNameAttributePrefix) {
+			continue
+		}
+		if len(values) > 0 && values[0] != "" {
+			displayNames[strings.ToLower(key[len(DisplayNameAttributePrefix):])] = values[0]
+		}
+	}
+	if len(displayNames) == 0 {
+		return name
+	}
+	for _, lang := range langs {
+		if displayName, ok := displayNames[lang]; ok {
+			return displayName
+		}
+		primary, _, _ := strings.Cut(lang, "-")
+		if displayName, ok := displayNames[primary]; ok {
+			return displayName
+		}
+	}
+	return name
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// errorStatusCodes maps wscutils error codes to the HTTP status code sent along with them.
+// Codes ending in "_not_found" map to 404 unless listed here; anything else falls back
+// to 400 Bad Request.
+var errorStatusCodes = map[string]int{
+	"unknown":                    http.StatusInternalServerError,
+	"internal_error":             http.StatusInternalServerError,
+	"invalid_request":            http.StatusBadRequest,
+	"invalid_json":               http.StatusBadRequest,
+	"database_error":             http.StatusInternalServerError,
+	"token_missing":              http.StatusUnauthorized,
+	"token_verification_failed":  http.StatusUnauthorized,
+	"token_cache_failed":         http.StatusInternalServerError,
+	"Unauthorized":               http.StatusUnauthorized,
+	"Forbidden":                  http.StatusForbidden,
+	"name already exist":         http.StatusConflict,
+	"tree_too_large":             http.StatusUnprocessableEntity,
+	"cycle_detected":             http.StatusUnprocessableEntity,
+	"user_already_exists":        http.StatusConflict,
+	"keycloak_unavailable":       http.StatusServiceUnavailable,
+	"unsupported_media_type":     http.StatusUnsupportedMediaType,
+	"realm_not_allowed":          http.StatusForbidden,
+	"request_too_large":          http.StatusRequestEntityTooLarge,
+	"not_found":                  http.StatusNotFound,
+	"method_not_allowed":         http.StatusMethodNotAllowed,
+	"protected_group":            http.StatusForbidden,
+	"federated_identity_exists":  http.StatusConflict,
+	"endpoint_disabled":          http.StatusForbidden,
+	"server_busy":                http.StatusServiceUnavailable,
+	"duplicate_unique_attribute": http.StatusConflict,
+	"feature_unsupported":        http.StatusNotImplemented,
+	"organization_exists":        http.StatusConflict,
+	"organization_member_exists": http.StatusConflict,
+	"email_not_sent":             http.StatusBadGateway,
+	"job_store_unavailable":      http.StatusServiceUnavailable,
+	"job_finished":               http.StatusConflict,
+	"request_cancelled":          http.StatusConflict,
+	"multiple_matches":           http.StatusConflict,
+	"keycloak_rate_limited":      http.StatusServiceUnavailable,
+	"client_scope_exists":        http.StatusConflict,
+}
+
+// SetErrorStatusCodes overrides entries of the error code to HTTP status mapping,
+// typically with values loaded from configuration at startup.
+func SetErrorStatusCodes(overrides map[string]int) {
+	for code, status := range overrides {
+		errorStatusCodes[code] = status
+	}
+}
+
+// HTTPStatusForError returns the HTTP status code to be used for the given error code.
+func HTTPStatusForError(errcode string) int {
+	if status, ok := errorStatusCodes[errcode]; ok {
+		return status
+	}
+	if strings.HasSuffix(errcode, "_not_found") {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// ErrorResponse builds an error response holding a single message with the error code, the
+// field it concerns, and vals. An empty field leaves the message without one, for errors that
+// do not concern a particular field. All error responses are built through it, so that clients
+// get messages of the same structure whatever the error.
+func ErrorResponse(code, field string, vals ...string) *wscutils.Response {
+	var fieldPtr *string
+	if field != "" {
+		fieldPtr = &field
+	}
+	return wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(code, fieldPtr, vals...)})
+}
+
+// SendErrorResponse sends a JSON error response with the HTTP status mapped from
+// the error code of the first message in the response, and its message vals localized
+// into the language the request asks for. Requests accepting application/problem+json get the
+// error as RFC 7807 problem details instead of the standard envelope.
+func SendErrorResponse(c *gin.Context, response *wscutils.Response) {
+	status := http.StatusBadRequest
+	if len(response.Messages) > 0 {
+		status = HTTPStatusForError(response.Messages[0].ErrCode)
+		c.Set(errorCodeContextKey, response.Messages[0].ErrCode)
+		if response.Messages[0].ErrCode == "keycloak_rate_limited" {
+			if wait, ok := KeycloakRetryAfter(c); ok {
+				c.Header("Retry-After", retryAfterSeconds(wait))
+			}
+		}
+		localized := *response
+		localized.Messages = LocalizeMessages(c, response.Messages)
+		response = &localized
+	}
+	if WantsProblemJSON(c) {
+		sendProblem(c, status, response)
+		return
+	}
+	c.JSON(status, response)
+}
+
+// KeycloakErrorCode converts an error returned by a gocloak call into an error code,
+// using notFoundCode when Keycloak reports that the resource does not exist.
+func KeycloakErrorCode(err error, notFoundCode string) string {
+	if IsCircuitOpen(err) {
+		return "keycloak_unavailable"
+	}
+	if IsCancelled(err) {
+		return "request_cancelled"
+	}
+	var apiErr *gocloak.APIError
+	if !errors.As(err, &apiErr) {
+		return "unknown"
+	}
+	switch apiErr.Code {
+	case http.StatusUnauthorized:
+		return "Unauthorized"
+	case http.StatusForbidden:
+		return "Forbidden"
+	case http.StatusNotFound:
+		return notFoundCode
+	case http.StatusTooManyRequests:
+		return "keycloak_rate_limited"
+	default:
+		return "unknown"
+	}
+}
+
+// IsConflict reports whether err is a Keycloak 409 Conflict response.
+func IsConflict(err error) bool {
+	var apiErr *gocloak.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
+
+// IsCancelled reports whether err was caused by the context of a Keycloak call being cancelled,
+// as when a background job is cancelled. gocloak flattens errors into strings, so the message
+// is matched.
+func IsCancelled(err error) bool {
+	return err != nil && (errors.Is(err, context.Canceled) || strings.Contains(err.Error(), context.Canceled.Error()))
+}
+
+// IsNotFound reports whether err is a Keycloak 404 Not Found response.
+func IsNotFound(err error) bool {
+	var apiErr *gocloak.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
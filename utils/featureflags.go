@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeatureFlagsHeader is the request header through which clients opt into experimental
+// behaviour, as a comma separated list of flags.
+const FeatureFlagsHeader = "X-Feature-Flags"
+
+// Stabilities of feature flags. Experimental flags may change or go away in any release; beta
+// flags are expected to become the default behaviour.
+const (
+	FlagExperimental = "experimental"
+	FlagBeta         = "beta"
+)
+
+// FeatureLinkPagination makes list responses carry their next and prev page links in a Link
+// header (RFC 8288) as well as in their meta section.
+const FeatureLinkPagination = "link-pagination"
+
+// KnownFeatureFlags maps each flag requests may set to its stability.
+var KnownFeatureFlags = map[string]string{
+	FeatureLinkPagination: FlagExperimental,
+}
+
+// featureFlagsContextKey is the gin context key under which the flags a request set are stored.
+const featureFlagsContextKey = "featureFlags"
+
+// SetFeatureFlags records the known flags a request set in its context.
+func SetFeatureFlags(c *gin.Context, flags map[string]bool) {
+	c.Set(featureFlagsContextKey, flags)
+}
+
+// FeatureEnabled reports whether a request set the given feature flag.
+func FeatureEnabled(c *gin.Context, flag string) bool {
+	flags, _ := c.Value(featureFlagsContextKey).(map[string]bool)
+	return flags[flag]
+}
+
+// EnabledFeatureFlags returns the feature flags a request set, sorted.
+func EnabledFeatureFlags(c *gin.Context) []string {
+	flags, _ := c.Value(featureFlagsContextKey).(map[string]bool)
+	enabled := make([]string, 0, len(flags))
+	for flag := range flags {
+		enabled = append(enabled, flag)
+	}
+	sort.Strings(enabled)
+	return enabled
+}
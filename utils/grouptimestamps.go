@@ -0,0 +1,77 @@
+package utils
+
+import "time"
+
+// Keycloak keeps no creation or modification time for groups, so idshield records them in these
+// group attributes, as RFC 3339 UTC times. Groups created before they were introduced have none.
+const (
+	CreatedAtAttribute = "idshield_created_at"
+	UpdatedAtAttribute = "idshield_updated_at"
+)
+
+// StampCreated returns a copy of attributes with both timestamp attributes set to now, for a
+// group about to be created.
+func StampCreated(attributes *map[string][]string) *map[string][]string {
+	now := []string{time.Now().UTC().Format(time.RFC3339)}
+	result := copyAttributes(attributes)
+	result[CreatedAtAttribute] = now
+	result[UpdatedAtAttribute] = now
+	return &result
+}
+
+// StampUpdated returns a copy of attributes, about to replace those of an existing group holding
+// current, with the creation time carried over from current and the update time set to now. The
+// creation time is left out when current has none, rather than made up.
+func StampUpdated(attributes, current *map[string][]string) *map[string][]string {
+	result := *WithTimestampsOf(attributes, current)
+	result[UpdatedAtAttribute] = []string{time.Now().UTC().Format(time.RFC3339)}
+	return &result
+}
+
+// WithTimestampsOf returns a copy of attributes with the timestamp attributes taken from current,
+// so that they never show up as a difference between the two.
+func WithTimestampsOf(attributes, current *map[string][]string) *map[string][]string {
+	result := copyAttributes(attributes)
+	for _, key := range []string{CreatedAtAttribute, UpdatedAtAttribute} {
+		delete(result, key)
+		if current != nil {
+			if values, ok := (*current)[key]; ok {
+				result[key] = values
+			}
+		}
+	}
+	return &result
+}
+
+// GroupTimestamps returns the creation and update times recorded in a group's attributes. Either
+// is nil when it is missing or cannot be parsed.
+func GroupTimestamps(attributes *map[string][]string) (createdAt, updatedAt *time.Time) {
+	return timestampAttribute(attributes, CreatedAtAttribute), timestampAttribute(attributes, UpdatedAtAttribute)
+}
+
+// timestampAttribute parses the first value of the attribute key as an RFC 3339 time.
+func timestampAttribute(attributes *map[string][]string, key string) *time.Time {
+	if attributes == nil {
+		return nil
+	}
+	values := (*attributes)[key]
+	if len(values) == 0 {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, values[0])
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// copyAttributes returns a shallow copy of attributes, which may be nil.
+func copyAttributes(attributes *map[string][]string) map[string][]string {
+	result := make(map[string][]string)
+	if attributes != nil {
+		for key, values := range *attributes {
+			result[key] = values
+		}
+	}
+	return result
+}
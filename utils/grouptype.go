@@ -0,0 +1,41 @@
+package utils
+
+// Capabilities and groups are both stored as Keycloak groups. idshield tells them apart
+// through the TypeAttribute group attribute, which is set automatically on creation.
+const (
+	TypeAttribute  = "idshield_type"
+	TypeGroup      = "group"
+	TypeCapability = "capability"
+)
+
+// RolesAttribute is the group attribute listing the realm roles a group's role mappings are
+// kept in line with. Each value is a role name, or a JSON array of role names.
+const RolesAttribute = "idshield_roles"
+
+// GroupType returns the idshield type recorded in a group's attributes. Groups created
+// before the attribute was introduced have none and are treated as plain groups.
+func GroupType(attributes *map[string][]string) string {
+	if attributes != nil {
+		if values := (*attributes)[TypeAttribute]; len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return TypeGroup
+}
+
+// WithGroupType returns a copy of attributes with the idshield type attribute set to groupType.
+func WithGroupType(attributes *map[string][]string, groupType string) *map[string][]string {
+	result := make(map[string][]string)
+	if attributes != nil {
+		for key, values := range *attributes {
+			result[key] = values
+		}
+	}
+	result[TypeAttribute] = []string{groupType}
+	return &result
+}
+
+// ValidGroupType reports whether groupType is one of the known idshield types.
+func ValidGroupType(groupType string) bool {
+	return groupType == TypeGroup || groupType == TypeCapability
+}
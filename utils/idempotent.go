@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentDeletes is whether deleting a resource that does not exist succeeds, for requests
+// that do not say otherwise.
+var idempotentDeletes bool
+
+// AlreadyDeletedResponse is the data of the success response to an idempotent delete of a
+// resource that does not exist.
+type AlreadyDeletedResponse struct {
+	AlreadyDeleted bool `json:"alreadyDeleted"`
+}
+
+// SetIdempotentDeletes sets whether deleting a resource that does not exist succeeds when the
+// request does not give the idempotent query parameter.
+func SetIdempotentDeletes(idempotent bool) {
+	idempotentDeletes = idempotent
+}
+
+// GetIdempotentParam reads the idempotent query parameter of a delete request, which defaults
+// to the configured idempotent_deletes. Idempotent deletes of a resource that does not exist
+// succeed with AlreadyDeletedResponse instead of failing. It returns false if the parameter is
+// not a valid boolean.
+func GetIdempotentParam(c *gin.Context) (idempotent, ok bool) {
+	v := c.Query("idempotent")
+	if v == "" {
+		return idempotentDeletes, true
+	}
+	idempotent, err := strconv.ParseBool(v)
+	return idempotent, err == nil
+}
+
+// SendAlreadyDeletedResponse answers an idempotent delete of a resource that does not exist.
+func SendAlreadyDeletedResponse(c *gin.Context) {
+	SendSuccessResponse(c, AlreadyDeletedResponse{AlreadyDeleted: true})
+}
@@ -0,0 +1,395 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// States a job goes through. A job is queued until a slot is free to run it, and is done or
+// failed once the request it runs has been answered with a success or an error, or cancelled
+// if it was cancelled before then.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+const (
+	// jobKeyPrefix prefixes the Redis keys job states are stored under.
+	jobKeyPrefix = "idshield:job:"
+	// jobCancelKeyPrefix prefixes the Redis keys flagging jobs to be cancelled by whichever
+	// instance runs them.
+	jobCancelKeyPrefix = "idshield:job-cancel:"
+	// jobCancelPollInterval is how often jobs check for a cancellation flag, and how often a
+	// cancellation waits for a job run by another instance to stop.
+	jobCancelPollInterval = time.Second
+)
+
+var (
+	// ErrJobNotFound is returned for a job that does not exist or whose state has expired.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned when cancelling a job that has already finished.
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// JobConfig configures the jobs that run bulk requests in the background. Zero values are
+// replaced by defaults.
+type JobConfig struct {
+	// RedisAddr is the Redis server job states are kept in, localhost:6379 by default.
+	RedisAddr string `json:"redis_addr"`
+	// TTLSeconds is how long the state of a job is kept after its last change, a day by default.
+	TTLSeconds int `json:"ttl_seconds"`
+	// TimeoutSeconds bounds the Keycloak calls of a job, 30 minutes by default. A job is further
+	// bounded by the lifetime of the token it was started with, as its calls are made with it.
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// Concurrency is how many jobs run at once, 2 by default. Further jobs wait queued.
+	Concurrency int `json:"concurrency"`
+	// SpoolDir is the directory request bodies are kept in until their job has run, the system's
+	// temporary directory by default.
+	SpoolDir string `json:"spool_dir"`
+	// MaxBodyBytes bounds the request body of a job, 1 GiB by default.
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+}
+
+// Job is the state of a request run in the background. Operation is the route of the request,
+// and Result the response body it was answered with, once the job has finished. The result of
+// a cancelled job reports the work done before it was cancelled.
+type Job struct {
+	ID         string          `json:"id"`
+	Operation  string          `json:"operation"`
+	Realm      string          `json:"realm"`
+	Actor      string          `json:"actor"`
+	State      string          `json:"state"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+}
+
+// JobWork runs the request of a job under ctx and returns the HTTP status and body of its response.
+type JobWork func(ctx context.Context) (status int, body []byte)
+
+// JobRunner runs jobs in the background, a bounded number at a time, keeping their state in
+// Redis so that any instance of the service can report on and cancel them.
+type JobRunner struct {
+	cfg     JobConfig
+	redis   *redis.Client
+	slots   chan struct{}
+	running atomic.Int64
+
+	// mu guards local and the state of its jobs, so that a cancellation either reaches a job
+	// before its work returns or finds it finished
+	mu    sync.Mutex
+	local map[string]*localJob
+}
+
+// localJob is a job queued or running on this instance. It stays listed until its final state
+// has been recorded.
+type localJob struct {
+	cancel    context.CancelFunc
+	cancelled bool
+	finished  bool
+	done      chan struct{}
+}
+
+// NewJobRunner creates a JobRunner for the given configuration.
+func NewJobRunner(cfg JobConfig) *JobRunner {
+	if cfg.RedisAddr == "" {
+		cfg.RedisAddr = "localhost:6379"
+	}
+	if cfg.TTLSeconds <= 0 {
+		cfg.TTLSeconds = 24 * 60 * 60
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 30 * 60
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 2
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 1 << 30
+	}
+	return &JobRunner{
+		cfg:   cfg,
+		redis: redis.NewClient(&redis.Options{Addr: cfg.RedisAddr}),
+		slots: make(chan struct{}, cfg.Concurrency),
+		local: map[string]*localJob{},
+	}
+}
+
+// Timeout returns the timeout of the Keycloak calls of a job.
+func (r *JobRunner) Timeout() time.Duration {
+	return time.Duration(r.cfg.TimeoutSeconds) * time.Second
+}
+
+// TimeoutFor returns the timeout of the Keycloak calls of a job made with token: the configured
+// timeout, or the time left before token expires if that is sooner, as calls made with an expired
+// token are refused anyway.
+func (r *JobRunner) TimeoutFor(token string) time.Duration {
+	timeout := r.Timeout()
+	if expiresIn, ok := TokenExpiresIn(token); ok && expiresIn < timeout {
+		timeout = max(expiresIn, 0)
+	}
+	return timeout
+}
+
+// MaxBodyBytes returns the largest request body a job is run with.
+func (r *JobRunner) MaxBodyBytes() int64 {
+	return r.cfg.MaxBodyBytes
+}
+
+// SpoolBody copies body to a new file in the spool directory, for a job to read once it runs,
+// and returns the file's name. Bodies are kept on disk rather than in memory, as those of bulk
+// imports may be large. The file is removed if copying fails.
+func (r *JobRunner) SpoolBody(body io.Reader) (string, error) {
+	file, err := os.CreateTemp(r.cfg.SpoolDir, "idshield-job-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// Running returns the number of jobs currently running.
+func (r *JobRunner) Running() int64 {
+	return r.running.Load()
+}
+
+// Enqueue gives job a new ID, records it as queued and runs work in the background once a
+// slot is free, under a context bounded by timeout from now. Once the job has finished, whether
+// or not work ran, release is called, if not nil, to free what the job held, such as its spooled
+// body. Enqueue fails, running nothing and leaving release uncalled, if the job cannot be recorded.
+func (r *JobRunner) Enqueue(ctx context.Context, job *Job, timeout time.Duration, work JobWork, release func()) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	job.ID = hex.EncodeToString(id)
+	job.State = JobQueued
+	job.CreatedAt = time.Now().UTC()
+	if err := r.save(ctx, job); err != nil {
+		return err
+	}
+
+	jobCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	local := &localJob{cancel: cancel, done: make(chan struct{})}
+	r.mu.Lock()
+	r.local[job.ID] = local
+	r.mu.Unlock()
+
+	queued := *job
+	go r.run(jobCtx, local, &queued, work, release)
+	return nil
+}
+
+// Cancel cancels the job with the given ID, wherever it runs, stopping its further Keycloak
+// calls, and returns the job once it has stopped, marked cancelled with the result of the
+// work it completed. If the job does not stop before ctx is done, it is returned as last
+// recorded. Cancelling a job that has already finished fails with ErrJobFinished, along with
+// the job as it finished.
+func (r *JobRunner) Cancel(ctx context.Context, id string) (*Job, error) {
+	r.mu.Lock()
+	local, ok := r.local[id]
+	signalled := ok && r.signal(local)
+	r.mu.Unlock()
+	if ok {
+		select {
+		case <-local.done:
+		case <-ctx.Done():
+		}
+		job, err := r.Get(ctx, id)
+		if err == nil && !signalled {
+			// The job's work returned before the cancellation reached it
+			return job, ErrJobFinished
+		}
+		return job, err
+	}
+
+	// The job is not on this instance, so it is flagged for the instance running it to notice
+	job, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.finished() {
+		return job, ErrJobFinished
+	}
+	if err := r.redis.Set(ctx, jobCancelKeyPrefix+id, "1", time.Duration(r.cfg.TTLSeconds)*time.Second).Err(); err != nil {
+		return nil, err
+	}
+	ticker := time.NewTicker(jobCancelPollInterval)
+	defer ticker.Stop()
+	for !job.finished() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return job, nil
+		}
+		if latest, err := r.Get(ctx, id); err == nil {
+			job = latest
+		}
+	}
+	if job.State != JobCancelled {
+		// The job finished before noticing the flag
+		return job, ErrJobFinished
+	}
+	return job, nil
+}
+
+// Get returns the job with the given ID, or ErrJobNotFound.
+func (r *JobRunner) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := r.redis.Get(ctx, jobKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// run waits for a free slot, then runs work under ctx and records its outcome. A job cancelled
+// while queued is never run. release is called in either case, before the outcome is recorded.
+func (r *JobRunner) run(ctx context.Context, local *localJob, job *Job, work JobWork, release func()) {
+	defer close(local.done)
+	defer local.cancel()
+	go r.watchCancelFlag(ctx, local, job.ID)
+
+	var status int
+	var body []byte
+	select {
+	case r.slots <- struct{}{}:
+		r.running.Add(1)
+		started := time.Now().UTC()
+		job.State, job.StartedAt = JobRunning, &started
+		r.record(job)
+
+		status, body = runWork(ctx, job.ID, work)
+
+		r.running.Add(-1)
+		<-r.slots
+	case <-ctx.Done():
+	}
+	if release != nil {
+		release()
+	}
+
+	// Whether the job was cancelled is settled under the lock, so that a cancellation arriving
+	// from now on finds it finished
+	r.mu.Lock()
+	local.finished = true
+	cancelled := local.cancelled
+	r.mu.Unlock()
+
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	switch {
+	case cancelled:
+		job.State = JobCancelled
+	case status == 0 || status >= http.StatusBadRequest:
+		job.State = JobFailed
+	default:
+		job.State = JobDone
+	}
+	if json.Valid(body) {
+		job.Result = body
+	}
+	r.record(job)
+
+	r.mu.Lock()
+	delete(r.local, job.ID)
+	r.mu.Unlock()
+}
+
+// runWork runs work under ctx. A panic fails the job with internal_error, as a panicking
+// request would have been answered, rather than bringing down the service.
+func runWork(ctx context.Context, id string, work JobWork) (status int, body []byte) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("[jobs] job %s panicked: %v\n%s", id, recovered, debug.Stack())
+			status = http.StatusInternalServerError
+			body, _ = json.Marshal(ErrorResponse("internal_error", ""))
+		}
+	}()
+	return work(ctx)
+}
+
+// signal cancels a local job whose work has not returned yet, reporting whether it did. The
+// caller holds mu.
+func (r *JobRunner) signal(local *localJob) bool {
+	if local.finished {
+		return false
+	}
+	local.cancelled = true
+	local.cancel()
+	return true
+}
+
+// watchCancelFlag cancels a local job once another instance flags it to be cancelled, until
+// ctx is done.
+func (r *JobRunner) watchCancelFlag(ctx context.Context, local *localJob, id string) {
+	ticker := time.NewTicker(jobCancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if n, err := r.redis.Exists(ctx, jobCancelKeyPrefix+id).Result(); err == nil && n > 0 {
+			r.mu.Lock()
+			r.signal(local)
+			r.mu.Unlock()
+			return
+		}
+	}
+}
+
+// finished reports whether the job has reached a final state.
+func (j *Job) finished() bool {
+	return j.State == JobDone || j.State == JobFailed || j.State == JobCancelled
+}
+
+// record saves the state of a running job. Redis being unreachable does not stop the job, so
+// the failure is only logged.
+func (r *JobRunner) record(job *Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout())
+	defer cancel()
+	if err := r.save(ctx, job); err != nil {
+		log.Printf("[jobs] could not record job %s as %s: %v", job.ID, job.State, err)
+	}
+}
+
+// save stores the state of job, to expire after the configured TTL.
+func (r *JobRunner) save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return r.redis.Set(ctx, jobKeyPrefix+job.ID, data, time.Duration(r.cfg.TTLSeconds)*time.Second).Err()
+}
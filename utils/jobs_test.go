@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+func TestRunWorkRecoversPanic(t *testing.T) {
+	status, body := runWork(context.Background(), "job-id", func(context.Context) (int, []byte) {
+		var groups map[string][]string
+		groups["sales"] = nil // panics
+		return http.StatusOK, nil
+	})
+	if status != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", status, http.StatusInternalServerError)
+	}
+	var response wscutils.Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("body is not the standard envelope: %v: %s", err, body)
+	}
+	if len(response.Messages) != 1 || response.Messages[0].ErrCode != "internal_error" {
+		t.Errorf("messages = %+v, want a single internal_error", response.Messages)
+	}
+}
+
+func TestRunWorkPassesResponseOn(t *testing.T) {
+	status, body := runWork(context.Background(), "job-id", func(context.Context) (int, []byte) {
+		return http.StatusOK, []byte(`{"status":"success"}`)
+	})
+	if status != http.StatusOK || string(body) != `{"status":"success"}` {
+		t.Errorf("runWork() = %d, %s, want the work's response", status, body)
+	}
+}
+
+// tokenExpiringIn returns an unsigned token whose exp claim is d from now.
+func tokenExpiringIn(d time.Duration) string {
+	payload := fmt.Sprintf(`{"sub":"asha","exp":%d}`, time.Now().Add(d).Unix())
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestJobRunnerTimeoutFor(t *testing.T) {
+	runner := NewJobRunner(JobConfig{TimeoutSeconds: 30 * 60})
+	tests := []struct {
+		name  string
+		token string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "token outlives timeout", token: tokenExpiringIn(time.Hour), min: 30 * time.Minute, max: 30 * time.Minute},
+		{name: "token expires first", token: tokenExpiringIn(5 * time.Minute), min: 4 * time.Minute, max: 5 * time.Minute},
+		{name: "token expired", token: tokenExpiringIn(-time.Minute), min: 0, max: 0},
+		{name: "token without expiry", token: "e30.e30.sig", min: 30 * time.Minute, max: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runner.TimeoutFor(tt.token); got < tt.min || got > tt.max {
+				t.Errorf("TimeoutFor() = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
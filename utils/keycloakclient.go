@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// KeycloakClient is the subset of the gocloak client used by the handlers. Handlers depend
+// on this interface rather than on *gocloak.GoCloak so that they can be unit tested
+// against a mock such as keycloakmock.Client.
+type KeycloakClient interface {
+	// Raw requests, for Keycloak resources gocloak does not wrap
+	GetRequest(ctx context.Context) *resty.Request
+	GetRequestWithBearerAuth(ctx context.Context, token string) *resty.Request
+
+	// Tokens
+	RevokeToken(ctx context.Context, realm, clientID, clientSecret, refreshToken string) error
+	DecodeAccessToken(ctx context.Context, accessToken, realm string) (*jwt.Token, *jwt.MapClaims, error)
+
+	// Server
+	GetServerInfo(ctx context.Context, accessToken string) (*gocloak.ServerInfoRepresentation, error)
+
+	// Realms
+	GetRealm(ctx context.Context, token, realm string) (*gocloak.RealmRepresentation, error)
+	UpdateRealm(ctx context.Context, token string, realm gocloak.RealmRepresentation) error
+
+	// Groups
+	CreateGroup(ctx context.Context, token, realm string, group gocloak.Group) (string, error)
+	CreateChildGroup(ctx context.Context, token, realm, groupID string, group gocloak.Group) (string, error)
+	DeleteGroup(ctx context.Context, token, realm, groupID string) error
+	UpdateGroup(ctx context.Context, token, realm string, updatedGroup gocloak.Group) error
+	GetGroup(ctx context.Context, token, realm, groupID string) (*gocloak.Group, error)
+	GetGroupByPath(ctx context.Context, token, realm, groupPath string) (*gocloak.Group, error)
+	GetGroups(ctx context.Context, token, realm string, params gocloak.GetGroupsParams) ([]*gocloak.Group, error)
+	GetGroupMembers(ctx context.Context, token, realm, groupID string, params gocloak.GetGroupsParams) ([]*gocloak.User, error)
+	GetRoleMappingByGroupID(ctx context.Context, token, realm, groupID string) (*gocloak.MappingsRepresentation, error)
+	AddRealmRoleToGroup(ctx context.Context, token, realm, groupID string, roles []gocloak.Role) error
+	DeleteRealmRoleFromGroup(ctx context.Context, token, realm, groupID string, roles []gocloak.Role) error
+	AddClientRolesToGroup(ctx context.Context, token, realm, idOfClient, groupID string, roles []gocloak.Role) error
+	DeleteClientRoleFromGroup(ctx context.Context, token, realm, idOfClient, groupID string, roles []gocloak.Role) error
+
+	// Users
+	CreateUser(ctx context.Context, token, realm string, user gocloak.User) (string, error)
+	GetUsers(ctx context.Context, token, realm string, params gocloak.GetUsersParams) ([]*gocloak.User, error)
+	GetUserCount(ctx context.Context, token string, realm string, params gocloak.GetUsersParams) (int, error)
+	GetUserByID(ctx context.Context, accessToken, realm, userID string) (*gocloak.User, error)
+	UpdateUser(ctx context.Context, accessToken, realm string, user gocloak.User) error
+	DeleteUser(ctx context.Context, token, realm, userID string) error
+	ExecuteActionsEmail(ctx context.Context, token, realm string, params gocloak.ExecuteActionsEmail) error
+	GetUserGroups(ctx context.Context, token, realm, userID string, params gocloak.GetGroupsParams) ([]*gocloak.Group, error)
+	AddUserToGroup(ctx context.Context, token, realm, userID, groupID string) error
+	DeleteUserFromGroup(ctx context.Context, token, realm, userID, groupID string) error
+	GetRoleMappingByUserID(ctx context.Context, token, realm, userID string) (*gocloak.MappingsRepresentation, error)
+	GetCredentials(ctx context.Context, token, realm, userID string) ([]*gocloak.CredentialRepresentation, error)
+	DeleteCredentials(ctx context.Context, token, realm, userID, credentialID string) error
+	GetUserSessions(ctx context.Context, token, realm, userID string) ([]*gocloak.UserSessionRepresentation, error)
+
+	// Identity providers and federated identities
+	GetIdentityProvider(ctx context.Context, token, realm, alias string) (*gocloak.IdentityProviderRepresentation, error)
+	GetUserFederatedIdentities(ctx context.Context, token, realm, userID string) ([]*gocloak.FederatedIdentityRepresentation, error)
+	CreateUserFederatedIdentity(ctx context.Context, token, realm, userID, providerID string, federatedIdentityRep gocloak.FederatedIdentityRepresentation) error
+	DeleteUserFederatedIdentity(ctx context.Context, token, realm, userID, providerID string) error
+
+	// Roles
+	GetRealmRole(ctx context.Context, token, realm, roleName string) (*gocloak.Role, error)
+	GetCompositeRolesByRoleID(ctx context.Context, token, realm, roleID string) ([]*gocloak.Role, error)
+
+	// Clients and client roles
+	GetClients(ctx context.Context, accessToken, realm string, params gocloak.GetClientsParams) ([]*gocloak.Client, error)
+	GetClient(ctx context.Context, token, realm, idOfClient string) (*gocloak.Client, error)
+	GetClientRole(ctx context.Context, token, realm, idOfClient, roleName string) (*gocloak.Role, error)
+	AddClientRolesToUser(ctx context.Context, token, realm, idOfClient, userID string, roles []gocloak.Role) error
+	GetCompositeClientRolesByUserID(ctx context.Context, token, realm, idOfClient, userID string) ([]*gocloak.Role, error)
+
+	// Client scopes
+	GetClientScopes(ctx context.Context, token, realm string) ([]*gocloak.ClientScope, error)
+	CreateClientScope(ctx context.Context, token, realm string, scope gocloak.ClientScope) (string, error)
+	AddDefaultScopeToClient(ctx context.Context, token, realm, idOfClient, scopeID string) error
+	AddOptionalScopeToClient(ctx context.Context, token, realm, idOfClient, scopeID string) error
+}
+
+// The real gocloak client must always satisfy KeycloakClient.
+var _ KeycloakClient = (*gocloak.GoCloak)(nil)
@@ -0,0 +1,468 @@
+// Package keycloakmock provides a mock implementation of utils.KeycloakClient for unit
+// testing handlers without a running Keycloak.
+package keycloakmock
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// ErrNotMocked is returned by every method whose function field has not been set.
+var ErrNotMocked = errors.New("keycloakmock: method not mocked")
+
+// Client is a mock utils.KeycloakClient. Each method delegates to the function field of
+// the same name with a Func suffix, and returns ErrNotMocked when that field is nil.
+// GetRequest and GetRequestWithBearerAuth instead default to plain resty requests, so that
+// handlers calling Keycloak's REST API directly can be tested against an httptest server given
+// as their Keycloak URL. Keep it in sync with utils.KeycloakClient.
+type Client struct {
+	GetRequestFunc                      func(context.Context) *resty.Request
+	GetRequestWithBearerAuthFunc        func(context.Context, string) *resty.Request
+	RevokeTokenFunc                     func(context.Context, string, string, string, string) error
+	DecodeAccessTokenFunc               func(context.Context, string, string) (*jwt.Token, *jwt.MapClaims, error)
+	GetServerInfoFunc                   func(context.Context, string) (*gocloak.ServerInfoRepresentation, error)
+	GetRealmFunc                        func(context.Context, string, string) (*gocloak.RealmRepresentation, error)
+	UpdateRealmFunc                     func(context.Context, string, gocloak.RealmRepresentation) error
+	CreateGroupFunc                     func(context.Context, string, string, gocloak.Group) (string, error)
+	CreateChildGroupFunc                func(context.Context, string, string, string, gocloak.Group) (string, error)
+	DeleteGroupFunc                     func(context.Context, string, string, string) error
+	UpdateGroupFunc                     func(context.Context, string, string, gocloak.Group) error
+	GetGroupFunc                        func(context.Context, string, string, string) (*gocloak.Group, error)
+	GetGroupByPathFunc                  func(context.Context, string, string, string) (*gocloak.Group, error)
+	GetGroupsFunc                       func(context.Context, string, string, gocloak.GetGroupsParams) ([]*gocloak.Group, error)
+	GetGroupMembersFunc                 func(context.Context, string, string, string, gocloak.GetGroupsParams) ([]*gocloak.User, error)
+	GetRoleMappingByGroupIDFunc         func(context.Context, string, string, string) (*gocloak.MappingsRepresentation, error)
+	AddRealmRoleToGroupFunc             func(context.Context, string, string, string, []gocloak.Role) error
+	DeleteRealmRoleFromGroupFunc        func(context.Context, string, string, string, []gocloak.Role) error
+	AddClientRolesToGroupFunc           func(context.Context, string, string, string, string, []gocloak.Role) error
+	DeleteClientRoleFromGroupFunc       func(context.Context, string, string, string, string, []gocloak.Role) error
+	CreateUserFunc                      func(context.Context, string, string, gocloak.User) (string, error)
+	GetUsersFunc                        func(context.Context, string, string, gocloak.GetUsersParams) ([]*gocloak.User, error)
+	GetUserCountFunc                    func(context.Context, string, string, gocloak.GetUsersParams) (int, error)
+	GetUserByIDFunc                     func(context.Context, string, string, string) (*gocloak.User, error)
+	UpdateUserFunc                      func(context.Context, string, string, gocloak.User) error
+	DeleteUserFunc                      func(context.Context, string, string, string) error
+	ExecuteActionsEmailFunc             func(context.Context, string, string, gocloak.ExecuteActionsEmail) error
+	GetUserGroupsFunc                   func(context.Context, string, string, string, gocloak.GetGroupsParams) ([]*gocloak.Group, error)
+	AddUserToGroupFunc                  func(context.Context, string, string, string, string) error
+	DeleteUserFromGroupFunc             func(context.Context, string, string, string, string) error
+	GetRoleMappingByUserIDFunc          func(context.Context, string, string, string) (*gocloak.MappingsRepresentation, error)
+	GetCredentialsFunc                  func(context.Context, string, string, string) ([]*gocloak.CredentialRepresentation, error)
+	DeleteCredentialsFunc               func(context.Context, string, string, string, string) error
+	GetUserSessionsFunc                 func(context.Context, string, string, string) ([]*gocloak.UserSessionRepresentation, error)
+	GetIdentityProviderFunc             func(context.Context, string, string, string) (*gocloak.IdentityProviderRepresentation, error)
+	GetUserFederatedIdentitiesFunc      func(context.Context, string, string, string) ([]*gocloak.FederatedIdentityRepresentation, error)
+	CreateUserFederatedIdentityFunc     func(context.Context, string, string, string, string, gocloak.FederatedIdentityRepresentation) error
+	DeleteUserFederatedIdentityFunc     func(context.Context, string, string, string, string) error
+	GetRealmRoleFunc                    func(context.Context, string, string, string) (*gocloak.Role, error)
+	GetCompositeRolesByRoleIDFunc       func(context.Context, string, string, string) ([]*gocloak.Role, error)
+	GetClientsFunc                      func(context.Context, string, string, gocloak.GetClientsParams) ([]*gocloak.Client, error)
+	GetClientFunc                       func(context.Context, string, string, string) (*gocloak.Client, error)
+	GetClientRoleFunc                   func(context.Context, string, string, string, string) (*gocloak.Role, error)
+	AddClientRolesToUserFunc            func(context.Context, string, string, string, string, []gocloak.Role) error
+	GetCompositeClientRolesByUserIDFunc func(context.Context, string, string, string, string) ([]*gocloak.Role, error)
+	GetClientScopesFunc                 func(context.Context, string, string) ([]*gocloak.ClientScope, error)
+	CreateClientScopeFunc               func(context.Context, string, string, gocloak.ClientScope) (string, error)
+	AddDefaultScopeToClientFunc         func(context.Context, string, string, string, string) error
+	AddOptionalScopeToClientFunc        func(context.Context, string, string, string, string) error
+}
+
+// Client must always satisfy utils.KeycloakClient.
+var _ utils.KeycloakClient = (*Client)(nil)
+
+// GetRequest calls GetRequestFunc.
+func (m *Client) GetRequest(ctx context.Context) *resty.Request {
+	if m.GetRequestFunc == nil {
+		return resty.New().R().SetContext(ctx)
+	}
+	return m.GetRequestFunc(ctx)
+}
+
+// GetRequestWithBearerAuth calls GetRequestWithBearerAuthFunc.
+func (m *Client) GetRequestWithBearerAuth(ctx context.Context, token string) *resty.Request {
+	if m.GetRequestWithBearerAuthFunc == nil {
+		return resty.New().R().SetContext(ctx).SetAuthToken(token)
+	}
+	return m.GetRequestWithBearerAuthFunc(ctx, token)
+}
+
+// RevokeToken calls RevokeTokenFunc.
+func (m *Client) RevokeToken(ctx context.Context, realm string, clientID string, clientSecret string, refreshToken string) error {
+	if m.RevokeTokenFunc == nil {
+		return ErrNotMocked
+	}
+	return m.RevokeTokenFunc(ctx, realm, clientID, clientSecret, refreshToken)
+}
+
+// DecodeAccessToken calls DecodeAccessTokenFunc.
+func (m *Client) DecodeAccessToken(ctx context.Context, accessToken string, realm string) (*jwt.Token, *jwt.MapClaims, error) {
+	if m.DecodeAccessTokenFunc == nil {
+		return nil, nil, ErrNotMocked
+	}
+	return m.DecodeAccessTokenFunc(ctx, accessToken, realm)
+}
+
+// GetServerInfo calls GetServerInfoFunc.
+func (m *Client) GetServerInfo(ctx context.Context, accessToken string) (*gocloak.ServerInfoRepresentation, error) {
+	if m.GetServerInfoFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetServerInfoFunc(ctx, accessToken)
+}
+
+// GetRealm calls GetRealmFunc.
+func (m *Client) GetRealm(ctx context.Context, token string, realm string) (*gocloak.RealmRepresentation, error) {
+	if m.GetRealmFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetRealmFunc(ctx, token, realm)
+}
+
+// UpdateRealm calls UpdateRealmFunc.
+func (m *Client) UpdateRealm(ctx context.Context, token string, realm gocloak.RealmRepresentation) error {
+	if m.UpdateRealmFunc == nil {
+		return ErrNotMocked
+	}
+	return m.UpdateRealmFunc(ctx, token, realm)
+}
+
+// CreateGroup calls CreateGroupFunc.
+func (m *Client) CreateGroup(ctx context.Context, token string, realm string, group gocloak.Group) (string, error) {
+	if m.CreateGroupFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.CreateGroupFunc(ctx, token, realm, group)
+}
+
+// CreateChildGroup calls CreateChildGroupFunc.
+func (m *Client) CreateChildGroup(ctx context.Context, token string, realm string, groupID string, group gocloak.Group) (string, error) {
+	if m.CreateChildGroupFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.CreateChildGroupFunc(ctx, token, realm, groupID, group)
+}
+
+// DeleteGroup calls DeleteGroupFunc.
+func (m *Client) DeleteGroup(ctx context.Context, token string, realm string, groupID string) error {
+	if m.DeleteGroupFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteGroupFunc(ctx, token, realm, groupID)
+}
+
+// UpdateGroup calls UpdateGroupFunc.
+func (m *Client) UpdateGroup(ctx context.Context, token string, realm string, updatedGroup gocloak.Group) error {
+	if m.UpdateGroupFunc == nil {
+		return ErrNotMocked
+	}
+	return m.UpdateGroupFunc(ctx, token, realm, updatedGroup)
+}
+
+// GetGroup calls GetGroupFunc.
+func (m *Client) GetGroup(ctx context.Context, token string, realm string, groupID string) (*gocloak.Group, error) {
+	if m.GetGroupFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetGroupFunc(ctx, token, realm, groupID)
+}
+
+// GetGroupByPath calls GetGroupByPathFunc.
+func (m *Client) GetGroupByPath(ctx context.Context, token string, realm string, groupPath string) (*gocloak.Group, error) {
+	if m.GetGroupByPathFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetGroupByPathFunc(ctx, token, realm, groupPath)
+}
+
+// GetGroups calls GetGroupsFunc.
+func (m *Client) GetGroups(ctx context.Context, token string, realm string, params gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+	if m.GetGroupsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetGroupsFunc(ctx, token, realm, params)
+}
+
+// GetGroupMembers calls GetGroupMembersFunc.
+func (m *Client) GetGroupMembers(ctx context.Context, token string, realm string, groupID string, params gocloak.GetGroupsParams) ([]*gocloak.User, error) {
+	if m.GetGroupMembersFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetGroupMembersFunc(ctx, token, realm, groupID, params)
+}
+
+// GetRoleMappingByGroupID calls GetRoleMappingByGroupIDFunc.
+func (m *Client) GetRoleMappingByGroupID(ctx context.Context, token string, realm string, groupID string) (*gocloak.MappingsRepresentation, error) {
+	if m.GetRoleMappingByGroupIDFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetRoleMappingByGroupIDFunc(ctx, token, realm, groupID)
+}
+
+// AddRealmRoleToGroup calls AddRealmRoleToGroupFunc.
+func (m *Client) AddRealmRoleToGroup(ctx context.Context, token string, realm string, groupID string, roles []gocloak.Role) error {
+	if m.AddRealmRoleToGroupFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AddRealmRoleToGroupFunc(ctx, token, realm, groupID, roles)
+}
+
+// DeleteRealmRoleFromGroup calls DeleteRealmRoleFromGroupFunc.
+func (m *Client) DeleteRealmRoleFromGroup(ctx context.Context, token string, realm string, groupID string, roles []gocloak.Role) error {
+	if m.DeleteRealmRoleFromGroupFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteRealmRoleFromGroupFunc(ctx, token, realm, groupID, roles)
+}
+
+// AddClientRolesToGroup calls AddClientRolesToGroupFunc.
+func (m *Client) AddClientRolesToGroup(ctx context.Context, token string, realm string, idOfClient string, groupID string, roles []gocloak.Role) error {
+	if m.AddClientRolesToGroupFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AddClientRolesToGroupFunc(ctx, token, realm, idOfClient, groupID, roles)
+}
+
+// DeleteClientRoleFromGroup calls DeleteClientRoleFromGroupFunc.
+func (m *Client) DeleteClientRoleFromGroup(ctx context.Context, token string, realm string, idOfClient string, groupID string, roles []gocloak.Role) error {
+	if m.DeleteClientRoleFromGroupFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteClientRoleFromGroupFunc(ctx, token, realm, idOfClient, groupID, roles)
+}
+
+// CreateUser calls CreateUserFunc.
+func (m *Client) CreateUser(ctx context.Context, token string, realm string, user gocloak.User) (string, error) {
+	if m.CreateUserFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.CreateUserFunc(ctx, token, realm, user)
+}
+
+// GetUsers calls GetUsersFunc.
+func (m *Client) GetUsers(ctx context.Context, token string, realm string, params gocloak.GetUsersParams) ([]*gocloak.User, error) {
+	if m.GetUsersFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetUsersFunc(ctx, token, realm, params)
+}
+
+// GetUserCount calls GetUserCountFunc.
+func (m *Client) GetUserCount(ctx context.Context, token string, realm string, params gocloak.GetUsersParams) (int, error) {
+	if m.GetUserCountFunc == nil {
+		return 0, ErrNotMocked
+	}
+	return m.GetUserCountFunc(ctx, token, realm, params)
+}
+
+// GetUserByID calls GetUserByIDFunc.
+func (m *Client) GetUserByID(ctx context.Context, accessToken string, realm string, userID string) (*gocloak.User, error) {
+	if m.GetUserByIDFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetUserByIDFunc(ctx, accessToken, realm, userID)
+}
+
+// UpdateUser calls UpdateUserFunc.
+func (m *Client) UpdateUser(ctx context.Context, accessToken string, realm string, user gocloak.User) error {
+	if m.UpdateUserFunc == nil {
+		return ErrNotMocked
+	}
+	return m.UpdateUserFunc(ctx, accessToken, realm, user)
+}
+
+// DeleteUser calls DeleteUserFunc.
+func (m *Client) DeleteUser(ctx context.Context, token string, realm string, userID string) error {
+	if m.DeleteUserFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteUserFunc(ctx, token, realm, userID)
+}
+
+// ExecuteActionsEmail calls ExecuteActionsEmailFunc.
+func (m *Client) ExecuteActionsEmail(ctx context.Context, token string, realm string, params gocloak.ExecuteActionsEmail) error {
+	if m.ExecuteActionsEmailFunc == nil {
+		return ErrNotMocked
+	}
+	return m.ExecuteActionsEmailFunc(ctx, token, realm, params)
+}
+
+// GetUserGroups calls GetUserGroupsFunc.
+func (m *Client) GetUserGroups(ctx context.Context, token string, realm string, userID string, params gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+	if m.GetUserGroupsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetUserGroupsFunc(ctx, token, realm, userID, params)
+}
+
+// AddUserToGroup calls AddUserToGroupFunc.
+func (m *Client) AddUserToGroup(ctx context.Context, token string, realm string, userID string, groupID string) error {
+	if m.AddUserToGroupFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AddUserToGroupFunc(ctx, token, realm, userID, groupID)
+}
+
+// DeleteUserFromGroup calls DeleteUserFromGroupFunc.
+func (m *Client) DeleteUserFromGroup(ctx context.Context, token string, realm string, userID string, groupID string) error {
+	if m.DeleteUserFromGroupFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteUserFromGroupFunc(ctx, token, realm, userID, groupID)
+}
+
+// GetRoleMappingByUserID calls GetRoleMappingByUserIDFunc.
+func (m *Client) GetRoleMappingByUserID(ctx context.Context, token string, realm string, userID string) (*gocloak.MappingsRepresentation, error) {
+	if m.GetRoleMappingByUserIDFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetRoleMappingByUserIDFunc(ctx, token, realm, userID)
+}
+
+// GetCredentials calls GetCredentialsFunc.
+func (m *Client) GetCredentials(ctx context.Context, token string, realm string, userID string) ([]*gocloak.CredentialRepresentation, error) {
+	if m.GetCredentialsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetCredentialsFunc(ctx, token, realm, userID)
+}
+
+// DeleteCredentials calls DeleteCredentialsFunc.
+func (m *Client) DeleteCredentials(ctx context.Context, token string, realm string, userID string, credentialID string) error {
+	if m.DeleteCredentialsFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteCredentialsFunc(ctx, token, realm, userID, credentialID)
+}
+
+// GetUserSessions calls GetUserSessionsFunc.
+func (m *Client) GetUserSessions(ctx context.Context, token string, realm string, userID string) ([]*gocloak.UserSessionRepresentation, error) {
+	if m.GetUserSessionsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetUserSessionsFunc(ctx, token, realm, userID)
+}
+
+// GetIdentityProvider calls GetIdentityProviderFunc.
+func (m *Client) GetIdentityProvider(ctx context.Context, token string, realm string, alias string) (*gocloak.IdentityProviderRepresentation, error) {
+	if m.GetIdentityProviderFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetIdentityProviderFunc(ctx, token, realm, alias)
+}
+
+// GetUserFederatedIdentities calls GetUserFederatedIdentitiesFunc.
+func (m *Client) GetUserFederatedIdentities(ctx context.Context, token string, realm string, userID string) ([]*gocloak.FederatedIdentityRepresentation, error) {
+	if m.GetUserFederatedIdentitiesFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetUserFederatedIdentitiesFunc(ctx, token, realm, userID)
+}
+
+// CreateUserFederatedIdentity calls CreateUserFederatedIdentityFunc.
+func (m *Client) CreateUserFederatedIdentity(ctx context.Context, token string, realm string, userID string, providerID string, federatedIdentityRep gocloak.FederatedIdentityRepresentation) error {
+	if m.CreateUserFederatedIdentityFunc == nil {
+		return ErrNotMocked
+	}
+	return m.CreateUserFederatedIdentityFunc(ctx, token, realm, userID, providerID, federatedIdentityRep)
+}
+
+// DeleteUserFederatedIdentity calls DeleteUserFederatedIdentityFunc.
+func (m *Client) DeleteUserFederatedIdentity(ctx context.Context, token string, realm string, userID string, providerID string) error {
+	if m.DeleteUserFederatedIdentityFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteUserFederatedIdentityFunc(ctx, token, realm, userID, providerID)
+}
+
+// GetRealmRole calls GetRealmRoleFunc.
+func (m *Client) GetRealmRole(ctx context.Context, token string, realm string, roleName string) (*gocloak.Role, error) {
+	if m.GetRealmRoleFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetRealmRoleFunc(ctx, token, realm, roleName)
+}
+
+// GetCompositeRolesByRoleID calls GetCompositeRolesByRoleIDFunc.
+func (m *Client) GetCompositeRolesByRoleID(ctx context.Context, token string, realm string, roleID string) ([]*gocloak.Role, error) {
+	if m.GetCompositeRolesByRoleIDFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetCompositeRolesByRoleIDFunc(ctx, token, realm, roleID)
+}
+
+// GetClients calls GetClientsFunc.
+func (m *Client) GetClients(ctx context.Context, accessToken string, realm string, params gocloak.GetClientsParams) ([]*gocloak.Client, error) {
+	if m.GetClientsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetClientsFunc(ctx, accessToken, realm, params)
+}
+
+// GetClient calls GetClientFunc.
+func (m *Client) GetClient(ctx context.Context, token string, realm string, idOfClient string) (*gocloak.Client, error) {
+	if m.GetClientFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetClientFunc(ctx, token, realm, idOfClient)
+}
+
+// GetClientRole calls GetClientRoleFunc.
+func (m *Client) GetClientRole(ctx context.Context, token string, realm string, idOfClient string, roleName string) (*gocloak.Role, error) {
+	if m.GetClientRoleFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetClientRoleFunc(ctx, token, realm, idOfClient, roleName)
+}
+
+// AddClientRolesToUser calls AddClientRolesToUserFunc.
+func (m *Client) AddClientRolesToUser(ctx context.Context, token string, realm string, idOfClient string, userID string, roles []gocloak.Role) error {
+	if m.AddClientRolesToUserFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AddClientRolesToUserFunc(ctx, token, realm, idOfClient, userID, roles)
+}
+
+// GetCompositeClientRolesByUserID calls GetCompositeClientRolesByUserIDFunc.
+func (m *Client) GetCompositeClientRolesByUserID(ctx context.Context, token string, realm string, idOfClient string, userID string) ([]*gocloak.Role, error) {
+	if m.GetCompositeClientRolesByUserIDFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetCompositeClientRolesByUserIDFunc(ctx, token, realm, idOfClient, userID)
+}
+
+// GetClientScopes calls GetClientScopesFunc.
+func (m *Client) GetClientScopes(ctx context.Context, token string, realm string) ([]*gocloak.ClientScope, error) {
+	if m.GetClientScopesFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetClientScopesFunc(ctx, token, realm)
+}
+
+// CreateClientScope calls CreateClientScopeFunc.
+func (m *Client) CreateClientScope(ctx context.Context, token string, realm string, scope gocloak.ClientScope) (string, error) {
+	if m.CreateClientScopeFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.CreateClientScopeFunc(ctx, token, realm, scope)
+}
+
+// AddDefaultScopeToClient calls AddDefaultScopeToClientFunc.
+func (m *Client) AddDefaultScopeToClient(ctx context.Context, token string, realm string, idOfClient string, scopeID string) error {
+	if m.AddDefaultScopeToClientFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AddDefaultScopeToClientFunc(ctx, token, realm, idOfClient, scopeID)
+}
+
+// AddOptionalScopeToClient calls AddOptionalScopeToClientFunc.
+func (m *Client) AddOptionalScopeToClient(ctx context.Context, token string, realm string, idOfClient string, scopeID string) error {
+	if m.AddOptionalScopeToClientFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AddOptionalScopeToClientFunc(ctx, token, realm, idOfClient, scopeID)
+}
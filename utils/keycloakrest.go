@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/go-resty/resty/v2"
+)
+
+// KeycloakAdminURL builds the URL of a Keycloak admin REST resource that gocloak does not
+// wrap, e.g. KeycloakAdminURL(base, realm, "admin-events").
+func KeycloakAdminURL(keycloakURL, realm string, path ...string) string {
+	parts := append([]string{strings.TrimRight(keycloakURL, "/"), "admin", "realms", realm}, path...)
+	return strings.Join(parts, "/")
+}
+
+// KeycloakRealmURL builds the URL of a public Keycloak realm resource, e.g.
+// KeycloakRealmURL(base, realm, ".well-known", "openid-configuration").
+func KeycloakRealmURL(keycloakURL, realm string, path ...string) string {
+	parts := append([]string{strings.TrimRight(keycloakURL, "/"), "realms", realm}, path...)
+	return strings.Join(parts, "/")
+}
+
+// CheckKeycloakResponse converts the outcome of a raw resty call to Keycloak into an
+// error shaped like the ones gocloak returns, so KeycloakErrorCode can be applied to it.
+func CheckKeycloakResponse(resp *resty.Response, err error) error {
+	if err != nil {
+		return &gocloak.APIError{Code: 0, Message: err.Error()}
+	}
+	if resp == nil {
+		return &gocloak.APIError{Message: "empty response"}
+	}
+	if resp.IsError() {
+		return &gocloak.APIError{Code: resp.StatusCode(), Message: resp.Status()}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+)
+
+// keycloakTimingsContextKey is the gin context key under which the Keycloak call timings of a
+// request are stored.
+const keycloakTimingsContextKey = "keycloakTimings"
+
+// KeycloakTimings sums up the Keycloak calls made for a single request. The zero value is ready
+// to use, and all methods of a nil KeycloakTimings are no-ops.
+type KeycloakTimings struct {
+	mu      sync.Mutex
+	calls   int
+	total   time.Duration
+	slowest string
+	longest time.Duration
+}
+
+// KeycloakTimingsSummary is a snapshot of the Keycloak calls made for a request, in a form fit
+// for logging. Slowest names the call that took longest, as its method and URL.
+type KeycloakTimingsSummary struct {
+	Calls     int    `json:"calls"`
+	TotalMs   int64  `json:"totalMs"`
+	Slowest   string `json:"slowest,omitempty"`
+	SlowestMs int64  `json:"slowestMs,omitempty"`
+}
+
+// StartKeycloakTimings records the Keycloak calls made with contexts derived from c from now on,
+// and returns their timings.
+func StartKeycloakTimings(c *gin.Context) *KeycloakTimings {
+	timings := &KeycloakTimings{}
+	c.Set(keycloakTimingsContextKey, timings)
+	return timings
+}
+
+// record adds a single call to the timings.
+func (t *KeycloakTimings) record(call string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls++
+	t.total += duration
+	if duration > t.longest {
+		t.slowest, t.longest = call, duration
+	}
+}
+
+// Summary returns a snapshot of the timings.
+func (t *KeycloakTimings) Summary() KeycloakTimingsSummary {
+	if t == nil {
+		return KeycloakTimingsSummary{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return KeycloakTimingsSummary{
+		Calls:     t.calls,
+		TotalMs:   t.total.Milliseconds(),
+		Slowest:   t.slowest,
+		SlowestMs: t.longest.Milliseconds(),
+	}
+}
+
+// keycloakTimingsFromContext returns the timings of the request ctx belongs to, if any.
+func keycloakTimingsFromContext(ctx context.Context) *KeycloakTimings {
+	if ctx == nil {
+		return nil
+	}
+	timings, _ := ctx.Value(keycloakTimingsContextKey).(*KeycloakTimings)
+	return timings
+}
+
+// AttachKeycloakTimings times every call made through client, adding it to the timings of the
+// request found in the call's context. Calls rejected before being sent are not counted.
+func AttachKeycloakTimings(client *resty.Client) {
+	client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		keycloakTimingsFromContext(resp.Request.Context()).record(resp.Request.Method+" "+resp.Request.URL, resp.Time())
+		return nil
+	})
+	client.OnError(func(r *resty.Request, err error) {
+		var respErr *resty.ResponseError
+		if errors.As(err, &respErr) || r.Time.IsZero() {
+			// already counted when the response came in, or never sent
+			return
+		}
+		keycloakTimingsFromContext(r.Context()).record(r.Method+" "+r.URL, time.Since(r.Time))
+	})
+}
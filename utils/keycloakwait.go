@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+// KeycloakWaitConfig configures waiting at startup for Keycloak to become reachable, for
+// deployments that may start idshield before Keycloak is ready. Zero values are replaced by
+// defaults.
+type KeycloakWaitConfig struct {
+	// Enabled makes idshield wait for Keycloak before serving; it does not wait by default.
+	Enabled bool `json:"enabled"`
+	// MaxAttempts is how many times Keycloak is tried before giving up; 30 by default.
+	MaxAttempts int `json:"max_attempts"`
+	// IntervalSeconds is the pause between attempts; 2 by default.
+	IntervalSeconds int `json:"interval_seconds"`
+	// TimeoutSeconds bounds the whole wait, whatever attempts remain; 120 by default.
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// WaitForKeycloak tries until Keycloak answers for realm, logging each failed attempt, and
+// returns an error once cfg's attempts or timeout run out. Any answer short of a server error
+// counts, so that a misconfigured realm is left for the checks that follow to report. It
+// returns at once when waiting is not enabled.
+func WaitForKeycloak(client *gocloak.GoCloak, realm string, cfg KeycloakWaitConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 30
+	}
+	if cfg.IntervalSeconds <= 0 {
+		cfg.IntervalSeconds = 2
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 120
+	}
+	deadline := time.Now().Add(time.Duration(cfg.TimeoutSeconds) * time.Second)
+
+	var err error
+	for attempt := 1; attempt <= cfg.MaxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), min(DefaultRequestTimeout(), time.Until(deadline)))
+		_, err = client.GetIssuer(ctx, realm)
+		cancel()
+		if keycloakAnswered(err) {
+			if attempt > 1 {
+				log.Printf("Keycloak reachable after %d attempts", attempt)
+			}
+			return nil
+		}
+		log.Printf("Waiting for Keycloak: attempt %d of %d failed: %v", attempt, cfg.MaxAttempts, err)
+		if attempt == cfg.MaxAttempts || time.Until(deadline) < time.Duration(cfg.IntervalSeconds)*time.Second {
+			break
+		}
+		time.Sleep(time.Duration(cfg.IntervalSeconds) * time.Second)
+	}
+	return fmt.Errorf("keycloak not reachable after waiting: %w", err)
+}
+
+// keycloakAnswered reports whether err, returned by a Keycloak call, still shows Keycloak to
+// be up and answering.
+func keycloakAnswered(err error) bool {
+	var apiErr *gocloak.APIError
+	if err == nil {
+		return true
+	}
+	return errors.As(err, &apiErr) && apiErr.Code > 0 && apiErr.Code < http.StatusInternalServerError
+}
@@ -0,0 +1,47 @@
+package utils
+
+import "sync"
+
+var (
+	membershipHooksMu sync.RWMutex
+	// membershipHooks are called whenever idshield changes the members of a group.
+	membershipHooks []func(realm, groupID string)
+	// groupsHooks are called whenever idshield creates, changes or deletes groups.
+	groupsHooks []func(realm string)
+)
+
+// OnGroupMembershipChange registers hook to be called with the realm and ID of a group whenever
+// idshield changes its members, so that services can drop what they cached about it.
+func OnGroupMembershipChange(hook func(realm, groupID string)) {
+	membershipHooksMu.Lock()
+	defer membershipHooksMu.Unlock()
+	membershipHooks = append(membershipHooks, hook)
+}
+
+// GroupMembershipChanged calls the registered hooks for a group whose members have changed,
+// including a group that has been deleted. Handlers changing group membership must call it.
+func GroupMembershipChanged(realm, groupID string) {
+	membershipHooksMu.RLock()
+	defer membershipHooksMu.RUnlock()
+	for _, hook := range membershipHooks {
+		hook(realm, groupID)
+	}
+}
+
+// OnGroupsChange registers hook to be called with a realm whenever idshield creates, changes or
+// deletes groups or capabilities in it, so that services can drop what they cached about them.
+func OnGroupsChange(hook func(realm string)) {
+	membershipHooksMu.Lock()
+	defer membershipHooksMu.Unlock()
+	groupsHooks = append(groupsHooks, hook)
+}
+
+// GroupsChanged calls the registered hooks for a realm whose groups or capabilities have been
+// created, changed or deleted. Handlers changing groups must call it.
+func GroupsChanged(realm string) {
+	membershipHooksMu.RLock()
+	defer membershipHooksMu.RUnlock()
+	for _, hook := range groupsHooks {
+		hook(realm)
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+// MergePatchContentType is the media type of JSON merge patch request bodies.
+const MergePatchContentType = "application/merge-patch+json"
+
+// MergePatch applies a JSON merge patch (RFC 7386) to target, both decoded from JSON into the
+// generic form encoding/json produces, and returns the result. Members of a patch object
+// replace those of the target object, null members delete them, and nested objects are merged
+// in turn; any other patch replaces the target as a whole. target is left untouched.
+func MergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	result := map[string]any{}
+	if targetObj, ok := target.(map[string]any); ok {
+		for key, value := range targetObj {
+			result[key] = value
+		}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = MergePatch(result[key], value)
+	}
+	return result
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// messageCatalogs holds the translations of validation messages, keyed by language and then
+// by the English message, in the manner of gettext message IDs. English needs no catalog.
+var messageCatalogs = map[string]map[string]string{}
+
+// LoadMessageCatalogs loads every <language>.json file in dir, e.g. "hi.json", each holding a
+// JSON object mapping English messages to their translation. An empty dir loads nothing.
+func LoadMessageCatalogs(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	catalogs := make(map[string]map[string]string, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("reading message catalog %s: %w", file, err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return fmt.Errorf("parsing message catalog %s: %w", file, err)
+		}
+		lang := strings.ToLower(strings.TrimSuffix(filepath.Base(file), ".json"))
+		catalogs[lang] = catalog
+	}
+	messageCatalogs = catalogs
+	return nil
+}
+
+// RequestLanguages returns the languages a request asks for, most preferred first: the lang
+// query parameter if given, otherwise the languages of the Accept-Language header by quality.
+func RequestLanguages(c *gin.Context) []string {
+	if lang := c.Query("lang"); lang != "" {
+		return []string{strings.ToLower(lang)}
+	}
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		langs = append(langs, weighted{strings.ToLower(tag), q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	result := make([]string, 0, len(langs))
+	for _, l := range langs {
+		result = append(result, l.lang)
+	}
+	return result
+}
+
+// requestCatalog returns the catalog of the most preferred language with one, trying each
+// language as given (e.g. "pt-br") and then by its primary subtag (e.g. "pt").
+func requestCatalog(c *gin.Context) map[string]string {
+	if len(messageCatalogs) == 0 {
+		return nil
+	}
+	for _, lang := range RequestLanguages(c) {
+		if lang == "en" || strings.HasPrefix(lang, "en-") {
+			return nil
+		}
+		if catalog, ok := messageCatalogs[lang]; ok {
+			return catalog
+		}
+		primary, _, _ := strings.Cut(lang, "-")
+		if catalog, ok := messageCatalogs[primary]; ok {
+			return catalog
+		}
+	}
+	return nil
+}
+
+// LocalizeMessages translates the vals of messages into the language the request asks for.
+// Vals with no translation are left in English.
+func LocalizeMessages(c *gin.Context, messages []wscutils.ErrorMessage) []wscutils.ErrorMessage {
+	catalog := requestCatalog(c)
+	if catalog == nil {
+		return messages
+	}
+	localized := make([]wscutils.ErrorMessage, len(messages))
+	for i, message := range messages {
+		localized[i] = message
+		if len(message.Vals) == 0 {
+			continue
+		}
+		localized[i].Vals = make([]string, len(message.Vals))
+		for j, val := range message.Vals {
+			if translated, ok := catalog[val]; ok {
+				val = translated
+			}
+			localized[i].Vals[j] = val
+		}
+	}
+	return localized
+}
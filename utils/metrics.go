@@ -0,0 +1,28 @@
+package utils
+
+import "sync"
+
+var (
+	metricsMu sync.RWMutex
+	// metricGauges holds, for each registered metric, a function reporting its current value.
+	metricGauges = map[string]func() any{}
+)
+
+// RegisterMetric registers a metric whose current value is reported by gauge
+// whenever the metrics endpoint is queried.
+func RegisterMetric(name string, gauge func() any) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricGauges[name] = gauge
+}
+
+// MetricsSnapshot returns the current value of every registered metric.
+func MetricsSnapshot() map[string]any {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	snapshot := make(map[string]any, len(metricGauges))
+	for name, gauge := range metricGauges {
+		snapshot[name] = gauge()
+	}
+	return snapshot
+}
@@ -0,0 +1,23 @@
+package utils
+
+// CollectPages calls fetch for successive pages of pageSize items, starting at offset 0,
+// until a short page is returned or limit items have been gathered. A non-positive limit
+// means no limit. If fetch fails part way through, the items gathered so far are returned
+// along with the error, so that callers may choose to return partial results.
+func CollectPages[T any](pageSize, limit int, fetch func(first, max int) ([]T, error)) ([]T, error) {
+	var items []T
+	for first := 0; limit <= 0 || first < limit; first += pageSize {
+		page, err := fetch(first, pageSize)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, page...)
+		if len(page) < pageSize {
+			break
+		}
+	}
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// problemTypeBase prefixes the error code in the type URI of a problem.
+const problemTypeBase = "urn:idshield:error:"
+
+// Problem is an RFC 7807 problem details object. Errors is an extension member carrying every
+// message of the error response, of which the problem describes the first, and Data another
+// carrying the data of the few error responses that have any.
+type Problem struct {
+	Type     string                  `json:"type"`
+	Title    string                  `json:"title"`
+	Status   int                     `json:"status"`
+	Detail   string                  `json:"detail,omitempty"`
+	Instance string                  `json:"instance"`
+	Errors   []wscutils.ErrorMessage `json:"errors,omitempty"`
+	Data     any                     `json:"data,omitempty"`
+}
+
+// problemTitles overrides the title of problems for error codes that do not read well once
+// humanized.
+var problemTitles = map[string]string{
+	"unknown":            "Internal error",
+	"Unauthorized":       "Unauthorized",
+	"Forbidden":          "Forbidden",
+	"name already exist": "Name already exists",
+	"token_missing":      "Missing bearer token",
+}
+
+// WantsProblemJSON reports whether a request's Accept header asks for problem details.
+func WantsProblemJSON(c *gin.Context) bool {
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != ProblemContentType {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// NewProblem maps the messages of an error response to a problem. Its type and title derive
+// from the error code of the first message and its detail from that message's field and vals.
+func NewProblem(c *gin.Context, status int, messages []wscutils.ErrorMessage) Problem {
+	problem := Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Instance: c.Request.URL.Path, Errors: messages}
+	if len(messages) == 0 {
+		return problem
+	}
+	msg := messages[0]
+	problem.Type = problemTypeBase + strings.ReplaceAll(msg.ErrCode, " ", "_")
+	problem.Title = problemTitle(msg.ErrCode)
+	problem.Detail = strings.Join(msg.Vals, "; ")
+	if msg.Field != nil {
+		if problem.Detail == "" {
+			problem.Detail = "invalid " + *msg.Field
+		} else {
+			problem.Detail = *msg.Field + ": " + problem.Detail
+		}
+	}
+	return problem
+}
+
+// problemTitle returns the title of problems with the given error code, e.g. "Group not
+// found" for group_not_found.
+func problemTitle(errcode string) string {
+	if title, ok := problemTitles[errcode]; ok {
+		return title
+	}
+	title := strings.ReplaceAll(errcode, "_", " ")
+	if title == "" {
+		return title
+	}
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+// sendProblem sends an error response as problem details.
+func sendProblem(c *gin.Context, status int, response *wscutils.Response) {
+	problem := NewProblem(c, status, response.Messages)
+	problem.Data = response.Data
+	body, err := json.Marshal(problem)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, ProblemContentType, body)
+}
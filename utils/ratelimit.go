@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// keycloakRetryAfterContextKey is the gin context key under which the wait Keycloak asked
+	// for when it last rate limited a call made for the request is stored.
+	keycloakRetryAfterContextKey = "keycloakRetryAfter"
+	// defaultRateLimitWait is the wait assumed when Keycloak rate limits a call without saying
+	// how long to wait.
+	defaultRateLimitWait = time.Second
+)
+
+// RateLimitRetry handles Keycloak rejecting calls with 429 Too Many Requests. A rejected call is
+// tried once more after waiting as long as the Retry-After header asks, provided that is no longer
+// than the configured maximum and the call's deadline leaves room for it. Otherwise the rejection
+// is returned, and the wait Keycloak asked for is kept so that the response to the request can
+// pass it on.
+type RateLimitRetry struct {
+	maxWait  time.Duration
+	retried  atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewRateLimitRetry creates a RateLimitRetry waiting at most maxWaitSeconds, 5 by default. A
+// negative maxWaitSeconds never waits, so that every rejection is returned at once.
+func NewRateLimitRetry(maxWaitSeconds int) *RateLimitRetry {
+	if maxWaitSeconds == 0 {
+		maxWaitSeconds = 5
+	}
+	if maxWaitSeconds < 0 {
+		maxWaitSeconds = 0
+	}
+	return &RateLimitRetry{maxWait: time.Duration(maxWaitSeconds) * time.Second}
+}
+
+// Retried returns the number of rate limited calls tried again.
+func (r *RateLimitRetry) Retried() int64 {
+	return r.retried.Load()
+}
+
+// Rejected returns the number of rate limited calls given up on.
+func (r *RateLimitRetry) Rejected() int64 {
+	return r.rejected.Load()
+}
+
+// Attach installs the retry on a resty client, such as the one used by gocloak. Only rate
+// limited calls are retried; other failures are returned as before.
+func (r *RateLimitRetry) Attach(client *resty.Client) {
+	client.SetRetryCount(1).
+		SetRetryMaxWaitTime(r.maxWait).
+		SetRetryAfter(func(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+			return retryAfter(resp), nil
+		}).
+		AddRetryCondition(func(resp *resty.Response, _ error) bool {
+			if resp == nil || resp.StatusCode() != http.StatusTooManyRequests {
+				return false
+			}
+			wait := retryAfter(resp)
+			ctx := resp.Request.Context()
+			if resp.Request.Attempt == 1 && r.maxWait > 0 && wait <= r.maxWait && fitsDeadline(ctx, wait) {
+				r.retried.Add(1)
+				return true
+			}
+			r.rejected.Add(1)
+			if c, ok := ctx.Value(gin.ContextKey).(*gin.Context); ok {
+				c.Set(keycloakRetryAfterContextKey, wait)
+			}
+			return false
+		})
+}
+
+// KeycloakRetryAfter returns how long Keycloak asked to wait when it last rate limited a call
+// made for the request of c.
+func KeycloakRetryAfter(c *gin.Context) (time.Duration, bool) {
+	value, ok := c.Get(keycloakRetryAfterContextKey)
+	if !ok {
+		return 0, false
+	}
+	wait, ok := value.(time.Duration)
+	return wait, ok
+}
+
+// retryAfterSeconds formats a wait as the whole number of seconds of a Retry-After header,
+// rounding up.
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// retryAfter returns the wait asked for by the Retry-After header of a response, given either
+// in seconds or as a date, or defaultRateLimitWait if it has none.
+func retryAfter(resp *resty.Response) time.Duration {
+	header := resp.Header().Get("Retry-After")
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return defaultRateLimitWait
+}
+
+// fitsDeadline reports whether waiting for wait leaves ctx some time before its deadline.
+func fitsDeadline(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > wait
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitingKeycloak returns a server answering the first limited calls with 429 and the given
+// Retry-After, and the others with no groups, along with the number of calls it got.
+func rateLimitingKeycloak(t *testing.T, limited int64, retryAfter string) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) <= limited {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestRateLimitRetryWithinMaxWait(t *testing.T) {
+	server, calls := rateLimitingKeycloak(t, 1, "1")
+	client := gocloak.NewClient(server.URL)
+	retry := NewRateLimitRetry(2)
+	retry.Attach(client.RestyClient())
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/group-tree", nil)
+	ctx, cancel := RequestContext(c)
+	defer cancel()
+
+	if _, err := client.GetGroups(ctx, "token", "test", gocloak.GetGroupsParams{}); err != nil {
+		t.Fatalf("GetGroups() failed after a retry: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Keycloak got %d calls, want 2", got)
+	}
+	if retry.Retried() != 1 || retry.Rejected() != 0 {
+		t.Errorf("retried %d and rejected %d calls, want 1 and 0", retry.Retried(), retry.Rejected())
+	}
+	if _, ok := KeycloakRetryAfter(c); ok {
+		t.Error("wait recorded for a call that succeeded")
+	}
+}
+
+func TestRateLimitRetryBeyondMaxWait(t *testing.T) {
+	server, calls := rateLimitingKeycloak(t, 1, "30")
+	client := gocloak.NewClient(server.URL)
+	retry := NewRateLimitRetry(2)
+	retry.Attach(client.RestyClient())
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/group-tree", nil)
+	ctx, cancel := RequestContext(c)
+	defer cancel()
+
+	_, err := client.GetGroups(ctx, "token", "test", gocloak.GetGroupsParams{})
+	if err == nil {
+		t.Fatal("GetGroups() succeeded, want the rate limit returned")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Keycloak got %d calls, want 1", got)
+	}
+	if retry.Retried() != 0 || retry.Rejected() != 1 {
+		t.Errorf("retried %d and rejected %d calls, want 0 and 1", retry.Retried(), retry.Rejected())
+	}
+
+	code := KeycloakErrorCode(err, "group_not_found")
+	if code != "keycloak_rate_limited" {
+		t.Fatalf("error code = %q, want keycloak_rate_limited", code)
+	}
+	SendErrorResponse(c, ErrorResponse(code, ""))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want the 30 seconds Keycloak asked for", got)
+	}
+}
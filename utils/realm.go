@@ -0,0 +1,16 @@
+package utils
+
+import "github.com/gin-gonic/gin"
+
+// realmContextKey is the gin context key under which the resolved realm is stored.
+const realmContextKey = "realm"
+
+// SetRealm records the realm a request targets in its context.
+func SetRealm(c *gin.Context, realm string) {
+	c.Set(realmContextKey, realm)
+}
+
+// GetRealm returns the realm a request targets, as resolved by the realm middleware.
+func GetRealm(c *gin.Context) string {
+	return c.GetString(realmContextKey)
+}
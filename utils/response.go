@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+const (
+	// DefaultPageSize is the page size used by list endpoints when max is not given.
+	DefaultPageSize = 100
+	// MaxPageSize is the largest page size list endpoints accept.
+	MaxPageSize = 1000
+)
+
+// ListMeta describes the page of results carried by a list response. Partial is set when
+// the results were cut short by an error, whose code is given in PartialReason.
+type ListMeta struct {
+	Total         int    `json:"total"`
+	First         int    `json:"first"`
+	Max           int    `json:"max"`
+	Next          string `json:"next,omitempty"`
+	Prev          string `json:"prev,omitempty"`
+	Partial       bool   `json:"partial,omitempty"`
+	PartialReason string `json:"partialReason,omitempty"`
+}
+
+// ResponseWithMeta is the standard wscutils response envelope with additional meta and
+// warnings sections, each left out when empty. Single object responses without warnings keep
+// using wscutils.Response.
+type ResponseWithMeta struct {
+	wscutils.Response
+	Meta     *ListMeta               `json:"meta,omitempty"`
+	Warnings []wscutils.ErrorMessage `json:"warnings,omitempty"`
+}
+
+// GetPageParams reads the first and max query parameters of a list request, applying
+// DefaultPageSize and MaxPageSize. It returns false if either is not a valid number.
+func GetPageParams(c *gin.Context) (first, max int, ok bool) {
+	first, max = 0, DefaultPageSize
+	var err error
+	if v := c.Query("first"); v != "" {
+		if first, err = strconv.Atoi(v); err != nil || first < 0 {
+			return 0, 0, false
+		}
+	}
+	if v := c.Query("max"); v != "" {
+		if max, err = strconv.Atoi(v); err != nil || max <= 0 {
+			return 0, 0, false
+		}
+	}
+	if max > MaxPageSize {
+		max = MaxPageSize
+	}
+	return first, max, true
+}
+
+// GetBriefParam reads the brief query parameter of a list request, which defaults to true.
+// Brief listings ask Keycloak for brief representations, leaving out attributes. It returns
+// false if the parameter is not a valid boolean.
+func GetBriefParam(c *gin.Context) (brief, ok bool) {
+	v := c.Query("brief")
+	if v == "" {
+		return true, true
+	}
+	brief, err := strconv.ParseBool(v)
+	return brief, err == nil
+}
+
+// GetRawParam reads the raw query parameter, which defaults to false. Raw requests get
+// Keycloak's own representation of groups or users instead of idshield's trimmed one. It
+// returns false if the parameter is not a valid boolean.
+func GetRawParam(c *gin.Context) (raw, ok bool) {
+	v := c.Query("raw")
+	if v == "" {
+		return false, true
+	}
+	raw, err := strconv.ParseBool(v)
+	return raw, err == nil
+}
+
+// GetSortParams reads the sort and order query parameters of a list request. sort must be one
+// of fields, and is empty when not given, leaving the endpoint's own order. order is asc (the
+// default) or desc. It returns false if either is not valid.
+func GetSortParams(c *gin.Context, fields ...string) (field string, desc, ok bool) {
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		return "", false, false
+	}
+	field = c.Query("sort")
+	if field == "" {
+		return "", desc, true
+	}
+	for _, f := range fields {
+		if f == field {
+			return field, desc, true
+		}
+	}
+	return "", false, false
+}
+
+// NewListMeta builds the meta section for a page of results, with next and prev links
+// pointing at the neighbouring pages of the current request URL. A negative total means
+// the total is unknown, in which case a next link is given whenever the page is full.
+func NewListMeta(c *gin.Context, total, first, max, pageLen int) ListMeta {
+	meta := ListMeta{Total: total, First: first, Max: max}
+	if (total >= 0 && first+pageLen < total) || (total < 0 && pageLen == max) {
+		meta.Next = pageLink(c, first+max, max)
+	}
+	if first > 0 {
+		prev := first - max
+		if prev < 0 {
+			prev = 0
+		}
+		meta.Prev = pageLink(c, prev, max)
+	}
+	return meta
+}
+
+// pageLink returns the current request URL with its first and max parameters replaced.
+func pageLink(c *gin.Context, first, max int) string {
+	u := *c.Request.URL
+	q := u.Query()
+	q.Set("first", strconv.Itoa(first))
+	q.Set("max", strconv.Itoa(max))
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// SendListResponse sends a success response carrying a page of results and its meta section.
+// Requests setting the link-pagination feature flag get the page links in a Link header too.
+func SendListResponse(c *gin.Context, data any, meta ListMeta) {
+	if FeatureEnabled(c, FeatureLinkPagination) {
+		var links []string
+		if meta.Next != "" {
+			links = append(links, "<"+meta.Next+`>; rel="next"`)
+		}
+		if meta.Prev != "" {
+			links = append(links, "<"+meta.Prev+`>; rel="prev"`)
+		}
+		if len(links) > 0 {
+			c.Header("Link", strings.Join(links, ", "))
+		}
+	}
+	c.JSON(http.StatusOK, ResponseWithMeta{
+		Response: wscutils.Response{Status: wscutils.SuccessStatus, Data: data},
+		Meta:     &meta,
+		Warnings: LocalizeMessages(c, Warnings(c)),
+	})
+}
+
+// SendSuccessResponse sends a success response carrying data along with any warnings raised
+// for the request. Without warnings, the response is the same as wscutils.SendSuccessResponse's.
+func SendSuccessResponse(c *gin.Context, data any) {
+	c.JSON(http.StatusOK, ResponseWithMeta{
+		Response: wscutils.Response{Status: wscutils.SuccessStatus, Data: data},
+		Warnings: LocalizeMessages(c, Warnings(c)),
+	})
+}
+
+// SendCreatedResponse sends a 201 success response carrying the created resource and any
+// warnings raised for the request, with a Location header pointing at it. location is
+// relative to the realm the request targets and is given the same leading realm segment as
+// the request, if any.
+func SendCreatedResponse(c *gin.Context, location string, data any) {
+	if realm := c.Param("realm"); realm != "" {
+		location = "/" + url.PathEscape(realm) + location
+	}
+	c.Header("Location", location)
+	c.JSON(http.StatusCreated, ResponseWithMeta{
+		Response: wscutils.Response{Status: wscutils.SuccessStatus, Data: data},
+		Warnings: LocalizeMessages(c, Warnings(c)),
+	})
+}
+
+// SendAcceptedResponse sends a 202 success response for a request accepted to be carried out
+// in the background, with a Location header pointing at where its progress can be followed.
+// location is given the request's leading realm segment as with SendCreatedResponse.
+func SendAcceptedResponse(c *gin.Context, location string, data any) {
+	if realm := c.Param("realm"); realm != "" {
+		location = "/" + url.PathEscape(realm) + location
+	}
+	c.Header("Location", location)
+	c.JSON(http.StatusAccepted, ResponseWithMeta{
+		Response: wscutils.Response{Status: wscutils.SuccessStatus, Data: data},
+		Warnings: LocalizeMessages(c, Warnings(c)),
+	})
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+// MaxCompositeDepth is the deepest chain of composite roles that is expanded. Roles below
+// it are left out and the expansion is flagged as truncated.
+const MaxCompositeDepth = 10
+
+// RoleExpander collects roles and expands composite roles breadth first, visiting every
+// role at most once so that cycles between composites terminate.
+type RoleExpander struct {
+	ctx     context.Context
+	client  KeycloakClient
+	token   string
+	realm   string
+	roles   map[string]gocloak.Role // keyed by role ID
+	pending []gocloak.Role
+	// Truncated is set when composite roles nested deeper than MaxCompositeDepth were left out
+	Truncated bool
+}
+
+// NewRoleExpander creates an empty RoleExpander for roles of realm.
+func NewRoleExpander(ctx context.Context, client KeycloakClient, token, realm string) *RoleExpander {
+	return &RoleExpander{ctx: ctx, client: client, token: token, realm: realm, roles: map[string]gocloak.Role{}}
+}
+
+// Add records a role, queueing it for expansion if it is new and composite.
+func (e *RoleExpander) Add(role gocloak.Role) {
+	if role.ID == nil {
+		return
+	}
+	if _, ok := e.roles[*role.ID]; ok {
+		return
+	}
+	e.roles[*role.ID] = role
+	if gocloak.PBool(role.Composite) {
+		e.pending = append(e.pending, role)
+	}
+}
+
+// AddMappings records every realm and client role of a role mapping.
+func (e *RoleExpander) AddMappings(mappings *gocloak.MappingsRepresentation) {
+	if mappings == nil {
+		return
+	}
+	if mappings.RealmMappings != nil {
+		for _, role := range *mappings.RealmMappings {
+			e.Add(role)
+		}
+	}
+	for _, clientMappings := range mappings.ClientMappings {
+		if clientMappings == nil || clientMappings.Mappings == nil {
+			continue
+		}
+		for _, role := range *clientMappings.Mappings {
+			e.Add(role)
+		}
+	}
+}
+
+// Expand resolves the pending composite roles level by level, up to MaxCompositeDepth levels.
+func (e *RoleExpander) Expand() error {
+	for depth := 0; len(e.pending) > 0; depth++ {
+		if depth >= MaxCompositeDepth {
+			e.Truncated = true
+			return nil
+		}
+		level := e.pending
+		e.pending = nil
+		for _, role := range level {
+			composites, err := e.client.GetCompositeRolesByRoleID(e.ctx, e.token, e.realm, *role.ID)
+			if err != nil {
+				return err
+			}
+			for _, composite := range composites {
+				if composite != nil {
+					e.Add(*composite)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RoleNames returns the sorted names of the collected realm roles, and, when withClientRoles
+// is set, of the collected client roles keyed by the client ID of the client owning them.
+func (e *RoleExpander) RoleNames(withClientRoles bool) (realmRoles []string, clientRoles map[string][]string, err error) {
+	realmRoles, clientRoles = []string{}, map[string][]string{}
+	clientIDs := map[string]string{}
+	for _, role := range e.roles {
+		if !gocloak.PBool(role.ClientRole) {
+			realmRoles = append(realmRoles, gocloak.PString(role.Name))
+			continue
+		}
+		if !withClientRoles {
+			continue
+		}
+		idOfClient := gocloak.PString(role.ContainerID)
+		clientID, ok := clientIDs[idOfClient]
+		if !ok {
+			kcClient, err := e.client.GetClient(e.ctx, e.token, e.realm, idOfClient)
+			if err != nil {
+				return nil, nil, err
+			}
+			clientID = gocloak.PString(kcClient.ClientID)
+			clientIDs[idOfClient] = clientID
+		}
+		clientRoles[clientID] = append(clientRoles[clientID], gocloak.PString(role.Name))
+	}
+	sort.Strings(realmRoles)
+	for _, names := range clientRoles {
+		sort.Strings(names)
+	}
+	return realmRoles, clientRoles, nil
+}
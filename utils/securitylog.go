@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// SecurityEventMarker is the field carrying the kind of a security event in the log entries
+// written by SecurityLog, so that log shippers can route them to a SIEM.
+const SecurityEventMarker = "securityEvent"
+
+// Kinds of security events logged through SecurityLog.
+const (
+	SecurityEventAuthorizationDenied = "authorization_denied"
+	SecurityEventTokenRevoked        = "token_revoked"
+	SecurityEventCredentialRemoved   = "credential_removed"
+	SecurityEventRoleGranted         = "role_granted"
+	SecurityEventIdentityLinked      = "federated_identity_linked"
+	SecurityEventIdentityUnlinked    = "federated_identity_unlinked"
+	SecurityEventRealmPolicyChanged  = "realm_policy_changed"
+)
+
+// SecurityLog logs a security relevant event of the request of c at Sec priority, above that of
+// routine activity logs, tagged with SecurityEventMarker. The entry names the caller, its address,
+// and the method and path of the request, along with details, which must never hold secrets such
+// as tokens or passwords.
+func SecurityLog(c *gin.Context, lh *logharbour.Logger, event string, details map[string]any) {
+	data := map[string]any{
+		SecurityEventMarker: event,
+		"method":            c.Request.Method,
+		"path":              c.Request.URL.Path,
+		"realm":             GetRealm(c),
+	}
+	for key, value := range details {
+		data[key] = value
+	}
+	who := ""
+	if token, err := router.ExtractToken(c.GetHeader("Authorization")); err == nil {
+		who = SubjectFromToken(token)
+	}
+	lh.Sec().WithWho(who).WithRemoteIP(c.ClientIP()).WithWhatClass("security").WithWhatInstanceId(event).
+		LogActivity("Security event: "+event, data)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+// RequiredManagementRoles lists the realm-management client roles idshield's operations need.
+var RequiredManagementRoles = []string{
+	"query-groups",
+	"view-users",
+	"manage-users",
+	"view-realm",
+	"manage-realm",
+	"view-clients",
+	"view-events",
+}
+
+// SelfTest checks that token, typically obtained for idshield's own service account, can do
+// what idshield needs in realm. It reads a single group and then looks for every role of
+// RequiredManagementRoles among the token's realm-management roles. It returns one problem
+// per failed check, naming what is missing.
+func SelfTest(ctx context.Context, client KeycloakClient, token, realm string) []string {
+	var problems []string
+	if _, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{Max: gocloak.IntP(1), BriefRepresentation: gocloak.BoolP(true)}); err != nil {
+		problems = append(problems, fmt.Sprintf("cannot list groups of realm %s (%s): %v", realm, KeycloakErrorCode(err, "realm_not_found"), err))
+	}
+
+	claims, err := TokenClaims(token)
+	if err != nil {
+		return append(problems, fmt.Sprintf("cannot read the roles of the token: %v", err))
+	}
+	granted := map[string]bool{}
+	access, _ := claims["resource_access"].(map[string]any)
+	management, _ := access["realm-management"].(map[string]any)
+	roles, _ := management["roles"].([]any)
+	for _, role := range roles {
+		if name, ok := role.(string); ok {
+			granted[name] = true
+		}
+	}
+	for _, role := range RequiredManagementRoles {
+		if !granted[role] {
+			problems = append(problems, fmt.Sprintf("missing realm-management role %s", role))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultRequestTimeout is the timeout of Keycloak calls made by routes with no timeout of their own.
+	defaultRequestTimeout = 10 * time.Second
+	// defaultMinClientTimeout and defaultMaxClientTimeout bound the timeouts clients ask for by default.
+	defaultMinClientTimeout = time.Second
+	defaultMaxClientTimeout = 5 * time.Minute
+	// clientTimeoutContextKey is the gin context key under which the timeout a client asked for is stored.
+	clientTimeoutContextKey = "clientTimeout"
+)
+
+var (
+	requestTimeout   = defaultRequestTimeout
+	routeTimeouts    = map[string]time.Duration{}
+	minClientTimeout = defaultMinClientTimeout
+	maxClientTimeout = defaultMaxClientTimeout
+)
+
+// SetRequestTimeouts sets the default timeout, in seconds, of the context handlers derive for
+// Keycloak calls, along with per route overrides keyed by route path (e.g. "/user-csv-import").
+// A non-positive default keeps the built in 10 seconds. Routes registered under a leading
+// realm segment share the timeout of their plain path.
+func SetRequestTimeouts(defaultSeconds int, routes map[string]int) error {
+	if defaultSeconds > 0 {
+		requestTimeout = time.Duration(defaultSeconds) * time.Second
+	}
+	timeouts := make(map[string]time.Duration, len(routes))
+	for route, seconds := range routes {
+		if seconds <= 0 {
+			return fmt.Errorf("timeout for route %s must be positive, got %d", route, seconds)
+		}
+		timeouts[route] = time.Duration(seconds) * time.Second
+	}
+	routeTimeouts = timeouts
+	return nil
+}
+
+// SetClientTimeoutBounds sets, in milliseconds, the shortest and longest timeouts a client may
+// ask for in place of its route's. A non-positive bound keeps the built in one, 1 second for the
+// shortest and 5 minutes for the longest.
+func SetClientTimeoutBounds(minMs, maxMs int) error {
+	min, max := defaultMinClientTimeout, defaultMaxClientTimeout
+	if minMs > 0 {
+		min = time.Duration(minMs) * time.Millisecond
+	}
+	if maxMs > 0 {
+		max = time.Duration(maxMs) * time.Millisecond
+	}
+	if min > max {
+		return fmt.Errorf("shortest client timeout %v exceeds the longest, %v", min, max)
+	}
+	minClientTimeout, maxClientTimeout = min, max
+	return nil
+}
+
+// ClampClientTimeout returns the timeout of ms milliseconds a client asked for, brought within
+// the configured bounds.
+func ClampClientTimeout(ms int64) time.Duration {
+	if ms <= 0 || ms < minClientTimeout.Milliseconds() {
+		return minClientTimeout
+	}
+	if ms > maxClientTimeout.Milliseconds() {
+		return maxClientTimeout
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// SetClientTimeout records the timeout a client asked for in the context of its request, to be
+// used instead of the one configured for the route.
+func SetClientTimeout(c *gin.Context, timeout time.Duration) {
+	c.Set(clientTimeoutContextKey, timeout)
+}
+
+// ValidateRouteTimeouts checks that every route with a configured timeout is registered on r.
+func ValidateRouteTimeouts(r *gin.Engine) error {
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		registered[route.Path] = true
+	}
+	for route := range routeTimeouts {
+		if !registered[route] {
+			return fmt.Errorf("timeout configured for unknown route %s", route)
+		}
+	}
+	return nil
+}
+
+// DefaultRequestTimeout returns the timeout used by routes with no timeout of their own.
+func DefaultRequestTimeout() time.Duration {
+	return requestTimeout
+}
+
+// RequestTimeout returns the timeout the client of c asked for, if any, and otherwise the one
+// configured for the route matched by c.
+func RequestTimeout(c *gin.Context) time.Duration {
+	if timeout, ok := c.Get(clientTimeoutContextKey); ok {
+		return timeout.(time.Duration)
+	}
+	route := strings.TrimPrefix(c.FullPath(), "/:realm")
+	if timeout, ok := routeTimeouts[route]; ok {
+		return timeout
+	}
+	return requestTimeout
+}
+
+// RequestContext derives the context for the Keycloak calls of a request, bounded by the
+// timeout its client asked for or, failing that, the one configured for its route.
+func RequestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c, RequestTimeout(c))
+}
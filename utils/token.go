@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TokenClaims returns the claims of a JWT without verifying its signature. Tokens that
+// reach the handlers have already been verified by the auth middleware.
+func TokenClaims(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload: %w", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	return claims, nil
+}
+
+// SubjectFromToken returns who a token was issued to, preferring the username over the
+// subject ID. It returns an empty string if the token cannot be decoded.
+func SubjectFromToken(token string) string {
+	claims, err := TokenClaims(token)
+	if err != nil {
+		return ""
+	}
+	if username, ok := claims["preferred_username"].(string); ok && username != "" {
+		return username
+	}
+	subject, _ := claims["sub"].(string)
+	return subject
+}
+
+// TokenExpiresIn returns how long is left until a token expires, according to its exp claim.
+// It reports false if the token cannot be decoded or carries no expiry.
+func TokenExpiresIn(token string) (time.Duration, bool) {
+	claims, err := TokenClaims(token)
+	if err != nil {
+		return 0, false
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return 0, false
+	}
+	return time.Until(time.Unix(int64(exp), 0)), true
+}
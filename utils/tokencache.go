@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/remiges-tech/alya/router"
+)
+
+// tokenCacheRetryInterval is how long the token cache is bypassed after it fails, before
+// it is tried again.
+const tokenCacheRetryInterval = 10 * time.Second
+
+// FallbackTokenCache wraps the token cache used by the auth middleware so that an unreachable
+// cache degrades to verifying every token directly, instead of failing every request.
+// After a failure the cache is bypassed for tokenCacheRetryInterval, then tried again, so
+// that caching resumes by itself once the cache recovers.
+type FallbackTokenCache struct {
+	cache router.TokenCache
+
+	mu        sync.Mutex
+	available bool
+	retryAt   time.Time
+}
+
+// NewFallbackTokenCache wraps cache in a FallbackTokenCache.
+func NewFallbackTokenCache(cache router.TokenCache) *FallbackTokenCache {
+	return &FallbackTokenCache{cache: cache, available: true}
+}
+
+// Available reports whether the token cache was reachable when last used.
+func (f *FallbackTokenCache) Available() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.available
+}
+
+// Check tries the cache, logging a warning if it is unreachable.
+func (f *FallbackTokenCache) Check() {
+	_, err := f.cache.Get("idshield-token-cache-check")
+	f.record(err)
+}
+
+// Get reports whether token is cached. While the cache is unavailable every token is
+// reported as not cached, so that the auth middleware verifies it.
+func (f *FallbackTokenCache) Get(token string) (bool, error) {
+	if !f.usable() {
+		return false, nil
+	}
+	cached, err := f.cache.Get(token)
+	f.record(err)
+	return cached && err == nil, nil
+}
+
+// Set caches token, unless the cache is unavailable.
+func (f *FallbackTokenCache) Set(token string) error {
+	if !f.usable() {
+		return nil
+	}
+	f.record(f.cache.Set(token))
+	return nil
+}
+
+// usable reports whether the cache should be tried, that is, whether it is available or
+// has been bypassed for long enough to try it again.
+func (f *FallbackTokenCache) usable() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.available || !time.Now().Before(f.retryAt)
+}
+
+// record updates the availability of the cache after a call to it, logging every change.
+func (f *FallbackTokenCache) record(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case err != nil:
+		if f.available {
+			log.Printf("[token cache] unavailable, verifying tokens directly: %v", err)
+		}
+		f.available = false
+		f.retryAt = time.Now().Add(tokenCacheRetryInterval)
+	case !f.available:
+		log.Printf("[token cache] available again, resuming caching")
+		f.available = true
+	}
+}
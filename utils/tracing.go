@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// spanContextKey is the gin context key under which the span of a request is stored.
+	spanContextKey = "span"
+	// errorCodeContextKey is the gin context key under which the error code of a failed request is stored.
+	errorCodeContextKey = "errorCode"
+)
+
+// TracingConfig holds the OpenTelemetry trace export settings. Zero values are replaced by defaults.
+type TracingConfig struct {
+	// Endpoint is the base URL of an OTLP/HTTP collector, e.g. http://localhost:4318.
+	// Tracing is off when empty.
+	Endpoint string `json:"endpoint"`
+	// Headers are sent with every export, e.g. to authenticate with the collector.
+	Headers map[string]string `json:"headers"`
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string `json:"service_name"`
+	// BatchSize is the largest number of spans sent in one export.
+	BatchSize int `json:"batch_size"`
+	// FlushSeconds is how often spans are exported when a batch does not fill up.
+	FlushSeconds int `json:"flush_seconds"`
+	// TimeoutSeconds bounds each export.
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// Tracer records spans through the OpenTelemetry SDK and exports them in batches in the
+// background. Trace context is propagated in the W3C traceparent and tracestate headers.
+// A nil Tracer records nothing, so that tracing can be left unconfigured.
+type Tracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	dropped    atomic.Int64
+}
+
+// NewTracer creates a Tracer exporting to the OTLP/HTTP collector of the given configuration,
+// or returns nil when no collector endpoint is configured.
+func NewTracer(cfg TracingConfig) *Tracer {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 10
+	}
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(cfg.Endpoint, "/")+"/v1/traces"),
+		otlptracehttp.WithHeaders(cfg.Headers),
+		otlptracehttp.WithTimeout(time.Duration(cfg.TimeoutSeconds)*time.Second),
+	)
+	if err != nil {
+		log.Printf("[tracing] tracing disabled, could not create exporter: %v", err)
+		return nil
+	}
+	return NewTracerWithExporter(cfg, exporter)
+}
+
+// NewTracerWithExporter creates a Tracer for the given configuration that hands its spans to
+// exporter, e.g. an in-memory exporter in tests. The configured endpoint is not used.
+func NewTracerWithExporter(cfg TracingConfig, exporter sdktrace.SpanExporter) *Tracer {
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "idshield"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.FlushSeconds <= 0 {
+		cfg.FlushSeconds = 5
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 10
+	}
+	t := &Tracer{propagator: propagation.TraceContext{}}
+	t.provider = sdktrace.NewTracerProvider(
+		// Traces the caller did not sample are propagated but not recorded
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+		sdktrace.WithBatcher(&countingExporter{SpanExporter: exporter, dropped: &t.dropped},
+			sdktrace.WithMaxExportBatchSize(cfg.BatchSize),
+			sdktrace.WithMaxQueueSize(4*cfg.BatchSize),
+			sdktrace.WithBatchTimeout(time.Duration(cfg.FlushSeconds)*time.Second),
+			sdktrace.WithExportTimeout(time.Duration(cfg.TimeoutSeconds)*time.Second),
+		),
+	)
+	t.tracer = t.provider.Tracer("github.com/remiges-tech/idshield")
+	return t
+}
+
+// Dropped returns the number of spans lost because an export failed.
+func (t *Tracer) Dropped() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+// Shutdown exports the spans still queued and stops the tracer.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// StartServerSpan starts the span of an incoming request, continuing the trace given in the
+// request's trace context headers, if any, or starting a new one. It returns nil when tracing
+// is off.
+func (t *Tracer) StartServerSpan(r *http.Request, name string) trace.Span {
+	if t == nil {
+		return nil
+	}
+	ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	_, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+	return span
+}
+
+// Attach makes every call made through client a child span of the span found in the call's
+// context, and propagates the trace to Keycloak in the traceparent and tracestate headers.
+// Calls rejected by hooks before being sent, such as by the circuit breaker, get no span.
+func (t *Tracer) Attach(client *resty.Client) {
+	if t == nil {
+		return
+	}
+	// The span of a request is kept in the gin context, where the SDK does not look for it
+	client.OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
+		if span := SpanFromContext(r.Context()); span != nil {
+			r.SetContext(trace.ContextWithSpan(r.Context(), span))
+		}
+		return nil
+	})
+	client.SetTransport(otelhttp.NewTransport(client.GetClient().Transport,
+		otelhttp.WithTracerProvider(t.provider),
+		otelhttp.WithPropagators(t.propagator),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+		// Calls made outside of any request, such as at startup, start no trace of their own
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return trace.SpanFromContext(r.Context()).SpanContext().IsValid()
+		}),
+	))
+}
+
+// SetRequestSpan records the span of a request in its context, making it the parent of
+// the Keycloak calls made with contexts derived from it.
+func SetRequestSpan(c *gin.Context, span trace.Span) {
+	c.Set(spanContextKey, span)
+}
+
+// SpanFromContext returns the span of the request ctx belongs to, if any.
+func SpanFromContext(ctx context.Context) trace.Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey).(trace.Span)
+	return span
+}
+
+// ResponseErrorCode returns the error code a request was answered with, if it failed.
+func ResponseErrorCode(c *gin.Context) string {
+	return c.GetString(errorCodeContextKey)
+}
+
+// countingExporter counts the spans of failed exports before passing on the error.
+type countingExporter struct {
+	sdktrace.SpanExporter
+	dropped *atomic.Int64
+}
+
+// ExportSpans exports spans, counting them as dropped if the export fails.
+func (e *countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		e.dropped.Add(int64(len(spans)))
+		log.Printf("[tracing] failed to export %d spans: %v", len(spans), err)
+	}
+	return err
+}
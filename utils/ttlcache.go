@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// TTLCache is a small in-memory cache whose entries expire after a fixed duration.
+// It is safe for concurrent use.
+type TTLCache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// NewTTLCache creates a TTLCache whose entries live for ttl.
+func NewTTLCache[V any](ttl time.Duration) *TTLCache[V] {
+	return &TTLCache[V]{
+		ttl:     ttl,
+		entries: make(map[string]ttlEntry[V]),
+	}
+}
+
+// Get returns the cached value for key if present and not expired.
+func (c *TTLCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Set stores value under key for the cache's ttl. Nothing is stored under the empty key, so
+// that a value CallerCacheKey found no key for is never served.
+func (c *TTLCache[V]) Set(key string, value V) {
+	if key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = ttlEntry[V]{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
+
+// Delete removes key from the cache.
+func (c *TTLCache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// DeletePrefix removes every entry whose key starts with prefix.
+func (c *TTLCache[V]) DeletePrefix(prefix string) {
+	c.DeleteFunc(func(key string, _ V) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// DeleteFunc removes every entry for which del returns true.
+func (c *TTLCache[V]) DeleteFunc(del func(key string, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if del(key, entry.value) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// CallerCacheKey returns the key under which what keyclock gave the caller holding token is
+// cached, made of the realm, the other parts and the caller's subject ID. keyclock decides what
+// each caller may see, so what it gave one caller must never be served to another. It returns an
+// empty key, under which nothing is cached, if the token names no subject.
+func CallerCacheKey(token, realm string, parts ...string) string {
+	claims, err := TokenClaims(token)
+	if err != nil {
+		return ""
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return ""
+	}
+	return strings.Join(append(append([]string{realm}, parts...), subject), "/")
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+// tokenFor returns an unsigned token with the given claims.
+func tokenFor(claims string) string {
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+}
+
+func TestCallerCacheKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "subject", token: tokenFor(`{"sub":"f3a1","preferred_username":"asha"}`), want: "test/sales/f3a1"},
+		{name: "no subject", token: tokenFor(`{"preferred_username":"asha"}`), want: ""},
+		{name: "malformed token", token: "token", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CallerCacheKey(tt.token, "test", "sales"); got != tt.want {
+				t.Errorf("CallerCacheKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTTLCacheByCaller(t *testing.T) {
+	cache := NewTTLCache[string](time.Minute)
+	asha := CallerCacheKey(tokenFor(`{"sub":"asha"}`), "test")
+	ravi := CallerCacheKey(tokenFor(`{"sub":"ravi"}`), "test")
+	cache.Set(asha, "everything")
+	cache.Set("", "nobody's")
+
+	if _, ok := cache.Get(ravi); ok {
+		t.Error("value cached for one caller served to another")
+	}
+	if _, ok := cache.Get(""); ok {
+		t.Error("value cached under the empty key")
+	}
+	if got, ok := cache.Get(asha); !ok || got != "everything" {
+		t.Errorf("Get() = %q, %v, want the caller's own value", got, ok)
+	}
+
+	cache.Set(CallerCacheKey(tokenFor(`{"sub":"asha"}`), "test2"), "other realm")
+	cache.DeletePrefix("test/")
+	if _, ok := cache.Get(asha); ok {
+		t.Error("value left after its realm was dropped")
+	}
+	if _, ok := cache.Get("test2/asha"); !ok {
+		t.Error("value of another realm dropped")
+	}
+}
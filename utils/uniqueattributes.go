@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// uniqueAttributes maps a realm to the group attributes whose values no two groups of the realm
+// may share.
+var uniqueAttributes = map[string][]string{}
+
+// SetUniqueAttributes sets the group attributes whose values must be unique, keyed by realm.
+func SetUniqueAttributes(attributes map[string][]string) {
+	uniqueAttributes = attributes
+}
+
+// UniqueAttributeConflicts checks the values attributes gives the unique attributes of realm
+// against every other group of the realm, the group at ownPath being the one they are for. It
+// returns one duplicate_unique_attribute error per value another group already holds. Each
+// value checked costs a search of the realm's groups by attribute.
+func UniqueAttributeConflicts(ctx context.Context, client KeycloakClient, token, realm, ownPath string, attributes *map[string][]string) ([]wscutils.ErrorMessage, error) {
+	if attributes == nil {
+		return nil, nil
+	}
+	var conflicts []wscutils.ErrorMessage
+	for _, key := range uniqueAttributes[realm] {
+		for _, value := range (*attributes)[key] {
+			groups, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{
+				Q:                   gocloak.StringP(key + ":" + value),
+				BriefRepresentation: gocloak.BoolP(false),
+			})
+			if err != nil {
+				return nil, err
+			}
+			if path := groupHoldingValue(groups, key, value, ownPath); path != "" {
+				field := "attributes." + key
+				conflicts = append(conflicts, wscutils.BuildErrorMessage("duplicate_unique_attribute", &field, value, path))
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// groupHoldingValue returns the path of a group among groups and their sub groups, other than
+// the one at ownPath, whose attribute key holds value, or an empty string if there is none.
+// Keycloak may return the parents of the groups matching a search, so every group is checked.
+func groupHoldingValue(groups []*gocloak.Group, key, value, ownPath string) string {
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		if path := gocloak.PString(group.Path); path != ownPath && group.Attributes != nil {
+			for _, held := range (*group.Attributes)[key] {
+				if held == value {
+					return path
+				}
+			}
+		}
+		if group.SubGroups != nil {
+			subGroups := make([]*gocloak.Group, 0, len(*group.SubGroups))
+			for i := range *group.SubGroups {
+				subGroups = append(subGroups, &(*group.SubGroups)[i])
+			}
+			if path := groupHoldingValue(subGroups, key, value, ownPath); path != "" {
+				return path
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// warningsContextKey is the gin context key under which the warnings raised for a request are stored.
+const warningsContextKey = "warnings"
+
+// AddWarning records a condition worth telling the caller about that does not fail the request.
+// Warnings are sent along with the data of a success response.
+func AddWarning(c *gin.Context, warning wscutils.ErrorMessage) {
+	c.Set(warningsContextKey, append(Warnings(c), warning))
+}
+
+// Warnings returns the warnings raised so far for a request.
+func Warnings(c *gin.Context) []wscutils.ErrorMessage {
+	value, _ := c.Get(warningsContextKey)
+	warnings, _ := value.([]wscutils.ErrorMessage)
+	return warnings
+}
+
+// GetStrictParam reads the strict query parameter, which defaults to false. Strict requests
+// fail with their warnings as errors instead of succeeding with them. It returns false if the
+// parameter is not a valid boolean.
+func GetStrictParam(c *gin.Context) (strict, ok bool) {
+	v := c.Query("strict")
+	if v == "" {
+		return false, true
+	}
+	strict, err := strconv.ParseBool(v)
+	return strict, err == nil
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookSignatureHeader carries the hex encoded HMAC-SHA256 of a webhook body, keyed by
+// the configured secret and prefixed with "sha256=".
+const WebhookSignatureHeader = "X-Idshield-Signature"
+
+// WebhookConfig holds the outbound webhooks fired after successful mutations.
+// Zero values are replaced by defaults.
+type WebhookConfig struct {
+	// URLs lists the endpoints every event is posted to. No events are sent when empty.
+	URLs []string `json:"urls"`
+	// Secret is the HMAC key used to sign each event body.
+	Secret string `json:"secret"`
+	// TimeoutSeconds bounds each delivery attempt.
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// MaxAttempts is how many times delivery to a URL is tried before giving up.
+	MaxAttempts int `json:"max_attempts"`
+	// QueueSize is how many deliveries may wait for a worker; further ones are dropped.
+	QueueSize int `json:"queue_size"`
+	// Workers is how many deliveries are made at once.
+	Workers int `json:"workers"`
+}
+
+// WebhookEvent is the JSON body posted to webhooks. Event is of the form
+// "<resourceType>.<action>", e.g. "group.created".
+type WebhookEvent struct {
+	Event        string    `json:"event"`
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	Realm        string    `json:"realm"`
+	Actor        string    `json:"actor"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// WebhookNotifier delivers events to the configured webhooks. Delivery is best effort and
+// happens in the background, a bounded number at a time, so that webhook failures never hold up
+// a response and bulk changes cannot pile up unbounded deliveries.
+type WebhookNotifier struct {
+	cfg        WebhookConfig
+	client     *http.Client
+	deliveries chan webhookDelivery
+	failed     atomic.Int64
+	dropped    atomic.Int64
+}
+
+// webhookDelivery is a single event waiting to be posted to a single webhook.
+type webhookDelivery struct {
+	url       string
+	body      []byte
+	signature string
+}
+
+// NewWebhookNotifier creates a WebhookNotifier for the given configuration.
+func NewWebhookNotifier(cfg WebhookConfig) *WebhookNotifier {
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 5
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	n := &WebhookNotifier{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		deliveries: make(chan webhookDelivery, cfg.QueueSize),
+	}
+	if len(cfg.URLs) > 0 {
+		for i := 0; i < cfg.Workers; i++ {
+			go n.run()
+		}
+	}
+	return n
+}
+
+// Failed returns the number of deliveries abandoned after every attempt failed.
+func (n *WebhookNotifier) Failed() int64 {
+	return n.failed.Load()
+}
+
+// Dropped returns the number of deliveries never attempted because the queue was full.
+func (n *WebhookNotifier) Dropped() int64 {
+	return n.dropped.Load()
+}
+
+// Notify queues a "<resourceType>.<action>" event for delivery to every configured webhook. It
+// never blocks: deliveries that find the queue full are dropped and counted.
+func (n *WebhookNotifier) Notify(resourceType, action, resourceID, realm, actor string) {
+	if n == nil || len(n.cfg.URLs) == 0 {
+		return
+	}
+	body, err := json.Marshal(WebhookEvent{
+		Event:        resourceType + "." + action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Realm:        realm,
+		Actor:        actor,
+		Timestamp:    time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("[webhook] failed to encode event: %v", err)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(n.cfg.Secret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, url := range n.cfg.URLs {
+		select {
+		case n.deliveries <- webhookDelivery{url: url, body: body, signature: signature}:
+		default:
+			n.dropped.Add(1)
+			log.Printf("[webhook] queue full, dropping %s event for %s", resourceType+"."+action, url)
+		}
+	}
+}
+
+// run makes the queued deliveries, one at a time.
+func (n *WebhookNotifier) run() {
+	for d := range n.deliveries {
+		n.deliver(d.url, d.body, d.signature)
+	}
+}
+
+// deliver posts body to url, retrying with a doubling backoff up to MaxAttempts times.
+func (n *WebhookNotifier) deliver(url string, body []byte, signature string) {
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= n.cfg.MaxAttempts; attempt++ {
+		if err = n.post(url, body, signature); err == nil {
+			return
+		}
+		if attempt < n.cfg.MaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	n.failed.Add(1)
+	log.Printf("[webhook] giving up on %s after %d attempts: %v", url, n.cfg.MaxAttempts, err)
+}
+
+// post makes a single delivery attempt.
+func (n *WebhookNotifier) post(url string, body []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signature)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
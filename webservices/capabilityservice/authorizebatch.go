@@ -0,0 +1,121 @@
+package capabilityservice
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// AuthorizeCheck asks whether the user Subject holds Capability.
+type AuthorizeCheck struct {
+	Subject    string `json:"subject" validate:"required"`
+	Capability string `json:"capability" validate:"required"`
+}
+
+// BatchAuthorizeRequest represents the structure for incoming batch authorization requests.
+// A single request may ask for at most 100 decisions.
+type BatchAuthorizeRequest struct {
+	Checks []AuthorizeCheck `json:"checks" validate:"required,min=1,max=100,dive"`
+}
+
+// AuthorizeDecision is the outcome of a single check. Error is set, and Allowed false, when
+// the check could not be evaluated, e.g. because the subject does not exist.
+type AuthorizeDecision struct {
+	Subject    string `json:"subject"`
+	Capability string `json:"capability"`
+	Allowed    bool   `json:"allowed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HandleBatchAuthorizeRequest is a Handler function for deciding whether each of a list of users holds a capability.
+// The capabilities of each subject are fetched from keyclock once, however many checks name it.
+func HandleBatchAuthorizeRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("batch authorize request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into BatchAuthorizeRequest struct
+	var req BatchAuthorizeRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForBatchAuthorizeError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	capabilitiesGroup := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Capabilities, or the error met fetching them, per subject, shared by every check naming it
+	capabilities := map[string]map[string]bool{}
+	lookupErrors := map[string]string{}
+
+	decisions := make([]AuthorizeDecision, 0, len(req.Checks))
+	for _, check := range req.Checks {
+		decision := AuthorizeDecision{Subject: check.Subject, Capability: check.Capability}
+		held, fetched := capabilities[check.Subject]
+		code, failed := lookupErrors[check.Subject]
+		if !fetched && !failed {
+			held, err = utils.UserCapabilities(ctx, client, token, realm, check.Subject, capabilitiesGroup)
+			if err != nil {
+				lh.Debug0().LogDebug("Error while fetching user capabilities:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "subject": check.Subject}})
+				code, failed = utils.KeycloakErrorCode(err, "user_not_found"), true
+				lookupErrors[check.Subject] = code
+			} else {
+				capabilities[check.Subject] = held
+			}
+		}
+		if failed {
+			decision.Error = code
+		} else {
+			decision.Allowed = held[check.Capability]
+		}
+		decisions = append(decisions, decision)
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, decisions)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of batchAuthorize", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForBatchAuthorizeError returns a slice of strings to be used as vals for a validation error.
+func (req *BatchAuthorizeRequest) getValsForBatchAuthorizeError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Checks":
+		vals = append(vals, "checks must list between 1 and 100 checks")
+	case "Subject":
+		vals = append(vals, "subject is required")
+	case "Capability":
+		vals = append(vals, "capability is required")
+	}
+	return vals
+}
@@ -0,0 +1,135 @@
+package capabilityservice
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// catalogCacheTTL is how long a capabilities catalog is served from cache. Changing groups or
+	// capabilities through idshield drops the cached catalogs of their realm at once; the ttl bounds
+	// how long changes made elsewhere go unseen.
+	catalogCacheTTL = 60 * time.Second
+	// descriptionAttribute is the capability attribute holding its description.
+	descriptionAttribute = "description"
+)
+
+// CatalogEntry represents a single capability in the capabilities catalog.
+type CatalogEntry struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"`
+}
+
+// CatalogCategory holds the capabilities of the catalog in a category, sorted by name. The
+// capabilities without a category are held by the category named by an empty string.
+type CatalogCategory struct {
+	Category     string         `json:"category"`
+	Capabilities []CatalogEntry `json:"capabilities"`
+}
+
+// catalogCache holds recently fetched capabilities catalogs keyed by realm and caller, as keyclock
+// only shows each caller the groups it may see.
+var catalogCache = utils.NewTTLCache[[]CatalogEntry](catalogCacheTTL)
+
+// InvalidateCapabilitiesCatalog drops the cached capabilities catalogs of a realm. It is registered
+// with utils.OnGroupsChange, which handlers changing groups call.
+func InvalidateCapabilitiesCatalog(realm string) {
+	catalogCache.DeletePrefix(realm + "/")
+}
+
+// HandleCapabilitiesCatalogRequest is a Handler function for listing every capability defined in keyclock,
+// sorted by name. With groupBy=category, the capabilities are grouped by category instead, the categories
+// sorted by name with the capabilities that have none first.
+func HandleCapabilitiesCatalogRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("capabilities catalog request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	groupBy := c.Query("groupBy")
+	if groupBy != "" && groupBy != categoryAttribute {
+		lh.Debug0().LogDebug("Invalid groupBy parameter", logharbour.DebugInfo{Variables: map[string]any{"groupBy": groupBy}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "groupBy"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	parentName := s.Dependencies["capabilitiesGroup"].(string)
+
+	cacheKey := utils.CallerCacheKey(token, realm)
+	if catalog, ok := catalogCache.Get(cacheKey); ok {
+		lh.Debug0().LogDebug("capabilities catalog served from cache", logharbour.DebugInfo{Variables: map[string]any{"realm": realm}})
+		utils.SendSuccessResponse(c, catalogData(catalog, groupBy))
+		return
+	}
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	catalog := []CatalogEntry{}
+	parent, err := client.GetGroupByPath(ctx, token, realm, "/"+parentName)
+	switch {
+	case utils.IsNotFound(err):
+		// No capability has been created in the realm yet
+	case err != nil:
+		lh.LogActivity("Error while fetching capabilities parent group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	case parent.SubGroups != nil:
+		for _, capability := range *parent.SubGroups {
+			catalog = append(catalog, CatalogEntry{
+				ID:          gocloak.PString(capability.ID),
+				Name:        gocloak.PString(capability.Name),
+				Description: attributeValue(capability.Attributes, descriptionAttribute),
+				Category:    attributeValue(capability.Attributes, categoryAttribute),
+			})
+		}
+	}
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].Name < catalog[j].Name })
+	catalogCache.Set(cacheKey, catalog)
+
+	// Send success response
+	utils.SendSuccessResponse(c, catalogData(catalog, groupBy))
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of capabilitiesCatalog", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// catalogData returns the catalog as sent for the groupBy query parameter: as is, or grouped
+// into categories.
+func catalogData(catalog []CatalogEntry, groupBy string) any {
+	if groupBy != categoryAttribute {
+		return catalog
+	}
+	categories := []CatalogCategory{}
+	index := map[string]int{}
+	for _, entry := range catalog {
+		i, ok := index[entry.Category]
+		if !ok {
+			i = len(categories)
+			index[entry.Category] = i
+			categories = append(categories, CatalogCategory{Category: entry.Category})
+		}
+		categories[i].Capabilities = append(categories[i].Capabilities, entry)
+	}
+	sort.SliceStable(categories, func(i, j int) bool { return categories[i].Category < categories[j].Category })
+	return categories
+}
@@ -0,0 +1,199 @@
+package capabilityservice
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// bulkAssignConcurrency is the number of users assigned a capability in parallel.
+const bulkAssignConcurrency = 5
+
+// CapabilityBulkAssignRequest represents the structure for incoming capability bulk assignment requests.
+// A single request may assign a capability to at most 1000 users.
+type CapabilityBulkAssignRequest struct {
+	CapabilityID string   `json:"capabilityID" validate:"required"`
+	UserIDs      []string `json:"userIDs" validate:"required,min=1,max=1000,unique,dive,required"`
+	DryRun       bool     `json:"dryRun"`
+}
+
+// CapabilityAssignResult is the outcome of assigning the capability to a single user. Status is
+// assigned, or wouldAssign for a dry run, alreadyAssigned when the user held the capability
+// already, or failed, with Error set.
+type CapabilityAssignResult struct {
+	UserID string `json:"userID"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CapabilityBulkAssignResponse represents the structure for outgoing capability bulk assignment responses.
+type CapabilityBulkAssignResponse struct {
+	Capability      string                   `json:"capability"`
+	DryRun          bool                     `json:"dryRun"`
+	Assigned        int                      `json:"assigned"`
+	AlreadyAssigned int                      `json:"alreadyAssigned"`
+	Failed          int                      `json:"failed"`
+	Results         []CapabilityAssignResult `json:"results"`
+}
+
+// HandleCapabilityBulkAssignRequest is a Handler function for granting a capability in keyclock to a cohort of
+// users at once, adding each of them to the capability's group. Users are handled a few at a time, and a user
+// who cannot be assigned the capability does not stop the others.
+func HandleCapabilityBulkAssignRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("capability bulk assign request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into CapabilityBulkAssignRequest struct
+	var req CapabilityBulkAssignRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForCapabilityBulkAssignError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	parentName := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// The group must be a capability, that is, directly under the capabilities group
+	group, err := client.GetGroup(ctx, token, realm, req.CapabilityID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching capability:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "capabilityID": req.CapabilityID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "capability_not_found"), ""))
+		return
+	}
+	capability, ok := strings.CutPrefix(gocloak.PString(group.Path), "/"+parentName+"/")
+	if !ok || strings.Contains(capability, "/") {
+		lh.Debug0().LogDebug("Group is not a capability", logharbour.DebugInfo{Variables: map[string]any{"capabilityID": req.CapabilityID, "path": gocloak.PString(group.Path)}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("capability_not_found", "capabilityID"))
+		return
+	}
+
+	// Start a bounded pool of workers assigning the capability, each result kept in request order
+	results := make([]CapabilityAssignResult, len(req.UserIDs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < bulkAssignConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = assignCapability(ctx, client, token, realm, group, req.UserIDs[i], req.DryRun)
+			}
+		}()
+	}
+	for i := range req.UserIDs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	response := CapabilityBulkAssignResponse{Capability: capability, DryRun: req.DryRun, Results: results}
+	var assigned []string
+	for _, result := range results {
+		switch result.Status {
+		case "assigned", "wouldAssign":
+			response.Assigned++
+			assigned = append(assigned, result.UserID)
+		case "alreadyAssigned":
+			response.AlreadyAssigned++
+		default:
+			response.Failed++
+		}
+	}
+
+	if !req.DryRun && len(assigned) > 0 {
+		utils.GroupMembershipChanged(realm, req.CapabilityID)
+
+		// Audit the change along with who made it
+		lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("capability").WithWhatInstanceId(req.CapabilityID).
+			LogDataChange("capability bulk assigned", logharbour.ChangeInfo{
+				Entity:    "capability",
+				Operation: "update",
+				Changes:   map[string]any{"members": map[string]any{"added": assigned}},
+			})
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of capabilityBulkAssign", map[string]any{"dryRun": req.DryRun, "assigned": response.Assigned, "failed": response.Failed, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// assignCapability adds a single user to the group of a capability, unless the user is a member
+// already, and reports the outcome. A dry run only checks whether the user is a member.
+func assignCapability(ctx context.Context, client utils.KeycloakClient, token, realm string, group *gocloak.Group, userID string, dryRun bool) CapabilityAssignResult {
+	result := CapabilityAssignResult{UserID: userID}
+
+	// Bound each user by the default timeout as well
+	ctx, cancel := context.WithTimeout(ctx, utils.DefaultRequestTimeout())
+	defer cancel()
+
+	groups, err := client.GetUserGroups(ctx, token, realm, userID, gocloak.GetGroupsParams{Search: group.Name})
+	if err != nil {
+		result.Status, result.Error = "failed", utils.KeycloakErrorCode(err, "user_not_found")
+		return result
+	}
+	for _, held := range groups {
+		if held != nil && gocloak.PString(held.ID) == gocloak.PString(group.ID) {
+			result.Status = "alreadyAssigned"
+			return result
+		}
+	}
+	if dryRun {
+		result.Status = "wouldAssign"
+		return result
+	}
+	if err := client.AddUserToGroup(ctx, token, realm, userID, gocloak.PString(group.ID)); err != nil {
+		result.Status, result.Error = "failed", utils.KeycloakErrorCode(err, "user_not_found")
+		return result
+	}
+	result.Status = "assigned"
+	return result
+}
+
+// getValsForCapabilityBulkAssignError returns a slice of strings to be used as vals for a validation error.
+func (req *CapabilityBulkAssignRequest) getValsForCapabilityBulkAssignError(err validator.FieldError) []string {
+	var vals []string
+	switch field := err.Field(); {
+	case field == "CapabilityID":
+		vals = append(vals, "capabilityID is required")
+	case field == "UserIDs":
+		vals = append(vals, "userIDs must list between 1 and 1000 distinct user IDs")
+	case strings.HasPrefix(field, "UserIDs["):
+		vals = append(vals, "userIDs must not contain empty IDs")
+	}
+	return vals
+}
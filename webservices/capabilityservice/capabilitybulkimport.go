@@ -0,0 +1,159 @@
+package capabilityservice
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// CapabilityBulkImportRequest represents the structure for incoming capability bulk import requests.
+// A single request may create at most 500 capabilities.
+type CapabilityBulkImportRequest struct {
+	Capabilities []CreateCapabilityRequest `json:"capabilities" validate:"required,min=1,max=500,dive"`
+}
+
+// CapabilityImportResult is the outcome of importing a single capability. Status is created,
+// exists when a capability of that name was already defined, or failed, with Error set.
+type CapabilityImportResult struct {
+	Name   string `json:"name"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CapabilityBulkImportResponse represents the structure for outgoing capability bulk import responses.
+type CapabilityBulkImportResponse struct {
+	Created int                      `json:"created"`
+	Exists  int                      `json:"exists"`
+	Failed  int                      `json:"failed"`
+	Results []CapabilityImportResult `json:"results"`
+}
+
+// HandleCapabilityBulkImportRequest is a Handler function for creating many capabilities in keyclock at once,
+// e.g. to seed a standard set into a fresh realm. The capabilities parent group is resolved, or created, once.
+// A capability that already exists or fails to be created does not stop the others.
+func HandleCapabilityBulkImportRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("capability bulk import request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into CapabilityBulkImportRequest struct
+	var req CapabilityBulkImportRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForCapabilityBulkImportError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	parentName := s.Dependencies["capabilitiesGroup"].(string)
+	webhooks := s.Dependencies["webhooks"].(*utils.WebhookNotifier)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	parentID, err := GetCapabilitiesParentID(ctx, client, token, realm, parentName)
+	if err != nil {
+		lh.LogActivity("Error while resolving capabilities parent group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	response := CapabilityBulkImportResponse{Results: make([]CapabilityImportResult, 0, len(req.Capabilities))}
+	var created []string
+	categories := s.Dependencies["capabilityCategories"].([]string)
+	for _, item := range req.Capabilities {
+		result := CapabilityImportResult{Name: *item.Name}
+
+		// Each capability's attributes are checked on their own, failing only that capability
+		attributes, itemErrors := item.structuredAttributes(categories)
+		if len(itemErrors) == 0 {
+			attributes, _, itemErrors = utils.DedupeAttributes(attributes)
+		}
+		itemErrors = append(itemErrors, utils.ValidateAttributes(utils.TypeCapability, attributes)...)
+		if len(itemErrors) > 0 {
+			result.Status, result.Error = "failed", itemErrors[0].ErrCode
+			response.Failed++
+			response.Results = append(response.Results, result)
+			continue
+		}
+
+		capabilityID, err := client.CreateChildGroup(ctx, token, realm, parentID, gocloak.Group{
+			Name:       item.Name,
+			Attributes: utils.StampCreated(utils.WithGroupType(attributes, utils.TypeCapability)),
+		})
+		var apiErr *gocloak.APIError
+		switch {
+		case err == nil:
+			result.ID, result.Status = capabilityID, "created"
+			response.Created++
+			created = append(created, result.Name)
+			webhooks.Notify("capability", "created", capabilityID, realm, utils.SubjectFromToken(token))
+		case errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict:
+			result.Status = "exists"
+			response.Exists++
+		default:
+			lh.LogActivity("Error while creating capability:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "name": result.Name}})
+			result.Status, result.Error = "failed", utils.KeycloakErrorCode(err, "group_not_found")
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	if len(created) > 0 {
+		utils.GroupsChanged(realm)
+
+		// Audit the change along with who made it
+		lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("capability").WithWhatInstanceId(parentID).
+			LogDataChange("capabilities bulk imported", logharbour.ChangeInfo{
+				Entity:    "capability",
+				Operation: "create",
+				Changes:   map[string]any{"capabilities": created},
+			})
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of capabilityBulkImport", map[string]any{"created": response.Created, "exists": response.Exists, "failed": response.Failed, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForCapabilityBulkImportError returns a slice of strings to be used as vals for a validation error.
+func (req *CapabilityBulkImportRequest) getValsForCapabilityBulkImportError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Capabilities":
+		vals = append(vals, "capabilities must list between 1 and 500 capabilities")
+	case "Name":
+		vals = append(vals, "capability name is required")
+	}
+	return vals
+}
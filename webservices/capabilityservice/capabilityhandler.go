@@ -0,0 +1,211 @@
+package capabilityservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// categoryAttribute is the capability attribute holding its category.
+const categoryAttribute = "category"
+
+// CreateCapabilityRequest represents the structure for incoming capability creation requests.
+// Description and Category are stored as the description and category attributes, replacing
+// any given in Attributes.
+type CreateCapabilityRequest struct {
+	Name        *string              `json:"name" validate:"required"`
+	Description *string              `json:"description,omitempty"`
+	Category    *string              `json:"category,omitempty"`
+	Attributes  *map[string][]string `json:"attributes,omitempty"`
+}
+
+// CapabilityResponse represents the structure for outgoing capability responses.
+type CapabilityResponse struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Category    string               `json:"category,omitempty"`
+	Path        *string              `json:"path"`
+	CreatedAt   *time.Time           `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time           `json:"updatedAt,omitempty"`
+	Attributes  *map[string][]string `json:"attributes"`
+}
+
+// HandleCapabilityCreationRequest is a Handler function for creating a capability in keyclock.
+// Capabilities are stored as sub groups of the capabilities parent group.
+func HandleCapabilityCreationRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("create capability request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into CreateCapabilityRequest struct
+	var req CreateCapabilityRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForCreateCapabilityError)
+	attributes, categoryErrors := req.structuredAttributes(s.Dependencies["capabilityCategories"].([]string))
+	validationErrors = append(validationErrors, categoryErrors...)
+	attributes, duplicated, duplicateErrors := utils.DedupeAttributes(attributes)
+	if len(duplicated) > 0 && len(duplicateErrors) == 0 {
+		lh.Warn().LogActivity("Duplicate attribute values removed", map[string]any{"keys": duplicated})
+	}
+	req.Attributes = attributes
+	validationErrors = append(validationErrors, duplicateErrors...)
+	validationErrors = append(validationErrors, utils.ValidateAttributes(utils.TypeCapability, req.Attributes)...)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	parentName := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	parentID, err := GetCapabilitiesParentID(ctx, client, token, realm, parentName)
+	if err != nil {
+		lh.LogActivity("Error while resolving capabilities parent group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	capability := gocloak.Group{
+		Name:       req.Name,
+		Attributes: utils.StampCreated(utils.WithGroupType(req.Attributes, utils.TypeCapability)),
+	}
+	capabilityID, err := client.CreateChildGroup(ctx, token, realm, parentID, capability)
+	if err != nil {
+		lh.LogActivity("Error while creating capability:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		var apiErr *gocloak.APIError
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+			utils.SendErrorResponse(c, utils.ErrorResponse("name already exist", ""))
+			return
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	utils.GroupsChanged(realm)
+
+	// Get the capability info by using its ID
+	capabilityInfo, err := client.GetGroup(ctx, token, realm, capabilityID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching created capability:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "capability_not_found"), ""))
+		return
+	}
+
+	// Let any configured webhooks know about the change
+	s.Dependencies["webhooks"].(*utils.WebhookNotifier).Notify("capability", "created", capabilityID, realm, utils.SubjectFromToken(token))
+
+	response := CapabilityResponse{
+		ID:          gocloak.PString(capabilityInfo.ID),
+		Name:        gocloak.PString(capabilityInfo.Name),
+		Description: attributeValue(capabilityInfo.Attributes, descriptionAttribute),
+		Category:    attributeValue(capabilityInfo.Attributes, categoryAttribute),
+		Path:        capabilityInfo.Path,
+		Attributes:  capabilityInfo.Attributes,
+	}
+	response.CreatedAt, response.UpdatedAt = utils.GroupTimestamps(capabilityInfo.Attributes)
+
+	// Send success response, pointing at the created capability
+	utils.SendCreatedResponse(c, "/capability/"+url.PathEscape(capabilityID), response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of createCapability", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// GetCapabilitiesParentID returns the ID of the top level group holding all capabilities,
+// creating it on first use.
+func GetCapabilitiesParentID(ctx context.Context, client utils.KeycloakClient, token, realm, parentName string) (string, error) {
+	parent, err := client.GetGroupByPath(ctx, token, realm, "/"+parentName)
+	if err == nil && parent.ID != nil {
+		return *parent.ID, nil
+	}
+	var apiErr *gocloak.APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound) {
+		return "", err
+	}
+	return client.CreateGroup(ctx, token, realm, gocloak.Group{
+		Name:       gocloak.StringP(parentName),
+		Attributes: utils.StampCreated(utils.WithGroupType(nil, utils.TypeCapability)),
+	})
+}
+
+// structuredAttributes returns the attributes of req with its description and category added.
+// The category must be one of categories, unless categories is empty.
+func (req *CreateCapabilityRequest) structuredAttributes(categories []string) (*map[string][]string, []wscutils.ErrorMessage) {
+	if req.Description == nil && req.Category == nil {
+		return req.Attributes, nil
+	}
+	attributes := map[string][]string{}
+	if req.Attributes != nil {
+		for key, values := range *req.Attributes {
+			attributes[key] = values
+		}
+	}
+	if req.Description != nil && *req.Description != "" {
+		attributes[descriptionAttribute] = []string{*req.Description}
+	}
+	if req.Category != nil && *req.Category != "" {
+		if len(categories) > 0 && !slices.Contains(categories, *req.Category) {
+			field := "category"
+			return nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage("invalid_category", &field, *req.Category)}
+		}
+		attributes[categoryAttribute] = []string{*req.Category}
+	}
+	return &attributes, nil
+}
+
+// attributeValue returns the first value of the attribute key, or an empty string if there is none.
+func attributeValue(attributes *map[string][]string, key string) string {
+	if attributes == nil {
+		return ""
+	}
+	if values := (*attributes)[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// getValsForCreateCapabilityError returns a slice of strings to be used as vals for a validation error.
+func (req *CreateCapabilityRequest) getValsForCreateCapabilityError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Name":
+		switch err.Tag() {
+		case "required":
+			vals = append(vals, "capability name is required")
+		}
+	}
+	return vals
+}
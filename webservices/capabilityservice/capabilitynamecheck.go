@@ -0,0 +1,67 @@
+package capabilityservice
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// CapabilityNameCheckResponse represents the structure for outgoing capability name availability responses.
+type CapabilityNameCheckResponse struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+}
+
+// HandleCapabilityNameCheckRequest is a Handler function for checking whether a capability name is still free.
+// The result is never cached so that it reflects the current state of keyclock.
+func HandleCapabilityNameCheckRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("capability name check request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" || strings.Contains(name, "/") {
+		lh.Debug0().LogDebug("Missing or invalid capability name", logharbour.DebugInfo{Variables: map[string]any{"name": name}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "name"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	parentName := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// A single lookup by path is enough, as capabilities all live under the same parent
+	available := false
+	_, err = client.GetGroupByPath(ctx, token, realm, "/"+parentName+"/"+name)
+	if err != nil {
+		var apiErr *gocloak.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+			lh.LogActivity("Error while looking up capability:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "capability_not_found"), ""))
+			return
+		}
+		available = true
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, CapabilityNameCheckResponse{Name: name, Available: available})
+}
@@ -0,0 +1,201 @@
+package capabilityservice
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxCapabilityDepth is the deepest level of sub groups below a capability's group walked to find
+// the memberships granting the capability.
+const maxCapabilityDepth = 10
+
+var (
+	// errCapabilityCycle is returned when a group turns up again among its own sub groups.
+	errCapabilityCycle = errors.New("capability group nested in itself")
+	// errCapabilityTooDeep is returned when a capability's sub groups nest deeper than maxCapabilityDepth.
+	errCapabilityTooDeep = errors.New("capability sub groups nested too deep")
+)
+
+// GrantStep is a step of the chain through which a user holds a capability. Type is what the
+// step is, and Path the group it concerns.
+type GrantStep struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// CapabilityGrant is a capability a user holds, along with the chain that grants it, starting
+// from the user.
+type CapabilityGrant struct {
+	Capability string      `json:"capability"`
+	GrantedBy  []GrantStep `json:"grantedBy"`
+}
+
+// UserCapabilityTreeResponse represents the structure for outgoing user capability tree responses.
+type UserCapabilityTreeResponse struct {
+	UserID       string            `json:"userID"`
+	Capabilities []CapabilityGrant `json:"capabilities"`
+}
+
+// HandleUserCapabilityTreeRequest is a Handler function for explaining why a user in keyclock holds each of
+// their capabilities, for access reviews. Members of a sub group inherit what its parents grant, so a
+// capability is granted by membership of the capability's group or of any group nested below it, and each
+// comes with the shortest chain granting it. The nesting is walked with a depth guard and cycle detection.
+func HandleUserCapabilityTreeRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("user capability tree request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	userID := c.Query("userID")
+	if userID == "" {
+		lh.Debug0().LogDebug("Missing userID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "userID"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	capabilitiesGroup := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure the user exists, as keycloak returns no groups for unknown users
+	if _, err := client.GetUserByID(ctx, token, realm, userID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching user:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+		return
+	}
+
+	groups, err := utils.CollectPages(utils.MaxPageSize, 0, func(first, max int) ([]*gocloak.Group, error) {
+		return client.GetUserGroups(ctx, token, realm, userID, gocloak.GetGroupsParams{
+			First: gocloak.IntP(first),
+			Max:   gocloak.IntP(max),
+		})
+	})
+	if err != nil {
+		lh.LogActivity("Error while fetching user groups:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+		return
+	}
+
+	// Only the groups below the capabilities group can grant a capability
+	member := map[string]bool{}
+	var memberPaths []string
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		path := gocloak.PString(group.Path)
+		if strings.HasPrefix(path, "/"+capabilitiesGroup+"/") {
+			member[gocloak.PString(group.ID)] = true
+			memberPaths = append(memberPaths, path)
+		}
+	}
+
+	response := UserCapabilityTreeResponse{UserID: userID, Capabilities: []CapabilityGrant{}}
+	var capabilities []gocloak.Group
+	if len(member) > 0 {
+		parent, err := client.GetGroupByPath(ctx, token, realm, "/"+capabilitiesGroup)
+		switch {
+		case utils.IsNotFound(err):
+			// No capability has been created in the realm yet
+		case err != nil:
+			lh.LogActivity("Error while fetching capabilities parent group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		case parent.SubGroups != nil:
+			capabilities = *parent.SubGroups
+		}
+	}
+	for _, capability := range capabilities {
+		if !holdsUnder(memberPaths, gocloak.PString(capability.Path)) {
+			continue
+		}
+		chain, err := grantChain(capability, member, map[string]bool{}, 0)
+		if err != nil {
+			lh.Warn().LogActivity("Capability sub groups cannot be walked", map[string]any{"capability": gocloak.PString(capability.Name), "error": err.Error(), "maxDepth": maxCapabilityDepth})
+			code := "tree_too_large"
+			if errors.Is(err, errCapabilityCycle) {
+				code = "cycle_detected"
+			}
+			utils.SendErrorResponse(c, utils.ErrorResponse(code, ""))
+			return
+		}
+		if chain != nil {
+			response.Capabilities = append(response.Capabilities, CapabilityGrant{Capability: gocloak.PString(capability.Name), GrantedBy: chain})
+		}
+	}
+	sort.Slice(response.Capabilities, func(i, j int) bool {
+		return response.Capabilities[i].Capability < response.Capabilities[j].Capability
+	})
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of userCapabilityTree", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// holdsUnder reports whether any of paths is the group at path or a group nested below it.
+func holdsUnder(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// grantChain returns the shortest chain through which membership of group or of a group nested
+// below it grants group, starting from the membership, or nil if the user is a member of none of
+// them. visiting holds the IDs of the groups being walked above group, depth levels deep.
+func grantChain(group gocloak.Group, member, visiting map[string]bool, depth int) ([]GrantStep, error) {
+	if depth > maxCapabilityDepth {
+		return nil, errCapabilityTooDeep
+	}
+	id := gocloak.PString(group.ID)
+	if visiting[id] {
+		return nil, errCapabilityCycle
+	}
+	if member[id] {
+		return []GrantStep{{Type: "groupMembership", Path: gocloak.PString(group.Path)}}, nil
+	}
+	if group.SubGroups == nil {
+		return nil, nil
+	}
+
+	visiting[id] = true
+	defer delete(visiting, id)
+	var shortest []GrantStep
+	for _, subGroup := range *group.SubGroups {
+		chain, err := grantChain(subGroup, member, visiting, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if chain != nil && (shortest == nil || len(chain) < len(shortest)) {
+			shortest = chain
+		}
+	}
+	if shortest == nil {
+		return nil, nil
+	}
+	return append(shortest, GrantStep{Type: "parentGroup", Path: gocloak.PString(group.Path)}), nil
+}
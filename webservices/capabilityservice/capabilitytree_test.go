@@ -0,0 +1,136 @@
+package capabilityservice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/idshield/utils/keycloakmock"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// capabilityGroup returns a group at path with the given sub groups, its ID being its path.
+func capabilityGroup(path string, subGroups ...gocloak.Group) gocloak.Group {
+	name := path[strings.LastIndex(path, "/")+1:]
+	return gocloak.Group{ID: gocloak.StringP(path), Name: gocloak.StringP(name), Path: gocloak.StringP(path), SubGroups: &subGroups}
+}
+
+// serveCapabilityTree asks for the capability tree of a user who is a member of memberOf, in a
+// realm whose capabilities are the sub groups of capabilities, and returns the recorded response.
+func serveCapabilityTree(capabilities gocloak.Group, memberOf ...string) *httptest.ResponseRecorder {
+	client := &keycloakmock.Client{
+		GetUserByIDFunc: func(_ context.Context, _, _, userID string) (*gocloak.User, error) {
+			return &gocloak.User{ID: gocloak.StringP(userID)}, nil
+		},
+		GetUserGroupsFunc: func(context.Context, string, string, string, gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+			groups := []*gocloak.Group{}
+			for _, path := range memberOf {
+				groups = append(groups, &gocloak.Group{ID: gocloak.StringP(path), Path: gocloak.StringP(path)})
+			}
+			return groups, nil
+		},
+		GetGroupByPathFunc: func(context.Context, string, string, string) (*gocloak.Group, error) {
+			return &capabilities, nil
+		},
+	}
+	lh := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "idshield-test", io.Discard)
+	s := service.NewService(gin.New()).WithLogHarbour(lh).WithDependency("goclock", client).WithDependency("capabilitiesGroup", "capabilities")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/user-capability-tree", func(c *gin.Context) {
+		utils.SetRealm(c, "test")
+		HandleUserCapabilityTreeRequest(c, s)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/user-capability-tree?userID=asha-id", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleUserCapabilityTreeRequest(t *testing.T) {
+	capabilities := capabilityGroup("/capabilities",
+		capabilityGroup("/capabilities/report", capabilityGroup("/capabilities/report/eu", capabilityGroup("/capabilities/report/eu/paris"))),
+		capabilityGroup("/capabilities/export", capabilityGroup("/capabilities/export/eu")),
+		capabilityGroup("/capabilities/audit"),
+	)
+	w := serveCapabilityTree(capabilities, "/capabilities/report/eu/paris", "/capabilities/export", "/capabilities/export/eu", "/tenants/acme")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var response struct {
+		Data UserCapabilityTreeResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response is not the standard envelope: %v: %s", err, w.Body.String())
+	}
+	want := []CapabilityGrant{
+		{Capability: "export", GrantedBy: []GrantStep{{Type: "groupMembership", Path: "/capabilities/export"}}},
+		{Capability: "report", GrantedBy: []GrantStep{
+			{Type: "groupMembership", Path: "/capabilities/report/eu/paris"},
+			{Type: "parentGroup", Path: "/capabilities/report/eu"},
+			{Type: "parentGroup", Path: "/capabilities/report"},
+		}},
+	}
+	if !reflect.DeepEqual(response.Data.Capabilities, want) {
+		t.Errorf("capabilities = %+v, want %+v", response.Data.Capabilities, want)
+	}
+}
+
+func TestHandleUserCapabilityTreeRequestUnwalkable(t *testing.T) {
+	// A group listed again below itself, as keyclock never should
+	cyclic := capabilityGroup("/capabilities/report/eu", capabilityGroup("/capabilities/report/eu/paris"))
+	(*cyclic.SubGroups)[0].SubGroups = &[]gocloak.Group{cyclic}
+
+	deep := capabilityGroup("/capabilities/report" + strings.Repeat("/x", maxCapabilityDepth+1))
+	for path := *deep.Path; strings.Count(path, "/") > 2; {
+		path = path[:strings.LastIndex(path, "/")]
+		deep = capabilityGroup(path, deep)
+	}
+
+	tests := []struct {
+		name       string
+		report     gocloak.Group
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "cycle",
+			report:     capabilityGroup("/capabilities/report", cyclic),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   "cycle_detected",
+		},
+		{
+			name:       "too deep",
+			report:     deep,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   "tree_too_large",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveCapabilityTree(capabilityGroup("/capabilities", tt.report), "/capabilities/report/elsewhere")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var response wscutils.Response
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("response is not the standard envelope: %v: %s", err, w.Body.String())
+			}
+			if len(response.Messages) == 0 || response.Messages[0].ErrCode != tt.wantCode {
+				t.Errorf("messages = %+v, want error code %q", response.Messages, tt.wantCode)
+			}
+		})
+	}
+}
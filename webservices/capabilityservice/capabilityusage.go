@@ -0,0 +1,164 @@
+package capabilityservice
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// usageReportCacheTTL is how long a capability usage report is served from cache.
+	usageReportCacheTTL = 5 * time.Minute
+	// usageCountConcurrency is the number of capabilities whose holders are counted at once.
+	usageCountConcurrency = 5
+	// usageCountPageSize is the number of holders fetched per call while counting.
+	usageCountPageSize = 500
+)
+
+// CapabilityUsage represents the number of users holding a single capability.
+type CapabilityUsage struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	Users    int    `json:"users"`
+}
+
+// CapabilityUsageReport represents the structure for outgoing capability usage reports.
+// Capabilities are sorted by the number of users holding them, most held first. Unused
+// counts the capabilities nobody holds.
+type CapabilityUsageReport struct {
+	GeneratedAt  time.Time         `json:"generatedAt"`
+	Capabilities []CapabilityUsage `json:"capabilities"`
+	Unused       int               `json:"unused"`
+}
+
+// usageReportCache holds recently built capability usage reports keyed by realm and caller, as
+// keyclock decides which callers may see the members of a group.
+var usageReportCache = utils.NewTTLCache[CapabilityUsageReport](usageReportCacheTTL)
+
+// HandleCapabilityUsageReportRequest is a Handler function for counting the users in keyclock holding each
+// capability, for capacity planning and to find unused capabilities. Every holder of every capability is
+// paged through, so the report is cached for a few minutes.
+func HandleCapabilityUsageReportRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("capability usage report request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	parentName := s.Dependencies["capabilitiesGroup"].(string)
+
+	cacheKey := utils.CallerCacheKey(token, realm)
+	if report, ok := usageReportCache.Get(cacheKey); ok {
+		lh.Debug0().LogDebug("capability usage report served from cache", logharbour.DebugInfo{Variables: map[string]any{"realm": realm}})
+		utils.SendSuccessResponse(c, report)
+		return
+	}
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	report := CapabilityUsageReport{GeneratedAt: time.Now().UTC(), Capabilities: []CapabilityUsage{}}
+	parent, err := client.GetGroupByPath(ctx, token, realm, "/"+parentName)
+	switch {
+	case utils.IsNotFound(err):
+		// No capability has been created in the realm yet
+	case err != nil:
+		lh.LogActivity("Error while fetching capabilities parent group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	case parent.SubGroups != nil:
+		for _, capability := range *parent.SubGroups {
+			report.Capabilities = append(report.Capabilities, CapabilityUsage{
+				ID:       gocloak.PString(capability.ID),
+				Name:     gocloak.PString(capability.Name),
+				Category: attributeValue(capability.Attributes, categoryAttribute),
+			})
+		}
+	}
+
+	// Capabilities are held through direct membership of their group alone, so the holders of
+	// each are its members. Count them a few capabilities at a time.
+	errs := make([]error, len(report.Capabilities))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < usageCountConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				report.Capabilities[i].Users, errs[i] = countMembers(ctx, client, token, realm, report.Capabilities[i].ID)
+			}
+		}()
+	}
+	for i := range report.Capabilities {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			lh.LogActivity("Error while counting capability holders:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "capability": report.Capabilities[i].Name}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "capability_not_found"), ""))
+			return
+		}
+	}
+
+	// Most held first, capabilities held by as many users in name order
+	sort.Slice(report.Capabilities, func(i, j int) bool {
+		a, b := report.Capabilities[i], report.Capabilities[j]
+		if a.Users != b.Users {
+			return a.Users > b.Users
+		}
+		return a.Name < b.Name
+	})
+	for _, capability := range report.Capabilities {
+		if capability.Users == 0 {
+			report.Unused++
+		}
+	}
+	usageReportCache.Set(cacheKey, report)
+
+	// Send success response
+	utils.SendSuccessResponse(c, report)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of capabilityUsageReport", map[string]any{"capabilities": len(report.Capabilities), "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// countMembers counts the members of a group by paging through their brief representations,
+// as keyclock has no member count call.
+func countMembers(ctx context.Context, client utils.KeycloakClient, token, realm, groupID string) (int, error) {
+	count := 0
+	for first := 0; ; first += usageCountPageSize {
+		members, err := client.GetGroupMembers(ctx, token, realm, groupID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(usageCountPageSize),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+		if err != nil {
+			return 0, err
+		}
+		count += len(members)
+		if len(members) < usageCountPageSize {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package capabilityservice
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// capabilityUsersCacheTTL is how long the holders of a capability are served from cache,
+	// so that paging through them does not fetch them all again for every page.
+	capabilityUsersCacheTTL = 60 * time.Second
+	// maxCapabilityUsers is the largest number of holders of a single capability gathered.
+	maxCapabilityUsers = 50000
+)
+
+// CapabilityUser represents a single user holding a capability.
+type CapabilityUser struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// capabilityHolders are the holders of a capability, along with the ID of its group.
+type capabilityHolders struct {
+	groupID string
+	users   []CapabilityUser
+}
+
+// capabilityUsersCache holds recently gathered holders of capabilities keyed by realm, capability
+// name and caller, as keyclock decides which callers may see the members of a group.
+var capabilityUsersCache = utils.NewTTLCache[capabilityHolders](capabilityUsersCacheTTL)
+
+// InvalidateCapabilityHolders drops what is cached about the holders of a group, should it be a
+// capability. It is registered with utils.OnGroupMembershipChange.
+func InvalidateCapabilityHolders(realm, groupID string) {
+	capabilityUsersCache.DeleteFunc(func(key string, holders capabilityHolders) bool {
+		return holders.groupID == groupID && strings.HasPrefix(key, realm+"/")
+	})
+	usageReportCache.DeleteFunc(func(key string, report CapabilityUsageReport) bool {
+		if !strings.HasPrefix(key, realm+"/") {
+			return false
+		}
+		for _, capability := range report.Capabilities {
+			if capability.ID == groupID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// HandleCapabilityUsersRequest is a Handler function for listing the users in keyclock holding a capability,
+// that is, the members of the capability's group. Every holder is gathered to page through them, so the
+// result is cached for a short while.
+func HandleCapabilityUsersRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("capability users request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	capability := c.Query("capability")
+	if capability == "" {
+		lh.Debug0().LogDebug("Missing capability", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "capability"))
+		return
+	}
+
+	first, max, ok := utils.GetPageParams(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid page parameters", logharbour.DebugInfo{Variables: map[string]any{"first": c.Query("first"), "max": c.Query("max")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	parentName := s.Dependencies["capabilitiesGroup"].(string)
+
+	cacheKey := utils.CallerCacheKey(token, realm, capability)
+	holders, cached := capabilityUsersCache.Get(cacheKey)
+	users := holders.users
+	if !cached {
+		// Create a context with the timeout configured for this route
+		ctx, cancel := utils.RequestContext(c)
+		defer cancel()
+
+		group, err := client.GetGroupByPath(ctx, token, realm, "/"+parentName+"/"+capability)
+		if err != nil {
+			lh.Debug0().LogDebug("Error while fetching capability:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "capability": capability}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "capability_not_found"), ""))
+			return
+		}
+
+		members, err := utils.CollectPages(utils.MaxPageSize, maxCapabilityUsers+1, func(first, max int) ([]*gocloak.User, error) {
+			return client.GetGroupMembers(ctx, token, realm, gocloak.PString(group.ID), gocloak.GetGroupsParams{
+				First:               gocloak.IntP(first),
+				Max:                 gocloak.IntP(max),
+				BriefRepresentation: gocloak.BoolP(true),
+			})
+		})
+		if err != nil {
+			lh.LogActivity("Error while fetching capability holders:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "capability": capability}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "capability_not_found"), ""))
+			return
+		}
+		if len(members) > maxCapabilityUsers {
+			lh.Warn().LogActivity("Capability held by too many users to list", map[string]any{"capability": capability, "limit": maxCapabilityUsers})
+			utils.SendErrorResponse(c, utils.ErrorResponse("range_too_large", "capability"))
+			return
+		}
+
+		users = make([]CapabilityUser, 0, len(members))
+		for _, user := range members {
+			if user == nil {
+				continue
+			}
+			users = append(users, CapabilityUser{
+				ID:        gocloak.PString(user.ID),
+				Username:  gocloak.PString(user.Username),
+				Email:     gocloak.PString(user.Email),
+				FirstName: gocloak.PString(user.FirstName),
+				LastName:  gocloak.PString(user.LastName),
+				Enabled:   gocloak.PBool(user.Enabled),
+			})
+		}
+		capabilityUsersCache.Set(cacheKey, capabilityHolders{groupID: gocloak.PString(group.ID), users: users})
+	}
+
+	// Serve the page asked for
+	page := []CapabilityUser{}
+	if first < len(users) {
+		end := first + max
+		if end > len(users) {
+			end = len(users)
+		}
+		page = users[first:end]
+	}
+
+	// Send success response
+	utils.SendListResponse(c, page, utils.NewListMeta(c, len(users), first, max, len(page)))
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of capabilityUsers", map[string]any{"cached": cached, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
@@ -0,0 +1,159 @@
+package capabilityservice
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxOrphanScan is the largest number of capabilities checked for holders in one request.
+const maxOrphanScan = 2000
+
+// OrphanCapability represents a capability nobody holds. CreatedAt is left out for capabilities
+// created before idshield started recording it.
+type OrphanCapability struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Category  string     `json:"category,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// OrphanCapabilitiesResponse represents the structure for outgoing orphan capabilities responses.
+// Scanned is the number of capabilities checked; Truncated is set when the realm has more than
+// maxOrphanScan, of which only the first by name were checked.
+type OrphanCapabilitiesResponse struct {
+	Capabilities []OrphanCapability `json:"capabilities"`
+	Scanned      int                `json:"scanned"`
+	Truncated    bool               `json:"truncated"`
+}
+
+// HandleOrphanCapabilitiesRequest is a Handler function for listing the capabilities in keyclock that nobody
+// holds and that have no sub groups, for cleaning up dead permissions, e.g. /orphan-capabilities?minAgeDays=90.
+// With minAgeDays, capabilities created more recently are left out.
+func HandleOrphanCapabilitiesRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("orphan capabilities request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	minAgeDays := 0
+	if value := c.Query("minAgeDays"); value != "" {
+		if minAgeDays, err = strconv.Atoi(value); err != nil || minAgeDays < 0 {
+			lh.Debug0().LogDebug("Invalid minAgeDays parameter", logharbour.DebugInfo{Variables: map[string]any{"minAgeDays": value}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "minAgeDays"))
+			return
+		}
+	}
+	createdBefore := time.Now().AddDate(0, 0, -minAgeDays)
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	parentName := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	var candidates []gocloak.Group
+	parent, err := client.GetGroupByPath(ctx, token, realm, "/"+parentName)
+	switch {
+	case utils.IsNotFound(err):
+		// No capability has been created in the realm yet
+	case err != nil:
+		lh.LogActivity("Error while fetching capabilities parent group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	case parent.SubGroups != nil:
+		candidates = *parent.SubGroups
+	}
+	sort.Slice(candidates, func(i, j int) bool { return gocloak.PString(candidates[i].Name) < gocloak.PString(candidates[j].Name) })
+
+	response := OrphanCapabilitiesResponse{Capabilities: []OrphanCapability{}}
+	if len(candidates) > maxOrphanScan {
+		candidates, response.Truncated = candidates[:maxOrphanScan], true
+		lh.Warn().LogActivity("Orphan capabilities scan stopped early", map[string]any{"realm": realm, "capabilities": len(*parent.SubGroups)})
+	}
+	response.Scanned = len(candidates)
+
+	// Only capabilities old enough and without sub groups need their holders looked up
+	var unheld []gocloak.Group
+	for _, capability := range candidates {
+		createdAt, _ := utils.GroupTimestamps(capability.Attributes)
+		if minAgeDays > 0 && createdAt != nil && createdAt.After(createdBefore) {
+			continue
+		}
+		if capability.SubGroups != nil && len(*capability.SubGroups) > 0 {
+			continue
+		}
+		unheld = append(unheld, capability)
+	}
+
+	// Look for a single holder of each, a few capabilities at a time
+	held := make([]bool, len(unheld))
+	errs := make([]error, len(unheld))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < usageCountConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				held[i], errs[i] = hasMembers(ctx, client, token, realm, gocloak.PString(unheld[i].ID))
+			}
+		}()
+	}
+	for i := range unheld {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, capability := range unheld {
+		if errs[i] != nil {
+			lh.LogActivity("Error while looking for capability holders:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": errs[i], "capability": gocloak.PString(capability.Name)}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(errs[i], "capability_not_found"), ""))
+			return
+		}
+		if held[i] {
+			continue
+		}
+		orphan := OrphanCapability{
+			ID:       gocloak.PString(capability.ID),
+			Name:     gocloak.PString(capability.Name),
+			Category: attributeValue(capability.Attributes, categoryAttribute),
+		}
+		orphan.CreatedAt, _ = utils.GroupTimestamps(capability.Attributes)
+		response.Capabilities = append(response.Capabilities, orphan)
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of orphanCapabilities", map[string]any{"scanned": response.Scanned, "orphans": len(response.Capabilities), "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// hasMembers reports whether a group has at least one member.
+func hasMembers(ctx context.Context, client utils.KeycloakClient, token, realm, groupID string) (bool, error) {
+	members, err := client.GetGroupMembers(ctx, token, realm, groupID, gocloak.GetGroupsParams{
+		Max:                 gocloak.IntP(1),
+		BriefRepresentation: gocloak.BoolP(true),
+	})
+	return len(members) > 0, err
+}
@@ -0,0 +1,108 @@
+package eventservice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminEvent is a keyclock admin event. Fields a keyclock version does not report are left empty:
+// ID and Details only exist from keyclock 23 on, and ResourceType is derived from ResourcePath for
+// versions that predate it.
+type AdminEvent struct {
+	ID             string            `json:"id,omitempty"`
+	Time           time.Time         `json:"time"`
+	RealmID        string            `json:"realmId"`
+	OperationType  string            `json:"operationType"`
+	ResourceType   string            `json:"resourceType"`
+	ResourcePath   string            `json:"resourcePath"`
+	AuthDetails    AdminEventAuth    `json:"authDetails"`
+	Representation string            `json:"representation,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	Details        map[string]string `json:"details,omitempty"`
+}
+
+// AdminEventAuth identifies who made the change an admin event records.
+type AdminEventAuth struct {
+	RealmID   string `json:"realmId"`
+	ClientID  string `json:"clientId"`
+	UserID    string `json:"userId"`
+	IPAddress string `json:"ipAddress"`
+}
+
+// resourceTypesByPath gives the resource type of the resources under a leading resource path
+// segment, for events that do not report one.
+var resourceTypesByPath = map[string]string{
+	"users":             "USER",
+	"groups":            "GROUP",
+	"roles":             "REALM_ROLE",
+	"roles-by-id":       "REALM_ROLE",
+	"clients":           "CLIENT",
+	"client-scopes":     "CLIENT_SCOPE",
+	"identity-provider": "IDENTITY_PROVIDER",
+	"components":        "COMPONENT",
+	"authentication":    "AUTH_FLOW",
+}
+
+// parseAdminEvent converts an admin event, as decoded from keyclock's JSON, into an AdminEvent.
+// Fields of an unexpected type are read as best they can be rather than failing the event.
+func parseAdminEvent(raw map[string]any) AdminEvent {
+	event := AdminEvent{
+		ID:             stringField(raw, "id"),
+		RealmID:        stringField(raw, "realmId"),
+		OperationType:  stringField(raw, "operationType"),
+		ResourceType:   stringField(raw, "resourceType"),
+		ResourcePath:   stringField(raw, "resourcePath"),
+		Representation: stringField(raw, "representation"),
+		Error:          stringField(raw, "error"),
+	}
+	if millis, ok := int64Field(raw, "time"); ok {
+		event.Time = time.UnixMilli(millis).UTC()
+	}
+	if event.ResourceType == "" {
+		segment, _, _ := strings.Cut(event.ResourcePath, "/")
+		event.ResourceType = resourceTypesByPath[segment]
+	}
+	if auth, ok := raw["authDetails"].(map[string]any); ok {
+		event.AuthDetails = AdminEventAuth{
+			RealmID:   stringField(auth, "realmId"),
+			ClientID:  stringField(auth, "clientId"),
+			UserID:    stringField(auth, "userId"),
+			IPAddress: stringField(auth, "ipAddress"),
+		}
+	}
+	if details, ok := raw["details"].(map[string]any); ok && len(details) > 0 {
+		event.Details = make(map[string]string, len(details))
+		for key := range details {
+			event.Details[key] = stringField(details, key)
+		}
+	}
+	return event
+}
+
+// stringField returns the value of key in m as a string, formatting values that are not strings.
+func stringField(m map[string]any, key string) string {
+	switch v := m[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// int64Field returns the value of key in m as an integer, accepting numbers and numeric strings.
+func int64Field(m map[string]any, key string) (int64, bool) {
+	switch v := m[key].(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,133 @@
+package eventservice
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// eventDateLayout is the date format keycloak expects for event date filters.
+	eventDateLayout = "2006-01-02"
+	// maxEventRangeDays is the widest date range that may be queried in one request.
+	maxEventRangeDays = 31
+	// defaultEventRangeDays is the date range queried when the request gives none.
+	defaultEventRangeDays = 7
+)
+
+// adminEventFilters maps the query parameters filtering admin events on their exact value to
+// the keyclock query parameters they are passed on as. resourcePath may use * as a wildcard.
+var adminEventFilters = map[string]string{
+	"resourcePath":  "resourcePath",
+	"authUser":      "authUser",
+	"authClient":    "authClient",
+	"authRealm":     "authRealm",
+	"authIpAddress": "authIpAddress",
+}
+
+// HandleAdminEventsRequest is a Handler function for fetching keyclock admin events filtered
+// by operation type, resource type, resource path, author and date range. The events are
+// returned as AdminEvent whatever shape the keyclock version serves them in.
+func HandleAdminEventsRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("admin events request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	first, max, ok := utils.GetPageParams(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid paging parameters", logharbour.DebugInfo{Variables: map[string]any{"first": c.Query("first"), "max": c.Query("max")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	dateFrom, dateTo, errcode := getEventDateRange(c, "dateFrom", "dateTo")
+	if errcode != "" {
+		lh.Debug0().LogDebug("Invalid date range", logharbour.DebugInfo{Variables: map[string]any{"dateFrom": c.Query("dateFrom"), "dateTo": c.Query("dateTo")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// gocloak does not wrap the admin events resource, so call it directly
+	request := client.GetRequestWithBearerAuth(ctx, token).
+		SetQueryParam("dateFrom", dateFrom.Format(eventDateLayout)).
+		SetQueryParam("dateTo", dateTo.Format(eventDateLayout)).
+		SetQueryParam("first", strconv.Itoa(first)).
+		SetQueryParam("max", strconv.Itoa(max))
+	if operationType := c.Query("operationType"); operationType != "" {
+		request.SetQueryParam("operationTypes", strings.ToUpper(operationType))
+	}
+	if resourceType := c.Query("resourceType"); resourceType != "" {
+		request.SetQueryParam("resourceTypes", strings.ToUpper(resourceType))
+	}
+	for param, keycloakParam := range adminEventFilters {
+		if value := c.Query(param); value != "" {
+			request.SetQueryParam(keycloakParam, value)
+		}
+	}
+
+	var events []map[string]any
+	resp, err := request.SetResult(&events).Get(utils.KeycloakAdminURL(keycloakURL, realm, "admin-events"))
+	if err := utils.CheckKeycloakResponse(resp, err); err != nil {
+		lh.LogActivity("Error while fetching admin events:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+	typed := make([]AdminEvent, 0, len(events))
+	for _, event := range events {
+		typed = append(typed, parseAdminEvent(event))
+	}
+
+	// Send success response
+	utils.SendListResponse(c, typed, utils.NewListMeta(c, -1, first, max, len(typed)))
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of adminEvents", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getEventDateRange reads the date range from the fromParam and toParam query parameters,
+// defaulting to the last defaultEventRangeDays days. It returns a non-empty error code if the
+// dates are invalid or span more than maxEventRangeDays.
+func getEventDateRange(c *gin.Context, fromParam, toParam string) (from, to time.Time, errcode string) {
+	var err error
+	to = time.Now().UTC()
+	if v := c.Query(toParam); v != "" {
+		if to, err = time.Parse(eventDateLayout, v); err != nil {
+			return from, to, "invalid_request"
+		}
+	}
+	from = to.AddDate(0, 0, -defaultEventRangeDays)
+	if v := c.Query(fromParam); v != "" {
+		if from, err = time.Parse(eventDateLayout, v); err != nil {
+			return from, to, "invalid_request"
+		}
+	}
+	if from.After(to) {
+		return from, to, "invalid_request"
+	}
+	if to.Sub(from) > maxEventRangeDays*24*time.Hour {
+		return from, to, "range_too_large"
+	}
+	return from, to, ""
+}
@@ -0,0 +1,195 @@
+package eventservice
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// loginEventPageSize is the number of login events fetched from keyclock at a time.
+	loginEventPageSize = 1000
+	// maxLoginEventScan is the largest number of login events aggregated for one request.
+	maxLoginEventScan = 100000
+	// loginStatsCacheTTL is how long login statistics are served from the cache.
+	loginStatsCacheTTL = time.Minute
+)
+
+// LoginCounts holds the number of successful and failed logins.
+type LoginCounts struct {
+	Logins      int `json:"logins"`
+	LoginErrors int `json:"loginErrors"`
+}
+
+// LoginDayStats holds the login counts of a day.
+type LoginDayStats struct {
+	Date string `json:"date"`
+	LoginCounts
+}
+
+// LoginClientStats holds the login counts of a client.
+type LoginClientStats struct {
+	ClientID string `json:"clientId"`
+	LoginCounts
+}
+
+// LoginStatsResponse represents the structure for outgoing login statistics responses. Days holds
+// every day of the range, including those without logins, and Clients every client logged in to.
+// Truncated is set when more than maxLoginEventScan events were found, of which only the most recent
+// were counted.
+type LoginStatsResponse struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	LoginCounts
+	Days      []LoginDayStats    `json:"days"`
+	Clients   []LoginClientStats `json:"clients"`
+	Scanned   int                `json:"scanned"`
+	Truncated bool               `json:"truncated"`
+}
+
+// loginStatsCache holds recently computed login statistics keyed by realm, date range and caller,
+// so that statistics are only served to callers keyclock lets view the realm's events.
+var loginStatsCache = utils.NewTTLCache[LoginStatsResponse](loginStatsCacheTTL)
+
+// HandleLoginStatsRequest is a Handler function for aggregating the LOGIN and LOGIN_ERROR events keyclock
+// recorded between two dates, e.g. /login-stats?from=2024-01-01&to=2024-01-31, into counts per day and per
+// client. The range defaults to the last 7 days and spans at most 31. Results are cached for a minute.
+func HandleLoginStatsRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("login stats request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	from, to, errcode := getEventDateRange(c, "from", "to")
+	if errcode != "" {
+		lh.Debug0().LogDebug("Invalid date range", logharbour.DebugInfo{Variables: map[string]any{"from": c.Query("from"), "to": c.Query("to")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+
+	cacheKey := utils.CallerCacheKey(token, realm, from.Format(eventDateLayout), to.Format(eventDateLayout))
+	if stats, ok := loginStatsCache.Get(cacheKey); ok {
+		lh.Debug0().LogDebug("login stats served from cache", logharbour.DebugInfo{Variables: map[string]any{"realm": realm}})
+		utils.SendSuccessResponse(c, stats)
+		return
+	}
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	stats := newLoginStats(from, to)
+	days := map[string]*LoginCounts{}
+	for i := range stats.Days {
+		days[stats.Days[i].Date] = &stats.Days[i].LoginCounts
+	}
+	clients := map[string]*LoginCounts{}
+
+	// gocloak cannot filter events on several types, so call the events resource directly
+	for first := 0; ; first += loginEventPageSize {
+		if first >= maxLoginEventScan {
+			stats.Truncated = true
+			break
+		}
+		var events []loginEvent
+		resp, err := client.GetRequestWithBearerAuth(ctx, token).
+			SetQueryParamsFromValues(url.Values{"type": {"LOGIN", "LOGIN_ERROR"}}).
+			SetQueryParam("dateFrom", stats.From).
+			SetQueryParam("dateTo", stats.To).
+			SetQueryParam("first", strconv.Itoa(first)).
+			SetQueryParam("max", strconv.Itoa(loginEventPageSize)).
+			SetResult(&events).
+			Get(utils.KeycloakAdminURL(keycloakURL, realm, "events"))
+		if err := utils.CheckKeycloakResponse(resp, err); err != nil {
+			lh.LogActivity("Error while fetching login events:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "first": first}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+			return
+		}
+		for _, event := range events {
+			counts := clients[event.ClientID]
+			if counts == nil {
+				counts = &LoginCounts{}
+				clients[event.ClientID] = counts
+			}
+			day := days[time.UnixMilli(event.Time).UTC().Format(eventDateLayout)]
+			for _, counted := range []*LoginCounts{&stats.LoginCounts, counts, day} {
+				if counted != nil {
+					counted.add(event.Type)
+				}
+			}
+		}
+		stats.Scanned += len(events)
+		if len(events) < loginEventPageSize {
+			break
+		}
+	}
+	if stats.Truncated {
+		lh.Warn().LogActivity("Login stats scan stopped early", map[string]any{"realm": realm, "from": stats.From, "to": stats.To, "scanned": stats.Scanned})
+	}
+
+	for clientID, counts := range clients {
+		stats.Clients = append(stats.Clients, LoginClientStats{ClientID: clientID, LoginCounts: *counts})
+	}
+	sort.Slice(stats.Clients, func(i, j int) bool { return stats.Clients[i].ClientID < stats.Clients[j].ClientID })
+	loginStatsCache.Set(cacheKey, stats)
+
+	// Send success response
+	utils.SendSuccessResponse(c, stats)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of loginStats", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// loginEvent is the part of a keyclock event needed for login statistics.
+type loginEvent struct {
+	Time     int64  `json:"time"`
+	Type     string `json:"type"`
+	ClientID string `json:"clientId"`
+}
+
+// newLoginStats returns empty login statistics for the days from from to to.
+func newLoginStats(from, to time.Time) LoginStatsResponse {
+	stats := LoginStatsResponse{
+		From:    from.Format(eventDateLayout),
+		To:      to.Format(eventDateLayout),
+		Days:    []LoginDayStats{},
+		Clients: []LoginClientStats{},
+	}
+	last := stats.To
+	for day := from; ; day = day.AddDate(0, 0, 1) {
+		date := day.Format(eventDateLayout)
+		stats.Days = append(stats.Days, LoginDayStats{Date: date})
+		if date >= last {
+			break
+		}
+	}
+	return stats
+}
+
+// add counts an event of the given type.
+func (counts *LoginCounts) add(eventType string) {
+	switch eventType {
+	case "LOGIN":
+		counts.Logins++
+	case "LOGIN_ERROR":
+		counts.LoginErrors++
+	}
+}
@@ -0,0 +1,203 @@
+package groupservice
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// bulkDeleteCapability is the capability a caller must hold to bulk delete groups.
+const bulkDeleteCapability = "group_bulk_delete"
+
+// GroupBulkDeleteRequest represents the structure for incoming group bulk delete requests.
+// The group at PathPrefix and every group beneath it are deleted; PathPrefix matches whole
+// path segments, so /tenants/acme does not match /tenants/acme-corp. Confirm must be true
+// unless DryRun is set, in which case nothing is deleted.
+type GroupBulkDeleteRequest struct {
+	PathPrefix string `json:"pathPrefix" validate:"required,startswith=/,min=2"`
+	Confirm    bool   `json:"confirm"`
+	DryRun     bool   `json:"dryRun"`
+}
+
+// GroupBulkDeleteResponse represents the structure for outgoing group bulk delete responses.
+// Groups lists the paths of every matching group, including those removed along with
+// their parent. When deleting fails part way, the error response holds it with Groups
+// listing the groups deleted before the failure.
+type GroupBulkDeleteResponse struct {
+	DryRun bool     `json:"dryRun"`
+	Groups []string `json:"groups"`
+}
+
+// HandleGroupBulkDeleteRequest is a Handler function for deleting every group under a path prefix in keyclock
+func HandleGroupBulkDeleteRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group bulk delete request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into GroupBulkDeleteRequest struct
+	var req GroupBulkDeleteRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForGroupBulkDeleteError)
+	if len(validationErrors) == 0 && !req.DryRun && !req.Confirm {
+		field := "confirm"
+		validationErrors = append(validationErrors, wscutils.BuildErrorMessage("confirmation_required", &field))
+	}
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	idempotent, ok := utils.GetIdempotentParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid idempotent parameter", logharbour.DebugInfo{Variables: map[string]any{"idempotent": c.Query("idempotent")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "idempotent"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	capabilitiesGroup := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Bulk deletion is destructive enough to need a capability of its own
+	capable, err := utils.HasCapability(ctx, client, token, capabilitiesGroup, bulkDeleteCapability)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while checking capability:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+		return
+	}
+	if !capable {
+		lh.Sec().LogActivity("Group bulk delete refused, caller lacks capability", map[string]any{"caller": utils.SubjectFromToken(token), "capability": bulkDeleteCapability})
+		utils.SendErrorResponse(c, utils.ErrorResponse("Forbidden", ""))
+		return
+	}
+
+	groups, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{BriefRepresentation: gocloak.BoolP(false)})
+	if err != nil {
+		lh.LogActivity("Error while fetching Groups:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	matched, roots := matchGroupsByPrefix(derefGroups(groups), req.PathPrefix, false, nil, nil)
+
+	// Never delete the capabilities root or any capability beneath it
+	capabilitiesPath := "/" + capabilitiesGroup
+	for _, path := range matched {
+		if underPath(path, capabilitiesPath) {
+			lh.Sec().LogActivity("Group bulk delete refused, prefix matches capabilities", map[string]any{"caller": utils.SubjectFromToken(token), "pathPrefix": req.PathPrefix})
+			utils.SendErrorResponse(c, utils.ErrorResponse("protected_group", "pathPrefix", path))
+			return
+		}
+	}
+
+	if !req.DryRun {
+		// Deleting a group also deletes its sub groups, so only the topmost matches are deleted
+		deleted := []string{}
+		var deleteErr error
+		for _, group := range roots {
+			err := client.DeleteGroup(ctx, token, realm, gocloak.PString(group.ID))
+			if idempotent && utils.IsNotFound(err) {
+				// Deleted by someone else since being listed
+				lh.Debug0().LogDebug("Group already deleted", logharbour.DebugInfo{Variables: map[string]any{"path": gocloak.PString(group.Path)}})
+				continue
+			}
+			if err != nil {
+				lh.LogActivity("Error while deleting group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "path": gocloak.PString(group.Path)}})
+				deleteErr = err
+				break
+			}
+			for _, path := range matched {
+				if underPath(path, gocloak.PString(group.Path)) {
+					deleted = append(deleted, path)
+				}
+			}
+			utils.GroupMembershipChanged(realm, gocloak.PString(group.ID))
+		}
+		utils.GroupsChanged(realm)
+
+		// Audit the change along with who made it, including the groups deleted before a failure
+		if len(deleted) > 0 {
+			lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("group").WithWhatInstanceId(req.PathPrefix).
+				LogDataChange("groups bulk deleted", logharbour.ChangeInfo{
+					Entity:    "group",
+					Operation: "delete",
+					Changes:   map[string]any{"groups": deleted, "partial": deleteErr != nil},
+				})
+		}
+		if deleteErr != nil {
+			response := utils.ErrorResponse(utils.KeycloakErrorCode(deleteErr, "group_not_found"), "")
+			response.Data = GroupBulkDeleteResponse{Groups: deleted}
+			utils.SendErrorResponse(c, response)
+			return
+		}
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, GroupBulkDeleteResponse{DryRun: req.DryRun, Groups: matched})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupBulkDelete", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// matchGroupsByPrefix walks a group tree and appends to matched the path of every group at or
+// beneath the path prefix, and to roots those matching groups whose parent did not match.
+func matchGroupsByPrefix(groups []gocloak.Group, prefix string, parentMatched bool, matched []string, roots []gocloak.Group) ([]string, []gocloak.Group) {
+	for _, group := range groups {
+		isMatch := underPath(gocloak.PString(group.Path), prefix)
+		if isMatch {
+			matched = append(matched, gocloak.PString(group.Path))
+			if !parentMatched {
+				roots = append(roots, group)
+			}
+		}
+		if group.SubGroups != nil {
+			matched, roots = matchGroupsByPrefix(*group.SubGroups, prefix, isMatch, matched, roots)
+		}
+	}
+	if matched == nil {
+		matched = []string{}
+	}
+	return matched, roots
+}
+
+// underPath reports whether path is prefix or a path beneath it. Whole path segments are
+// compared, so /tenants/acme-corp is not beneath /tenants/acme.
+func underPath(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// getValsForGroupBulkDeleteError returns a slice of strings to be used as vals for a validation error.
+func (req *GroupBulkDeleteRequest) getValsForGroupBulkDeleteError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "PathPrefix":
+		vals = append(vals, "pathPrefix must be a group path such as /tenants/acme")
+	}
+	return vals
+}
@@ -0,0 +1,129 @@
+package groupservice
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils/keycloakmock"
+)
+
+// bulkDeleterToken is an unsigned token of a caller of the test realm.
+var bulkDeleterToken = "e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"asha-id","iss":"https://keycloak.example.com/realms/test"}`)) + ".sig"
+
+// tenantGroup returns a group at path with the given sub groups, its ID being its path.
+func tenantGroup(path string, subGroups ...gocloak.Group) *gocloak.Group {
+	return &gocloak.Group{ID: gocloak.StringP(path), Path: gocloak.StringP(path), SubGroups: &subGroups}
+}
+
+// bulkDeleteService returns a service for a caller holding the bulk delete capability in a realm
+// holding /tenants/acme and /tenants/acme-corp, deleting groups with deleteGroup.
+func bulkDeleteService(deleteGroup func(groupID string) error) *service.Service {
+	client := &keycloakmock.Client{
+		GetUserGroupsFunc: func(context.Context, string, string, string, gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+			return []*gocloak.Group{{Path: gocloak.StringP("/capabilities/" + bulkDeleteCapability)}}, nil
+		},
+		GetGroupsFunc: func(context.Context, string, string, gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+			return []*gocloak.Group{tenantGroup("/tenants",
+				*tenantGroup("/tenants/acme", *tenantGroup("/tenants/acme/eu")),
+				*tenantGroup("/tenants/acme-corp", *tenantGroup("/tenants/acme-corp/us")),
+			)}, nil
+		},
+		DeleteGroupFunc: func(_ context.Context, _, _, groupID string) error {
+			return deleteGroup(groupID)
+		},
+	}
+	return newTestService(client).WithDependency("capabilitiesGroup", "capabilities")
+}
+
+// responseGroups returns the groups listed in the data of a bulk delete response.
+func responseGroups(t *testing.T, data any) []string {
+	t.Helper()
+	body, _ := json.Marshal(data)
+	var response GroupBulkDeleteResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("data is not a bulk delete response: %v: %s", err, body)
+	}
+	return response.Groups
+}
+
+func TestHandleGroupBulkDeleteRequestPrefix(t *testing.T) {
+	tests := []struct {
+		name        string
+		pathPrefix  string
+		wantDeleted []string
+		wantGroups  []string
+	}{
+		{
+			name:        "sibling sharing the name prefix left alone",
+			pathPrefix:  "/tenants/acme",
+			wantDeleted: []string{"/tenants/acme"},
+			wantGroups:  []string{"/tenants/acme", "/tenants/acme/eu"},
+		},
+		{
+			name:        "sub groups only",
+			pathPrefix:  "/tenants/acme/",
+			wantDeleted: []string{"/tenants/acme/eu"},
+			wantGroups:  []string{"/tenants/acme/eu"},
+		},
+		{
+			name:        "partial segment matches nothing",
+			pathPrefix:  "/tenants/ac",
+			wantDeleted: nil,
+			wantGroups:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			s := bulkDeleteService(func(groupID string) error {
+				deleted = append(deleted, groupID)
+				return nil
+			})
+
+			w := serveWithToken(s, HandleGroupBulkDeleteRequest, bulkDeleterToken, http.MethodPost, "/group-bulk-delete",
+				`{"data": {"pathPrefix": "`+tt.pathPrefix+`", "confirm": true}}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+				t.Errorf("deleted %v, want %v", deleted, tt.wantDeleted)
+			}
+			if got := responseGroups(t, decodeResponse(t, w).Data); !reflect.DeepEqual(got, tt.wantGroups) {
+				t.Errorf("groups = %v, want %v", got, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestHandleGroupBulkDeleteRequestPartialFailure(t *testing.T) {
+	var attempted []string
+	s := bulkDeleteService(func(groupID string) error {
+		attempted = append(attempted, groupID)
+		if groupID == "/tenants/acme-corp" {
+			return &gocloak.APIError{Code: http.StatusForbidden, Message: "403 Forbidden: HTTP 403 Forbidden"}
+		}
+		return nil
+	})
+
+	w := serveWithToken(s, HandleGroupBulkDeleteRequest, bulkDeleterToken, http.MethodPost, "/group-bulk-delete",
+		`{"data": {"pathPrefix": "/tenants/", "confirm": true}}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body.String())
+	}
+	if want := []string{"/tenants/acme", "/tenants/acme-corp"}; !reflect.DeepEqual(attempted, want) {
+		t.Errorf("deletes attempted %v, want %v", attempted, want)
+	}
+	response := decodeResponse(t, w)
+	if len(response.Messages) != 1 || response.Messages[0].ErrCode != "Forbidden" {
+		t.Errorf("messages = %+v, want a single Forbidden", response.Messages)
+	}
+	if got, want := responseGroups(t, response.Data), []string{"/tenants/acme", "/tenants/acme/eu"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %v, want those deleted before the failure, %v", got, want)
+	}
+}
@@ -0,0 +1,91 @@
+package groupservice
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// GroupResponse represents the structure for outgoing single group responses. Type is the
+// idshield type of the group, group or capability. DisplayName is the group's display name in
+// the language the request asks for, or its name. CreatedAt and UpdatedAt are left out for
+// groups created before idshield started recording them.
+type GroupResponse struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	DisplayName string               `json:"displayName"`
+	Path        string               `json:"path"`
+	Type        string               `json:"type"`
+	CreatedAt   *time.Time           `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time           `json:"updatedAt,omitempty"`
+	Attributes  *map[string][]string `json:"attributes"`
+}
+
+// HandleGroupGetByPathRequest is a Handler function for fetching a group in keyclock by its full path,
+// e.g. /parent/child
+func HandleGroupGetByPathRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("get group by path request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	path := c.Query("path")
+	if len(path) < 2 || !strings.HasPrefix(path, "/") {
+		lh.Debug0().LogDebug("Missing or relative group path", logharbour.DebugInfo{Variables: map[string]any{"path": path}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "path"))
+		return
+	}
+
+	raw, ok := utils.GetRawParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid raw parameter", logharbour.DebugInfo{Variables: map[string]any{"raw": c.Query("raw")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	group, err := client.GetGroupByPath(ctx, token, realm, path)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching group by path:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "path": path}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	// Send success response, with keycloak's own representation if asked for
+	response := GroupResponse{
+		ID:         gocloak.PString(group.ID),
+		Name:       gocloak.PString(group.Name),
+		Path:       gocloak.PString(group.Path),
+		Type:       utils.GroupType(group.Attributes),
+		Attributes: group.Attributes,
+	}
+	response.DisplayName = utils.DisplayName(utils.RequestLanguages(c), response.Name, group.Attributes)
+	response.CreatedAt, response.UpdatedAt = utils.GroupTimestamps(group.Attributes)
+	var data any = response
+	if raw {
+		data = group
+	}
+	utils.SendSuccessResponse(c, data)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of getGroupByPath", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
@@ -0,0 +1,192 @@
+package groupservice
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// GroupDiffSection holds the attributes and directly mapped roles one group has and the other lacks.
+// ClientRoles is keyed by client ID.
+type GroupDiffSection struct {
+	Attributes  map[string][]string `json:"attributes"`
+	RealmRoles  []string            `json:"realmRoles"`
+	ClientRoles map[string][]string `json:"clientRoles"`
+}
+
+// ChangedAttribute holds the values of an attribute both groups have, but with different values.
+type ChangedAttribute struct {
+	A []string `json:"a"`
+	B []string `json:"b"`
+}
+
+// GroupDiffResponse represents the structure for outgoing group comparison responses. Added holds what
+// group B has and group A lacks, Removed what A has and B lacks, and Changed the attributes they both
+// have with different values. Identical is set when there is no difference at all.
+type GroupDiffResponse struct {
+	A         GroupRef                    `json:"a"`
+	B         GroupRef                    `json:"b"`
+	Identical bool                        `json:"identical"`
+	Added     GroupDiffSection            `json:"added"`
+	Removed   GroupDiffSection            `json:"removed"`
+	Changed   map[string]ChangedAttribute `json:"changed"`
+}
+
+// GroupRef names a group compared.
+type GroupRef struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+}
+
+// groupConfig is what is compared of a group: its attributes and its directly mapped roles.
+type groupConfig struct {
+	group       *gocloak.Group
+	realmRoles  []string
+	clientRoles map[string][]string
+}
+
+// HandleGroupDiffRequest is a Handler function for comparing the configuration of two groups in keyclock,
+// e.g. /group-diff?a=ID&b=ID, to check that two environments or tenants are set up alike. The attributes and
+// the roles mapped directly to each group are compared; the order of values does not matter, and the
+// creation and update times idshield records are left out.
+func HandleGroupDiffRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group diff request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	idA, idB := c.Query("a"), c.Query("b")
+	sides := []struct{ field, id string }{{"a", idA}, {"b", idB}}
+	for _, side := range sides {
+		if side.id == "" {
+			lh.Debug0().LogDebug("Missing group ID", logharbour.DebugInfo{Variables: map[string]any{"field": side.field}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("missing", side.field))
+			return
+		}
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	configs := make([]*groupConfig, 2)
+	for i, side := range sides {
+		configs[i], err = loadGroupConfig(ctx, client, token, realm, side.id)
+		if err != nil {
+			lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": side.id}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), side.field))
+			return
+		}
+	}
+	a, b := configs[0], configs[1]
+
+	response := GroupDiffResponse{
+		A:       GroupRef{ID: idA, Path: gocloak.PString(a.group.Path)},
+		B:       GroupRef{ID: idB, Path: gocloak.PString(b.group.Path)},
+		Added:   GroupDiffSection{Attributes: map[string][]string{}, RealmRoles: missingNames(b.realmRoles, a.realmRoles), ClientRoles: map[string][]string{}},
+		Removed: GroupDiffSection{Attributes: map[string][]string{}, RealmRoles: missingNames(a.realmRoles, b.realmRoles), ClientRoles: map[string][]string{}},
+		Changed: map[string]ChangedAttribute{},
+	}
+
+	// The timestamps always differ between groups, so they are left out
+	attributesA := *utils.WithTimestampsOf(a.group.Attributes, nil)
+	attributesB := *utils.WithTimestampsOf(b.group.Attributes, nil)
+	for key, values := range attributesB {
+		existing, ok := attributesA[key]
+		switch {
+		case !ok:
+			response.Added.Attributes[key] = values
+		case !sameValues(existing, values):
+			response.Changed[key] = ChangedAttribute{A: existing, B: values}
+		}
+	}
+	for key, values := range attributesA {
+		if _, ok := attributesB[key]; !ok {
+			response.Removed.Attributes[key] = values
+		}
+	}
+
+	for clientID, names := range b.clientRoles {
+		if missing := missingNames(names, a.clientRoles[clientID]); len(missing) > 0 {
+			response.Added.ClientRoles[clientID] = missing
+		}
+	}
+	for clientID, names := range a.clientRoles {
+		if missing := missingNames(names, b.clientRoles[clientID]); len(missing) > 0 {
+			response.Removed.ClientRoles[clientID] = missing
+		}
+	}
+
+	response.Identical = len(response.Changed) == 0 && response.Added.empty() && response.Removed.empty()
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupDiff", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// loadGroupConfig fetches a group along with the names of the roles mapped directly to it.
+func loadGroupConfig(ctx context.Context, client utils.KeycloakClient, token, realm, groupID string) (*groupConfig, error) {
+	group, err := client.GetGroup(ctx, token, realm, groupID)
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := client.GetRoleMappingByGroupID(ctx, token, realm, groupID)
+	if err != nil {
+		return nil, err
+	}
+	config := &groupConfig{group: group, clientRoles: map[string][]string{}}
+	if mappings.RealmMappings != nil {
+		for _, role := range *mappings.RealmMappings {
+			config.realmRoles = append(config.realmRoles, gocloak.PString(role.Name))
+		}
+	}
+	for clientID, clientMappings := range mappings.ClientMappings {
+		if clientMappings == nil || clientMappings.Mappings == nil {
+			continue
+		}
+		for _, role := range *clientMappings.Mappings {
+			config.clientRoles[clientID] = append(config.clientRoles[clientID], gocloak.PString(role.Name))
+		}
+	}
+	return config, nil
+}
+
+// missingNames returns, sorted, the names in names that are not in others.
+func missingNames(names, others []string) []string {
+	have := make(map[string]bool, len(others))
+	for _, name := range others {
+		have[name] = true
+	}
+	missing := []string{}
+	for _, name := range names {
+		if !have[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// empty reports whether the section holds nothing.
+func (section GroupDiffSection) empty() bool {
+	return len(section.Attributes) == 0 && len(section.RealmRoles) == 0 && len(section.ClientRoles) == 0
+}
@@ -0,0 +1,425 @@
+package groupservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// GroupExport is the portable representation of a group, its sub groups, attributes and
+// role mappings. It carries no Keycloak IDs so that it can be imported into another realm.
+// ClientRoles is keyed by client ID.
+type GroupExport struct {
+	Name        string              `json:"name" validate:"required"`
+	Attributes  map[string][]string `json:"attributes,omitempty"`
+	RealmRoles  []string            `json:"realmRoles,omitempty"`
+	ClientRoles map[string][]string `json:"clientRoles,omitempty"`
+	SubGroups   []GroupExport       `json:"subGroups,omitempty" validate:"dive"`
+}
+
+// GroupImportRequest represents the structure for incoming group import requests. When
+// ParentID is empty the group is imported as a top level group.
+type GroupImportRequest struct {
+	ParentID string      `json:"parentID,omitempty"`
+	Group    GroupExport `json:"group"`
+}
+
+// MissingRole identifies a role mapping that could not be imported because the role does
+// not exist in the target realm. ClientID is empty for realm roles.
+type MissingRole struct {
+	Path     string `json:"path"`
+	Role     string `json:"role"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// GroupImportResponse represents the structure for outgoing group import responses.
+type GroupImportResponse struct {
+	ID           string        `json:"id"`
+	Path         string        `json:"path"`
+	MissingRoles []MissingRole `json:"missingRoles"`
+}
+
+// errTreeTooLarge is returned while exporting a group tree deeper or larger than a group tree may be.
+var errTreeTooLarge = errors.New("group tree too large")
+
+// HandleGroupExportRequest is a Handler function for exporting a group from keyclock as portable JSON
+func HandleGroupExportRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group export request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	groupID := c.Query("groupID")
+	if groupID == "" {
+		lh.Debug0().LogDebug("Missing groupID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "groupID"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	nodeCount := 0
+	export, err := exportGroup(ctx, client, token, realm, groupID, 1, &nodeCount)
+	if errors.Is(err, errTreeTooLarge) {
+		lh.Debug0().LogDebug("group tree exceeds bounds", logharbour.DebugInfo{Variables: map[string]any{"maxDepth": maxTreeDepth, "maxNodes": maxTreeNodes}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("tree_too_large", ""))
+		return
+	}
+	if err != nil {
+		lh.LogActivity("Error while exporting group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "groupID": groupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, export)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupExport", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// exportGroup builds the portable representation of a group and, recursively, of its sub groups.
+func exportGroup(ctx context.Context, client utils.KeycloakClient, token, realm, groupID string, depth int, nodeCount *int) (GroupExport, error) {
+	*nodeCount++
+	if depth > maxTreeDepth || *nodeCount > maxTreeNodes {
+		return GroupExport{}, errTreeTooLarge
+	}
+	group, err := client.GetGroup(ctx, token, realm, groupID)
+	if err != nil {
+		return GroupExport{}, err
+	}
+	mappings, err := client.GetRoleMappingByGroupID(ctx, token, realm, groupID)
+	if err != nil {
+		return GroupExport{}, err
+	}
+
+	export := GroupExport{Name: gocloak.PString(group.Name)}
+	if group.Attributes != nil {
+		export.Attributes = *group.Attributes
+	}
+	if mappings.RealmMappings != nil {
+		for _, role := range *mappings.RealmMappings {
+			export.RealmRoles = append(export.RealmRoles, gocloak.PString(role.Name))
+		}
+		sort.Strings(export.RealmRoles)
+	}
+	for clientID, clientMappings := range mappings.ClientMappings {
+		if clientMappings == nil || clientMappings.Mappings == nil {
+			continue
+		}
+		if export.ClientRoles == nil {
+			export.ClientRoles = map[string][]string{}
+		}
+		for _, role := range *clientMappings.Mappings {
+			export.ClientRoles[clientID] = append(export.ClientRoles[clientID], gocloak.PString(role.Name))
+		}
+		sort.Strings(export.ClientRoles[clientID])
+	}
+
+	if group.SubGroups != nil {
+		for _, subGroup := range *group.SubGroups {
+			child, err := exportGroup(ctx, client, token, realm, gocloak.PString(subGroup.ID), depth+1, nodeCount)
+			if err != nil {
+				return GroupExport{}, err
+			}
+			export.SubGroups = append(export.SubGroups, child)
+		}
+	}
+	return export, nil
+}
+
+// HandleGroupImportRequest is a Handler function for recreating an exported group in keyclock.
+// Role mappings whose role does not exist in the target realm are skipped and reported.
+func HandleGroupImportRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group import request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into GroupImportRequest struct
+	var req GroupImportRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForGroupImportError)
+	validationErrors = append(validationErrors, validateImportAttributes(lh, &req.Group)...)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	importer := &groupImporter{ctx: ctx, client: client, token: token, realm: realm, clientIDs: map[string]string{}}
+	groupID, err := importer.importGroup(req.ParentID, req.Group)
+
+	// Part of the tree may have been created even if the import failed
+	utils.GroupsChanged(realm)
+
+	var uniqueErr *uniqueAttributeError
+	if errors.As(err, &uniqueErr) {
+		lh.Debug0().LogDebug("Unique attribute values already held:", logharbour.DebugInfo{Variables: map[string]interface{}{"conflicts": uniqueErr.conflicts}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, uniqueErr.conflicts))
+		return
+	}
+	if err != nil {
+		lh.LogActivity("Error while importing group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		errcode := utils.KeycloakErrorCode(err, "group_not_found")
+		if utils.IsConflict(err) {
+			errcode = "name already exist"
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
+	}
+
+	group, err := client.GetGroup(ctx, token, realm, groupID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching imported group:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	if len(importer.missingRoles) > 0 {
+		lh.Warn().LogActivity("Group imported without some of its roles", map[string]any{"missingRoles": importer.missingRoles})
+	}
+
+	// Let any configured webhooks know about the change
+	s.Dependencies["webhooks"].(*utils.WebhookNotifier).Notify("group", "created", groupID, realm, utils.SubjectFromToken(token))
+
+	// Send success response
+	utils.SendSuccessResponse(c, GroupImportResponse{
+		ID:           groupID,
+		Path:         gocloak.PString(group.Path),
+		MissingRoles: append([]MissingRole{}, importer.missingRoles...),
+	})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupImport", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// validateImportAttributes checks the attributes of every group in an export for duplicate
+// values and against the configured attribute schemas, removing duplicates unless they are
+// rejected.
+func validateImportAttributes(lh *logharbour.Logger, export *GroupExport) []wscutils.ErrorMessage {
+	attributes, duplicated, errs := utils.DedupeAttributes(&export.Attributes)
+	if len(duplicated) > 0 && len(errs) == 0 {
+		lh.Warn().LogActivity("Duplicate attribute values removed", map[string]any{"group": export.Name, "keys": duplicated})
+	}
+	export.Attributes = *attributes
+	errs = append(errs, utils.ValidateAttributes(utils.GroupType(attributes), attributes)...)
+	for i := range export.SubGroups {
+		errs = append(errs, validateImportAttributes(lh, &export.SubGroups[i])...)
+	}
+	return errs
+}
+
+// groupImporter recreates exported groups in a realm, collecting the roles it could not map.
+type groupImporter struct {
+	ctx          context.Context
+	client       utils.KeycloakClient
+	token        string
+	realm        string
+	clientIDs    map[string]string // internal client ID keyed by client ID
+	missingRoles []MissingRole
+}
+
+// importGroup creates export, along with its sub groups, under parentID, or at the top level if
+// parentID is empty, and returns the new group's ID.
+func (im *groupImporter) importGroup(parentID string, export GroupExport) (string, error) {
+	groupID, _, err := im.createGroup(parentID, export)
+	if err != nil {
+		return "", err
+	}
+	for _, subGroup := range export.SubGroups {
+		if _, err := im.importGroup(groupID, subGroup); err != nil {
+			return "", err
+		}
+	}
+	return groupID, nil
+}
+
+// createGroup creates export, leaving out its sub groups, under parentID, or at the top level if
+// parentID is empty, and maps its roles. It returns the new group's ID and path.
+func (im *groupImporter) createGroup(parentID string, export GroupExport) (string, string, error) {
+	attributes := export.Attributes
+	// The group does not exist yet, so any group holding one of its unique values is another
+	if err := im.checkUniqueAttributes("", &attributes); err != nil {
+		return "", "", err
+	}
+	group := gocloak.Group{
+		Name:       gocloak.StringP(export.Name),
+		Attributes: utils.StampCreated(utils.WithGroupType(&attributes, utils.GroupType(&attributes))),
+	}
+	var groupID string
+	var err error
+	if parentID == "" {
+		groupID, err = im.client.CreateGroup(im.ctx, im.token, im.realm, group)
+	} else {
+		groupID, err = im.client.CreateChildGroup(im.ctx, im.token, im.realm, parentID, group)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	created, err := im.client.GetGroup(im.ctx, im.token, im.realm, groupID)
+	if err != nil {
+		return "", "", err
+	}
+	path := gocloak.PString(created.Path)
+
+	if err := im.mapRoles(groupID, path, export); err != nil {
+		return "", "", err
+	}
+	return groupID, path, nil
+}
+
+// checkUniqueAttributes returns a *uniqueAttributeError if another group than the one at ownPath
+// already holds a value attributes gives a unique attribute.
+func (im *groupImporter) checkUniqueAttributes(ownPath string, attributes *map[string][]string) error {
+	conflicts, err := utils.UniqueAttributeConflicts(im.ctx, im.client, im.token, im.realm, ownPath, attributes)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &uniqueAttributeError{conflicts: conflicts}
+	}
+	return nil
+}
+
+// uniqueAttributeError reports the unique attribute values of a group that other groups already hold.
+type uniqueAttributeError struct {
+	conflicts []wscutils.ErrorMessage
+}
+
+func (e *uniqueAttributeError) Error() string {
+	return fmt.Sprintf("%d unique attribute values already held by other groups", len(e.conflicts))
+}
+
+// mapRoles maps the realm and client roles of export to a group, skipping roles that do not exist.
+func (im *groupImporter) mapRoles(groupID, path string, export GroupExport) error {
+	if err := im.mapRealmRoles(groupID, path, export.RealmRoles); err != nil {
+		return err
+	}
+	for clientID, roleNames := range export.ClientRoles {
+		if err := im.mapClientRoles(groupID, path, clientID, roleNames); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapRealmRoles maps the named realm roles to a group, skipping roles that do not exist.
+func (im *groupImporter) mapRealmRoles(groupID, path string, roleNames []string) error {
+	var roles []gocloak.Role
+	for _, roleName := range roleNames {
+		role, err := im.client.GetRealmRole(im.ctx, im.token, im.realm, roleName)
+		if utils.IsNotFound(err) {
+			im.missingRoles = append(im.missingRoles, MissingRole{Path: path, Role: roleName})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		roles = append(roles, *role)
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	return im.client.AddRealmRoleToGroup(im.ctx, im.token, im.realm, groupID, roles)
+}
+
+// mapClientRoles maps the named roles of a client to a group, skipping roles that do not
+// exist, including every role of a client that does not exist.
+func (im *groupImporter) mapClientRoles(groupID, path, clientID string, roleNames []string) error {
+	idOfClient, err := im.idOfClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	var roles []gocloak.Role
+	for _, roleName := range roleNames {
+		if idOfClient == "" {
+			im.missingRoles = append(im.missingRoles, MissingRole{Path: path, Role: roleName, ClientID: clientID})
+			continue
+		}
+		role, err := im.client.GetClientRole(im.ctx, im.token, im.realm, idOfClient, roleName)
+		if utils.IsNotFound(err) {
+			im.missingRoles = append(im.missingRoles, MissingRole{Path: path, Role: roleName, ClientID: clientID})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		roles = append(roles, *role)
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	return im.client.AddClientRolesToGroup(im.ctx, im.token, im.realm, idOfClient, groupID, roles)
+}
+
+// idOfClient returns the internal ID of the client with the given client ID, or an empty string
+// if there is no such client.
+func (im *groupImporter) idOfClient(clientID string) (string, error) {
+	if idOfClient, ok := im.clientIDs[clientID]; ok {
+		return idOfClient, nil
+	}
+	clients, err := im.client.GetClients(im.ctx, im.token, im.realm, gocloak.GetClientsParams{ClientID: gocloak.StringP(clientID)})
+	if err != nil {
+		return "", err
+	}
+	idOfClient := ""
+	if len(clients) > 0 && clients[0].ID != nil {
+		idOfClient = *clients[0].ID
+	}
+	im.clientIDs[clientID] = idOfClient
+	return idOfClient, nil
+}
+
+// getValsForGroupImportError returns a slice of strings to be used as vals for a validation error.
+func (req *GroupImportRequest) getValsForGroupImportError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Name":
+		vals = append(vals, "group name is required")
+	}
+	return vals
+}
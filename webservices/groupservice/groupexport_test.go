@@ -0,0 +1,92 @@
+package groupservice
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/idshield/utils/keycloakmock"
+)
+
+// withUniqueAttributes runs the test with the given unique attributes in the test realm.
+func withUniqueAttributes(t *testing.T, keys ...string) {
+	t.Helper()
+	utils.SetUniqueAttributes(map[string][]string{testRealm: keys})
+	t.Cleanup(func() { utils.SetUniqueAttributes(nil) })
+}
+
+// holdingGroups returns a GetGroups mock finding the group at path as holding every searched value.
+func holdingGroups(path string) func(context.Context, string, string, gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+	return func(_ context.Context, _, _ string, params gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+		key, value, _ := strings.Cut(gocloak.PString(params.Q), ":")
+		return []*gocloak.Group{{
+			ID:         gocloak.StringP("holder-id"),
+			Path:       gocloak.StringP(path),
+			Attributes: &map[string][]string{key: {value}},
+		}}, nil
+	}
+}
+
+func TestHandleGroupImportRequestUniqueAttributes(t *testing.T) {
+	withUniqueAttributes(t, "costCentre")
+
+	created := false
+	client := &keycloakmock.Client{
+		GetGroupsFunc: holdingGroups("/finance"),
+		CreateGroupFunc: func(context.Context, string, string, gocloak.Group) (string, error) {
+			created = true
+			return "group-id", nil
+		},
+	}
+
+	w := serve(newTestService(client), HandleGroupImportRequest, http.MethodPost, "/group-import",
+		`{"data": {"group": {"name": "sales", "attributes": {"costCentre": ["cc-42"]}}}}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	response := decodeResponse(t, w)
+	if len(response.Messages) != 1 || response.Messages[0].ErrCode != "duplicate_unique_attribute" ||
+		response.Messages[0].Field == nil || *response.Messages[0].Field != "attributes.costCentre" {
+		t.Errorf("messages = %+v, want a single duplicate_unique_attribute on attributes.costCentre", response.Messages)
+	}
+	if created {
+		t.Error("group created despite holding another group's unique value")
+	}
+}
+
+func TestHandleGroupImportRequestUniqueAttributesOfSubGroup(t *testing.T) {
+	withUniqueAttributes(t, "costCentre")
+
+	var createdChildren []string
+	client := &keycloakmock.Client{
+		GetGroupsFunc: func(_ context.Context, _, _ string, params gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+			if gocloak.PString(params.Q) == "costCentre:cc-42" {
+				return holdingGroups("/finance")(context.Background(), "", "", params)
+			}
+			return nil, nil
+		},
+		CreateGroupFunc: func(context.Context, string, string, gocloak.Group) (string, error) {
+			return "parent-id", nil
+		},
+		CreateChildGroupFunc: func(_ context.Context, _, _, _ string, group gocloak.Group) (string, error) {
+			createdChildren = append(createdChildren, gocloak.PString(group.Name))
+			return "child-id", nil
+		},
+		GetGroupFunc: func(_ context.Context, _, _, groupID string) (*gocloak.Group, error) {
+			return &gocloak.Group{ID: &groupID, Path: gocloak.StringP("/sales")}, nil
+		},
+	}
+
+	w := serve(newTestService(client), HandleGroupImportRequest, http.MethodPost, "/group-import",
+		`{"data": {"group": {"name": "sales", "attributes": {"costCentre": ["cc-1"]},
+			"subGroups": [{"name": "emea", "attributes": {"costCentre": ["cc-42"]}}]}}}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	if len(createdChildren) != 0 {
+		t.Errorf("sub groups created despite a conflict: %v", createdChildren)
+	}
+}
@@ -2,7 +2,9 @@ package groupservice
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/Nerzal/gocloak/v13"
@@ -11,13 +13,16 @@ import (
 	"github.com/remiges-tech/alya/router"
 	"github.com/remiges-tech/alya/service"
 	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
 	"github.com/remiges-tech/logharbour/logharbour"
 )
 
 // CreateGroupRequest represents the structure for incoming group creation requests.
+// Members lists the IDs of users to add to the group once it is created.
 type CreateGroupRequest struct {
 	Name       *string              `json:"name" validate:"required"`
 	Attributes *map[string][]string `json:"attributes,omitempty"`
+	Members    []string             `json:"members,omitempty" validate:"omitempty,max=1000,dive,required"`
 }
 
 // CreateGroupResponse represents the structure for outgoing group creation responses.
@@ -25,7 +30,22 @@ type CreateGroupResponse struct {
 	ID         string               `json:"id"`
 	Name       string               `json:"name"`
 	Path       *string              `json:"path"`
+	CreatedAt  *time.Time           `json:"createdAt,omitempty"`
+	UpdatedAt  *time.Time           `json:"updatedAt,omitempty"`
 	Attributes *map[string][]string `json:"attributes"`
+	Created    bool                 `json:"created"`
+	// Members reports the outcome of adding each requested member; MemberFailures repeats
+	// those that could not be added
+	Members        []MemberAssignment `json:"members,omitempty"`
+	MemberFailures []MemberAssignment `json:"memberFailures,omitempty"`
+}
+
+// MemberAssignment is the outcome of adding a single user to a group. Error holds the error
+// code when the user could not be added.
+type MemberAssignment struct {
+	UserID string `json:"userID"`
+	Added  bool   `json:"added"`
+	Error  string `json:"error,omitempty"`
 }
 
 // Capabilities representing Token capabilities.
@@ -33,7 +53,10 @@ type Capabilities struct {
 	Capability []string `json:"capability"`
 }
 
-// HandleGroupCreationRequest is a Handler  function for creating group in keyclock
+// HandleGroupCreationRequest is a Handler  function for creating group in keyclock.
+// With the upsert=true query parameter, an existing top level group of the same name has its
+// attributes updated instead of the request failing with a name conflict. With strict=true,
+// the request fails with its warnings instead of creating the group.
 func HandleGroupCreationRequest(c *gin.Context, s *service.Service) {
 	lh := s.LogHarbour
 	lh.Log("create Group request received")
@@ -42,7 +65,7 @@ func HandleGroupCreationRequest(c *gin.Context, s *service.Service) {
 	if err != nil {
 		// Log and respond to token extraction/validation error
 		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
-		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse("token_missing"))
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
 		return
 	}
 
@@ -52,23 +75,30 @@ func HandleGroupCreationRequest(c *gin.Context, s *service.Service) {
 	// if err != nil {
 	// 	l.LogActivity("Error while decodeing token:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
 	// 	fmt.Println("err", err)
-	// 	wscutils.SendErrorResponse(c, wscutils.NewErrorResponse("token_verification_failed"))
+	// 	utils.SendErrorResponse(c, utils.ErrorResponse("token_verification_failed", ""))
 	// 	return
 	// }
 
 	// if !isCapable {
 	// 	l.LogActivity("Unauthorized user:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
-	// 	wscutils.SendErrorResponse(c, wscutils.NewErrorResponse("Unauthorized"))
+	// 	utils.SendErrorResponse(c, utils.ErrorResponse("Unauthorized", ""))
 	// 	return
 	// }
 
+	strict, ok := utils.GetStrictParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid strict parameter", logharbour.DebugInfo{Variables: map[string]any{"strict": c.Query("strict")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
 	// Unmarshal JSON request into CreateGroupRequest struct
 	var createGroupReq CreateGroupRequest
 
 	if err := wscutils.BindJSON(c, &createGroupReq); err != nil {
 		// Log and respond to JSON Unmarshalling error
 		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
-		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse("invalid_json"))
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
 		return
 	}
 
@@ -76,57 +106,135 @@ func HandleGroupCreationRequest(c *gin.Context, s *service.Service) {
 
 	//Validate incoming request
 	validationErrors := validateCreateGroup(createGroupReq, c)
+	attributes, duplicated, duplicateErrors := utils.DedupeAttributes(createGroupReq.Attributes)
+	if len(duplicated) > 0 && len(duplicateErrors) == 0 {
+		lh.Warn().LogActivity("Duplicate attribute values removed", map[string]any{"keys": duplicated})
+	}
+	createGroupReq.Attributes = attributes
+	validationErrors = append(validationErrors, duplicateErrors...)
+	validationErrors = append(validationErrors, utils.ValidateAttributes(utils.TypeGroup, createGroupReq.Attributes)...)
 	if len(validationErrors) > 0 {
 
 		// Log and respond to validation errors
 		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
-		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
 		return
 	}
 
-	// Extracting the GoCloak client and realm from the service dependencies
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
 	// for handling authentication and authorization.
-	client := s.Dependencies["goclock"].(*gocloak.GoCloak)
-	realm := s.Dependencies["realm"].(string)
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
 
-	// Create a context with a timeout of 10 seconds
-	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
 	defer cancel()
 
+	// Warn about likely mistakes, or refuse them in strict mode
+	warnings, err := groupCreateWarnings(ctx, client, token, realm, createGroupReq)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while checking for similar group names:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+	}
+	if strict && len(warnings) > 0 {
+		lh.Debug0().LogDebug("Warnings refused in strict mode:", logharbour.DebugInfo{Variables: map[string]interface{}{"warnings": warnings}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, warnings))
+		return
+	}
+	for _, warning := range warnings {
+		utils.AddWarning(c, warning)
+	}
+
+	// Resolve the realm roles the group's roles attribute asks for before touching the group
+	roleRule, err := resolveGroupRoleRule(ctx, client, token, realm, createGroupReq.Attributes)
+	if err != nil {
+		sendRoleRuleError(c, lh, err)
+		return
+	}
+
+	// Values of unique attributes must not be held by any other group
+	conflicts, err := utils.UniqueAttributeConflicts(ctx, client, token, realm, "/"+*createGroupReq.Name, createGroupReq.Attributes)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while checking unique attributes:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	if len(conflicts) > 0 {
+		lh.Debug0().LogDebug("Unique attribute values already held:", logharbour.DebugInfo{Variables: map[string]interface{}{"conflicts": conflicts}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, conflicts))
+		return
+	}
+
 	// Create a new goclock group
 	group := gocloak.Group{
 		Name:       createGroupReq.Name,
-		Attributes: createGroupReq.Attributes,
+		Attributes: utils.StampCreated(utils.WithGroupType(createGroupReq.Attributes, utils.TypeGroup)),
 	}
 
 	// Create a group
+	created := true
 	groupCreationID, err := client.CreateGroup(ctx, token, realm, group)
+	if err != nil && c.Query("upsert") == "true" && utils.IsConflict(err) {
+		lh.Debug0().LogDebug("group exists, updating it: ", logharbour.DebugInfo{Variables: map[string]any{"group": *createGroupReq.Name}})
+		created = false
+		groupCreationID, err = updateExistingGroup(ctx, client, token, realm, group)
+	}
 	if err != nil {
 		lh.LogActivity("Error while creating Group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
-
-		conflictErr := fmt.Sprintf("409 Conflict: Top level group named '%s' already exists.", *createGroupReq.Name)
-
-		switch err.Error() {
-		case "401 Unauthorized: HTTP 401 Unauthorized":
-			lh.Debug0().LogDebug("Unauthorized error occurred: ", logharbour.DebugInfo{Variables: map[string]any{"error": err, "token": token}})
-			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse("Unauthorized"))
-			return
-		case conflictErr:
-			lh.Debug0().LogDebug("name conflict error occurred: ", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
-			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse("name already exist"))
-			return
-		default:
-			lh.Debug0().LogDebug("Unknown error occurred: ", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
-			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse("unknown"))
-			return
+		errcode := utils.KeycloakErrorCode(err, "group_not_found")
+		if utils.IsConflict(err) || errors.Is(err, errGroupTypeMismatch) {
+			errcode = "name already exist"
 		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
 	}
 
 	// Get a Group Info by using Group ID
 	groupInfo, err := client.GetGroup(ctx, token, realm, groupCreationID)
 	if err != nil {
+		lh.LogActivity("Error while fetching created group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "groupID": groupCreationID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	// Bring the group's realm role mappings in line with its roles attribute
+	reconciliation, err := roleRule.apply(ctx, client, token, realm, groupCreationID)
+	if err != nil {
+		lh.LogActivity("Error while reconciling group roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
 		return
 	}
+	auditRoleReconciliation(lh, token, reconciliation)
+
+	// The group hierarchy has changed, so drop any cached tree for this realm
+	utils.GroupsChanged(realm)
+
+	// Add the initial members; failures are reported rather than failing the whole request
+	members, memberFailures := addGroupMembers(ctx, client, token, realm, groupCreationID, createGroupReq.Members)
+	if len(memberFailures) > 0 {
+		lh.Warn().LogActivity("Some members could not be added to group", map[string]any{"groupID": groupCreationID, "failures": memberFailures})
+	}
+	if added := len(members) - len(memberFailures); added > 0 {
+		utils.GroupMembershipChanged(realm, groupCreationID)
+		addedIDs := make([]string, 0, added)
+		for _, member := range members {
+			if member.Added {
+				addedIDs = append(addedIDs, member.UserID)
+			}
+		}
+		lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("group").WithWhatInstanceId(groupCreationID).
+			LogDataChange("group members added", logharbour.ChangeInfo{
+				Entity:    "group",
+				Operation: "update",
+				Changes:   map[string]any{"members": map[string]any{"added": addedIDs}},
+			})
+	}
+
+	// Let any configured webhooks know about the change
+	action := "updated"
+	if created {
+		action = "created"
+	}
+	s.Dependencies["webhooks"].(*utils.WebhookNotifier).Notify("group", action, groupCreationID, realm, utils.SubjectFromToken(token))
 
 	// Create response struct
 	CreateGroupResponse := CreateGroupResponse{
@@ -134,14 +242,63 @@ func HandleGroupCreationRequest(c *gin.Context, s *service.Service) {
 		Name:       *groupInfo.Name,
 		Path:       groupInfo.Path,
 		Attributes: groupInfo.Attributes,
+		Created:    created,
+
+		Members:        members,
+		MemberFailures: memberFailures,
+	}
+	CreateGroupResponse.CreatedAt, CreateGroupResponse.UpdatedAt = utils.GroupTimestamps(groupInfo.Attributes)
+	// Send success response, pointing at the group when it was newly created
+	if created {
+		utils.SendCreatedResponse(c, "/group/"+url.PathEscape(groupCreationID), CreateGroupResponse)
+	} else {
+		utils.SendSuccessResponse(c, CreateGroupResponse)
 	}
-	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: "success", Data: CreateGroupResponse})
 
 	// Log the completion of execution
 	lh.LogActivity("Finished execution of createGroup", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
 }
 
+// addGroupMembers adds each user to the group, returning the outcome for every user along
+// with the failed ones.
+func addGroupMembers(ctx context.Context, client utils.KeycloakClient, token, realm, groupID string, userIDs []string) (members, failures []MemberAssignment) {
+	seen := map[string]bool{}
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		member := MemberAssignment{UserID: userID, Added: true}
+		if err := client.AddUserToGroup(ctx, token, realm, userID, groupID); err != nil {
+			member.Added, member.Error = false, utils.KeycloakErrorCode(err, "user_not_found")
+			failures = append(failures, member)
+		}
+		members = append(members, member)
+	}
+	return members, failures
+}
+
+// errGroupTypeMismatch is returned when an upsert targets a top level group that is not a plain group.
+var errGroupTypeMismatch = errors.New("top level group of another type already exists")
+
+// updateExistingGroup replaces the attributes of the existing top level group named like group
+// and returns its ID.
+func updateExistingGroup(ctx context.Context, client utils.KeycloakClient, token, realm string, group gocloak.Group) (string, error) {
+	existing, err := client.GetGroupByPath(ctx, token, realm, "/"+*group.Name)
+	if err != nil {
+		return "", err
+	}
+	// Never let an upsert turn a capability into a group
+	if utils.GroupType(existing.Attributes) != utils.TypeGroup {
+		return "", errGroupTypeMismatch
+	}
+	existing.Attributes = utils.StampUpdated(group.Attributes, existing.Attributes)
+	if err := client.UpdateGroup(ctx, token, realm, *existing); err != nil {
+		return "", err
+	}
+	return *existing.ID, nil
+}
+
 // Validate validates the request body
 func validateCreateGroup(req CreateGroupRequest, c *gin.Context) []wscutils.ErrorMessage {
 	// validate request body using standard validator
@@ -158,13 +315,23 @@ func validateCreateGroup(req CreateGroupRequest, c *gin.Context) []wscutils.Erro
 func (req *CreateGroupRequest) getValsForCreateCapabilityError(err validator.FieldError) []string {
 	var vals []string
 	switch err.Field() {
-	case "name":
+	case "Name":
 		switch err.Tag() {
 		case "required":
 			vals = append(vals, "group name is required")
-			vals = append(vals, *req.Name)
+			// Name is nil when it is missing altogether, as with an empty {} body
+			name := "<missing>"
+			if req.Name != nil {
+				name = *req.Name
+			}
+			vals = append(vals, name)
 		}
-
+	case "Members":
+		vals = append(vals, "at most 1000 members may be given")
+	}
+	// Errors on single members are reported against e.g. Members[2]
+	if strings.HasPrefix(err.Field(), "Members[") {
+		vals = append(vals, "member user IDs must not be empty")
 	}
 	return vals
 }
@@ -0,0 +1,141 @@
+package groupservice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/idshield/utils/keycloakmock"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const testRealm = "test"
+
+// newTestService returns a service calling client instead of Keycloak, logging nowhere.
+func newTestService(client *keycloakmock.Client) *service.Service {
+	lh := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "idshield-test", io.Discard)
+	return service.NewService(gin.New()).
+		WithLogHarbour(lh).
+		WithDependency("goclock", client).
+		WithDependency("webhooks", utils.NewWebhookNotifier(utils.WebhookConfig{}))
+}
+
+// serve sends a request with the given body to handler in the test realm and returns the
+// recorded response.
+func serve(s *service.Service, handler service.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	return serveWithToken(s, handler, "token", method, target, body)
+}
+
+// serveWithToken is serve for a caller holding token.
+func serveWithToken(s *service.Service, handler service.HandlerFunc, token, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, strings.Split(target, "?")[0], func(c *gin.Context) {
+		utils.SetRealm(c, testRealm)
+		handler(c, s)
+	})
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// decodeResponse decodes the standard response envelope of w.
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) wscutils.Response {
+	t.Helper()
+	var response wscutils.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response is not the standard envelope: %v: %s", err, w.Body.String())
+	}
+	return response
+}
+
+func TestHandleGroupCreationRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		createErr  error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "created", wantStatus: http.StatusCreated},
+		{
+			name:       "name taken",
+			createErr:  &gocloak.APIError{Code: http.StatusConflict, Message: "409 Conflict: Top level group named 'sales' already exists."},
+			wantStatus: http.StatusConflict,
+			wantCode:   "name already exist",
+		},
+		{
+			name:       "not allowed",
+			createErr:  &gocloak.APIError{Code: http.StatusForbidden, Message: "403 Forbidden: HTTP 403 Forbidden"},
+			wantStatus: http.StatusForbidden,
+			wantCode:   "Forbidden",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *gocloak.Group
+			client := &keycloakmock.Client{
+				GetGroupsFunc: func(context.Context, string, string, gocloak.GetGroupsParams) ([]*gocloak.Group, error) {
+					return nil, nil
+				},
+				CreateGroupFunc: func(_ context.Context, _, realm string, group gocloak.Group) (string, error) {
+					if realm != testRealm {
+						t.Errorf("group created in realm %q, want %q", realm, testRealm)
+					}
+					if tt.createErr != nil {
+						return "", tt.createErr
+					}
+					created = &group
+					return "group-id", nil
+				},
+				GetGroupFunc: func(_ context.Context, _, _, groupID string) (*gocloak.Group, error) {
+					return &gocloak.Group{ID: &groupID, Name: created.Name, Path: gocloak.StringP("/" + *created.Name), Attributes: created.Attributes}, nil
+				},
+			}
+
+			w := serve(newTestService(client), HandleGroupCreationRequest, http.MethodPost, "/group",
+				`{"data": {"name": "sales", "attributes": {"region": ["emea"]}}}`)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			response := decodeResponse(t, w)
+			if tt.wantCode == "" {
+				if got := w.Header().Get("Location"); got != "/group/group-id" {
+					t.Errorf("Location = %q, want /group/group-id", got)
+				}
+				if utils.GroupType(created.Attributes) != utils.TypeGroup {
+					t.Errorf("group created without the group type: %v", created.Attributes)
+				}
+				return
+			}
+			if len(response.Messages) != 1 || response.Messages[0].ErrCode != tt.wantCode {
+				t.Errorf("messages = %+v, want a single %s", response.Messages, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandleGroupCreationRequestWithoutName(t *testing.T) {
+	w := serve(newTestService(&keycloakmock.Client{}), HandleGroupCreationRequest, http.MethodPost, "/group", `{"data": {}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	response := decodeResponse(t, w)
+	if len(response.Messages) != 1 || response.Messages[0].Field == nil || *response.Messages[0].Field != "Name" {
+		t.Fatalf("messages = %+v, want a single validation error on Name", response.Messages)
+	}
+	if code := response.Messages[0].ErrCode; code != "required" {
+		t.Errorf("error code = %q, want required", code)
+	}
+}
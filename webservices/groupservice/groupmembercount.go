@@ -0,0 +1,102 @@
+package groupservice
+
+import (
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// memberCountPageSize is the number of members fetched per call while counting.
+	memberCountPageSize = 100
+	// memberCountCacheTTL is how long a group's member count is served from cache.
+	memberCountCacheTTL = 30 * time.Second
+)
+
+// GroupMemberCountResponse represents the structure for outgoing group member count responses.
+type GroupMemberCountResponse struct {
+	GroupID string `json:"groupID"`
+	Count   int    `json:"count"`
+}
+
+// memberCountCache holds recently computed member counts keyed by realm and group ID.
+var memberCountCache = utils.NewTTLCache[int](memberCountCacheTTL)
+
+// InvalidateGroupMemberCount drops the cached member count of a group. It is registered with
+// utils.OnGroupMembershipChange, which handlers changing group membership call.
+func InvalidateGroupMemberCount(realm, groupID string) {
+	memberCountCache.Delete(realm + "/" + groupID)
+}
+
+// HandleGroupMemberCountRequest is a Handler function for counting the members of a group in keyclock
+func HandleGroupMemberCountRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group member count request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	groupID := c.Query("groupID")
+	if groupID == "" {
+		lh.Debug0().LogDebug("Missing groupID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "groupID"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	cacheKey := realm + "/" + groupID
+	if count, ok := memberCountCache.Get(cacheKey); ok {
+		utils.SendSuccessResponse(c, GroupMemberCountResponse{GroupID: groupID, Count: count})
+		return
+	}
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure the group exists, as keycloak returns an empty member list for unknown groups
+	if _, err := client.GetGroup(ctx, token, realm, groupID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	// Keycloak has no member count call, so page through brief member representations
+	count := 0
+	for first := 0; ; first += memberCountPageSize {
+		members, err := client.GetGroupMembers(ctx, token, realm, groupID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(memberCountPageSize),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+		if err != nil {
+			lh.LogActivity("Error while fetching group members:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+		count += len(members)
+		if len(members) < memberCountPageSize {
+			break
+		}
+	}
+	memberCountCache.Set(cacheKey, count)
+
+	// Send success response
+	utils.SendSuccessResponse(c, GroupMemberCountResponse{GroupID: groupID, Count: count})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupMemberCount", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
@@ -0,0 +1,173 @@
+package groupservice
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxExportMembers is the largest number of members a single membership export returns.
+const maxExportMembers = 50000
+
+// memberSortFields lists the fields group members can be sorted by: name sorts by username
+// and created by creation time.
+var memberSortFields = []string{"name", "created"}
+
+// GroupMember represents a single member in a group membership export.
+type GroupMember struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Enabled   bool   `json:"enabled"`
+	// Attributes is only given when the export is not brief
+	Attributes *map[string][]string `json:"attributes,omitempty"`
+}
+
+// HandleGroupMemberExportRequest is a Handler function for exporting every member of a group in keyclock.
+// If keyclock fails part way through, the members gathered so far are returned flagged as partial.
+func HandleGroupMemberExportRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group member export request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	groupID := c.Query("groupID")
+	if groupID == "" {
+		lh.Debug0().LogDebug("Missing groupID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "groupID"))
+		return
+	}
+
+	brief, ok := utils.GetBriefParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid brief parameter", logharbour.DebugInfo{Variables: map[string]any{"brief": c.Query("brief")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	raw, ok := utils.GetRawParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid raw parameter", logharbour.DebugInfo{Variables: map[string]any{"raw": c.Query("raw")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	sortField, desc, ok := utils.GetSortParams(c, memberSortFields...)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid sort parameters", logharbour.DebugInfo{Variables: map[string]any{"sort": c.Query("sort"), "order": c.Query("order")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_sort", "sort", strings.Join(memberSortFields, ", ")))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure the group exists, as keycloak returns an empty member list for unknown groups
+	if _, err := client.GetGroup(ctx, token, realm, groupID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	// Fetch one more member than the limit, to tell whether the limit cut the export short
+	users, err := utils.CollectPages(utils.MaxPageSize, maxExportMembers+1, func(first, max int) ([]*gocloak.User, error) {
+		return client.GetGroupMembers(ctx, token, realm, groupID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(max),
+			BriefRepresentation: gocloak.BoolP(brief),
+		})
+	})
+	if err != nil && len(users) == 0 {
+		lh.LogActivity("Error while fetching group members:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	meta := utils.ListMeta{}
+	switch {
+	case err != nil:
+		lh.Warn().LogActivity("Returning partial group membership after error", map[string]any{"groupID": groupID, "members": len(users), "error": err.Error()})
+		meta.Partial, meta.PartialReason = true, utils.KeycloakErrorCode(err, "group_not_found")
+	case len(users) > maxExportMembers:
+		users = users[:maxExportMembers]
+		meta.Partial, meta.PartialReason = true, "range_too_large"
+	}
+
+	if sortField != "" {
+		sortMembers(users, sortField, desc)
+	}
+
+	members := make([]GroupMember, 0, len(users))
+	for _, user := range users {
+		if user == nil {
+			continue
+		}
+		members = append(members, GroupMember{
+			ID:         gocloak.PString(user.ID),
+			Username:   gocloak.PString(user.Username),
+			Email:      gocloak.PString(user.Email),
+			FirstName:  gocloak.PString(user.FirstName),
+			LastName:   gocloak.PString(user.LastName),
+			Enabled:    gocloak.PBool(user.Enabled),
+			Attributes: user.Attributes,
+		})
+	}
+	meta.Max = len(members)
+	meta.Total = len(members)
+	if meta.Partial {
+		meta.Total = -1
+	}
+
+	// Send success response, with keycloak's own representation of the members if asked for
+	var data any = members
+	if raw {
+		data = users
+	}
+	utils.SendListResponse(c, data, meta)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupMemberExport", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// sortMembers sorts users by field, keeping the order keycloak returned them in for users
+// that compare equal.
+func sortMembers(users []*gocloak.User, field string, desc bool) {
+	key := func(user *gocloak.User) (string, int64) {
+		if user == nil {
+			return "", 0
+		}
+		return gocloak.PString(user.Username), gocloak.PInt64(user.CreatedTimestamp)
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		if desc {
+			a, b = b, a
+		}
+		nameA, createdA := key(a)
+		nameB, createdB := key(b)
+		if field == "created" {
+			return createdA < createdB
+		}
+		return nameA < nameB
+	})
+}
@@ -0,0 +1,210 @@
+package groupservice
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxMoveMembers is the largest number of members a single move handles.
+const maxMoveMembers = 10000
+
+// Outcomes of moving a single member.
+const (
+	MemberMoved  = "moved"
+	MemberCopied = "copied"
+	MemberFailed = "failed"
+)
+
+// GroupMembersMoveRequest represents the structure for incoming group member move requests.
+// Every member of the source group is moved unless UserIDs names a subset of them.
+type GroupMembersMoveRequest struct {
+	SourceGroupID string   `json:"sourceGroupID" validate:"required"`
+	TargetGroupID string   `json:"targetGroupID" validate:"required,nefield=SourceGroupID"`
+	UserIDs       []string `json:"userIDs" validate:"omitempty,max=10000,dive,required"`
+}
+
+// MemberMove is the outcome of moving a single member. A member whose removal from the
+// source group failed is reported as copied, as it was left in both groups.
+type MemberMove struct {
+	UserID string `json:"userID"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GroupMembersMoveResponse represents the structure for outgoing group member move responses.
+type GroupMembersMoveResponse struct {
+	SourceGroupID string       `json:"sourceGroupID"`
+	TargetGroupID string       `json:"targetGroupID"`
+	Copy          bool         `json:"copy"`
+	Members       []MemberMove `json:"members"`
+	Failed        int          `json:"failed"`
+}
+
+// HandleGroupMembersMoveRequest is a Handler function for moving members from one group to another in keyclock.
+// With the copy=true query parameter, members are added to the target group without being removed from the source.
+// A member is only removed from the source group once it was added to the target, so a failure never leaves it in neither.
+func HandleGroupMembersMoveRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group members move request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	copyOnly := false
+	if v := c.Query("copy"); v != "" {
+		if copyOnly, err = strconv.ParseBool(v); err != nil {
+			lh.Debug0().LogDebug("Invalid copy parameter", logharbour.DebugInfo{Variables: map[string]any{"copy": v}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+			return
+		}
+	}
+
+	// Unmarshal JSON request into GroupMembersMoveRequest struct
+	var req GroupMembersMoveRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForGroupMembersMoveError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure both groups exist, as keycloak returns an empty member list for unknown groups
+	for _, groupID := range []string{req.SourceGroupID, req.TargetGroupID} {
+		if _, err := client.GetGroup(ctx, token, realm, groupID); err != nil {
+			lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+	}
+
+	// Fetch one more member than the limit, to tell whether the source group is too large to move at once
+	users, err := utils.CollectPages(utils.MaxPageSize, maxMoveMembers+1, func(first, max int) ([]*gocloak.User, error) {
+		return client.GetGroupMembers(ctx, token, realm, req.SourceGroupID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(max),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+	})
+	if err != nil {
+		lh.LogActivity("Error while fetching group members:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "groupID": req.SourceGroupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	members := make(map[string]bool, len(users))
+	for _, user := range users {
+		members[gocloak.PString(user.ID)] = true
+	}
+
+	userIDs := req.UserIDs
+	if len(userIDs) == 0 {
+		if len(users) > maxMoveMembers {
+			lh.Debug0().LogDebug("Source group too large to move at once", logharbour.DebugInfo{Variables: map[string]any{"groupID": req.SourceGroupID}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("range_too_large", "userIDs", strconv.Itoa(maxMoveMembers)))
+			return
+		}
+		for _, user := range users {
+			userIDs = append(userIDs, gocloak.PString(user.ID))
+		}
+	}
+
+	response := GroupMembersMoveResponse{SourceGroupID: req.SourceGroupID, TargetGroupID: req.TargetGroupID, Copy: copyOnly, Members: []MemberMove{}}
+	var moved, copied []string
+	seen := map[string]bool{}
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		move := MemberMove{UserID: userID, Status: MemberFailed}
+		switch {
+		case !members[userID]:
+			move.Error = "not_group_member"
+		default:
+			if err := client.AddUserToGroup(ctx, token, realm, userID, req.TargetGroupID); err != nil {
+				move.Error = utils.KeycloakErrorCode(err, "user_not_found")
+				break
+			}
+			move.Status = MemberCopied
+			if copyOnly {
+				copied = append(copied, userID)
+				break
+			}
+			// The member stays in the target group if its removal from the source fails
+			if err := client.DeleteUserFromGroup(ctx, token, realm, userID, req.SourceGroupID); err != nil {
+				move.Error = utils.KeycloakErrorCode(err, "user_not_found")
+				copied = append(copied, userID)
+				break
+			}
+			move.Status = MemberMoved
+			moved = append(moved, userID)
+		}
+		if move.Error != "" {
+			response.Failed++
+		}
+		response.Members = append(response.Members, move)
+	}
+	utils.GroupMembershipChanged(realm, req.SourceGroupID)
+	utils.GroupMembershipChanged(realm, req.TargetGroupID)
+
+	// Audit the change along with who made it
+	if len(moved) > 0 || len(copied) > 0 {
+		lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("group").WithWhatInstanceId(req.TargetGroupID).
+			LogDataChange("group members moved", logharbour.ChangeInfo{
+				Entity:    "group",
+				Operation: "update",
+				Changes:   map[string]any{"sourceGroupID": req.SourceGroupID, "moved": moved, "copied": copied},
+			})
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupMembersMove", map[string]any{"members": len(response.Members), "failed": response.Failed, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForGroupMembersMoveError returns a slice of strings to be used as vals for a validation error.
+func (req *GroupMembersMoveRequest) getValsForGroupMembersMoveError(err validator.FieldError) []string {
+	var vals []string
+	switch field := err.Field(); {
+	case field == "SourceGroupID":
+		vals = append(vals, "sourceGroupID is required")
+	case field == "TargetGroupID":
+		vals = append(vals, "targetGroupID is required and must differ from sourceGroupID")
+	case field == "UserIDs":
+		vals = append(vals, "userIDs must list at most 10000 users")
+	case strings.HasPrefix(field, "UserIDs["):
+		vals = append(vals, "userIDs must not contain empty IDs")
+	}
+	return vals
+}
@@ -0,0 +1,176 @@
+package groupservice
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxSetMembers is the largest number of members a group may have before or after its
+// membership is set.
+const maxSetMembers = 10000
+
+// GroupMembersSetRequest represents the structure for incoming group membership set requests.
+// UserIDs is the complete list of members the group should have; an empty list removes them all.
+type GroupMembersSetRequest struct {
+	GroupID string   `json:"groupID" validate:"required"`
+	UserIDs []string `json:"userIDs" validate:"required,max=10000,dive,required"`
+}
+
+// MemberChange is a change to a group's membership that failed. Action is add or remove.
+type MemberChange struct {
+	UserID string `json:"userID"`
+	Action string `json:"action"`
+	Error  string `json:"error"`
+}
+
+// GroupMembersSetResponse represents the structure for outgoing group membership set responses.
+// Added and Removed list the members actually added and removed.
+type GroupMembersSetResponse struct {
+	GroupID  string         `json:"groupID"`
+	Added    []string       `json:"added"`
+	Removed  []string       `json:"removed"`
+	Failures []MemberChange `json:"failures"`
+}
+
+// HandleGroupMembersSetRequest is a Handler function for making the members of a group in keyclock exactly
+// those listed, adding the missing ones and removing the others. It is the declarative counterpart of adding
+// and removing members one by one, e.g. for sync jobs. A failed change is reported without stopping the others.
+func HandleGroupMembersSetRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group members set request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into GroupMembersSetRequest struct
+	var req GroupMembersSetRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForGroupMembersSetError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure the group exists, as keycloak returns an empty member list for unknown groups
+	if _, err := client.GetGroup(ctx, token, realm, req.GroupID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": req.GroupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	// Fetch one more member than the limit, to tell whether the group is too large to set at once
+	users, err := utils.CollectPages(utils.MaxPageSize, maxSetMembers+1, func(first, max int) ([]*gocloak.User, error) {
+		return client.GetGroupMembers(ctx, token, realm, req.GroupID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(max),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+	})
+	if err != nil {
+		lh.LogActivity("Error while fetching group members:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "groupID": req.GroupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	if len(users) > maxSetMembers {
+		lh.Debug0().LogDebug("Group too large to set its members at once", logharbour.DebugInfo{Variables: map[string]any{"groupID": req.GroupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("range_too_large", "groupID", strconv.Itoa(maxSetMembers)))
+		return
+	}
+
+	current := make(map[string]bool, len(users))
+	for _, user := range users {
+		current[gocloak.PString(user.ID)] = true
+	}
+	desired := make(map[string]bool, len(req.UserIDs))
+	for _, userID := range req.UserIDs {
+		desired[userID] = true
+	}
+
+	// Add the missing members before removing the others
+	response := GroupMembersSetResponse{GroupID: req.GroupID, Added: []string{}, Removed: []string{}, Failures: []MemberChange{}}
+	for userID := range desired {
+		if current[userID] {
+			continue
+		}
+		if err := client.AddUserToGroup(ctx, token, realm, userID, req.GroupID); err != nil {
+			response.Failures = append(response.Failures, MemberChange{UserID: userID, Action: "add", Error: utils.KeycloakErrorCode(err, "user_not_found")})
+			continue
+		}
+		response.Added = append(response.Added, userID)
+	}
+	for userID := range current {
+		if desired[userID] {
+			continue
+		}
+		if err := client.DeleteUserFromGroup(ctx, token, realm, userID, req.GroupID); err != nil {
+			response.Failures = append(response.Failures, MemberChange{UserID: userID, Action: "remove", Error: utils.KeycloakErrorCode(err, "user_not_found")})
+			continue
+		}
+		response.Removed = append(response.Removed, userID)
+	}
+	sort.Strings(response.Added)
+	sort.Strings(response.Removed)
+	sort.Slice(response.Failures, func(i, j int) bool { return response.Failures[i].UserID < response.Failures[j].UserID })
+
+	// Audit the change along with who made it
+	if len(response.Added) > 0 || len(response.Removed) > 0 {
+		utils.GroupMembershipChanged(realm, req.GroupID)
+		lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("group").WithWhatInstanceId(req.GroupID).
+			LogDataChange("group members set", logharbour.ChangeInfo{
+				Entity:    "group",
+				Operation: "update",
+				Changes:   map[string]any{"members": map[string]any{"added": response.Added, "removed": response.Removed}},
+			})
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupMembersSet", map[string]any{"added": len(response.Added), "removed": len(response.Removed), "failed": len(response.Failures), "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForGroupMembersSetError returns a slice of strings to be used as vals for a validation error.
+func (req *GroupMembersSetRequest) getValsForGroupMembersSetError(err validator.FieldError) []string {
+	var vals []string
+	switch field := err.Field(); {
+	case field == "GroupID":
+		vals = append(vals, "groupID is required")
+	case field == "UserIDs":
+		vals = append(vals, "userIDs must list the members, at most 10000, and may be empty")
+	case strings.HasPrefix(field, "UserIDs["):
+		vals = append(vals, "userIDs must not contain empty IDs")
+	}
+	return vals
+}
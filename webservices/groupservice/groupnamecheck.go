@@ -0,0 +1,90 @@
+package groupservice
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// GroupNameCheckResponse represents the structure for outgoing group name check responses.
+// ConflictPath is the path of the group already holding the name, or empty when it is available.
+type GroupNameCheckResponse struct {
+	Available    bool   `json:"available"`
+	ConflictPath string `json:"conflictPath"`
+}
+
+// HandleGroupNameCheckRequest is a Handler function for checking whether a group name is free under a
+// parent in keyclock, e.g. /group-name-check?name=sales&parent=/emea, or at the top level when parent is
+// left out. keyclock only keeps names unique among siblings, so the same name may be free under one
+// parent and taken under another. Nothing is cached, so the answer holds at the time of the request.
+func HandleGroupNameCheckRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group name check request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	name := c.Query("name")
+	if name == "" {
+		lh.Debug0().LogDebug("Missing group name", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "name"))
+		return
+	}
+	if strings.Contains(name, "/") {
+		lh.Debug0().LogDebug("Invalid group name", logharbour.DebugInfo{Variables: map[string]any{"name": name}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "name"))
+		return
+	}
+	parent := strings.TrimSuffix(c.Query("parent"), "/")
+	if parent != "" && !strings.HasPrefix(parent, "/") {
+		lh.Debug0().LogDebug("Relative parent path", logharbour.DebugInfo{Variables: map[string]any{"parent": parent}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "parent"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	response := GroupNameCheckResponse{}
+	group, err := client.GetGroupByPath(ctx, token, realm, parent+"/"+name)
+	switch {
+	case err == nil:
+		response.ConflictPath = gocloak.PString(group.Path)
+	case !utils.IsNotFound(err):
+		lh.Debug0().LogDebug("Error while fetching group by path:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "path": parent + "/" + name}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	case parent != "":
+		// The name is only available if there is a parent to create the group under
+		if _, err := client.GetGroupByPath(ctx, token, realm, parent); err != nil {
+			lh.Debug0().LogDebug("Error while fetching parent group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "parent": parent}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), "parent"))
+			return
+		}
+		response.Available = true
+	default:
+		response.Available = true
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupNameCheck", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
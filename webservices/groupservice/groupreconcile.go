@@ -0,0 +1,239 @@
+package groupservice
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// GroupReconcileRequest represents the structure for incoming group reconciliation requests. Attributes
+// is the full set of attributes the group at Path should have: attributes it has but that are not listed
+// are removed. The group's realm role mappings follow the roles attribute among them.
+type GroupReconcileRequest struct {
+	Path       string              `json:"path" validate:"required,startswith=/,min=2"`
+	Attributes map[string][]string `json:"attributes"`
+	DryRun     bool                `json:"dryRun"`
+}
+
+// AttributeDiff describes how a group's attributes differ from the desired ones. Added and Updated
+// hold the desired values of the attributes concerned, and Removed the names of those to remove.
+type AttributeDiff struct {
+	Added   map[string][]string `json:"added"`
+	Updated map[string][]string `json:"updated"`
+	Removed []string            `json:"removed"`
+}
+
+// GroupReconcileResponse represents the structure for outgoing group reconciliation responses. It
+// describes the changes made, or that would have been made for a dry run.
+type GroupReconcileResponse struct {
+	GroupID    string              `json:"groupID"`
+	Path       string              `json:"path"`
+	DryRun     bool                `json:"dryRun"`
+	Changed    bool                `json:"changed"`
+	Attributes AttributeDiff       `json:"attributes"`
+	Roles      *RoleReconciliation `json:"roles"`
+}
+
+// HandleGroupReconcileRequest is a Handler function for bringing a group in keyclock in line with a desired
+// state, so that idshield can serve as a declarative provisioning target. Only the differences are applied.
+func HandleGroupReconcileRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group reconcile request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into GroupReconcileRequest struct
+	var req GroupReconcileRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForGroupReconcileError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	group, err := client.GetGroupByPath(ctx, token, realm, req.Path)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "path": req.Path}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	groupID := gocloak.PString(group.ID)
+
+	// The desired attributes are checked against the schema of the group's own type, which is kept
+	groupType := utils.GroupType(group.Attributes)
+	desired, duplicated, validationErrors := utils.DedupeAttributes(&req.Attributes)
+	if len(duplicated) > 0 && len(validationErrors) == 0 {
+		lh.Warn().LogActivity("Duplicate attribute values removed", map[string]any{"keys": duplicated})
+	}
+	desired = utils.WithGroupType(desired, groupType)
+	// The timestamps are idshield's own and are not reconciled
+	desired = utils.WithTimestampsOf(desired, group.Attributes)
+	validationErrors = append(validationErrors, utils.ValidateAttributes(groupType, desired)...)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Values of unique attributes must not be held by any other group
+	conflicts, err := utils.UniqueAttributeConflicts(ctx, client, token, realm, gocloak.PString(group.Path), desired)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while checking unique attributes:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	if len(conflicts) > 0 {
+		lh.Debug0().LogDebug("Unique attribute values already held:", logharbour.DebugInfo{Variables: map[string]interface{}{"conflicts": conflicts}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, conflicts))
+		return
+	}
+
+	// Work out every change before making any, so that an unknown role changes nothing
+	diff := diffAttributes(group.Attributes, desired)
+	rule, err := resolveGroupRoleRule(ctx, client, token, realm, desired)
+	if err != nil {
+		sendRoleRuleError(c, lh, err)
+		return
+	}
+	roles, toAdd, toRemove, err := rule.plan(ctx, client, token, realm, groupID)
+	if err != nil {
+		lh.LogActivity("Error while fetching group roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	attributesChanged := len(diff.Added) > 0 || len(diff.Updated) > 0 || len(diff.Removed) > 0
+	response := GroupReconcileResponse{
+		GroupID:    groupID,
+		Path:       gocloak.PString(group.Path),
+		DryRun:     req.DryRun,
+		Changed:    attributesChanged || len(toAdd) > 0 || len(toRemove) > 0,
+		Attributes: diff,
+		Roles:      roles,
+	}
+
+	if !req.DryRun && response.Changed {
+		if attributesChanged {
+			group.Attributes = utils.StampUpdated(desired, group.Attributes)
+			if err := client.UpdateGroup(ctx, token, realm, *group); err != nil {
+				lh.LogActivity("Error while updating group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+				utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+				return
+			}
+			utils.GroupsChanged(realm)
+		}
+		if len(toAdd) > 0 {
+			err = client.AddRealmRoleToGroup(ctx, token, realm, groupID, toAdd)
+		}
+		if err == nil && len(toRemove) > 0 {
+			err = client.DeleteRealmRoleFromGroup(ctx, token, realm, groupID, toRemove)
+		}
+		if err != nil {
+			lh.LogActivity("Error while reconciling group roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+
+		// Audit the change along with who made it
+		lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("group").WithWhatInstanceId(groupID).
+			LogDataChange("group reconciled", logharbour.ChangeInfo{
+				Entity:    "group",
+				Operation: "update",
+				Changes: map[string]any{
+					"attributes": diff,
+					"realmRoles": map[string]any{"added": roles.Added, "removed": roles.Removed},
+				},
+			})
+
+		// Let any configured webhooks know about the change
+		s.Dependencies["webhooks"].(*utils.WebhookNotifier).Notify("group", "updated", groupID, realm, utils.SubjectFromToken(token))
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupReconcile", map[string]any{"dryRun": req.DryRun, "changed": response.Changed, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// diffAttributes compares a group's current attributes with the desired ones. The order of the
+// values of an attribute does not matter.
+func diffAttributes(current, desired *map[string][]string) AttributeDiff {
+	diff := AttributeDiff{Added: map[string][]string{}, Updated: map[string][]string{}, Removed: []string{}}
+	have := map[string][]string{}
+	if current != nil {
+		have = *current
+	}
+	for key, values := range *desired {
+		existing, ok := have[key]
+		switch {
+		case !ok:
+			diff.Added[key] = values
+		case !sameValues(existing, values):
+			diff.Updated[key] = values
+		}
+	}
+	for key := range have {
+		if _, ok := (*desired)[key]; !ok {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// sameValues reports whether a and b hold the same values, in any order.
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, value := range a {
+		counts[value]++
+	}
+	for _, value := range b {
+		if counts[value] == 0 {
+			return false
+		}
+		counts[value]--
+	}
+	return true
+}
+
+// getValsForGroupReconcileError returns a slice of strings to be used as vals for a validation error.
+func (req *GroupReconcileRequest) getValsForGroupReconcileError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Path":
+		vals = append(vals, "path must be a group path such as /tenants/acme")
+	}
+	return vals
+}
@@ -0,0 +1,268 @@
+package groupservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// ReconcileRolesRequest represents the structure for incoming role reconciliation requests.
+type ReconcileRolesRequest struct {
+	GroupID string `json:"groupID" validate:"required"`
+}
+
+// RoleReconciliation describes how a group's realm role mappings were brought in line with its
+// roles attribute. Managed is false when the group has no roles attribute, in which case its
+// role mappings are left alone.
+type RoleReconciliation struct {
+	GroupID string   `json:"groupID"`
+	Managed bool     `json:"managed"`
+	Roles   []string `json:"roles"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// errRoleNotFound is returned when a group's roles attribute names a realm role that does not exist.
+type errRoleNotFound struct {
+	role string
+}
+
+func (e *errRoleNotFound) Error() string {
+	return "realm role " + e.role + " does not exist"
+}
+
+// errMalformedRolesAttribute is returned when a value of a group's roles attribute looks like a
+// JSON array but is not an array of strings.
+var errMalformedRolesAttribute = errors.New("roles attribute is not a list of role names")
+
+// groupRoleRule holds the realm roles a group's roles attribute asks for, resolved ahead of
+// applying them so that a group is not created when one of them does not exist.
+type groupRoleRule struct {
+	managed bool
+	roles   map[string]gocloak.Role // keyed by role name
+}
+
+// HandleGroupReconcileRolesRequest is a Handler function for bringing the realm role mappings of a group
+// in keyclock in line with its roles attribute
+func HandleGroupReconcileRolesRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("reconcile group roles request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into ReconcileRolesRequest struct
+	var req ReconcileRolesRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForReconcileRolesError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	group, err := client.GetGroup(ctx, token, realm, req.GroupID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": req.GroupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	rule, err := resolveGroupRoleRule(ctx, client, token, realm, group.Attributes)
+	if err != nil {
+		sendRoleRuleError(c, lh, err)
+		return
+	}
+	reconciliation, err := rule.apply(ctx, client, token, realm, req.GroupID)
+	if err != nil {
+		lh.LogActivity("Error while reconciling group roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	auditRoleReconciliation(lh, token, reconciliation)
+
+	// Send success response
+	utils.SendSuccessResponse(c, reconciliation)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of reconcileGroupRoles", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// groupRoleNames returns the role names listed in a group's roles attribute, and whether the
+// group has the attribute at all.
+func groupRoleNames(attributes *map[string][]string) ([]string, bool, error) {
+	if attributes == nil {
+		return nil, false, nil
+	}
+	values, ok := (*attributes)[utils.RolesAttribute]
+	if !ok {
+		return nil, false, nil
+	}
+	var names []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.HasPrefix(value, "[") {
+			if value != "" {
+				names = append(names, value)
+			}
+			continue
+		}
+		var listed []string
+		if err := json.Unmarshal([]byte(value), &listed); err != nil {
+			return nil, true, errMalformedRolesAttribute
+		}
+		names = append(names, listed...)
+	}
+	return names, true, nil
+}
+
+// resolveGroupRoleRule looks up the realm roles a group's roles attribute asks for. It fails
+// with *errRoleNotFound when one of them does not exist.
+func resolveGroupRoleRule(ctx context.Context, client utils.KeycloakClient, token, realm string, attributes *map[string][]string) (*groupRoleRule, error) {
+	names, managed, err := groupRoleNames(attributes)
+	if err != nil || !managed {
+		return &groupRoleRule{managed: managed}, err
+	}
+	rule := &groupRoleRule{managed: true, roles: map[string]gocloak.Role{}}
+	for _, name := range names {
+		if _, ok := rule.roles[name]; ok {
+			continue
+		}
+		role, err := client.GetRealmRole(ctx, token, realm, name)
+		if utils.IsNotFound(err) {
+			return nil, &errRoleNotFound{role: name}
+		}
+		if err != nil {
+			return nil, err
+		}
+		rule.roles[name] = *role
+	}
+	return rule, nil
+}
+
+// plan works out how apply would change a group's realm role mappings, returning the roles to
+// map and unmap without changing anything.
+func (rule *groupRoleRule) plan(ctx context.Context, client utils.KeycloakClient, token, realm, groupID string) (reconciliation *RoleReconciliation, toAdd, toRemove []gocloak.Role, err error) {
+	reconciliation = &RoleReconciliation{GroupID: groupID, Managed: rule.managed, Roles: []string{}, Added: []string{}, Removed: []string{}}
+	if !rule.managed {
+		return reconciliation, nil, nil, nil
+	}
+	mappings, err := client.GetRoleMappingByGroupID(ctx, token, realm, groupID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	current := map[string]bool{}
+	if mappings != nil && mappings.RealmMappings != nil {
+		for _, role := range *mappings.RealmMappings {
+			name := gocloak.PString(role.Name)
+			current[name] = true
+			if _, ok := rule.roles[name]; !ok {
+				toRemove = append(toRemove, role)
+				reconciliation.Removed = append(reconciliation.Removed, name)
+			}
+		}
+	}
+	for name, role := range rule.roles {
+		reconciliation.Roles = append(reconciliation.Roles, name)
+		if !current[name] {
+			toAdd = append(toAdd, role)
+			reconciliation.Added = append(reconciliation.Added, name)
+		}
+	}
+	sort.Strings(reconciliation.Roles)
+	sort.Strings(reconciliation.Added)
+	sort.Strings(reconciliation.Removed)
+	return reconciliation, toAdd, toRemove, nil
+}
+
+// apply maps the rule's realm roles to a group and unmaps every other realm role from it.
+// A group without a roles attribute is left untouched.
+func (rule *groupRoleRule) apply(ctx context.Context, client utils.KeycloakClient, token, realm, groupID string) (*RoleReconciliation, error) {
+	reconciliation, toAdd, toRemove, err := rule.plan(ctx, client, token, realm, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(toAdd) > 0 {
+		if err := client.AddRealmRoleToGroup(ctx, token, realm, groupID, toAdd); err != nil {
+			return nil, err
+		}
+	}
+	if len(toRemove) > 0 {
+		if err := client.DeleteRealmRoleFromGroup(ctx, token, realm, groupID, toRemove); err != nil {
+			return nil, err
+		}
+	}
+	return reconciliation, nil
+}
+
+// sendRoleRuleError responds to a failure to resolve a group's roles attribute.
+func sendRoleRuleError(c *gin.Context, lh *logharbour.Logger, err error) {
+	field := "attributes." + utils.RolesAttribute
+	var notFound *errRoleNotFound
+	if errors.As(err, &notFound) {
+		lh.Debug0().LogDebug("Roles attribute names unknown role", logharbour.DebugInfo{Variables: map[string]any{"role": notFound.role}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("role_not_found", field, notFound.role))
+		return
+	}
+	if errors.Is(err, errMalformedRolesAttribute) {
+		lh.Debug0().LogDebug("Malformed roles attribute", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("attribute_schema_violation", field, "must be role names or a JSON array of role names"))
+		return
+	}
+	lh.Debug0().LogDebug("Error while fetching realm role:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+	utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "role_not_found"), ""))
+}
+
+// auditRoleReconciliation records the role mappings a reconciliation changed, if any.
+func auditRoleReconciliation(lh *logharbour.Logger, token string, reconciliation *RoleReconciliation) {
+	if len(reconciliation.Added) == 0 && len(reconciliation.Removed) == 0 {
+		return
+	}
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("group").WithWhatInstanceId(reconciliation.GroupID).
+		LogDataChange("group roles reconciled", logharbour.ChangeInfo{
+			Entity:    "group",
+			Operation: "update",
+			Changes:   map[string]any{"realmRoles": map[string]any{"added": reconciliation.Added, "removed": reconciliation.Removed}},
+		})
+}
+
+// getValsForReconcileRolesError returns a slice of strings to be used as vals for a validation error.
+func (req *ReconcileRolesRequest) getValsForReconcileRolesError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "GroupID":
+		vals = append(vals, "groupID is required")
+	}
+	return vals
+}
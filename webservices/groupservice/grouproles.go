@@ -0,0 +1,140 @@
+package groupservice
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// GroupRoles lists role names. ClientRoles is keyed by client ID and is only given when
+// client roles were asked for.
+type GroupRoles struct {
+	RealmRoles  []string            `json:"realmRoles"`
+	ClientRoles map[string][]string `json:"clientRoles,omitempty"`
+}
+
+// GroupRolesResponse represents the structure for outgoing group role responses. Direct holds
+// the roles mapped to the group itself; Effective holds every role its members are granted,
+// including those mapped to its parent groups and those included through composite roles.
+type GroupRolesResponse struct {
+	GroupID   string     `json:"groupID"`
+	Direct    GroupRoles `json:"direct"`
+	Effective GroupRoles `json:"effective"`
+	Truncated bool       `json:"truncated"`
+}
+
+// HandleGroupRolesRequest is a Handler function for fetching the roles membership of a group grants in keyclock
+func HandleGroupRolesRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group roles request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	groupID := c.Query("groupID")
+	if groupID == "" {
+		lh.Debug0().LogDebug("Missing groupID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "groupID"))
+		return
+	}
+
+	includeClientRoles := false
+	if v := c.Query("includeClientRoles"); v != "" {
+		if includeClientRoles, err = strconv.ParseBool(v); err != nil {
+			lh.Debug0().LogDebug("Invalid includeClientRoles parameter", logharbour.DebugInfo{Variables: map[string]any{"includeClientRoles": v}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+			return
+		}
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	group, err := client.GetGroup(ctx, token, realm, groupID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	// Collect the roles mapped directly to the group
+	mappings, err := client.GetRoleMappingByGroupID(ctx, token, realm, groupID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching group role mappings:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	direct := utils.NewRoleExpander(ctx, client, token, realm)
+	direct.AddMappings(mappings)
+	effective := utils.NewRoleExpander(ctx, client, token, realm)
+	effective.AddMappings(mappings)
+
+	// Members also inherit the roles mapped to the group's ancestors
+	segments := strings.Split(strings.Trim(gocloak.PString(group.Path), "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		ancestorPath := "/" + strings.Join(segments[:i], "/")
+		ancestor, err := client.GetGroupByPath(ctx, token, realm, ancestorPath)
+		if err != nil {
+			lh.Debug0().LogDebug("Error while fetching parent group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "path": ancestorPath}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+		ancestorMappings, err := client.GetRoleMappingByGroupID(ctx, token, realm, gocloak.PString(ancestor.ID))
+		if err != nil {
+			lh.Debug0().LogDebug("Error while fetching group role mappings:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "path": ancestorPath}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+		effective.AddMappings(ancestorMappings)
+	}
+
+	// Expand composite roles
+	if err := effective.Expand(); err != nil {
+		lh.LogActivity("Error while expanding composite roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "role_not_found"), ""))
+		return
+	}
+	if effective.Truncated {
+		lh.Warn().LogActivity("Composite role chain deeper than the expansion limit", map[string]any{"groupID": groupID, "maxDepth": utils.MaxCompositeDepth})
+	}
+
+	response := GroupRolesResponse{GroupID: groupID, Truncated: effective.Truncated}
+	for _, roles := range []struct {
+		expander *utils.RoleExpander
+		into     *GroupRoles
+	}{{direct, &response.Direct}, {effective, &response.Effective}} {
+		realmRoles, clientRoles, err := roles.expander.RoleNames(includeClientRoles)
+		if err != nil {
+			lh.Debug0().LogDebug("Error while fetching client:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "client_not_found"), ""))
+			return
+		}
+		roles.into.RealmRoles = realmRoles
+		if includeClientRoles {
+			roles.into.ClientRoles = clientRoles
+		}
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupRoles", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
@@ -0,0 +1,177 @@
+package groupservice
+
+import (
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// maxTreeDepth is the deepest level of nesting included in a group tree.
+	maxTreeDepth = 10
+	// maxTreeNodes is the maximum number of groups included in a group tree.
+	maxTreeNodes = 5000
+	// groupTreeCacheTTL is how long a built group tree is served from cache.
+	groupTreeCacheTTL = 30 * time.Second
+)
+
+// GroupTreeNode represents a single group in the group hierarchy tree.
+type GroupTreeNode struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Path     string          `json:"path"`
+	Type     string          `json:"type"`
+	Children []GroupTreeNode `json:"children"`
+	// DisplayName is set per request, to the display name in the language asked for or the name
+	DisplayName string `json:"displayName"`
+	// Attributes and the timestamps recorded in them are only given when the tree is not brief
+	Attributes *map[string][]string `json:"attributes,omitempty"`
+	CreatedAt  *time.Time           `json:"createdAt,omitempty"`
+	UpdatedAt  *time.Time           `json:"updatedAt,omitempty"`
+}
+
+// groupTreeCache holds recently built group trees keyed by realm and caller, as keyclock only
+// shows each caller the groups it may see.
+var groupTreeCache = utils.NewTTLCache[[]GroupTreeNode](groupTreeCacheTTL)
+
+// InvalidateGroupTree drops the cached group trees of a realm. It is registered with
+// utils.OnGroupsChange, which handlers changing groups call.
+func InvalidateGroupTree(realm string) {
+	groupTreeCache.DeletePrefix(realm + "/")
+}
+
+// HandleGroupTreeRequest is a Handler function for fetching the whole group hierarchy from keyclock as a tree
+func HandleGroupTreeRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("group tree request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Optionally restrict the tree to groups or capabilities
+	groupType := c.Query("type")
+	if groupType != "" && !utils.ValidGroupType(groupType) {
+		lh.Debug0().LogDebug("Invalid group type:", logharbour.DebugInfo{Variables: map[string]any{"type": groupType}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	brief, ok := utils.GetBriefParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid brief parameter", logharbour.DebugInfo{Variables: map[string]any{"brief": c.Query("brief")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	cacheKey := utils.CallerCacheKey(token, realm)
+	if tree, ok := groupTreeCache.Get(cacheKey); ok {
+		lh.Debug0().LogDebug("group tree served from cache", logharbour.DebugInfo{Variables: map[string]any{"realm": realm}})
+		utils.SendSuccessResponse(c, filterGroupTree(tree, groupType, brief, utils.RequestLanguages(c)))
+		return
+	}
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Fetch top level groups along with their nested sub groups. Full representations are
+	// needed even for a brief tree, as the group type is held in the attributes.
+	groups, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{BriefRepresentation: gocloak.BoolP(false)})
+	if err != nil {
+		lh.LogActivity("Error while fetching Groups:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	nodeCount := 0
+	tree, ok := buildGroupTree(derefGroups(groups), 1, &nodeCount)
+	if !ok {
+		lh.Debug0().LogDebug("group tree exceeds bounds", logharbour.DebugInfo{Variables: map[string]any{"maxDepth": maxTreeDepth, "maxNodes": maxTreeNodes}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("tree_too_large", ""))
+		return
+	}
+	groupTreeCache.Set(cacheKey, tree)
+
+	// Send success response
+	utils.SendSuccessResponse(c, filterGroupTree(tree, groupType, brief, utils.RequestLanguages(c)))
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of groupTree", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// buildGroupTree converts groups and their sub groups into tree nodes. It returns false
+// as soon as the tree grows deeper than maxTreeDepth or larger than maxTreeNodes.
+func buildGroupTree(groups []gocloak.Group, depth int, nodeCount *int) ([]GroupTreeNode, bool) {
+	if depth > maxTreeDepth {
+		return nil, false
+	}
+	nodes := make([]GroupTreeNode, 0, len(groups))
+	for _, group := range groups {
+		*nodeCount++
+		if *nodeCount > maxTreeNodes {
+			return nil, false
+		}
+		node := GroupTreeNode{
+			ID:         gocloak.PString(group.ID),
+			Name:       gocloak.PString(group.Name),
+			Path:       gocloak.PString(group.Path),
+			Type:       utils.GroupType(group.Attributes),
+			Children:   []GroupTreeNode{},
+			Attributes: group.Attributes,
+		}
+		node.CreatedAt, node.UpdatedAt = utils.GroupTimestamps(group.Attributes)
+		if group.SubGroups != nil && len(*group.SubGroups) > 0 {
+			children, ok := buildGroupTree(*group.SubGroups, depth+1, nodeCount)
+			if !ok {
+				return nil, false
+			}
+			node.Children = children
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, true
+}
+
+// filterGroupTree returns the nodes of the given idshield type, along with their sub trees, with
+// display names in the first of langs each has one for. An empty groupType keeps every node.
+// Brief trees leave out the attributes of each node. The cached nodes themselves are left as is.
+func filterGroupTree(nodes []GroupTreeNode, groupType string, brief bool, langs []string) []GroupTreeNode {
+	filtered := make([]GroupTreeNode, 0, len(nodes))
+	for _, node := range nodes {
+		if groupType != "" && node.Type != groupType {
+			continue
+		}
+		node.DisplayName = utils.DisplayName(langs, node.Name, node.Attributes)
+		if brief {
+			node.Attributes, node.CreatedAt, node.UpdatedAt = nil, nil, nil
+		}
+		node.Children = filterGroupTree(node.Children, groupType, brief, langs)
+		filtered = append(filtered, node)
+	}
+	return filtered
+}
+
+// derefGroups converts a slice of group pointers into a slice of groups, skipping nil entries.
+func derefGroups(groups []*gocloak.Group) []gocloak.Group {
+	result := make([]gocloak.Group, 0, len(groups))
+	for _, group := range groups {
+		if group != nil {
+			result = append(result, *group)
+		}
+	}
+	return result
+}
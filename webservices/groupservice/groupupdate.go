@@ -0,0 +1,244 @@
+package groupservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// groupPatchDocument is the part of a group a merge patch applies to. Other members of the
+// group, such as its path or sub groups, cannot be patched.
+type groupPatchDocument struct {
+	Name       string              `json:"name"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// HandleGroupUpdateRequest is a Handler function for updating a group in keyclock with a JSON merge patch
+// (RFC 7386), e.g. PATCH /group-update?groupID=ID with a body of {"attributes": {"region": ["eu"], "old": null}}.
+// The patch applies to the group's name and attributes: present members replace, null members delete.
+func HandleGroupUpdateRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("update group request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	groupID := c.Query("groupID")
+	if groupID == "" {
+		lh.Debug0().LogDebug("Missing groupID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "groupID"))
+		return
+	}
+
+	// The body is the merge patch itself, not wrapped in a data member
+	if mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err != nil || mediaType != utils.MergePatchContentType {
+		lh.Debug0().LogDebug("Group update without a merge patch", logharbour.DebugInfo{Variables: map[string]any{"contentType": c.GetHeader("Content-Type")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("unsupported_media_type", ""))
+		return
+	}
+	var patch any
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &patch)
+	}
+	if _, isObject := patch.(map[string]any); err != nil || !isObject {
+		lh.LogActivity("Error Unmarshalling merge patch:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	group, err := client.GetGroup(ctx, token, realm, groupID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	current := groupPatchDocument{Name: gocloak.PString(group.Name), Attributes: map[string][]string{}}
+	if group.Attributes != nil {
+		current.Attributes = *group.Attributes
+	}
+
+	patched, field, err := applyGroupPatch(current, patch)
+	if err != nil {
+		lh.Debug0().LogDebug("Merge patch does not apply to group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "field": field}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", field))
+		return
+	}
+	if patched.Name == "" || strings.Contains(patched.Name, "/") {
+		lh.Debug0().LogDebug("Invalid group name", logharbour.DebugInfo{Variables: map[string]any{"name": patched.Name}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "name"))
+		return
+	}
+
+	// The idshield type of the group cannot be patched, and the timestamps are kept by idshield
+	groupType := utils.GroupType(group.Attributes)
+	attributes, duplicated, validationErrors := utils.DedupeAttributes(utils.WithGroupType(&patched.Attributes, groupType))
+	if len(duplicated) > 0 && len(validationErrors) == 0 {
+		lh.Warn().LogActivity("Duplicate attribute values removed", map[string]any{"keys": duplicated})
+	}
+	validationErrors = append(validationErrors, utils.ValidateAttributes(groupType, attributes)...)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Resolve the realm roles the group's roles attribute asks for before touching the group
+	roleRule, err := resolveGroupRoleRule(ctx, client, token, realm, attributes)
+	if err != nil {
+		sendRoleRuleError(c, lh, err)
+		return
+	}
+
+	// Values of unique attributes must not be held by any other group
+	conflicts, err := utils.UniqueAttributeConflicts(ctx, client, token, realm, gocloak.PString(group.Path), attributes)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while checking unique attributes:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	if len(conflicts) > 0 {
+		lh.Debug0().LogDebug("Unique attribute values already held:", logharbour.DebugInfo{Variables: map[string]interface{}{"conflicts": conflicts}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, conflicts))
+		return
+	}
+
+	changes := groupPatchChanges(current, patched.Name, *utils.WithTimestampsOf(attributes, group.Attributes))
+	group.Name = gocloak.StringP(patched.Name)
+	group.Attributes = utils.StampUpdated(attributes, group.Attributes)
+	if err := client.UpdateGroup(ctx, token, realm, *group); err != nil {
+		lh.LogActivity("Error while updating group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		errcode := utils.KeycloakErrorCode(err, "group_not_found")
+		if utils.IsConflict(err) {
+			errcode = "name already exist"
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
+	}
+
+	// Bring the group's realm role mappings in line with its roles attribute
+	reconciliation, err := roleRule.apply(ctx, client, token, realm, groupID)
+	if err != nil {
+		lh.LogActivity("Error while reconciling group roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	auditRoleReconciliation(lh, token, reconciliation)
+
+	// A rename changes the paths in the group hierarchy
+	utils.GroupsChanged(realm)
+
+	// Fetch the group again, for its path after any rename
+	if updated, err := client.GetGroup(ctx, token, realm, groupID); err == nil {
+		group = updated
+	} else {
+		lh.Debug0().LogDebug("Error while fetching updated group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("group").WithWhatInstanceId(groupID).
+		LogDataChange("group updated", logharbour.ChangeInfo{
+			Entity:    "group",
+			Operation: "update",
+			Changes:   changes,
+		})
+
+	// Let any configured webhooks know about the change
+	s.Dependencies["webhooks"].(*utils.WebhookNotifier).Notify("group", "updated", groupID, realm, utils.SubjectFromToken(token))
+
+	// Send success response
+	response := GroupResponse{
+		ID:         gocloak.PString(group.ID),
+		Name:       gocloak.PString(group.Name),
+		Path:       gocloak.PString(group.Path),
+		Type:       utils.GroupType(group.Attributes),
+		Attributes: group.Attributes,
+	}
+	response.DisplayName = utils.DisplayName(utils.RequestLanguages(c), response.Name, group.Attributes)
+	response.CreatedAt, response.UpdatedAt = utils.GroupTimestamps(group.Attributes)
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of updateGroup", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// applyGroupPatch applies a merge patch to the patchable part of a group. When the result is
+// not a valid group document, it returns an error along with the offending member, e.g. "path"
+// for a member that cannot be patched.
+func applyGroupPatch(current groupPatchDocument, patch any) (groupPatchDocument, string, error) {
+	var target any
+	encoded, err := json.Marshal(current)
+	if err == nil {
+		err = json.Unmarshal(encoded, &target)
+	}
+	if err != nil {
+		return groupPatchDocument{}, "", err
+	}
+	if encoded, err = json.Marshal(utils.MergePatch(target, patch)); err != nil {
+		return groupPatchDocument{}, "", err
+	}
+
+	var patched groupPatchDocument
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		field := ""
+		var typeErr *json.UnmarshalTypeError
+		if _, member, ok := strings.Cut(err.Error(), "unknown field "); ok {
+			field = strings.Trim(member, `"`)
+		} else if errors.As(err, &typeErr) {
+			field = typeErr.Field
+		}
+		return groupPatchDocument{}, field, err
+	}
+	if patched.Attributes == nil {
+		patched.Attributes = map[string][]string{}
+	}
+	return patched, "", nil
+}
+
+// groupPatchChanges returns the audit record of the changes from current to the given name
+// and attributes, listing only what differs.
+func groupPatchChanges(current groupPatchDocument, name string, attributes map[string][]string) map[string]any {
+	changes := map[string]any{}
+	if name != current.Name {
+		changes["name"] = map[string]any{"old": current.Name, "new": name}
+	}
+	for key, values := range attributes {
+		if old, ok := current.Attributes[key]; !ok || !reflect.DeepEqual(old, values) {
+			changes["attributes."+key] = map[string]any{"old": old, "new": values}
+		}
+	}
+	for key, old := range current.Attributes {
+		if _, ok := attributes[key]; !ok {
+			changes["attributes."+key] = map[string]any{"old": old, "new": nil}
+		}
+	}
+	return changes
+}
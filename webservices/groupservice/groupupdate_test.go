@@ -0,0 +1,71 @@
+package groupservice
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyGroupPatch(t *testing.T) {
+	current := groupPatchDocument{
+		Name:       "sales",
+		Attributes: map[string][]string{"region": {"emea"}, "tier": {"gold"}},
+	}
+	tests := []struct {
+		name      string
+		patch     string
+		want      groupPatchDocument
+		wantField string
+	}{
+		{
+			name:  "rename",
+			patch: `{"name": "sales-emea"}`,
+			want:  groupPatchDocument{Name: "sales-emea", Attributes: map[string][]string{"region": {"emea"}, "tier": {"gold"}}},
+		},
+		{
+			name:  "attribute replaced, added and deleted",
+			patch: `{"attributes": {"region": ["apac"], "zone": ["south"], "tier": null}}`,
+			want:  groupPatchDocument{Name: "sales", Attributes: map[string][]string{"region": {"apac"}, "zone": {"south"}}},
+		},
+		{
+			name:  "every attribute deleted",
+			patch: `{"attributes": null}`,
+			want:  groupPatchDocument{Name: "sales", Attributes: map[string][]string{}},
+		},
+		{
+			name:  "empty patch",
+			patch: `{}`,
+			want:  current,
+		},
+		{name: "path", patch: `{"path": "/finance/sales"}`, wantField: "path"},
+		{name: "id", patch: `{"id": "other-id"}`, wantField: "id"},
+		{name: "sub groups", patch: `{"subGroups": []}`, wantField: "subGroups"},
+		{name: "name of the wrong type", patch: `{"name": 42}`, wantField: "name"},
+		{name: "attribute values not a list", patch: `{"attributes": {"region": "apac"}}`, wantField: "attributes.region"},
+		{name: "not an object", patch: `["sales"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch any
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatalf("invalid patch: %v", err)
+			}
+			got, field, err := applyGroupPatch(current, patch)
+			if tt.want.Name == "" {
+				if err == nil {
+					t.Fatalf("applyGroupPatch() = %+v, want an error", got)
+				}
+				if field != tt.wantField {
+					t.Errorf("offending member = %q, want %q", field, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyGroupPatch() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyGroupPatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package groupservice
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// similarNameDistance is the largest number of single character edits between two group names
+// considered a likely typo, for names of more than five characters; shorter names allow one.
+const similarNameDistance = 2
+
+// groupCreateWarnings returns the warnings raised by a group creation request: a group with no
+// attributes besides its type, and a name that looks like a typo of an existing top level group.
+func groupCreateWarnings(ctx context.Context, client utils.KeycloakClient, token, realm string, req CreateGroupRequest) ([]wscutils.ErrorMessage, error) {
+	var warnings []wscutils.ErrorMessage
+	if req.Attributes == nil || len(*req.Attributes) == 0 {
+		field := "attributes"
+		warnings = append(warnings, wscutils.BuildErrorMessage("group_without_attributes", &field))
+	}
+
+	groups, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{BriefRepresentation: gocloak.BoolP(true)})
+	if err != nil {
+		return warnings, err
+	}
+	if similar := similarGroupName(*req.Name, groups); similar != "" {
+		field := "name"
+		warnings = append(warnings, wscutils.BuildErrorMessage("similar_group_name", &field, similar))
+	}
+	return warnings, nil
+}
+
+// similarGroupName returns the name of a top level group that differs from name only by case or
+// by a few characters, or an empty string if there is none. A group of exactly that name is not
+// similar, it is the same group.
+func similarGroupName(name string, groups []*gocloak.Group) string {
+	maxDistance := similarNameDistance
+	if len([]rune(name)) <= 5 {
+		maxDistance = 1
+	}
+	lower := strings.ToLower(name)
+	for _, group := range groups {
+		if group == nil || gocloak.PString(group.Name) == name {
+			continue
+		}
+		existing := gocloak.PString(group.Name)
+		if editDistance(lower, strings.ToLower(existing)) <= maxDistance {
+			return existing
+		}
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,402 @@
+package groupservice
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// maxSnapshotGroupBytes is the room given to each group of a snapshot being restored, its
+	// attributes and role mappings included.
+	maxSnapshotGroupBytes = 4 << 10
+	// MaxRestoreBodyBytes is the largest request body accepted for restoring a snapshot, sized for
+	// the most groups a snapshot may hold.
+	MaxRestoreBodyBytes = maxTreeNodes * maxSnapshotGroupBytes
+)
+
+const (
+	// RestoreSkip leaves groups that already exist as they are when restoring a snapshot.
+	RestoreSkip = "skip"
+	// RestoreOverwrite replaces the attributes and role mappings of groups that already exist
+	// when restoring a snapshot.
+	RestoreOverwrite = "overwrite"
+)
+
+// RealmGroupsSnapshot is the portable representation of every group of a realm, capabilities
+// included, along with their attributes and role mappings.
+type RealmGroupsSnapshot struct {
+	Realm   string        `json:"realm"`
+	TakenAt time.Time     `json:"takenAt"`
+	Groups  []GroupExport `json:"groups" validate:"dive"`
+}
+
+// RealmGroupsRestoreRequest represents the structure for incoming realm groups restore requests:
+// a snapshot as taken, along with what to do with groups that already exist. OnConflict is skip,
+// the default, or overwrite.
+type RealmGroupsRestoreRequest struct {
+	RealmGroupsSnapshot
+	OnConflict string `json:"onConflict" validate:"omitempty,oneof=skip overwrite"`
+}
+
+// RestoredGroup reports what was done with a group of a snapshot. Action is created, skipped,
+// overwritten or failed; Error holds the error code of a failure.
+type RestoredGroup struct {
+	Path   string `json:"path"`
+	ID     string `json:"id,omitempty"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RealmGroupsRestoreResponse represents the structure for outgoing realm groups restore responses.
+type RealmGroupsRestoreResponse struct {
+	OnConflict   string          `json:"onConflict"`
+	Created      int             `json:"created"`
+	Skipped      int             `json:"skipped"`
+	Overwritten  int             `json:"overwritten"`
+	Failed       int             `json:"failed"`
+	Groups       []RestoredGroup `json:"groups"`
+	MissingRoles []MissingRole   `json:"missingRoles"`
+}
+
+// HandleRealmGroupsSnapshotRequest is a Handler function for exporting every group of a realm in keyclock,
+// with its attributes and role mappings, as a single document for disaster recovery. The snapshot is bounded
+// like the group tree, which keeps it small enough to be built in memory and sent whole, so that a failure
+// part way through is answered with an error rather than a truncated document.
+func HandleRealmGroupsSnapshotRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("realm groups snapshot request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	topGroups, err := utils.CollectPages(utils.MaxPageSize, 0, func(first, max int) ([]*gocloak.Group, error) {
+		return client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(max),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+	})
+	if err != nil {
+		lh.LogActivity("Error while fetching Groups:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	snapshot := RealmGroupsSnapshot{Realm: realm, TakenAt: time.Now().UTC(), Groups: []GroupExport{}}
+	nodeCount := 0
+	for _, group := range topGroups {
+		if group == nil {
+			continue
+		}
+		export, err := exportGroup(ctx, client, token, realm, gocloak.PString(group.ID), 1, &nodeCount)
+		if errors.Is(err, errTreeTooLarge) {
+			lh.Debug0().LogDebug("group tree exceeds bounds", logharbour.DebugInfo{Variables: map[string]any{"maxDepth": maxTreeDepth, "maxNodes": maxTreeNodes}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("tree_too_large", ""))
+			return
+		}
+		if err != nil {
+			lh.LogActivity("Error while exporting group:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "groupID": gocloak.PString(group.ID)}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+		snapshot.Groups = append(snapshot.Groups, export)
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, snapshot)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of realmGroupsSnapshot", map[string]any{"groups": nodeCount, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleRealmGroupsRestoreRequest is a Handler function for recreating in keyclock the groups of a snapshot
+// taken by HandleRealmGroupsSnapshotRequest, possibly into an empty realm. A group is matched to an existing
+// one by its path. Existing groups are skipped or overwritten as asked, but their missing sub groups are
+// restored either way. A group that cannot be restored is reported, along with its sub groups being left out,
+// without stopping the others.
+func HandleRealmGroupsRestoreRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("realm groups restore request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into RealmGroupsRestoreRequest struct
+	var req RealmGroupsRestoreRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = RestoreSkip
+	}
+
+	// The snapshot is bounded like the one taken
+	nodeCount := 0
+	for _, group := range req.Groups {
+		if !withinTreeBounds(group, 1, &nodeCount) {
+			lh.Debug0().LogDebug("group tree exceeds bounds", logharbour.DebugInfo{Variables: map[string]any{"maxDepth": maxTreeDepth, "maxNodes": maxTreeNodes}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("tree_too_large", ""))
+			return
+		}
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForRealmGroupsRestoreError)
+	for i := range req.Groups {
+		validationErrors = append(validationErrors, validateImportAttributes(lh, &req.Groups[i])...)
+	}
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	restorer := &groupRestorer{
+		groupImporter: &groupImporter{ctx: ctx, client: client, token: token, realm: realm, clientIDs: map[string]string{}},
+		overwrite:     req.OnConflict == RestoreOverwrite,
+		response:      RealmGroupsRestoreResponse{OnConflict: req.OnConflict, Groups: []RestoredGroup{}},
+	}
+	for _, group := range req.Groups {
+		if err = restorer.restoreGroup("", "", false, group); err != nil {
+			break
+		}
+	}
+
+	// Part of the tree may have been restored even if the restore was stopped
+	utils.GroupsChanged(realm)
+
+	response := restorer.response
+	response.MissingRoles = append([]MissingRole{}, restorer.missingRoles...)
+	subject := utils.SubjectFromToken(token)
+	lh.WithWho(subject).WithWhatClass("realm").WithWhatInstanceId(realm).
+		LogDataChange("realm groups restored", logharbour.ChangeInfo{
+			Entity:    "realm",
+			Operation: "update",
+			Changes: map[string]any{
+				"onConflict":  req.OnConflict,
+				"created":     response.Created,
+				"skipped":     response.Skipped,
+				"overwritten": response.Overwritten,
+				"failed":      response.Failed,
+			},
+		})
+
+	// Let any configured webhooks know about the changes
+	webhooks := s.Dependencies["webhooks"].(*utils.WebhookNotifier)
+	for _, group := range response.Groups {
+		switch group.Action {
+		case "created":
+			webhooks.Notify("group", "created", group.ID, realm, subject)
+		case "overwritten":
+			webhooks.Notify("group", "updated", group.ID, realm, subject)
+		}
+	}
+
+	if err != nil {
+		lh.LogActivity("Realm groups restore stopped:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "created": response.Created, "overwritten": response.Overwritten}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	if len(response.MissingRoles) > 0 {
+		lh.Warn().LogActivity("Groups restored without some of their roles", map[string]any{"missingRoles": response.MissingRoles})
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of realmGroupsRestore", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// withinTreeBounds reports whether export, counted into nodeCount, stays within maxTreeDepth and
+// maxTreeNodes.
+func withinTreeBounds(export GroupExport, depth int, nodeCount *int) bool {
+	*nodeCount++
+	if depth > maxTreeDepth || *nodeCount > maxTreeNodes {
+		return false
+	}
+	for _, subGroup := range export.SubGroups {
+		if !withinTreeBounds(subGroup, depth+1, nodeCount) {
+			return false
+		}
+	}
+	return true
+}
+
+// groupRestorer recreates the groups of a snapshot in a realm, reporting what it did with each.
+type groupRestorer struct {
+	*groupImporter
+	overwrite bool
+	response  RealmGroupsRestoreResponse
+}
+
+// restoreGroup restores export, along with its sub groups, under the group parentID at parentPath, or
+// at the top level if parentID is empty. parentCreated tells that the parent was just created, and so
+// has no sub groups yet. Failures are reported rather than returned, unless the request itself was
+// cancelled or timed out, which stops the restore.
+func (r *groupRestorer) restoreGroup(parentID, parentPath string, parentCreated bool, export GroupExport) error {
+	path := parentPath + "/" + export.Name
+	var existing *gocloak.Group
+	if !parentCreated {
+		group, err := r.client.GetGroupByPath(r.ctx, r.token, r.realm, path)
+		if err != nil && !utils.IsNotFound(err) {
+			return r.fail(path, "", err)
+		}
+		existing = group
+	}
+
+	var groupID, action string
+	var err error
+	switch {
+	case existing == nil:
+		action = "created"
+		groupID, _, err = r.createGroup(parentID, export)
+	case r.overwrite:
+		action = "overwritten"
+		groupID = gocloak.PString(existing.ID)
+		err = r.overwriteGroup(existing, path, export)
+	default:
+		action = "skipped"
+		groupID = gocloak.PString(existing.ID)
+	}
+	if err != nil {
+		return r.fail(path, groupID, err)
+	}
+	switch action {
+	case "created":
+		r.response.Created++
+	case "overwritten":
+		r.response.Overwritten++
+	default:
+		r.response.Skipped++
+	}
+	r.response.Groups = append(r.response.Groups, RestoredGroup{Path: path, ID: groupID, Action: action})
+	if action != "skipped" {
+		// Drop what was cached about the group, such as the holders of a capability
+		utils.GroupMembershipChanged(r.realm, groupID)
+	}
+
+	for _, subGroup := range export.SubGroups {
+		if err := r.restoreGroup(groupID, path, existing == nil, subGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fail reports the group at path as failed, returning err if it stops the restore.
+func (r *groupRestorer) fail(path, groupID string, err error) error {
+	if r.ctx.Err() != nil {
+		return err
+	}
+	errcode := utils.KeycloakErrorCode(err, "group_not_found")
+	var uniqueErr *uniqueAttributeError
+	if errors.As(err, &uniqueErr) {
+		errcode = "duplicate_unique_attribute"
+	}
+	r.response.Failed++
+	r.response.Groups = append(r.response.Groups, RestoredGroup{Path: path, ID: groupID, Action: "failed", Error: errcode})
+	return nil
+}
+
+// overwriteGroup replaces the attributes of an existing group with those of export, keeping its
+// timestamps, and makes its directly mapped roles those of export.
+func (r *groupRestorer) overwriteGroup(group *gocloak.Group, path string, export GroupExport) error {
+	groupID := gocloak.PString(group.ID)
+	attributes := export.Attributes
+	desired := utils.WithGroupType(&attributes, utils.GroupType(&attributes))
+	if err := r.checkUniqueAttributes(path, desired); err != nil {
+		return err
+	}
+	group.Attributes = utils.StampUpdated(desired, group.Attributes)
+	if err := r.client.UpdateGroup(r.ctx, r.token, r.realm, *group); err != nil {
+		return err
+	}
+
+	mappings, err := r.client.GetRoleMappingByGroupID(r.ctx, r.token, r.realm, groupID)
+	if err != nil {
+		return err
+	}
+	if mappings.RealmMappings != nil {
+		if extra := extraRoles(*mappings.RealmMappings, export.RealmRoles); len(extra) > 0 {
+			if err := r.client.DeleteRealmRoleFromGroup(r.ctx, r.token, r.realm, groupID, extra); err != nil {
+				return err
+			}
+		}
+	}
+	for clientID, clientMappings := range mappings.ClientMappings {
+		if clientMappings == nil || clientMappings.Mappings == nil {
+			continue
+		}
+		if extra := extraRoles(*clientMappings.Mappings, export.ClientRoles[clientID]); len(extra) > 0 {
+			if err := r.client.DeleteClientRoleFromGroup(r.ctx, r.token, r.realm, gocloak.PString(clientMappings.ID), groupID, extra); err != nil {
+				return err
+			}
+		}
+	}
+	return r.mapRoles(groupID, path, export)
+}
+
+// extraRoles returns the roles whose names are not among names.
+func extraRoles(roles []gocloak.Role, names []string) []gocloak.Role {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+	var extra []gocloak.Role
+	for _, role := range roles {
+		if !keep[gocloak.PString(role.Name)] {
+			extra = append(extra, role)
+		}
+	}
+	return extra
+}
+
+// getValsForRealmGroupsRestoreError returns a slice of strings to be used as vals for a validation error.
+func (req *RealmGroupsRestoreRequest) getValsForRealmGroupsRestoreError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Name":
+		vals = append(vals, "group name is required")
+	case "OnConflict":
+		vals = append(vals, "onConflict must be skip or overwrite")
+	}
+	return vals
+}
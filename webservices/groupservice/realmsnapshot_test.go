@@ -0,0 +1,117 @@
+package groupservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/idshield/utils/keycloakmock"
+)
+
+// decodeRestoreResponse decodes the data of a realm groups restore response.
+func decodeRestoreResponse(t *testing.T, data any) RealmGroupsRestoreResponse {
+	t.Helper()
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("encoding response data: %v", err)
+	}
+	var response RealmGroupsRestoreResponse
+	if err := json.Unmarshal(encoded, &response); err != nil {
+		t.Fatalf("response data is not a restore response: %v", err)
+	}
+	return response
+}
+
+func TestHandleRealmGroupsRestoreRequestOverwriteUniqueAttributes(t *testing.T) {
+	withUniqueAttributes(t, "costCentre")
+
+	updated := false
+	client := &keycloakmock.Client{
+		GetGroupsFunc: holdingGroups("/finance"),
+		GetGroupByPathFunc: func(_ context.Context, _, _, path string) (*gocloak.Group, error) {
+			return &gocloak.Group{ID: gocloak.StringP("sales-id"), Name: gocloak.StringP("sales"), Path: &path}, nil
+		},
+		UpdateGroupFunc: func(context.Context, string, string, gocloak.Group) error {
+			updated = true
+			return nil
+		},
+	}
+
+	w := serve(newTestService(client), HandleRealmGroupsRestoreRequest, http.MethodPost, "/realm-groups-restore",
+		`{"data": {"onConflict": "overwrite", "groups": [{"name": "sales", "attributes": {"costCentre": ["cc-42"]}}]}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	response := decodeRestoreResponse(t, decodeResponse(t, w).Data)
+	if response.Failed != 1 || len(response.Groups) != 1 || response.Groups[0].Error != "duplicate_unique_attribute" {
+		t.Errorf("response = %+v, want /sales failed with duplicate_unique_attribute", response)
+	}
+	if updated {
+		t.Error("group overwritten with another group's unique value")
+	}
+}
+
+var (
+	membershipChangesMu sync.Mutex
+	// membershipChanges records the groups of the test realm reported as having changed members.
+	membershipChanges []string
+)
+
+func init() {
+	utils.OnGroupMembershipChange(func(realm, groupID string) {
+		if realm == testRealm {
+			membershipChangesMu.Lock()
+			membershipChanges = append(membershipChanges, groupID)
+			membershipChangesMu.Unlock()
+		}
+	})
+}
+
+// takeMembershipChanges returns the groups reported as having changed members since it was last called.
+func takeMembershipChanges() []string {
+	membershipChangesMu.Lock()
+	defer membershipChangesMu.Unlock()
+	changes := membershipChanges
+	membershipChanges = nil
+	return changes
+}
+
+func TestHandleRealmGroupsRestoreRequestInvalidatesCaches(t *testing.T) {
+	takeMembershipChanges()
+	client := &keycloakmock.Client{
+		GetGroupByPathFunc: func(_ context.Context, _, _, path string) (*gocloak.Group, error) {
+			if path == "/sales" {
+				return &gocloak.Group{ID: gocloak.StringP("sales-id"), Name: gocloak.StringP("sales"), Path: &path}, nil
+			}
+			return nil, &gocloak.APIError{Code: http.StatusNotFound, Message: "404 Not Found"}
+		},
+		UpdateGroupFunc: func(context.Context, string, string, gocloak.Group) error { return nil },
+		GetRoleMappingByGroupIDFunc: func(context.Context, string, string, string) (*gocloak.MappingsRepresentation, error) {
+			return &gocloak.MappingsRepresentation{}, nil
+		},
+		CreateGroupFunc: func(context.Context, string, string, gocloak.Group) (string, error) {
+			return "support-id", nil
+		},
+		GetGroupFunc: func(_ context.Context, _, _, groupID string) (*gocloak.Group, error) {
+			return &gocloak.Group{ID: &groupID, Path: gocloak.StringP("/support")}, nil
+		},
+	}
+
+	w := serve(newTestService(client), HandleRealmGroupsRestoreRequest, http.MethodPost, "/realm-groups-restore",
+		`{"data": {"onConflict": "overwrite", "groups": [{"name": "sales"}, {"name": "support"}]}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	response := decodeRestoreResponse(t, decodeResponse(t, w).Data)
+	if response.Overwritten != 1 || response.Created != 1 {
+		t.Fatalf("response = %+v, want /sales overwritten and /support created", response)
+	}
+	changes := takeMembershipChanges()
+	if len(changes) != 2 || changes[0] != "sales-id" || changes[1] != "support-id" {
+		t.Errorf("caches dropped for %v, want sales-id and support-id", changes)
+	}
+}
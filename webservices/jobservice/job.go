@@ -0,0 +1,223 @@
+package jobservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// Async wraps the handler of a bulk endpoint so that requests given async=true are run as a
+// background job instead, and answered at once with 202 and the job, which can then be polled
+// at /jobs/{id}. The request is run as it would have been synchronously, only bounded by the
+// job timeout rather than the route's, or by the expiry of the caller's token if sooner, and the
+// response it gets becomes the job's result. Other requests are passed on to handler unchanged.
+func Async(handler service.HandlerFunc) service.HandlerFunc {
+	return func(c *gin.Context, s *service.Service) {
+		lh := s.LogHarbour
+
+		async := false
+		if v := c.Query("async"); v != "" {
+			var err error
+			if async, err = strconv.ParseBool(v); err != nil {
+				lh.Debug0().LogDebug("Invalid async parameter", logharbour.DebugInfo{Variables: map[string]any{"async": v}})
+				utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "async"))
+				return
+			}
+		}
+		if !async {
+			handler(c, s)
+			return
+		}
+
+		token, err := router.ExtractToken(c.GetHeader("Authorization"))
+		if err != nil {
+			// Log and respond to token extraction/validation error
+			lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+			return
+		}
+
+		jobs := s.Dependencies["jobs"].(*utils.JobRunner)
+
+		// The body is spooled to disk now, as the request is over by the time the job runs
+		bodyFile, err := jobs.SpoolBody(http.MaxBytesReader(c.Writer, c.Request.Body, jobs.MaxBodyBytes()))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			lh.Debug0().LogDebug("Request body too large for a job", logharbour.DebugInfo{Variables: map[string]any{"limit": maxBytesErr.Limit}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("request_too_large", ""))
+			return
+		}
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			lh.LogActivity("Error while spooling request body:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("internal_error", ""))
+			return
+		}
+		if err != nil {
+			lh.Debug0().LogDebug("Error while reading request body:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+			return
+		}
+		removeBody := func() { os.Remove(bodyFile) }
+
+		// Create a context with the timeout configured for this route
+		ctx, cancel := utils.RequestContext(c)
+		defer cancel()
+
+		job := &utils.Job{
+			Operation: strings.TrimPrefix(c.FullPath(), "/:realm"),
+			Realm:     utils.GetRealm(c),
+			Actor:     utils.SubjectFromToken(token),
+		}
+		// The job's calls are made with the caller's token, so it cannot usefully outlive it
+		timeout := jobs.TimeoutFor(token)
+		request := c.Copy()
+		err = jobs.Enqueue(ctx, job, timeout, func(ctx context.Context) (int, []byte) {
+			recorder := httptest.NewRecorder()
+			jc, engine := gin.CreateTestContext(recorder)
+			// Contexts derived from the gin context must see the job being cancelled
+			engine.ContextWithFallback = true
+			jc.Request = request.Request.Clone(ctx)
+			body, err := os.Open(bodyFile)
+			if err != nil {
+				response, _ := json.Marshal(utils.ErrorResponse("internal_error", ""))
+				return http.StatusInternalServerError, response
+			}
+			defer body.Close()
+			jc.Request.Body = body
+			jc.Params, jc.Keys = request.Params, request.Keys
+			utils.SetClientTimeout(jc, timeout)
+			handler(jc, s)
+			return recorder.Code, recorder.Body.Bytes()
+		}, removeBody)
+		if err != nil {
+			removeBody()
+			lh.LogActivity("Error while recording job:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("job_store_unavailable", ""))
+			return
+		}
+
+		// Send success response, pointing at where the job can be polled
+		utils.SendAcceptedResponse(c, "/jobs/"+url.PathEscape(job.ID), job)
+
+		// Log the completion of execution
+		lh.LogActivity("Queued job", map[string]string{"jobID": job.ID, "operation": job.Operation, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+	}
+}
+
+// HandleJobGetRequest is a Handler function for polling a background job the caller started in the realm, e.g.
+// with a bulk request given async=true. The job's result is given once it is done or failed.
+func HandleJobGetRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("get job request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	jobs := s.Dependencies["jobs"].(*utils.JobRunner)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Jobs of other realms and callers are not given away
+	job, err := jobs.Get(ctx, c.Param("id"))
+	if err == nil && !ownJob(job, realm, token) {
+		err = utils.ErrJobNotFound
+	}
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching job:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "jobID": c.Param("id")}})
+		if errors.Is(err, utils.ErrJobNotFound) {
+			utils.SendErrorResponse(c, utils.ErrorResponse("job_not_found", "id"))
+			return
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse("job_store_unavailable", ""))
+		return
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, job)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of getJob", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleJobCancelRequest is a Handler function for cancelling a queued or running background job the caller
+// started in the realm. The job's further keyclock calls are abandoned, and once it has stopped it is returned
+// marked cancelled, its result reporting the work done before then. A job that finished before the cancellation
+// reached it is left as it is, and the request fails with job_finished.
+func HandleJobCancelRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("cancel job request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	jobs := s.Dependencies["jobs"].(*utils.JobRunner)
+	realm := utils.GetRealm(c)
+	id := c.Param("id")
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Jobs of other realms and callers are not given away
+	job, err := jobs.Get(ctx, id)
+	if err == nil && !ownJob(job, realm, token) {
+		err = utils.ErrJobNotFound
+	}
+	if err == nil {
+		job, err = jobs.Cancel(ctx, id)
+	}
+	if err != nil {
+		lh.Debug0().LogDebug("Error while cancelling job:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "jobID": id}})
+		switch {
+		case errors.Is(err, utils.ErrJobNotFound):
+			utils.SendErrorResponse(c, utils.ErrorResponse("job_not_found", "id"))
+		case errors.Is(err, utils.ErrJobFinished):
+			utils.SendErrorResponse(c, utils.ErrorResponse("job_finished", "id", job.State))
+		default:
+			utils.SendErrorResponse(c, utils.ErrorResponse("job_store_unavailable", ""))
+		}
+		return
+	}
+
+	// Record who cancelled the job
+	lh.WithWho(utils.SubjectFromToken(token)).LogActivity("Job cancelled", map[string]string{"jobID": id, "operation": job.Operation, "state": job.State})
+
+	// Send success response
+	utils.SendSuccessResponse(c, job)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of cancelJob", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// ownJob reports whether job was started in realm by the caller token was issued to. A job's
+// result may hold whatever its request was answered with, so it is only given to its own caller.
+func ownJob(job *utils.Job, realm, token string) bool {
+	return job.Realm == realm && job.Actor == utils.SubjectFromToken(token)
+}
@@ -0,0 +1,291 @@
+package jobservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/idshield/utils/keycloakmock"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const testRealm = "test"
+
+func init() {
+	// Set once, as jobs started by one test may still be running in the next
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestService returns a service running jobs with runner and calling client instead of
+// Keycloak, logging nowhere.
+func newTestService(runner *utils.JobRunner, client *keycloakmock.Client) *service.Service {
+	lh := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "idshield-test", io.Discard)
+	return service.NewService(gin.New()).
+		WithLogHarbour(lh).
+		WithDependency("goclock", client).
+		WithDependency("jobs", runner)
+}
+
+// newTestRunner returns a JobRunner keeping job states in an in-memory Redis.
+func newTestRunner(t *testing.T) *utils.JobRunner {
+	return utils.NewJobRunner(utils.JobConfig{RedisAddr: miniredis.RunT(t).Addr()})
+}
+
+// tokenFor returns an unsigned token issued to username, valid for an hour.
+func tokenFor(username string) string {
+	payload := fmt.Sprintf(`{"preferred_username":%q,"exp":%d}`, username, time.Now().Add(time.Hour).Unix())
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+// decodeJob decodes the job carried by the standard response envelope of w.
+func decodeJob(t *testing.T, w *httptest.ResponseRecorder) utils.Job {
+	t.Helper()
+	var response struct {
+		Data utils.Job `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response does not carry a job: %v: %s", err, w.Body.String())
+	}
+	return response.Data
+}
+
+// serve sends a request with the given body and bearer token to handler in the test realm and
+// returns the recorded response.
+func serve(s *service.Service, handler service.HandlerFunc, method, route, target, token string, body io.Reader) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(method, route, func(c *gin.Context) {
+		utils.SetRealm(c, testRealm)
+		handler(c, s)
+	})
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// spoolDirFiles returns the names of the files in a spool directory.
+func spoolDirFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("cannot read spool directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// waitForJob waits for the job with the given ID to finish and returns it.
+func waitForJob(t *testing.T, runner *utils.JobRunner, id string) *utils.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := runner.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("cannot get job: %v", err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job = %+v, want it finished", job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAsyncRejectsLargeBody(t *testing.T) {
+	called := false
+	handler := Async(func(*gin.Context, *service.Service) { called = true })
+	// No job is recorded, so Redis is never reached
+	spoolDir := t.TempDir()
+	const maxBodyBytes = 1 << 10
+	s := newTestService(utils.NewJobRunner(utils.JobConfig{RedisAddr: "127.0.0.1:1", SpoolDir: spoolDir, MaxBodyBytes: maxBodyBytes}), &keycloakmock.Client{})
+
+	body := bytes.Repeat([]byte("x"), maxBodyBytes+1)
+	w := serve(s, handler, http.MethodPost, "/group-import", "/group-import?async=true", "token", bytes.NewReader(body))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "request_too_large") {
+		t.Errorf("body = %s, want request_too_large", w.Body.String())
+	}
+	if called {
+		t.Error("handler run for a body over the limit")
+	}
+	if files := spoolDirFiles(t, spoolDir); len(files) != 0 {
+		t.Errorf("spool directory holds %v, want the partial body removed", files)
+	}
+}
+
+func TestAsyncSpoolsBody(t *testing.T) {
+	spoolDir := t.TempDir()
+	runner := utils.NewJobRunner(utils.JobConfig{RedisAddr: miniredis.RunT(t).Addr(), SpoolDir: spoolDir})
+	s := newTestService(runner, &keycloakmock.Client{})
+
+	// Larger than any JSON request, as a CSV import may be
+	body := bytes.Repeat([]byte("asha,asha@example.com,Asha,Rao,true\n"), 100000)
+	var received []byte
+	handler := func(c *gin.Context, _ *service.Service) {
+		received, _ = io.ReadAll(c.Request.Body)
+		utils.SendSuccessResponse(c, nil)
+	}
+
+	w := serve(s, Async(handler), http.MethodPost, "/user-csv-import", "/user-csv-import?async=true", tokenFor("asha"), bytes.NewReader(body))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	if job := waitForJob(t, runner, decodeJob(t, w).ID); job.State != utils.JobDone {
+		t.Fatalf("job = %+v, want it done", job)
+	}
+	if !bytes.Equal(received, body) {
+		t.Errorf("handler read %d bytes, want the %d sent", len(received), len(body))
+	}
+	if files := spoolDirFiles(t, spoolDir); len(files) != 0 {
+		t.Errorf("spool directory holds %v after the job, want it empty", files)
+	}
+}
+
+func TestAsyncRemovesBodyOfJobCancelledWhileQueued(t *testing.T) {
+	spoolDir := t.TempDir()
+	runner := utils.NewJobRunner(utils.JobConfig{RedisAddr: miniredis.RunT(t).Addr(), SpoolDir: spoolDir, Concurrency: 1})
+	s := newTestService(runner, &keycloakmock.Client{})
+	owner := tokenFor("asha")
+
+	release := make(chan struct{})
+	blocking := func(c *gin.Context, _ *service.Service) {
+		<-release
+		utils.SendSuccessResponse(c, nil)
+	}
+	w := serve(s, Async(blocking), http.MethodPost, "/group-import", "/group-import?async=true", owner, strings.NewReader(`{"data": {}}`))
+	running := decodeJob(t, w).ID
+	w = serve(s, Async(blocking), http.MethodPost, "/group-import", "/group-import?async=true", owner, strings.NewReader(`{"data": {}}`))
+	queued := decodeJob(t, w).ID
+
+	w = serve(s, HandleJobCancelRequest, http.MethodPost, "/jobs/:id/cancel", "/jobs/"+queued+"/cancel", owner, nil)
+	if job := decodeJob(t, w); job.State != utils.JobCancelled {
+		t.Fatalf("cancelled job = %+v, want cancelled", job)
+	}
+	if files := spoolDirFiles(t, spoolDir); len(files) != 1 {
+		t.Errorf("spool directory holds %v, want only the body of the running job", files)
+	}
+
+	close(release)
+	waitForJob(t, runner, running)
+	if files := spoolDirFiles(t, spoolDir); len(files) != 0 {
+		t.Errorf("spool directory holds %v after the jobs, want it empty", files)
+	}
+}
+
+// bulkGroupFetch is a bulk handler fetching group after group, as long as its context allows.
+func bulkGroupFetch(c *gin.Context, s *service.Service) {
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	for i := 0; i < 500; i++ {
+		ctx, cancel := utils.RequestContext(c)
+		_, err := client.GetGroup(ctx, "token", utils.GetRealm(c), strconv.Itoa(i))
+		cancel()
+		if err != nil {
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+	}
+	utils.SendSuccessResponse(c, nil)
+}
+
+func TestAsyncCancelStopsKeycloakCalls(t *testing.T) {
+	var calls atomic.Int64
+	client := &keycloakmock.Client{
+		GetGroupFunc: func(ctx context.Context, _, _, groupID string) (*gocloak.Group, error) {
+			calls.Add(1)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+				return &gocloak.Group{ID: &groupID}, nil
+			}
+		},
+	}
+	s := newTestService(newTestRunner(t), client)
+	owner := tokenFor("asha")
+
+	w := serve(s, Async(bulkGroupFetch), http.MethodPost, "/group-bulk-fetch", "/group-bulk-fetch?async=true", owner, strings.NewReader(`{"data": {}}`))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	id := decodeJob(t, w).ID
+
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("job made %d Keycloak calls, want it running", calls.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	w = serve(s, HandleJobCancelRequest, http.MethodPost, "/jobs/:id/cancel", "/jobs/"+id+"/cancel", owner, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if job := decodeJob(t, w); job.State != utils.JobCancelled || !strings.Contains(string(job.Result), "request_cancelled") {
+		t.Errorf("cancelled job = %+v, want cancelled with a request_cancelled result", job)
+	}
+
+	made := calls.Load()
+	time.Sleep(100 * time.Millisecond)
+	if after := calls.Load(); after != made {
+		t.Errorf("job made %d more Keycloak calls after being cancelled", after-made)
+	}
+}
+
+func TestJobsOfOtherCallers(t *testing.T) {
+	s := newTestService(newTestRunner(t), &keycloakmock.Client{})
+	done := func(c *gin.Context, _ *service.Service) { utils.SendSuccessResponse(c, nil) }
+
+	w := serve(s, Async(done), http.MethodPost, "/group-bulk-fetch", "/group-bulk-fetch?async=true", tokenFor("asha"), strings.NewReader(`{"data": {}}`))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	id := decodeJob(t, w).ID
+
+	tests := []struct {
+		name       string
+		handler    service.HandlerFunc
+		method     string
+		route      string
+		target     string
+		token      string
+		wantStatus int
+	}{
+		{name: "get by owner", handler: HandleJobGetRequest, method: http.MethodGet, route: "/jobs/:id", target: "/jobs/" + id, token: tokenFor("asha"), wantStatus: http.StatusOK},
+		{name: "get by another caller", handler: HandleJobGetRequest, method: http.MethodGet, route: "/jobs/:id", target: "/jobs/" + id, token: tokenFor("ravi"), wantStatus: http.StatusNotFound},
+		{name: "cancel by another caller", handler: HandleJobCancelRequest, method: http.MethodPost, route: "/jobs/:id/cancel", target: "/jobs/" + id + "/cancel", token: tokenFor("ravi"), wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, tt.handler, tt.method, tt.route, tt.target, tt.token, nil)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package metricsservice
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// pingCapability is the capability a caller must hold to ping keycloak.
+const pingCapability = "keycloak_ping"
+
+// KeycloakPingResponse represents the structure for outgoing keycloak ping responses. Error holds
+// the error code of a failed call, whose latency is how long it took to fail.
+type KeycloakPingResponse struct {
+	Reachable     bool   `json:"reachable"`
+	LatencyMillis int64  `json:"latencyMillis"`
+	TimeoutMillis int64  `json:"timeoutMillis"`
+	WithinTimeout bool   `json:"withinTimeout"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// HandleKeycloakPingRequest is a Handler function for timing a lightweight call to keyclock, to diagnose slow keyclock incidents
+func HandleKeycloakPingRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("keycloak ping request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	capabilitiesGroup := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	capable, err := utils.HasCapability(ctx, client, token, capabilitiesGroup, pingCapability)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while checking capability:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+		return
+	}
+	if !capable {
+		lh.Sec().LogActivity("Keycloak ping refused, caller lacks capability", map[string]any{"caller": utils.SubjectFromToken(token), "capability": pingCapability})
+		utils.SendErrorResponse(c, utils.ErrorResponse("Forbidden", ""))
+		return
+	}
+
+	// Time the call on a fresh context, so that the capability check does not eat into its timeout
+	timeout := utils.RequestTimeout(c)
+	pingCtx, pingCancel := utils.RequestContext(c)
+	defer pingCancel()
+	start := time.Now()
+	info, err := client.GetServerInfo(pingCtx, token)
+	latency := time.Since(start)
+
+	response := KeycloakPingResponse{
+		Reachable:     err == nil,
+		LatencyMillis: latency.Milliseconds(),
+		TimeoutMillis: timeout.Milliseconds(),
+		WithinTimeout: err == nil && latency < timeout,
+	}
+	if err != nil {
+		response.Error = utils.KeycloakErrorCode(err, "not_found")
+		lh.Warn().LogActivity("Keycloak ping failed", map[string]any{"error": err.Error(), "latencyMillis": response.LatencyMillis})
+	} else if info != nil && info.SystemInfo != nil && info.SystemInfo.Version != nil {
+		response.ServerVersion = *info.SystemInfo.Version
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of keycloakPing", map[string]any{"latencyMillis": response.LatencyMillis, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
@@ -0,0 +1,16 @@
+package metricsservice
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// HandleMetricsRequest is a Handler function for reporting the current value of idshield's runtime metrics
+func HandleMetricsRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("metrics request received")
+
+	// Send success response
+	utils.SendSuccessResponse(c, utils.MetricsSnapshot())
+}
@@ -0,0 +1,304 @@
+package orgservice
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// minOrganizationsVersion is the first keyclock major version supporting organizations
+	// out of the box. They were a preview feature, disabled by default, before it.
+	minOrganizationsVersion = 26
+	// versionCacheTTL is how long the keyclock version check is trusted.
+	versionCacheTTL = 10 * time.Minute
+)
+
+// versionCache remembers whether the keyclock server supports organizations, so that the
+// server info is not fetched on every request.
+var versionCache = utils.NewTTLCache[bool](versionCacheTTL)
+
+// OrganizationDomain is an internet domain belonging to an organization.
+type OrganizationDomain struct {
+	Name     string `json:"name"`
+	Verified bool   `json:"verified"`
+}
+
+// Organization is a keyclock organization, the tenant of a multi-tenant realm.
+type Organization struct {
+	ID          string               `json:"id,omitempty"`
+	Name        string               `json:"name"`
+	Alias       string               `json:"alias,omitempty"`
+	Enabled     bool                 `json:"enabled"`
+	Description string               `json:"description,omitempty"`
+	RedirectURL string               `json:"redirectUrl,omitempty"`
+	Attributes  map[string][]string  `json:"attributes,omitempty"`
+	Domains     []OrganizationDomain `json:"domains"`
+}
+
+// CreateOrganizationRequest represents the structure for incoming organization creation requests.
+// Every organization needs at least one domain.
+type CreateOrganizationRequest struct {
+	Name        string              `json:"name" validate:"required"`
+	Alias       string              `json:"alias"`
+	Description string              `json:"description"`
+	RedirectURL string              `json:"redirectUrl" validate:"omitempty,url"`
+	Disabled    bool                `json:"disabled"`
+	Attributes  map[string][]string `json:"attributes"`
+	Domains     []string            `json:"domains" validate:"required,min=1,dive,fqdn"`
+}
+
+// HandleOrganizationCreationRequest is a Handler function for creating an organization in keyclock.
+func HandleOrganizationCreationRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("create organization request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into CreateOrganizationRequest struct
+	var req CreateOrganizationRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForCreateOrganizationError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkOrganizationsSupported(ctx, c, lh, client, token) {
+		return
+	}
+
+	organization := Organization{
+		Name:        req.Name,
+		Alias:       req.Alias,
+		Enabled:     !req.Disabled,
+		Description: req.Description,
+		RedirectURL: req.RedirectURL,
+		Attributes:  req.Attributes,
+		Domains:     make([]OrganizationDomain, 0, len(req.Domains)),
+	}
+	for _, domain := range req.Domains {
+		organization.Domains = append(organization.Domains, OrganizationDomain{Name: domain})
+	}
+
+	// gocloak does not wrap the organizations resource, so call it directly
+	resp, err := client.GetRequestWithBearerAuth(ctx, token).
+		SetBody(organization).
+		Post(utils.KeycloakAdminURL(keycloakURL, realm, "organizations"))
+	if err := utils.CheckKeycloakResponse(resp, err); err != nil {
+		lh.LogActivity("Error while creating organization:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		errcode := utils.KeycloakErrorCode(err, "realm_not_found")
+		if utils.IsConflict(err) {
+			errcode = "organization_exists"
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
+	}
+	organization.ID = path.Base(resp.Header().Get("Location"))
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("organization").WithWhatInstanceId(organization.ID).
+		LogDataChange("organization created", logharbour.ChangeInfo{
+			Entity:    "organization",
+			Operation: "create",
+			Changes:   map[string]any{"name": organization.Name, "domains": req.Domains},
+		})
+
+	// Send success response
+	utils.SendCreatedResponse(c, "/organization?orgID="+url.QueryEscape(organization.ID), organization)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of createOrganization", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleOrganizationGetRequest is a Handler function for fetching an organization in keyclock by id.
+func HandleOrganizationGetRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("get organization request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	orgID := c.Query("orgID")
+	if orgID == "" {
+		lh.Debug0().LogDebug("Missing orgID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "orgID"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkOrganizationsSupported(ctx, c, lh, client, token) {
+		return
+	}
+
+	var organization Organization
+	resp, err := client.GetRequestWithBearerAuth(ctx, token).
+		SetResult(&organization).
+		Get(utils.KeycloakAdminURL(keycloakURL, realm, "organizations", url.PathEscape(orgID)))
+	if err := utils.CheckKeycloakResponse(resp, err); err != nil {
+		lh.Debug0().LogDebug("Error while fetching organization:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "orgID": orgID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "organization_not_found"), ""))
+		return
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, organization)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of getOrganization", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleOrganizationListRequest is a Handler function for listing the organizations in keyclock a page at a time,
+// optionally those whose name or domain contains the search query parameter.
+func HandleOrganizationListRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("list organizations request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	first, max, ok := utils.GetPageParams(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid page parameters", logharbour.DebugInfo{Variables: map[string]any{"first": c.Query("first"), "max": c.Query("max")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkOrganizationsSupported(ctx, c, lh, client, token) {
+		return
+	}
+
+	request := client.GetRequestWithBearerAuth(ctx, token).
+		SetQueryParam("first", strconv.Itoa(first)).
+		SetQueryParam("max", strconv.Itoa(max))
+	if search := c.Query("search"); search != "" {
+		request.SetQueryParam("search", search)
+	}
+	organizations := []Organization{}
+	resp, err := request.SetResult(&organizations).Get(utils.KeycloakAdminURL(keycloakURL, realm, "organizations"))
+	if err := utils.CheckKeycloakResponse(resp, err); err != nil {
+		lh.LogActivity("Error while fetching organizations:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	// Send success response
+	utils.SendListResponse(c, organizations, utils.NewListMeta(c, -1, first, max, len(organizations)))
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of listOrganizations", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// checkOrganizationsSupported responds with feature_unsupported, and returns false, if the keyclock
+// server is too old to support organizations. It also returns false, having responded, if the
+// server's version could not be fetched.
+func checkOrganizationsSupported(ctx context.Context, c *gin.Context, lh *logharbour.Logger, client utils.KeycloakClient, token string) bool {
+	supported, err := organizationsSupported(ctx, client, token)
+	if err != nil {
+		lh.LogActivity("Error while fetching server info:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "unknown"), ""))
+		return false
+	}
+	if !supported {
+		lh.Debug0().LogDebug("Keycloak does not support organizations", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("feature_unsupported", "", "organizations need Keycloak "+strconv.Itoa(minOrganizationsVersion)+" or later"))
+		return false
+	}
+	return true
+}
+
+// organizationsSupported reports whether the keyclock server's major version is at least
+// minOrganizationsVersion. The answer is cached for versionCacheTTL.
+func organizationsSupported(ctx context.Context, client utils.KeycloakClient, token string) (bool, error) {
+	if supported, ok := versionCache.Get(""); ok {
+		return supported, nil
+	}
+	info, err := client.GetServerInfo(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	supported := false
+	if info != nil && info.SystemInfo != nil && info.SystemInfo.Version != nil {
+		majorText, _, _ := strings.Cut(*info.SystemInfo.Version, ".")
+		major, err := strconv.Atoi(majorText)
+		supported = err == nil && major >= minOrganizationsVersion
+	}
+	versionCache.Set("", supported)
+	return supported, nil
+}
+
+// getValsForCreateOrganizationError returns a slice of strings to be used as vals for a validation error.
+func (req *CreateOrganizationRequest) getValsForCreateOrganizationError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Name":
+		vals = append(vals, "name is required")
+	case "RedirectURL":
+		vals = append(vals, "redirectUrl must be a URL")
+	case "Domains":
+		vals = append(vals, "domains must list at least one domain")
+	default:
+		vals = append(vals, "domains must be domain names such as acme.com")
+	}
+	return vals
+}
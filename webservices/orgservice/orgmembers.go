@@ -0,0 +1,262 @@
+package orgservice
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// OrganizationMemberRequest represents the structure for incoming requests adding a user to an
+// organization or removing them from it.
+type OrganizationMemberRequest struct {
+	OrgID  string `json:"orgID" validate:"required"`
+	UserID string `json:"userID" validate:"required"`
+}
+
+// OrganizationMember is a user who is a member of an organization.
+type OrganizationMember struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email,omitempty"`
+	FirstName string `json:"firstName,omitempty"`
+	LastName  string `json:"lastName,omitempty"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// HandleOrganizationMemberAddRequest is a Handler function for making an existing user in keyclock a member
+// of an organization.
+func HandleOrganizationMemberAddRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("add organization member request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into OrganizationMemberRequest struct
+	var req OrganizationMemberRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForOrganizationMemberError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkOrganizationsSupported(ctx, c, lh, client, token) {
+		return
+	}
+
+	// Make sure the user exists, so that an unknown user is told apart from an unknown organization
+	if _, err := client.GetUserByID(ctx, token, realm, req.UserID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching user:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": req.UserID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+		return
+	}
+
+	// keyclock takes the id of the user to add as a bare JSON string
+	resp, err := client.GetRequestWithBearerAuth(ctx, token).
+		SetBody(strconv.Quote(req.UserID)).
+		Post(utils.KeycloakAdminURL(keycloakURL, realm, "organizations", url.PathEscape(req.OrgID), "members"))
+	if err := utils.CheckKeycloakResponse(resp, err); err != nil {
+		lh.LogActivity("Error while adding organization member:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		errcode := utils.KeycloakErrorCode(err, "organization_not_found")
+		if utils.IsConflict(err) {
+			errcode = "organization_member_exists"
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("organization").WithWhatInstanceId(req.OrgID).
+		LogDataChange("organization member added", logharbour.ChangeInfo{
+			Entity:    "organization",
+			Operation: "update",
+			Changes:   map[string]any{"members": map[string]any{"added": []string{req.UserID}}},
+		})
+
+	// Send success response
+	utils.SendSuccessResponse(c, req)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of addOrganizationMember", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleOrganizationMemberRemoveRequest is a Handler function for removing a user in keyclock from an organization.
+// Users that keyclock created for the organization, e.g. through its identity provider, are deleted with it.
+func HandleOrganizationMemberRemoveRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("remove organization member request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into OrganizationMemberRequest struct
+	var req OrganizationMemberRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForOrganizationMemberError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	idempotent, ok := utils.GetIdempotentParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid idempotent parameter", logharbour.DebugInfo{Variables: map[string]any{"idempotent": c.Query("idempotent")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "idempotent"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkOrganizationsSupported(ctx, c, lh, client, token) {
+		return
+	}
+
+	resp, err := client.GetRequestWithBearerAuth(ctx, token).
+		Delete(utils.KeycloakAdminURL(keycloakURL, realm, "organizations", url.PathEscape(req.OrgID), "members", url.PathEscape(req.UserID)))
+	err = utils.CheckKeycloakResponse(resp, err)
+	if idempotent && utils.IsNotFound(err) {
+		lh.Debug0().LogDebug("Organization member already removed", logharbour.DebugInfo{Variables: map[string]any{"orgID": req.OrgID, "userID": req.UserID}})
+		utils.SendAlreadyDeletedResponse(c)
+		return
+	}
+	if err != nil {
+		lh.LogActivity("Error while removing organization member:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "organization_member_not_found"), ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("organization").WithWhatInstanceId(req.OrgID).
+		LogDataChange("organization member removed", logharbour.ChangeInfo{
+			Entity:    "organization",
+			Operation: "update",
+			Changes:   map[string]any{"members": map[string]any{"removed": []string{req.UserID}}},
+		})
+
+	// Send success response
+	utils.SendSuccessResponse(c, req)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of removeOrganizationMember", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleOrganizationMembersRequest is a Handler function for listing the members of an organization in keyclock
+// a page at a time.
+func HandleOrganizationMembersRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("organization members request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	orgID := c.Query("orgID")
+	if orgID == "" {
+		lh.Debug0().LogDebug("Missing orgID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "orgID"))
+		return
+	}
+
+	first, max, ok := utils.GetPageParams(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid page parameters", logharbour.DebugInfo{Variables: map[string]any{"first": c.Query("first"), "max": c.Query("max")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkOrganizationsSupported(ctx, c, lh, client, token) {
+		return
+	}
+
+	members := []OrganizationMember{}
+	resp, err := client.GetRequestWithBearerAuth(ctx, token).
+		SetQueryParam("first", strconv.Itoa(first)).
+		SetQueryParam("max", strconv.Itoa(max)).
+		SetResult(&members).
+		Get(utils.KeycloakAdminURL(keycloakURL, realm, "organizations", url.PathEscape(orgID), "members"))
+	if err := utils.CheckKeycloakResponse(resp, err); err != nil {
+		lh.LogActivity("Error while fetching organization members:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "organization_not_found"), ""))
+		return
+	}
+
+	// Send success response
+	utils.SendListResponse(c, members, utils.NewListMeta(c, -1, first, max, len(members)))
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of organizationMembers", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForOrganizationMemberError returns a slice of strings to be used as vals for a validation error.
+func (req *OrganizationMemberRequest) getValsForOrganizationMemberError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "OrgID":
+		vals = append(vals, "orgID is required")
+	case "UserID":
+		vals = append(vals, "userID is required")
+	}
+	return vals
+}
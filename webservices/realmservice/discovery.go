@@ -0,0 +1,101 @@
+package realmservice
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// discoveryCacheTTL is how long a realm's OIDC discovery document is served from cache. The
+// document only changes when the realm's endpoints or supported features are reconfigured.
+const discoveryCacheTTL = 5 * time.Minute
+
+// discoveryCache holds recently fetched discovery documents, already rewritten, keyed by realm.
+var discoveryCache = utils.NewTTLCache[map[string]any](discoveryCacheTTL)
+
+// HandleDiscoveryRequest is a Handler function for fetching the OIDC discovery document of a realm from
+// keyclock, for clients that can only reach idshield. The document is sent as is, without the usual
+// response envelope, so that OIDC libraries can read it, and without needing a token. When a discovery
+// base URL is configured, the keyclock endpoint URLs in the document are rewritten to start with it instead.
+func HandleDiscoveryRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("OIDC discovery request received")
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	keycloakURL := s.Dependencies["keycloakURL"].(string)
+	baseURL := s.Dependencies["discoveryBaseURL"].(string)
+
+	document, cached := discoveryCache.Get(realm)
+	if !cached {
+		// Create a context with the timeout configured for this route
+		ctx, cancel := utils.RequestContext(c)
+		defer cancel()
+
+		// gocloak does not wrap the discovery document, so fetch it directly
+		resp, err := client.GetRequest(ctx).SetResult(&document).Get(utils.KeycloakRealmURL(keycloakURL, realm, ".well-known", "openid-configuration"))
+		if err := utils.CheckKeycloakResponse(resp, err); err != nil {
+			lh.LogActivity("Error while fetching OIDC discovery document:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+			return
+		}
+		if baseURL != "" {
+			document = rewriteDiscoveryURLs(document, realm, baseURL)
+		}
+		discoveryCache.Set(realm, document)
+	}
+
+	// Send success response
+	c.JSON(http.StatusOK, document)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of discovery", map[string]any{"cached": cached, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// rewriteDiscoveryURLs replaces the keyclock base URL that the document's issuer starts with by
+// baseURL, wherever a value of the document other than the issuer starts with it. The issuer is
+// kept, as tokens are validated against it. The document is left as is if its issuer is not a
+// realm URL.
+func rewriteDiscoveryURLs(document map[string]any, realm, baseURL string) map[string]any {
+	issuer, _ := document["issuer"].(string)
+	suffix := "/realms/" + realm
+	if !strings.HasSuffix(issuer, suffix) {
+		return document
+	}
+	from := strings.TrimSuffix(issuer, suffix)
+	to := strings.TrimRight(baseURL, "/")
+	rewritten := rewriteURLPrefix(document, from, to).(map[string]any)
+	rewritten["issuer"] = issuer
+	return rewritten
+}
+
+// rewriteURLPrefix returns a copy of value with every string starting with from made to start
+// with to instead, descending into objects and arrays.
+func rewriteURLPrefix(value any, from, to string) any {
+	switch v := value.(type) {
+	case string:
+		if v == from || strings.HasPrefix(v, from+"/") {
+			return to + strings.TrimPrefix(v, from)
+		}
+		return v
+	case map[string]any:
+		rewritten := make(map[string]any, len(v))
+		for key, item := range v {
+			rewritten[key] = rewriteURLPrefix(item, from, to)
+		}
+		return rewritten
+	case []any:
+		rewritten := make([]any, len(v))
+		for i, item := range v {
+			rewritten[i] = rewriteURLPrefix(item, from, to)
+		}
+		return rewritten
+	}
+	return value
+}
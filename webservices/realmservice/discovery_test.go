@@ -0,0 +1,48 @@
+package realmservice
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRewriteDiscoveryURLs(t *testing.T) {
+	document := map[string]any{
+		"issuer":                 "http://keycloak:8080/realms/sales",
+		"authorization_endpoint": "http://keycloak:8080/realms/sales/protocol/openid-connect/auth",
+		"jwks_uri":               "http://keycloak:8080/realms/sales/protocol/openid-connect/certs",
+		"mtls_endpoint_aliases": map[string]any{
+			"token_endpoint": "http://keycloak:8080/realms/sales/protocol/openid-connect/token",
+		},
+		"grant_types_supported": []any{"authorization_code", "refresh_token"},
+		"service_documentation": "http://keycloak:8080.example.com/docs",
+	}
+	want := map[string]any{
+		"issuer":                 "http://keycloak:8080/realms/sales",
+		"authorization_endpoint": "https://sso.example.com/kc/realms/sales/protocol/openid-connect/auth",
+		"jwks_uri":               "https://sso.example.com/kc/realms/sales/protocol/openid-connect/certs",
+		"mtls_endpoint_aliases": map[string]any{
+			"token_endpoint": "https://sso.example.com/kc/realms/sales/protocol/openid-connect/token",
+		},
+		"grant_types_supported": []any{"authorization_code", "refresh_token"},
+		"service_documentation": "http://keycloak:8080.example.com/docs",
+	}
+
+	got := rewriteDiscoveryURLs(document, "sales", "https://sso.example.com/kc/")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rewriteDiscoveryURLs() = %v, want %v", got, want)
+	}
+	if document["jwks_uri"] != "http://keycloak:8080/realms/sales/protocol/openid-connect/certs" {
+		t.Errorf("the fetched document was modified: %v", document)
+	}
+}
+
+func TestRewriteDiscoveryURLsOtherIssuer(t *testing.T) {
+	document := map[string]any{
+		"issuer":   "http://keycloak:8080/realms/other",
+		"jwks_uri": "http://keycloak:8080/realms/other/protocol/openid-connect/certs",
+	}
+	got := rewriteDiscoveryURLs(document, "sales", "https://sso.example.com")
+	if !reflect.DeepEqual(got, document) {
+		t.Errorf("rewriteDiscoveryURLs() = %v, want the document as is", got)
+	}
+}
@@ -0,0 +1,281 @@
+package realmservice
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// PasswordPolicy is the structured form of a keycloak realm password policy. Nil fields are
+// not part of the policy. ForceExpiredPasswordChange is in days.
+type PasswordPolicy struct {
+	Length                     *int    `json:"length,omitempty"`
+	MaxLength                  *int    `json:"maxLength,omitempty"`
+	Digits                     *int    `json:"digits,omitempty"`
+	LowerCase                  *int    `json:"lowerCase,omitempty"`
+	UpperCase                  *int    `json:"upperCase,omitempty"`
+	SpecialChars               *int    `json:"specialChars,omitempty"`
+	NotUsername                *bool   `json:"notUsername,omitempty"`
+	NotEmail                   *bool   `json:"notEmail,omitempty"`
+	PasswordHistory            *int    `json:"passwordHistory,omitempty"`
+	ForceExpiredPasswordChange *int    `json:"forceExpiredPasswordChange,omitempty"`
+	HashIterations             *int    `json:"hashIterations,omitempty"`
+	HashAlgorithm              *string `json:"hashAlgorithm,omitempty"`
+	RegexPattern               *string `json:"regexPattern,omitempty"`
+	PasswordBlacklist          *string `json:"passwordBlacklist,omitempty"`
+}
+
+// PasswordPolicyResponse represents the structure for outgoing password policy responses.
+// Policy is the policy as keycloak stores it; Unrecognized lists any of its tokens that
+// have no structured form.
+type PasswordPolicyResponse struct {
+	Policy       string         `json:"policy"`
+	Structured   PasswordPolicy `json:"structured"`
+	Unrecognized []string       `json:"unrecognized,omitempty"`
+}
+
+// policyField ties a keycloak password policy token to the PasswordPolicy field holding it.
+// Exactly one of the pointers is set.
+type policyField struct {
+	token string
+	json  string
+	num   **int
+	flag  **bool
+	text  **string
+}
+
+// fields lists the tokens of p in the order they are serialized.
+func (p *PasswordPolicy) fields() []policyField {
+	return []policyField{
+		{token: "length", json: "length", num: &p.Length},
+		{token: "maxLength", json: "maxLength", num: &p.MaxLength},
+		{token: "digits", json: "digits", num: &p.Digits},
+		{token: "lowerCase", json: "lowerCase", num: &p.LowerCase},
+		{token: "upperCase", json: "upperCase", num: &p.UpperCase},
+		{token: "specialChars", json: "specialChars", num: &p.SpecialChars},
+		{token: "notUsername", json: "notUsername", flag: &p.NotUsername},
+		{token: "notEmail", json: "notEmail", flag: &p.NotEmail},
+		{token: "passwordHistory", json: "passwordHistory", num: &p.PasswordHistory},
+		{token: "forceExpiredPasswordChange", json: "forceExpiredPasswordChange", num: &p.ForceExpiredPasswordChange},
+		{token: "hashIterations", json: "hashIterations", num: &p.HashIterations},
+		{token: "hashAlgorithm", json: "hashAlgorithm", text: &p.HashAlgorithm},
+		{token: "regexPattern", json: "regexPattern", text: &p.RegexPattern},
+		{token: "passwordBlacklist", json: "passwordBlacklist", text: &p.PasswordBlacklist},
+	}
+}
+
+// policyTokenRE matches a single password policy token such as "length(8)" or "notUsername".
+var policyTokenRE = regexp.MustCompile(`^(\w+)(?:\((.*)\))?$`)
+
+// parsePasswordPolicy converts a keycloak password policy string, e.g.
+// "length(8) and digits(1) and notUsername(undefined)", into its structured form. Tokens it
+// does not know are returned as unrecognized.
+func parsePasswordPolicy(policy string) (parsed PasswordPolicy, unrecognized []string) {
+	fields := parsed.fields()
+	for _, token := range strings.Split(policy, " and ") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		match := policyTokenRE.FindStringSubmatch(token)
+		known := false
+		for _, field := range fields {
+			if match == nil || field.token != match[1] {
+				continue
+			}
+			value := match[2]
+			switch {
+			case field.num != nil:
+				if n, err := strconv.Atoi(value); err == nil {
+					*field.num, known = &n, true
+				}
+			case field.flag != nil:
+				*field.flag, known = gocloak.BoolP(true), true
+			case field.text != nil:
+				*field.text, known = &value, true
+			}
+		}
+		if !known {
+			unrecognized = append(unrecognized, token)
+		}
+	}
+	return parsed, unrecognized
+}
+
+// String serializes p into the keycloak password policy format.
+func (p PasswordPolicy) String() string {
+	var tokens []string
+	for _, field := range p.fields() {
+		switch {
+		case field.num != nil && *field.num != nil:
+			tokens = append(tokens, fmt.Sprintf("%s(%d)", field.token, **field.num))
+		case field.flag != nil && *field.flag != nil && **field.flag:
+			tokens = append(tokens, field.token+"(undefined)")
+		case field.text != nil && *field.text != nil:
+			tokens = append(tokens, fmt.Sprintf("%s(%s)", field.token, **field.text))
+		}
+	}
+	return strings.Join(tokens, " and ")
+}
+
+// validate returns an invalid_password_policy error for every token of p that keycloak
+// would reject or that would not survive serialization.
+func (p PasswordPolicy) validate() []wscutils.ErrorMessage {
+	var errs []wscutils.ErrorMessage
+	invalid := func(name, reason string) {
+		field := name
+		errs = append(errs, wscutils.BuildErrorMessage("invalid_password_policy", &field, reason))
+	}
+	for _, field := range p.fields() {
+		switch {
+		case field.num != nil && *field.num != nil && **field.num < 0:
+			invalid(field.json, "must not be negative")
+		case field.text != nil && *field.text != nil:
+			value := **field.text
+			if value == "" || strings.Contains(value, ")") || strings.Contains(value, " and ") {
+				invalid(field.json, "must be non-empty and contain neither ')' nor ' and '")
+			}
+		}
+	}
+	if p.Length != nil && *p.Length < 1 {
+		invalid("length", "must be at least 1")
+	}
+	if p.HashIterations != nil && *p.HashIterations < 1 {
+		invalid("hashIterations", "must be at least 1")
+	}
+	if p.Length != nil && p.MaxLength != nil && *p.MaxLength < *p.Length {
+		invalid("maxLength", "must not be less than length")
+	}
+	if p.RegexPattern != nil {
+		if _, err := regexp.Compile(*p.RegexPattern); err != nil {
+			invalid("regexPattern", "must be a valid regular expression")
+		}
+	}
+	return errs
+}
+
+// HandleRealmPasswordPolicyGetRequest is a Handler function for fetching the password policy of a realm in keyclock
+func HandleRealmPasswordPolicyGetRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("get password policy request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	realmRep, err := client.GetRealm(ctx, token, realm)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "realm": realm}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	policy := gocloak.PString(realmRep.PasswordPolicy)
+	structured, unrecognized := parsePasswordPolicy(policy)
+
+	// Send success response
+	utils.SendSuccessResponse(c, PasswordPolicyResponse{
+		Policy:       policy,
+		Structured:   structured,
+		Unrecognized: unrecognized,
+	})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of getPasswordPolicy", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleRealmPasswordPolicySetRequest is a Handler function for replacing the password policy of a realm in keyclock
+func HandleRealmPasswordPolicySetRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("set password policy request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into PasswordPolicy struct
+	var req PasswordPolicy
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	if validationErrors := req.validate(); len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	realmRep, err := client.GetRealm(ctx, token, realm)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "realm": realm}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+	oldPolicy := gocloak.PString(realmRep.PasswordPolicy)
+	policy := req.String()
+
+	// Only the password policy is sent, leaving the rest of the realm untouched
+	if err := client.UpdateRealm(ctx, token, gocloak.RealmRepresentation{
+		Realm:          gocloak.StringP(realm),
+		PasswordPolicy: gocloak.StringP(policy),
+	}); err != nil {
+		lh.LogActivity("Error while updating password policy:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("realm").WithWhatInstanceId(realm).
+		LogDataChange("password policy updated", logharbour.ChangeInfo{
+			Entity:    "realm",
+			Operation: "update",
+			Changes:   map[string]any{"passwordPolicy": map[string]any{"old": oldPolicy, "new": policy}},
+		})
+	utils.SecurityLog(c, lh, utils.SecurityEventRealmPolicyChanged, map[string]any{"policy": "passwordPolicy"})
+
+	// Send success response
+	utils.SendSuccessResponse(c, PasswordPolicyResponse{
+		Policy:     policy,
+		Structured: req,
+	})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of setPasswordPolicy", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
@@ -0,0 +1,210 @@
+package realmservice
+
+import (
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// TokenLifespans holds the token lifespans and session timeouts of a realm, in seconds.
+// Refresh tokens live as long as the SSO session idle timeout allows, bounded by the SSO
+// session max lifespan. In set requests, nil fields are left unchanged.
+type TokenLifespans struct {
+	AccessTokenLifespan                *int `json:"accessTokenLifespan,omitempty" validate:"omitempty,min=1"`
+	AccessTokenLifespanForImplicitFlow *int `json:"accessTokenLifespanForImplicitFlow,omitempty" validate:"omitempty,min=1"`
+	SsoSessionIdleTimeout              *int `json:"ssoSessionIdleTimeout,omitempty" validate:"omitempty,min=1"`
+	SsoSessionMaxLifespan              *int `json:"ssoSessionMaxLifespan,omitempty" validate:"omitempty,min=1"`
+	SsoSessionIdleTimeoutRememberMe    *int `json:"ssoSessionIdleTimeoutRememberMe,omitempty" validate:"omitempty,min=1"`
+	SsoSessionMaxLifespanRememberMe    *int `json:"ssoSessionMaxLifespanRememberMe,omitempty" validate:"omitempty,min=1"`
+	OfflineSessionIdleTimeout          *int `json:"offlineSessionIdleTimeout,omitempty" validate:"omitempty,min=1"`
+}
+
+// tokenLifespansOf extracts the token lifespans of a realm.
+func tokenLifespansOf(realmRep *gocloak.RealmRepresentation) TokenLifespans {
+	return TokenLifespans{
+		AccessTokenLifespan:                realmRep.AccessTokenLifespan,
+		AccessTokenLifespanForImplicitFlow: realmRep.AccessTokenLifespanForImplicitFlow,
+		SsoSessionIdleTimeout:              realmRep.SsoSessionIdleTimeout,
+		SsoSessionMaxLifespan:              realmRep.SsoSessionMaxLifespan,
+		SsoSessionIdleTimeoutRememberMe:    realmRep.SsoSessionIdleTimeoutRememberMe,
+		SsoSessionMaxLifespanRememberMe:    realmRep.SsoSessionMaxLifespanRememberMe,
+		OfflineSessionIdleTimeout:          realmRep.OfflineSessionIdleTimeout,
+	}
+}
+
+// mergeInto returns current with every field set in l replaced.
+func (l TokenLifespans) mergeInto(current TokenLifespans) TokenLifespans {
+	for _, pair := range []struct{ from, to **int }{
+		{&l.AccessTokenLifespan, &current.AccessTokenLifespan},
+		{&l.AccessTokenLifespanForImplicitFlow, &current.AccessTokenLifespanForImplicitFlow},
+		{&l.SsoSessionIdleTimeout, &current.SsoSessionIdleTimeout},
+		{&l.SsoSessionMaxLifespan, &current.SsoSessionMaxLifespan},
+		{&l.SsoSessionIdleTimeoutRememberMe, &current.SsoSessionIdleTimeoutRememberMe},
+		{&l.SsoSessionMaxLifespanRememberMe, &current.SsoSessionMaxLifespanRememberMe},
+		{&l.OfflineSessionIdleTimeout, &current.OfflineSessionIdleTimeout},
+	} {
+		if *pair.from != nil {
+			*pair.to = *pair.from
+		}
+	}
+	return current
+}
+
+// validateBounds checks that no timeout exceeds the lifespan bounding it. Values of 0, which
+// keycloak treats as unset, are not compared.
+func (l TokenLifespans) validateBounds() []wscutils.ErrorMessage {
+	var validationErrors []wscutils.ErrorMessage
+	for _, bound := range []struct {
+		field, limitField string
+		value, limit      *int
+	}{
+		{"ssoSessionIdleTimeout", "ssoSessionMaxLifespan", l.SsoSessionIdleTimeout, l.SsoSessionMaxLifespan},
+		{"ssoSessionIdleTimeoutRememberMe", "ssoSessionMaxLifespanRememberMe", l.SsoSessionIdleTimeoutRememberMe, l.SsoSessionMaxLifespanRememberMe},
+		{"accessTokenLifespan", "ssoSessionMaxLifespan", l.AccessTokenLifespan, l.SsoSessionMaxLifespan},
+	} {
+		value, limit := gocloak.PInt(bound.value), gocloak.PInt(bound.limit)
+		if value > 0 && limit > 0 && value > limit {
+			field := bound.field
+			validationErrors = append(validationErrors, wscutils.BuildErrorMessage("invalid_token_lifespan", &field, bound.field+" must not exceed "+bound.limitField))
+		}
+	}
+	return validationErrors
+}
+
+// HandleRealmTokenLifespansGetRequest is a Handler function for fetching the token lifespans and session timeouts of a realm in keyclock
+func HandleRealmTokenLifespansGetRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("get token lifespans request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	realmRep, err := client.GetRealm(ctx, token, realm)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "realm": realm}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, tokenLifespansOf(realmRep))
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of getTokenLifespans", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleRealmTokenLifespansSetRequest is a Handler function for updating the token lifespans and session timeouts of a realm in keyclock
+func HandleRealmTokenLifespansSetRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("set token lifespans request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into TokenLifespans struct
+	var req TokenLifespans
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForTokenLifespansError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	realmRep, err := client.GetRealm(ctx, token, realm)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "realm": realm}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+	old := tokenLifespansOf(realmRep)
+	updated := req.mergeInto(old)
+
+	// Timeouts are checked against the lifespans bounding them as they will be once updated
+	if validationErrors := updated.validateBounds(); len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Only the lifespans asked for are sent, leaving the rest of the realm untouched
+	if err := client.UpdateRealm(ctx, token, gocloak.RealmRepresentation{
+		Realm:                              gocloak.StringP(realm),
+		AccessTokenLifespan:                req.AccessTokenLifespan,
+		AccessTokenLifespanForImplicitFlow: req.AccessTokenLifespanForImplicitFlow,
+		SsoSessionIdleTimeout:              req.SsoSessionIdleTimeout,
+		SsoSessionMaxLifespan:              req.SsoSessionMaxLifespan,
+		SsoSessionIdleTimeoutRememberMe:    req.SsoSessionIdleTimeoutRememberMe,
+		SsoSessionMaxLifespanRememberMe:    req.SsoSessionMaxLifespanRememberMe,
+		OfflineSessionIdleTimeout:          req.OfflineSessionIdleTimeout,
+	}); err != nil {
+		lh.LogActivity("Error while updating token lifespans:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("realm").WithWhatInstanceId(realm).
+		LogDataChange("token lifespans updated", logharbour.ChangeInfo{
+			Entity:    "realm",
+			Operation: "update",
+			Changes:   map[string]any{"tokenLifespans": map[string]any{"old": old, "new": updated}},
+		})
+	utils.SecurityLog(c, lh, utils.SecurityEventRealmPolicyChanged, map[string]any{"policy": "tokenLifespans"})
+
+	// Send success response
+	utils.SendSuccessResponse(c, updated)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of setTokenLifespans", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForTokenLifespansError returns a slice of strings to be used as vals for a validation error.
+func (req *TokenLifespans) getValsForTokenLifespansError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "AccessTokenLifespan", "AccessTokenLifespanForImplicitFlow", "SsoSessionIdleTimeout", "SsoSessionMaxLifespan",
+		"SsoSessionIdleTimeoutRememberMe", "SsoSessionMaxLifespanRememberMe", "OfflineSessionIdleTimeout":
+		vals = append(vals, "must be a positive number of seconds")
+	}
+	return vals
+}
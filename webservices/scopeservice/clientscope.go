@@ -0,0 +1,348 @@
+package scopeservice
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// scopeAdminCapability is the capability a caller must hold to manage client scopes.
+	scopeAdminCapability = "client_scope_admin"
+	// defaultScopeProtocol is the protocol of client scopes created without one.
+	defaultScopeProtocol = "openid-connect"
+)
+
+// ClientScope is a keyclock client scope, a set of claims and role mappings a client can request.
+type ClientScope struct {
+	ID                  string `json:"id"`
+	Name                string `json:"name"`
+	Description         string `json:"description,omitempty"`
+	Protocol            string `json:"protocol"`
+	IncludeInTokenScope bool   `json:"includeInTokenScope"`
+}
+
+// CreateClientScopeRequest represents the structure for incoming client scope creation requests.
+// Protocol defaults to openid-connect. IncludeInTokenScope defaults to true, as in keyclock.
+type CreateClientScopeRequest struct {
+	Name                string `json:"name" validate:"required,excludesall= "`
+	Description         string `json:"description"`
+	Protocol            string `json:"protocol" validate:"omitempty,oneof=openid-connect saml"`
+	IncludeInTokenScope *bool  `json:"includeInTokenScope"`
+}
+
+// AssignClientScopeRequest represents the structure for incoming client scope assignment requests.
+// Scope is the name of the client scope and ClientID the client ID of the client, which gets the
+// scope as one of its default or optional scopes depending on Type.
+type AssignClientScopeRequest struct {
+	ClientID string `json:"clientId" validate:"required"`
+	Scope    string `json:"scope" validate:"required"`
+	Type     string `json:"type" validate:"required,oneof=default optional"`
+}
+
+// HandleClientScopesListRequest is a Handler function for listing the client scopes of a realm in keyclock, sorted by name.
+func HandleClientScopesListRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("list client scopes request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	capabilitiesGroup := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkScopeAdmin(ctx, c, lh, client, token, capabilitiesGroup) {
+		return
+	}
+
+	scopes, err := client.GetClientScopes(ctx, token, realm)
+	if err != nil {
+		lh.LogActivity("Error while fetching client scopes:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	response := make([]ClientScope, 0, len(scopes))
+	for _, scope := range scopes {
+		if scope != nil {
+			response = append(response, toClientScope(scope))
+		}
+	}
+	sort.Slice(response, func(i, j int) bool { return response[i].Name < response[j].Name })
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of listClientScopes", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleClientScopeCreationRequest is a Handler function for creating a client scope in keyclock.
+func HandleClientScopeCreationRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("create client scope request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into CreateClientScopeRequest struct
+	var req CreateClientScopeRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForCreateClientScopeError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	capabilitiesGroup := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkScopeAdmin(ctx, c, lh, client, token, capabilitiesGroup) {
+		return
+	}
+
+	scope := ClientScope{
+		Name:                req.Name,
+		Description:         req.Description,
+		Protocol:            req.Protocol,
+		IncludeInTokenScope: req.IncludeInTokenScope == nil || *req.IncludeInTokenScope,
+	}
+	if scope.Protocol == "" {
+		scope.Protocol = defaultScopeProtocol
+	}
+	scopeRep := gocloak.ClientScope{
+		Name:     gocloak.StringP(scope.Name),
+		Protocol: gocloak.StringP(scope.Protocol),
+		ClientScopeAttributes: &gocloak.ClientScopeAttributes{
+			IncludeInTokenScope: gocloak.StringP(strconv.FormatBool(scope.IncludeInTokenScope)),
+		},
+	}
+	if scope.Description != "" {
+		scopeRep.Description = gocloak.StringP(scope.Description)
+	}
+
+	scope.ID, err = client.CreateClientScope(ctx, token, realm, scopeRep)
+	if err != nil {
+		lh.LogActivity("Error while creating client scope:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		errcode := utils.KeycloakErrorCode(err, "realm_not_found")
+		if utils.IsConflict(err) {
+			errcode = "client_scope_exists"
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("clientScope").WithWhatInstanceId(scope.ID).
+		LogDataChange("client scope created", logharbour.ChangeInfo{
+			Entity:    "clientScope",
+			Operation: "create",
+			Changes:   map[string]any{"name": scope.Name, "protocol": scope.Protocol},
+		})
+
+	// Send success response
+	utils.SendCreatedResponse(c, "/client-scopes", scope)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of createClientScope", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleClientScopeAssignRequest is a Handler function for giving a client in keyclock a client scope,
+// as one of its default or of its optional scopes.
+func HandleClientScopeAssignRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("assign client scope request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into AssignClientScopeRequest struct
+	var req AssignClientScopeRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForAssignClientScopeError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	capabilitiesGroup := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if !checkScopeAdmin(ctx, c, lh, client, token, capabilitiesGroup) {
+		return
+	}
+
+	// Resolve the keycloak client's internal ID from its client ID
+	clients, err := client.GetClients(ctx, token, realm, gocloak.GetClientsParams{ClientID: &req.ClientID})
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching client:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+	if len(clients) == 0 || clients[0].ID == nil {
+		lh.Debug0().LogDebug("Client not found:", logharbour.DebugInfo{Variables: map[string]any{"clientId": req.ClientID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("client_not_found", "clientId"))
+		return
+	}
+	idOfClient := *clients[0].ID
+
+	// Keycloak only looks client scopes up by ID, so find the scope by name among them all
+	scopes, err := client.GetClientScopes(ctx, token, realm)
+	if err != nil {
+		lh.LogActivity("Error while fetching client scopes:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+	var scope *gocloak.ClientScope
+	for _, candidate := range scopes {
+		if candidate != nil && gocloak.PString(candidate.Name) == req.Scope {
+			scope = candidate
+			break
+		}
+	}
+	if scope == nil || scope.ID == nil {
+		lh.Debug0().LogDebug("Client scope not found:", logharbour.DebugInfo{Variables: map[string]any{"scope": req.Scope}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("client_scope_not_found", "scope"))
+		return
+	}
+
+	if req.Type == "optional" {
+		err = client.AddOptionalScopeToClient(ctx, token, realm, idOfClient, *scope.ID)
+	} else {
+		err = client.AddDefaultScopeToClient(ctx, token, realm, idOfClient, *scope.ID)
+	}
+	if err != nil {
+		lh.LogActivity("Error while assigning client scope:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "clientId": req.ClientID, "scope": req.Scope}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "client_not_found"), ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("client").WithWhatInstanceId(req.ClientID).
+		LogDataChange("client scope assigned", logharbour.ChangeInfo{
+			Entity:    "client",
+			Operation: "update",
+			Changes:   map[string]any{req.Type + "ClientScopes": map[string]any{"added": req.Scope}},
+		})
+
+	// Send success response
+	utils.SendSuccessResponse(c, req)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of assignClientScope", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// checkScopeAdmin responds with Forbidden and returns false unless the caller holds the
+// capability to manage client scopes.
+func checkScopeAdmin(ctx context.Context, c *gin.Context, lh *logharbour.Logger, client utils.KeycloakClient, token, capabilitiesGroup string) bool {
+	capable, err := utils.HasCapability(ctx, client, token, capabilitiesGroup, scopeAdminCapability)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while checking capability:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+		return false
+	}
+	if !capable {
+		lh.Sec().LogActivity("Client scope request refused, caller lacks capability", map[string]any{"caller": utils.SubjectFromToken(token), "capability": scopeAdminCapability})
+		utils.SendErrorResponse(c, utils.ErrorResponse("Forbidden", ""))
+		return false
+	}
+	return true
+}
+
+// toClientScope converts a keyclock client scope into its response form.
+func toClientScope(scope *gocloak.ClientScope) ClientScope {
+	converted := ClientScope{
+		ID:                  gocloak.PString(scope.ID),
+		Name:                gocloak.PString(scope.Name),
+		Description:         gocloak.PString(scope.Description),
+		Protocol:            gocloak.PString(scope.Protocol),
+		IncludeInTokenScope: true,
+	}
+	if scope.ClientScopeAttributes != nil && scope.ClientScopeAttributes.IncludeInTokenScope != nil {
+		converted.IncludeInTokenScope = *scope.ClientScopeAttributes.IncludeInTokenScope == "true"
+	}
+	return converted
+}
+
+// getValsForCreateClientScopeError returns a slice of strings to be used as vals for a validation error.
+func (req *CreateClientScopeRequest) getValsForCreateClientScopeError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Name":
+		vals = append(vals, "name is required and must not contain spaces")
+	case "Protocol":
+		vals = append(vals, "protocol must be openid-connect or saml")
+	}
+	return vals
+}
+
+// getValsForAssignClientScopeError returns a slice of strings to be used as vals for a validation error.
+func (req *AssignClientScopeRequest) getValsForAssignClientScopeError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "ClientID":
+		vals = append(vals, "clientId is required")
+	case "Scope":
+		vals = append(vals, "scope is required")
+	case "Type":
+		vals = append(vals, "type must be default or optional")
+	}
+	return vals
+}
@@ -0,0 +1,198 @@
+package searchservice
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// defaultSearchResults is the number of results returned per category when max is not given.
+	defaultSearchResults = 10
+	// maxSearchResults is the largest number of results returned per category.
+	maxSearchResults = 50
+	// minSearchQueryLength is the shortest query accepted, to keep searches selective.
+	minSearchQueryLength = 2
+)
+
+// resultTypeUser is the type of user search results. Groups and capabilities use their idshield type.
+const resultTypeUser = "user"
+
+// SearchResult represents a single match of a global search. Type is one of group,
+// capability or user; Path is only given for groups and capabilities.
+type SearchResult struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+}
+
+// SearchResponse represents the structure for outgoing global search responses. Counts holds
+// the total number of matches per type, which may exceed the results returned.
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	Counts  map[string]int `json:"counts"`
+}
+
+// HandleGlobalSearchRequest is a Handler function for searching groups, capabilities and users in keyclock at once
+func HandleGlobalSearchRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("global search request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if len(query) < minSearchQueryLength {
+		lh.Debug0().LogDebug("Missing or too short search query", logharbour.DebugInfo{Variables: map[string]any{"q": query}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "q", strconv.Itoa(minSearchQueryLength)))
+		return
+	}
+
+	limit := defaultSearchResults
+	if v := c.Query("max"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			lh.Debug0().LogDebug("Invalid max parameter", logharbour.DebugInfo{Variables: map[string]any{"max": v}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+			return
+		}
+		if limit > maxSearchResults {
+			limit = maxSearchResults
+		}
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Groups and capabilities come from a single group search, which runs alongside the user search
+	var (
+		wg                     sync.WaitGroup
+		groupResults, userHits []SearchResult
+		groupCounts            map[string]int
+		userCount              int
+		groupErr, userErr      error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		groupResults, groupCounts, groupErr = searchGroups(ctx, client, token, realm, query, limit)
+	}()
+	go func() {
+		defer wg.Done()
+		userHits, userCount, userErr = searchUsers(ctx, client, token, realm, query, limit)
+	}()
+	wg.Wait()
+
+	for _, err := range []error{groupErr, userErr} {
+		if err != nil {
+			lh.LogActivity("Error while searching:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "q": query}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+			return
+		}
+	}
+
+	response := SearchResponse{
+		Results: append(groupResults, userHits...),
+		Counts:  groupCounts,
+	}
+	response.Counts[resultTypeUser] = userCount
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of globalSearch", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// searchGroups returns up to limit groups and up to limit capabilities whose name contains
+// query, along with the number of matches of each type.
+func searchGroups(ctx context.Context, client utils.KeycloakClient, token, realm, query string, limit int) ([]SearchResult, map[string]int, error) {
+	// Full representations are needed to tell groups from capabilities
+	groups, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{
+		Search:              gocloak.StringP(query),
+		BriefRepresentation: gocloak.BoolP(false),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	counts := map[string]int{utils.TypeGroup: 0, utils.TypeCapability: 0}
+	results := []SearchResult{}
+	collectGroupMatches(groups, strings.ToLower(query), limit, counts, &results)
+	return results, counts, nil
+}
+
+// collectGroupMatches walks the groups returned by a keycloak group search, which includes the
+// ancestors of matching groups, and records the groups whose own name matches.
+func collectGroupMatches(groups []*gocloak.Group, query string, limit int, counts map[string]int, results *[]SearchResult) {
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		if strings.Contains(strings.ToLower(gocloak.PString(group.Name)), query) {
+			groupType := utils.GroupType(group.Attributes)
+			counts[groupType]++
+			if counts[groupType] <= limit {
+				*results = append(*results, SearchResult{
+					Type: groupType,
+					ID:   gocloak.PString(group.ID),
+					Name: gocloak.PString(group.Name),
+					Path: gocloak.PString(group.Path),
+				})
+			}
+		}
+		if group.SubGroups != nil {
+			subGroups := make([]*gocloak.Group, 0, len(*group.SubGroups))
+			for i := range *group.SubGroups {
+				subGroups = append(subGroups, &(*group.SubGroups)[i])
+			}
+			collectGroupMatches(subGroups, query, limit, counts, results)
+		}
+	}
+}
+
+// searchUsers returns up to limit users matching query, along with the number of matches.
+func searchUsers(ctx context.Context, client utils.KeycloakClient, token, realm, query string, limit int) ([]SearchResult, int, error) {
+	users, err := client.GetUsers(ctx, token, realm, gocloak.GetUsersParams{
+		Search:              gocloak.StringP(query),
+		Max:                 gocloak.IntP(limit),
+		BriefRepresentation: gocloak.BoolP(true),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	count, err := client.GetUserCount(ctx, token, realm, gocloak.GetUsersParams{Search: gocloak.StringP(query)})
+	if err != nil {
+		return nil, 0, err
+	}
+	results := make([]SearchResult, 0, len(users))
+	for _, user := range users {
+		if user == nil {
+			continue
+		}
+		results = append(results, SearchResult{
+			Type: resultTypeUser,
+			ID:   gocloak.PString(user.ID),
+			Name: gocloak.PString(user.Username),
+		})
+	}
+	return results, count, nil
+}
@@ -0,0 +1,113 @@
+package tokenservice
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// TokenRevokeRequest represents the structure for incoming token revocation requests. Token is
+// the access or refresh token to revoke. ClientID names the public client the token was issued
+// to; without it, the token must have been issued to idshield's own client.
+type TokenRevokeRequest struct {
+	Token    string `json:"token" validate:"required"`
+	ClientID string `json:"clientID,omitempty"`
+}
+
+// TokenRevokeResponse represents the structure for outgoing token revocation responses.
+type TokenRevokeResponse struct {
+	Revoked bool `json:"revoked"`
+}
+
+// HandleTokenRevokeRequest is a Handler function for revoking a single token in keyclock. Revoking a
+// token that is already revoked or expired succeeds, as keyclock does not tell them apart. The token
+// is never logged.
+func HandleTokenRevokeRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("token revoke request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into TokenRevokeRequest struct
+	var req TokenRevokeRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForTokenRevokeError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Public clients revoke their tokens without a secret
+	clientID, clientSecret := req.ClientID, ""
+	if clientID == "" {
+		clientID = s.Dependencies["keycloakClientID"].(string)
+		clientSecret = s.Dependencies["keycloakClientSecret"].(string)
+	}
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if err := client.RevokeToken(ctx, realm, clientID, clientSecret, req.Token); err != nil {
+		lh.LogActivity("Error while revoking token:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "clientID": clientID}})
+		var apiErr *gocloak.APIError
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest {
+			// The token was issued to another client, or is not a token at all
+			utils.SendErrorResponse(c, utils.ErrorResponse("token_not_revocable", ""))
+			return
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	// Audit the revocation by whose token it was, never by the token itself
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("token").WithWhatInstanceId(utils.SubjectFromToken(req.Token)).
+		LogDataChange("token revoked", logharbour.ChangeInfo{
+			Entity:    "token",
+			Operation: "delete",
+			Changes:   map[string]any{"clientID": clientID},
+		})
+	utils.SecurityLog(c, lh, utils.SecurityEventTokenRevoked, map[string]any{"clientID": clientID, "subject": utils.SubjectFromToken(req.Token)})
+
+	// Send success response
+	utils.SendSuccessResponse(c, TokenRevokeResponse{Revoked: true})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of tokenRevoke", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForTokenRevokeError returns a slice of strings to be used as vals for a validation error.
+func (req *TokenRevokeRequest) getValsForTokenRevokeError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Token":
+		vals = append(vals, "token is required")
+	}
+	return vals
+}
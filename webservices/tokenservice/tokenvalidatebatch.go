@@ -0,0 +1,150 @@
+package tokenservice
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// TokenValidateBatchRequest represents the structure for incoming batch token validation requests.
+// A single request may validate at most 100 tokens.
+type TokenValidateBatchRequest struct {
+	Tokens []string `json:"tokens" validate:"required,min=1,max=100,dive,required"`
+}
+
+// TokenValidation is the outcome of validating a single token, reported at the position Index
+// the token was given at. Reason tells why an inactive token is not valid: expired,
+// invalid_signature or malformed. The claims are only reported for tokens signed by the realm.
+type TokenValidation struct {
+	Index     int        `json:"index"`
+	Active    bool       `json:"active"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Subject   string     `json:"subject,omitempty"`
+	ClientID  string     `json:"clientId,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// HandleTokenValidateBatchRequest is a Handler function for validating many access tokens of the realm at once,
+// e.g. for gateways. Tokens are checked locally against the realm's signing keys, which are fetched from keyclock
+// once and cached, so validating a token costs no keyclock round trip. Identical tokens are validated once. As
+// with any local validation, a token revoked before it expires is still reported active. Tokens are never logged.
+func HandleTokenValidateBatchRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("token validate batch request received")
+
+	_, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into TokenValidateBatchRequest struct
+	var req TokenValidateBatchRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForTokenValidateBatchError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Validate each distinct token once, sharing the outcome among its copies
+	outcomes := map[string]TokenValidation{}
+	results := make([]TokenValidation, 0, len(req.Tokens))
+	active := 0
+	for i, token := range req.Tokens {
+		outcome, seen := outcomes[token]
+		if !seen {
+			outcome, err = validateToken(ctx, client, realm, token)
+			if err != nil {
+				lh.LogActivity("Error while fetching realm signing keys:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+				utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+				return
+			}
+			outcomes[token] = outcome
+		}
+		outcome.Index = i
+		if outcome.Active {
+			active++
+		}
+		results = append(results, outcome)
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, results)
+
+	// Log the completion of execution, counting the tokens but never showing them
+	lh.LogActivity("Finished execution of tokenValidateBatch", map[string]any{"tokens": len(req.Tokens), "distinct": len(outcomes), "active": active, "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// validateToken checks the signature and expiry of an access token against the signing keys of
+// realm, which gocloak caches. It returns an error only if the keys could not be fetched.
+func validateToken(ctx context.Context, client utils.KeycloakClient, realm, token string) (TokenValidation, error) {
+	var validation TokenValidation
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		validation.Reason = "malformed"
+		return validation, nil
+	}
+
+	_, _, err := client.DecodeAccessToken(ctx, token, realm)
+	var apiErr *gocloak.APIError
+	switch {
+	case err == nil:
+		validation.Active = true
+	case utils.IsCircuitOpen(err) || errors.As(err, &apiErr):
+		return validation, err
+	case errors.Is(err, jwt.ErrTokenExpired):
+		validation.Reason = "expired"
+	default:
+		// The claims of a token that was not signed by the realm are not to be trusted
+		validation.Reason = "invalid_signature"
+		return validation, nil
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresAt := time.Unix(int64(exp), 0).UTC()
+		validation.ExpiresAt = &expiresAt
+	}
+	validation.Subject, _ = claims["sub"].(string)
+	validation.ClientID, _ = claims["azp"].(string)
+	return validation, nil
+}
+
+// getValsForTokenValidateBatchError returns a slice of strings to be used as vals for a validation error.
+func (req *TokenValidateBatchRequest) getValsForTokenValidateBatchError(err validator.FieldError) []string {
+	var vals []string
+	switch field := err.Field(); {
+	case field == "Tokens":
+		vals = append(vals, "tokens must list between 1 and 100 tokens")
+	case strings.HasPrefix(field, "Tokens["):
+		vals = append(vals, "tokens must not contain empty tokens")
+	}
+	return vals
+}
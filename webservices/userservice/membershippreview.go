@@ -0,0 +1,191 @@
+package userservice
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// MembershipPreviewResponse represents the structure for outgoing membership preview responses. The
+// gained capabilities and roles are those the user would hold after being added to the group and does
+// not hold yet, including roles reached through the group's ancestors and through composite roles.
+// GainedClientRoles is keyed by client ID.
+type MembershipPreviewResponse struct {
+	UserID             string              `json:"userID"`
+	GroupID            string              `json:"groupID"`
+	GroupPath          string              `json:"groupPath"`
+	AlreadyMember      bool                `json:"alreadyMember"`
+	GainedCapabilities []string            `json:"gainedCapabilities"`
+	GainedRealmRoles   []string            `json:"gainedRealmRoles"`
+	GainedClientRoles  map[string][]string `json:"gainedClientRoles"`
+	Truncated          bool                `json:"truncated"`
+}
+
+// HandleMembershipPreviewRequest is a Handler function for working out what adding a user to a group in
+// keyclock would grant, e.g. /membership-preview?user=ID&group=ID, without adding them. It supports informed
+// access granting decisions.
+func HandleMembershipPreviewRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("membership preview request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	userID, groupID := c.Query("user"), c.Query("group")
+	for _, param := range []struct{ field, value string }{{"user", userID}, {"group", groupID}} {
+		if param.value == "" {
+			lh.Debug0().LogDebug("Missing parameter", logharbour.DebugInfo{Variables: map[string]any{"field": param.field}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("missing", param.field))
+			return
+		}
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	capabilitiesGroup := s.Dependencies["capabilitiesGroup"].(string)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	if _, err := client.GetUserByID(ctx, token, realm, userID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching user:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), "user"))
+		return
+	}
+	group, err := client.GetGroup(ctx, token, realm, groupID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), "group"))
+		return
+	}
+
+	response := MembershipPreviewResponse{
+		UserID:             userID,
+		GroupID:            groupID,
+		GroupPath:          gocloak.PString(group.Path),
+		GainedCapabilities: []string{},
+		GainedRealmRoles:   []string{},
+		GainedClientRoles:  map[string][]string{},
+	}
+
+	userGroups, err := client.GetUserGroups(ctx, token, realm, userID, gocloak.GetGroupsParams{})
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching user groups:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+		return
+	}
+	for _, userGroup := range userGroups {
+		if userGroup != nil && gocloak.PString(userGroup.ID) == groupID {
+			response.AlreadyMember = true
+		}
+	}
+
+	if !response.AlreadyMember {
+		// Capabilities are granted by membership of a capability's group alone
+		grants, err := utils.UserCapabilityGrants(ctx, client, token, realm, userID, capabilitiesGroup)
+		if err != nil {
+			lh.LogActivity("Error while fetching user capabilities:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+			return
+		}
+		name, ok := strings.CutPrefix(response.GroupPath, "/"+capabilitiesGroup+"/")
+		if _, held := grants[name]; ok && !strings.Contains(name, "/") && !held {
+			response.GainedCapabilities = append(response.GainedCapabilities, name)
+		}
+
+		// Compare the effective roles of the user as it is with those it would have
+		beforeIDs, err := withAncestorIDs(ctx, client, token, realm, userGroups)
+		if err == nil {
+			var afterIDs []string
+			afterIDs, err = withAncestorIDs(ctx, client, token, realm, append(userGroups, group))
+			if err == nil {
+				err = previewRoles(ctx, client, token, realm, userID, beforeIDs, afterIDs, &response)
+			}
+		}
+		if err != nil {
+			lh.LogActivity("Error while working out effective roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+		if response.Truncated {
+			lh.Warn().LogActivity("Composite role chain deeper than the expansion limit", map[string]any{"userID": userID, "maxDepth": utils.MaxCompositeDepth})
+		}
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of membershipPreview", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// previewRoles sets in response the effective roles of a user that would be gained by its groups
+// going from those with IDs beforeIDs to those with IDs afterIDs, ancestors included in both.
+func previewRoles(ctx context.Context, client utils.KeycloakClient, token, realm, userID string, beforeIDs, afterIDs []string, response *MembershipPreviewResponse) error {
+	userMappings, err := client.GetRoleMappingByUserID(ctx, token, realm, userID)
+	if err != nil {
+		return err
+	}
+	groupMappings := map[string]*gocloak.MappingsRepresentation{}
+	for _, groupID := range afterIDs {
+		if groupMappings[groupID], err = client.GetRoleMappingByGroupID(ctx, token, realm, groupID); err != nil {
+			return err
+		}
+	}
+
+	var realmRoles [2][]string
+	var clientRoles [2]map[string][]string
+	for i, groupIDs := range [][]string{beforeIDs, afterIDs} {
+		expander := utils.NewRoleExpander(ctx, client, token, realm)
+		expander.AddMappings(userMappings)
+		for _, groupID := range groupIDs {
+			expander.AddMappings(groupMappings[groupID])
+		}
+		if err := expander.Expand(); err != nil {
+			return err
+		}
+		response.Truncated = response.Truncated || expander.Truncated
+		if realmRoles[i], clientRoles[i], err = expander.RoleNames(true); err != nil {
+			return err
+		}
+	}
+
+	response.GainedRealmRoles = gainedNames(realmRoles[1], realmRoles[0])
+	for clientID, names := range clientRoles[1] {
+		if gained := gainedNames(names, clientRoles[0][clientID]); len(gained) > 0 {
+			response.GainedClientRoles[clientID] = gained
+		}
+	}
+	return nil
+}
+
+// gainedNames returns, sorted, the names in after that are not in before.
+func gainedNames(after, before []string) []string {
+	had := make(map[string]bool, len(before))
+	for _, name := range before {
+		had[name] = true
+	}
+	gained := []string{}
+	for _, name := range after {
+		if !had[name] {
+			gained = append(gained, name)
+		}
+	}
+	sort.Strings(gained)
+	return gained
+}
@@ -0,0 +1,150 @@
+package userservice
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// AssignClientRoleRequest represents the structure for incoming client role assignment requests.
+type AssignClientRoleRequest struct {
+	UserID   string   `json:"userID" validate:"required"`
+	ClientID string   `json:"clientId" validate:"required"`
+	Roles    []string `json:"roles" validate:"required,min=1"`
+}
+
+// AssignClientRoleResponse represents the structure for outgoing client role assignment responses.
+type AssignClientRoleResponse struct {
+	UserID   string   `json:"userID"`
+	ClientID string   `json:"clientId"`
+	Roles    []string `json:"roles"`
+}
+
+// HandleAssignClientRoleRequest is a Handler function for assigning client roles to a user in keyclock
+func HandleAssignClientRoleRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("assign client role request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into AssignClientRoleRequest struct
+	var req AssignClientRoleRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForAssignClientRoleError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Resolve the keycloak client's internal ID from its client ID
+	clients, err := client.GetClients(ctx, token, realm, gocloak.GetClientsParams{ClientID: &req.ClientID})
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching client:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+	if len(clients) == 0 || clients[0].ID == nil {
+		lh.Debug0().LogDebug("Client not found:", logharbour.DebugInfo{Variables: map[string]any{"clientId": req.ClientID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("client_not_found", ""))
+		return
+	}
+	idOfClient := *clients[0].ID
+
+	// Make sure the user exists before touching its role mappings
+	if _, err := client.GetUserByID(ctx, token, realm, req.UserID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching user:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": req.UserID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	// Resolve every requested role by name
+	roles := make([]gocloak.Role, 0, len(req.Roles))
+	for _, roleName := range req.Roles {
+		role, err := client.GetClientRole(ctx, token, realm, idOfClient, roleName)
+		if err != nil {
+			lh.Debug0().LogDebug("Error while fetching client role:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "role": roleName}})
+			errcode := userErrorCode(err)
+			var apiErr *gocloak.APIError
+			if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+				errcode = "role_not_found"
+			}
+			utils.SendErrorResponse(c, utils.ErrorResponse(errcode, "roles", roleName))
+			return
+		}
+		roles = append(roles, *role)
+	}
+
+	if err := client.AddClientRolesToUser(ctx, token, realm, idOfClient, req.UserID, roles); err != nil {
+		lh.LogActivity("Error while assigning client roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+	utils.SecurityLog(c, lh, utils.SecurityEventRoleGranted, map[string]any{"userID": req.UserID, "clientID": req.ClientID, "roles": req.Roles})
+
+	// Fetch the user's effective client roles after the assignment
+	effectiveRoles, err := client.GetCompositeClientRolesByUserID(ctx, token, realm, idOfClient, req.UserID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching effective client roles:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	response := AssignClientRoleResponse{
+		UserID:   req.UserID,
+		ClientID: req.ClientID,
+		Roles:    make([]string, 0, len(effectiveRoles)),
+	}
+	for _, role := range effectiveRoles {
+		response.Roles = append(response.Roles, gocloak.PString(role.Name))
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of assignClientRole", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForAssignClientRoleError returns a slice of strings to be used as vals for a validation error.
+func (req *AssignClientRoleRequest) getValsForAssignClientRoleError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "UserID":
+		vals = append(vals, "userID is required")
+	case "ClientID":
+		vals = append(vals, "clientId is required")
+	case "Roles":
+		vals = append(vals, "at least one role name is required")
+	}
+	return vals
+}
@@ -0,0 +1,134 @@
+package userservice
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// ClientSessions describes a client a user is logged into. ID is the client's internal id and
+// ClientID its public one. SessionIDs lists the user's sessions with the client, for revoking
+// them one by one, and LastAccess is the latest access through any of them.
+type ClientSessions struct {
+	ID          string    `json:"id"`
+	ClientID    string    `json:"clientId"`
+	SessionIDs  []string  `json:"sessionIDs"`
+	IPAddresses []string  `json:"ipAddresses"`
+	LastAccess  time.Time `json:"lastAccess"`
+}
+
+// UserClientSessionsResponse represents the structure for outgoing user client sessions responses.
+type UserClientSessionsResponse struct {
+	UserID   string           `json:"userID"`
+	Sessions int              `json:"sessions"`
+	Clients  []ClientSessions `json:"clients"`
+}
+
+// HandleUserClientSessionsRequest is a Handler function for listing the clients a user in keyclock currently has
+// sessions with, grouping the user's sessions by client. A user without sessions gets an empty list of clients.
+func HandleUserClientSessionsRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("user client sessions request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	userID := c.Query("userID")
+	if userID == "" {
+		lh.Debug0().LogDebug("Missing userID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "userID"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure the user exists, as keycloak returns no sessions for unknown users
+	if _, err := client.GetUserByID(ctx, token, realm, userID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching user:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	sessions, err := client.GetUserSessions(ctx, token, realm, userID)
+	if err != nil {
+		lh.LogActivity("Error while fetching user sessions:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	response := UserClientSessionsResponse{UserID: userID, Clients: groupSessionsByClient(sessions)}
+	for _, session := range sessions {
+		if session != nil {
+			response.Sessions++
+		}
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of userClientSessions", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// groupSessionsByClient groups sessions by the clients they are with, ordered by client id.
+// A session with several clients is listed under each of them.
+func groupSessionsByClient(sessions []*gocloak.UserSessionRepresentation) []ClientSessions {
+	byClient := map[string]*ClientSessions{}
+	for _, session := range sessions {
+		if session == nil || session.Clients == nil {
+			continue
+		}
+		for id, clientID := range *session.Clients {
+			entry, ok := byClient[id]
+			if !ok {
+				entry = &ClientSessions{ID: id, ClientID: clientID, SessionIDs: []string{}, IPAddresses: []string{}}
+				byClient[id] = entry
+			}
+			entry.SessionIDs = append(entry.SessionIDs, gocloak.PString(session.ID))
+			if ip := gocloak.PString(session.IPAddress); ip != "" && !containsString(entry.IPAddresses, ip) {
+				entry.IPAddresses = append(entry.IPAddresses, ip)
+			}
+			if session.LastAccess != nil {
+				if lastAccess := time.UnixMilli(*session.LastAccess).UTC(); lastAccess.After(entry.LastAccess) {
+					entry.LastAccess = lastAccess
+				}
+			}
+		}
+	}
+
+	clients := make([]ClientSessions, 0, len(byClient))
+	for _, entry := range byClient {
+		sort.Strings(entry.SessionIDs)
+		sort.Strings(entry.IPAddresses)
+		clients = append(clients, *entry)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ClientID < clients[j].ClientID })
+	return clients
+}
+
+// containsString reports whether values holds value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
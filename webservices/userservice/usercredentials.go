@@ -0,0 +1,227 @@
+package userservice
+
+import (
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// mfaCredentialTypes lists the keycloak credential types that count as a second factor.
+var mfaCredentialTypes = map[string]bool{
+	"otp":                   true,
+	"webauthn":              true,
+	"webauthn-passwordless": true,
+}
+
+// UserCredential describes a single credential of a user. It never carries the secret or
+// credential data keycloak holds for it.
+type UserCredential struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type"`
+	UserLabel   string     `json:"userLabel,omitempty"`
+	CreatedDate *time.Time `json:"createdDate,omitempty"`
+}
+
+// UserCredentialsResponse represents the structure for outgoing user credentials responses.
+// MFAConfigured is set when the user has at least one OTP or WebAuthn credential.
+type UserCredentialsResponse struct {
+	UserID        string           `json:"userID"`
+	Credentials   []UserCredential `json:"credentials"`
+	MFAConfigured bool             `json:"mfaConfigured"`
+}
+
+// CredentialDeleteRequest represents the structure for incoming requests to remove a credential from a user.
+type CredentialDeleteRequest struct {
+	UserID       string `json:"userID" validate:"required"`
+	CredentialID string `json:"credentialID" validate:"required"`
+}
+
+// HandleUserCredentialsRequest is a Handler function for fetching the credentials metadata of a user in keyclock
+func HandleUserCredentialsRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("user credentials request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	userID := c.Query("userID")
+	if userID == "" {
+		lh.Debug0().LogDebug("Missing userID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "userID"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	credentials, err := client.GetCredentials(ctx, token, realm, userID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching user credentials:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	response := UserCredentialsResponse{UserID: userID, Credentials: make([]UserCredential, 0, len(credentials))}
+	for _, credential := range credentials {
+		if credential == nil {
+			continue
+		}
+		response.Credentials = append(response.Credentials, toUserCredential(credential))
+		if mfaCredentialTypes[gocloak.PString(credential.Type)] {
+			response.MFAConfigured = true
+		}
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of userCredentials", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// toUserCredential copies the metadata of a keycloak credential, leaving out its secret material.
+func toUserCredential(credential *gocloak.CredentialRepresentation) UserCredential {
+	result := UserCredential{
+		ID:        gocloak.PString(credential.ID),
+		Type:      gocloak.PString(credential.Type),
+		UserLabel: gocloak.PString(credential.UserLabel),
+	}
+	if credential.CreatedDate != nil {
+		created := time.UnixMilli(*credential.CreatedDate).UTC()
+		result.CreatedDate = &created
+	}
+	return result
+}
+
+// HandleUserCredentialDeleteRequest is a Handler function for removing a single credential, such as a
+// lost OTP device, from a user in keyclock
+func HandleUserCredentialDeleteRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("delete user credential request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into CredentialDeleteRequest struct
+	var req CredentialDeleteRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForCredentialDeleteError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	idempotent, ok := utils.GetIdempotentParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid idempotent parameter", logharbour.DebugInfo{Variables: map[string]any{"idempotent": c.Query("idempotent")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "idempotent"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure the credential belongs to the user before removing it
+	credentials, err := client.GetCredentials(ctx, token, realm, req.UserID)
+	if idempotent && utils.IsNotFound(err) {
+		lh.Debug0().LogDebug("User already deleted", logharbour.DebugInfo{Variables: map[string]any{"userID": req.UserID}})
+		utils.SendAlreadyDeletedResponse(c)
+		return
+	}
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching user credentials:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": req.UserID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+	var removed *UserCredential
+	for _, credential := range credentials {
+		if credential != nil && gocloak.PString(credential.ID) == req.CredentialID {
+			found := toUserCredential(credential)
+			removed = &found
+			break
+		}
+	}
+	if removed == nil && idempotent {
+		lh.Debug0().LogDebug("Credential already deleted", logharbour.DebugInfo{Variables: map[string]any{"userID": req.UserID, "credentialID": req.CredentialID}})
+		utils.SendAlreadyDeletedResponse(c)
+		return
+	}
+	if removed == nil {
+		lh.Debug0().LogDebug("Credential does not belong to user", logharbour.DebugInfo{Variables: map[string]any{"userID": req.UserID, "credentialID": req.CredentialID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("credential_not_found", "credentialID"))
+		return
+	}
+
+	err = client.DeleteCredentials(ctx, token, realm, req.UserID, req.CredentialID)
+	if idempotent && utils.IsNotFound(err) {
+		lh.Debug0().LogDebug("Credential already deleted", logharbour.DebugInfo{Variables: map[string]any{"userID": req.UserID, "credentialID": req.CredentialID}})
+		utils.SendAlreadyDeletedResponse(c)
+		return
+	}
+	if err != nil {
+		lh.LogActivity("Error while deleting user credential:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "credential_not_found"), ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("user").WithWhatInstanceId(req.UserID).
+		LogDataChange("credential removed", logharbour.ChangeInfo{
+			Entity:    "user",
+			Operation: "update",
+			Changes:   map[string]any{"credential": map[string]any{"id": removed.ID, "type": removed.Type, "userLabel": removed.UserLabel}},
+		})
+	utils.SecurityLog(c, lh, utils.SecurityEventCredentialRemoved, map[string]any{"userID": req.UserID, "credentialType": removed.Type})
+
+	// Send success response
+	utils.SendSuccessResponse(c, removed)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of deleteUserCredential", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForCredentialDeleteError returns a slice of strings to be used as vals for a validation error.
+func (req *CredentialDeleteRequest) getValsForCredentialDeleteError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "UserID":
+		vals = append(vals, "userID is required")
+	case "CredentialID":
+		vals = append(vals, "credentialID is required")
+	}
+	return vals
+}
@@ -0,0 +1,281 @@
+package userservice
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// csvImportConcurrency is the number of users created in parallel during a CSV import.
+	csvImportConcurrency = 5
+	// csvImportFormField is the multipart form field carrying the CSV file.
+	csvImportFormField = "file"
+)
+
+// csvImportHeader lists the columns, in order, expected in the first line of an imported CSV.
+var csvImportHeader = []string{"username", "email", "firstName", "lastName", "enabled"}
+
+// emailValidator checks email addresses locally so that malformed ones are rejected without a keycloak round trip.
+var emailValidator = validator.New()
+
+// CsvImportRowResult reports the outcome of importing a single CSV row. DefaultGroups lists
+// the paths of the default groups the user was added to, and DefaultGroupsFailed those the
+// user could not be added to.
+type CsvImportRowResult struct {
+	Row                 int      `json:"row"`
+	Username            string   `json:"username"`
+	ID                  string   `json:"id,omitempty"`
+	Status              string   `json:"status"`
+	Error               string   `json:"error,omitempty"`
+	DefaultGroups       []string `json:"defaultGroups,omitempty"`
+	DefaultGroupsFailed []string `json:"defaultGroupsFailed,omitempty"`
+}
+
+// csvImportGroup is a default group imported users are added to.
+type csvImportGroup struct {
+	path string
+	id   string
+}
+
+// csvImportRow is a parsed CSV row waiting to be created in keycloak.
+type csvImportRow struct {
+	row  int
+	user gocloak.User
+}
+
+// HandleUserCsvImportRequest is a Handler function for creating users in keyclock from an uploaded CSV file.
+// Users created are added to the default groups of the realm, unless skipDefaultGroups=true is given.
+func HandleUserCsvImportRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("user csv import request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	skipDefaultGroups := false
+	if v := c.Query("skipDefaultGroups"); v != "" {
+		if skipDefaultGroups, err = strconv.ParseBool(v); err != nil {
+			lh.Debug0().LogDebug("Invalid skipDefaultGroups parameter", logharbour.DebugInfo{Variables: map[string]any{"skipDefaultGroups": v}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+			return
+		}
+	}
+
+	// Read the multipart body part by part so the file is never buffered whole
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		lh.Debug0().LogDebug("Request is not multipart:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_csv", ""))
+		return
+	}
+	var file io.Reader
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		if part.FormName() == csvImportFormField {
+			file = part
+			break
+		}
+	}
+	if file == nil {
+		lh.Debug0().LogDebug("CSV file part missing", logharbour.DebugInfo{Variables: map[string]any{"field": csvImportFormField}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_csv", ""))
+		return
+	}
+
+	csvReader := csv.NewReader(file)
+	csvReader.FieldsPerRecord = len(csvImportHeader)
+	csvReader.TrimLeadingSpace = true
+
+	// Validate headers up front
+	header, err := csvReader.Read()
+	if err != nil || !validCsvImportHeader(header) {
+		lh.Debug0().LogDebug("Invalid CSV header:", logharbour.DebugInfo{Variables: map[string]any{"header": header, "error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_csv", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Every user created is reported to any configured webhooks
+	webhooks := s.Dependencies["webhooks"].(*utils.WebhookNotifier)
+	actor := utils.SubjectFromToken(token)
+
+	// Create a context with the timeout configured for this route, bounding the whole import
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Look up the default groups once for the whole import
+	var defaultGroups []csvImportGroup
+	if !skipDefaultGroups {
+		groupIDs, err := utils.ResolveDefaultGroups(ctx, client, token, realm)
+		if err != nil {
+			lh.Debug0().LogDebug("Error while fetching default groups:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+		for _, path := range utils.DefaultGroups(realm) {
+			defaultGroups = append(defaultGroups, csvImportGroup{path: path, id: groupIDs[path]})
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		results []CsvImportRowResult
+		wg      sync.WaitGroup
+	)
+	addResult := func(result CsvImportRowResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, result)
+	}
+
+	// Start a bounded pool of workers creating users as rows are streamed in
+	rows := make(chan csvImportRow)
+	for i := 0; i < csvImportConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range rows {
+				result := createCsvImportUser(ctx, client, token, realm, r, defaultGroups)
+				if result.Status == wscutils.SuccessStatus {
+					webhooks.Notify("user", "created", result.ID, realm, actor)
+				}
+				addResult(result)
+			}
+		}()
+	}
+
+	rowNum := 1
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		rowNum++
+		if err != nil {
+			var parseErr *csv.ParseError
+			addResult(CsvImportRowResult{Row: rowNum, Status: wscutils.ErrorStatus, Error: "invalid_csv"})
+			if errors.As(err, &parseErr) {
+				continue
+			}
+			lh.Debug0().LogDebug("Error reading CSV:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "row": rowNum}})
+			break
+		}
+		user, errcode := csvRecordToUser(record)
+		if errcode != "" {
+			addResult(CsvImportRowResult{Row: rowNum, Username: record[0], Status: wscutils.ErrorStatus, Error: errcode})
+			continue
+		}
+		rows <- csvImportRow{row: rowNum, user: user}
+	}
+	close(rows)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Row < results[j].Row })
+
+	// Send success response
+	utils.SendSuccessResponse(c, results)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of userCsvImport", map[string]any{"rows": len(results), "Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// validCsvImportHeader reports whether header matches csvImportHeader, ignoring case.
+func validCsvImportHeader(header []string) bool {
+	if len(header) != len(csvImportHeader) {
+		return false
+	}
+	for i, column := range csvImportHeader {
+		if !strings.EqualFold(strings.TrimSpace(header[i]), column) {
+			return false
+		}
+	}
+	return true
+}
+
+// csvRecordToUser builds a keycloak user from a CSV record. It returns a non-empty
+// error code if the record is invalid.
+func csvRecordToUser(record []string) (gocloak.User, string) {
+	username := strings.TrimSpace(record[0])
+	if username == "" {
+		return gocloak.User{}, "missing"
+	}
+	email := strings.TrimSpace(record[1])
+	if email != "" && emailValidator.Var(email, "email") != nil {
+		return gocloak.User{}, "invalid_email"
+	}
+	enabled, err := strconv.ParseBool(strings.TrimSpace(record[4]))
+	if err != nil {
+		return gocloak.User{}, "invalid_request"
+	}
+	return gocloak.User{
+		Username:  gocloak.StringP(username),
+		Email:     gocloak.StringP(email),
+		FirstName: gocloak.StringP(strings.TrimSpace(record[2])),
+		LastName:  gocloak.StringP(strings.TrimSpace(record[3])),
+		Enabled:   gocloak.BoolP(enabled),
+	}, ""
+}
+
+// createCsvImportUser creates a single user in keycloak, adds it to the default groups, and
+// reports the outcome. Failing to add the user to a default group does not fail the row.
+func createCsvImportUser(ctx context.Context, client utils.KeycloakClient, token, realm string, r csvImportRow, defaultGroups []csvImportGroup) CsvImportRowResult {
+	result := CsvImportRowResult{Row: r.row, Username: *r.user.Username, Status: wscutils.SuccessStatus}
+
+	// Bound each user by the default timeout as well
+	ctx, cancel := context.WithTimeout(ctx, utils.DefaultRequestTimeout())
+	defer cancel()
+
+	userID, err := client.CreateUser(ctx, token, realm, r.user)
+	if err != nil {
+		result.Status = wscutils.ErrorStatus
+		result.Error = userErrorCode(err)
+		return result
+	}
+	result.ID = userID
+	for _, group := range defaultGroups {
+		if err := client.AddUserToGroup(ctx, token, realm, userID, group.id); err != nil {
+			result.DefaultGroupsFailed = append(result.DefaultGroupsFailed, group.path)
+			continue
+		}
+		utils.GroupMembershipChanged(realm, group.id)
+		result.DefaultGroups = append(result.DefaultGroups, group.path)
+	}
+	return result
+}
+
+// userErrorCode converts an error returned by keycloak for a user operation into an error code.
+func userErrorCode(err error) string {
+	var apiErr *gocloak.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+		return "user_already_exists"
+	}
+	return utils.KeycloakErrorCode(err, "user_not_found")
+}
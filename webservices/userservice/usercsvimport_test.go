@@ -0,0 +1,66 @@
+package userservice
+
+import (
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+func TestCsvRecordToUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		wantEmail string
+		wantCode  string
+	}{
+		{name: "ascii", email: "asha@example.com", wantEmail: "asha@example.com"},
+		{name: "plus tag and subdomain", email: "asha.rao+hr@mail.example.co.in", wantEmail: "asha.rao+hr@mail.example.co.in"},
+		{name: "surrounding spaces trimmed", email: "  asha@example.com ", wantEmail: "asha@example.com"},
+		{name: "unicode domain", email: "asha@bücher.de", wantEmail: "asha@bücher.de"},
+		{name: "punycode domain", email: "asha@xn--bcher-kva.de", wantEmail: "asha@xn--bcher-kva.de"},
+		{name: "unicode local part and domain", email: "उपयोगकर्ता@उदाहरण.भारत", wantEmail: "उपयोगकर्ता@उदाहरण.भारत"},
+		{name: "empty email allowed", email: "", wantEmail: ""},
+		{name: "no at sign", email: "asha.example.com", wantCode: "invalid_email"},
+		{name: "no domain", email: "asha@", wantCode: "invalid_email"},
+		{name: "no local part", email: "@example.com", wantCode: "invalid_email"},
+		{name: "space in local part", email: "asha rao@example.com", wantCode: "invalid_email"},
+		{name: "empty domain label", email: "asha@example..com", wantCode: "invalid_email"},
+		{name: "two at signs", email: "asha@rao@example.com", wantCode: "invalid_email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, code := csvRecordToUser([]string{"asha", tt.email, "Asha", "Rao", "true"})
+			if code != tt.wantCode {
+				t.Fatalf("error code = %q, want %q", code, tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				return
+			}
+			if got := gocloak.PString(user.Email); got != tt.wantEmail {
+				t.Errorf("email = %q, want %q", got, tt.wantEmail)
+			}
+			if gocloak.PString(user.Username) != "asha" || !gocloak.PBool(user.Enabled) {
+				t.Errorf("user = %+v, want username asha, enabled", user)
+			}
+		})
+	}
+}
+
+func TestCsvRecordToUserOtherFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   []string
+		wantCode string
+	}{
+		{name: "missing username", record: []string{" ", "asha@example.com", "Asha", "Rao", "true"}, wantCode: "missing"},
+		{name: "invalid enabled", record: []string{"asha", "asha@example.com", "Asha", "Rao", "yes please"}, wantCode: "invalid_request"},
+		{name: "disabled", record: []string{"asha", "asha@example.com", "Asha", "Rao", "false"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, code := csvRecordToUser(tt.record); code != tt.wantCode {
+				t.Errorf("error code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
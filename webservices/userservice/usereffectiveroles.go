@@ -0,0 +1,142 @@
+package userservice
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// EffectiveRolesResponse represents the structure for outgoing effective role responses.
+// ClientRoles is keyed by client ID.
+type EffectiveRolesResponse struct {
+	UserID      string              `json:"userID"`
+	RealmRoles  []string            `json:"realmRoles"`
+	ClientRoles map[string][]string `json:"clientRoles"`
+	Truncated   bool                `json:"truncated"`
+}
+
+// HandleUserEffectiveRolesRequest is a Handler function for fetching the roles a user actually has in keyclock,
+// including those inherited from its groups and from composite roles
+func HandleUserEffectiveRolesRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("user effective roles request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	userID := c.Query("userID")
+	if userID == "" {
+		lh.Debug0().LogDebug("Missing userID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "userID"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Collect the roles mapped directly to the user
+	mappings, err := client.GetRoleMappingByUserID(ctx, token, realm, userID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching user role mappings:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+	expander := utils.NewRoleExpander(ctx, client, token, realm)
+	expander.AddMappings(mappings)
+
+	// Collect the roles mapped to the user's groups and to their ancestors
+	groupIDs, err := userGroupIDs(ctx, client, token, realm, userID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching user groups:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+	for _, groupID := range groupIDs {
+		groupMappings, err := client.GetRoleMappingByGroupID(ctx, token, realm, groupID)
+		if err != nil {
+			lh.Debug0().LogDebug("Error while fetching group role mappings:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "groupID": groupID}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+			return
+		}
+		expander.AddMappings(groupMappings)
+	}
+
+	// Expand composite roles
+	if err := expander.Expand(); err != nil {
+		lh.LogActivity("Error while expanding composite roles:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "role_not_found"), ""))
+		return
+	}
+	if expander.Truncated {
+		lh.Warn().LogActivity("Composite role chain deeper than the expansion limit", map[string]any{"userID": userID, "maxDepth": utils.MaxCompositeDepth})
+	}
+
+	realmRoles, clientRoles, err := expander.RoleNames(true)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching client:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "client_not_found"), ""))
+		return
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, EffectiveRolesResponse{
+		UserID:      userID,
+		RealmRoles:  realmRoles,
+		ClientRoles: clientRoles,
+		Truncated:   expander.Truncated,
+	})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of userEffectiveRoles", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// userGroupIDs returns the IDs of the groups the user belongs to together with all of their
+// ancestors, since a group inherits the role mappings of its parents.
+func userGroupIDs(ctx context.Context, client utils.KeycloakClient, token, realm, userID string) ([]string, error) {
+	groups, err := client.GetUserGroups(ctx, token, realm, userID, gocloak.GetGroupsParams{})
+	if err != nil {
+		return nil, err
+	}
+	return withAncestorIDs(ctx, client, token, realm, groups)
+}
+
+// withAncestorIDs returns the IDs of groups together with all of their ancestors.
+func withAncestorIDs(ctx context.Context, client utils.KeycloakClient, token, realm string, groups []*gocloak.Group) ([]string, error) {
+	seen := map[string]bool{}
+	var ids []string
+	for _, group := range groups {
+		if group.ID != nil && !seen[*group.ID] {
+			seen[*group.ID] = true
+			ids = append(ids, *group.ID)
+		}
+		segments := strings.Split(strings.Trim(gocloak.PString(group.Path), "/"), "/")
+		for i := 1; i < len(segments); i++ {
+			ancestor, err := client.GetGroupByPath(ctx, token, realm, "/"+strings.Join(segments[:i], "/"))
+			if err != nil {
+				return nil, err
+			}
+			if ancestor.ID != nil && !seen[*ancestor.ID] {
+				seen[*ancestor.ID] = true
+				ids = append(ids, *ancestor.ID)
+			}
+		}
+	}
+	return ids, nil
+}
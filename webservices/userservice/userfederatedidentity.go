@@ -0,0 +1,271 @@
+package userservice
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// FederatedIdentityAddRequest represents the structure for incoming requests to link an external
+// identity provider account to a user.
+type FederatedIdentityAddRequest struct {
+	UserID           string `json:"userID" validate:"required"`
+	Provider         string `json:"provider" validate:"required"`
+	ExternalUserID   string `json:"externalUserId" validate:"required"`
+	ExternalUsername string `json:"externalUsername" validate:"required"`
+}
+
+// FederatedIdentityRemoveRequest represents the structure for incoming requests to unlink an
+// external identity provider account from a user.
+type FederatedIdentityRemoveRequest struct {
+	UserID   string `json:"userID" validate:"required"`
+	Provider string `json:"provider" validate:"required"`
+}
+
+// FederatedIdentity represents a single external identity linked to a user.
+type FederatedIdentity struct {
+	Provider         string `json:"provider"`
+	ExternalUserID   string `json:"externalUserId"`
+	ExternalUsername string `json:"externalUsername"`
+}
+
+// HandleUserFederatedIdentityAddRequest is a Handler function for linking an external identity to a user in keyclock
+func HandleUserFederatedIdentityAddRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("add federated identity request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into FederatedIdentityAddRequest struct
+	var req FederatedIdentityAddRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForFederatedIdentityAddError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure the identity provider is configured in the realm
+	if _, err := client.GetIdentityProvider(ctx, token, realm, req.Provider); err != nil {
+		lh.Debug0().LogDebug("Error while fetching identity provider:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "provider": req.Provider}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "identity_provider_not_found"), ""))
+		return
+	}
+
+	identity := gocloak.FederatedIdentityRepresentation{
+		IdentityProvider: gocloak.StringP(req.Provider),
+		UserID:           gocloak.StringP(req.ExternalUserID),
+		UserName:         gocloak.StringP(req.ExternalUsername),
+	}
+	if err := client.CreateUserFederatedIdentity(ctx, token, realm, req.UserID, req.Provider, identity); err != nil {
+		lh.LogActivity("Error while linking federated identity:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		errcode := utils.KeycloakErrorCode(err, "user_not_found")
+		if utils.IsConflict(err) {
+			errcode = "federated_identity_exists"
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse(errcode, ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("user").WithWhatInstanceId(req.UserID).
+		LogDataChange("federated identity linked", logharbour.ChangeInfo{
+			Entity:    "user",
+			Operation: "update",
+			Changes:   map[string]any{"federatedIdentity": map[string]any{"provider": req.Provider, "externalUserId": req.ExternalUserID}},
+		})
+	utils.SecurityLog(c, lh, utils.SecurityEventIdentityLinked, map[string]any{"userID": req.UserID, "provider": req.Provider})
+
+	// Send success response, pointing at the user's federated identities
+	utils.SendCreatedResponse(c, "/user-federated-identities?userID="+url.QueryEscape(req.UserID), FederatedIdentity{
+		Provider:         req.Provider,
+		ExternalUserID:   req.ExternalUserID,
+		ExternalUsername: req.ExternalUsername,
+	})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of addFederatedIdentity", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleUserFederatedIdentityRemoveRequest is a Handler function for unlinking an external identity from a user in keyclock
+func HandleUserFederatedIdentityRemoveRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("remove federated identity request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into FederatedIdentityRemoveRequest struct
+	var req FederatedIdentityRemoveRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForFederatedIdentityRemoveError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	idempotent, ok := utils.GetIdempotentParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid idempotent parameter", logharbour.DebugInfo{Variables: map[string]any{"idempotent": c.Query("idempotent")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "idempotent"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	err = client.DeleteUserFederatedIdentity(ctx, token, realm, req.UserID, req.Provider)
+	if idempotent && utils.IsNotFound(err) {
+		lh.Debug0().LogDebug("Federated identity already unlinked", logharbour.DebugInfo{Variables: map[string]any{"userID": req.UserID, "provider": req.Provider}})
+		utils.SendAlreadyDeletedResponse(c)
+		return
+	}
+	if err != nil {
+		lh.LogActivity("Error while unlinking federated identity:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "federated_identity_not_found"), ""))
+		return
+	}
+
+	// Audit the change along with who made it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("user").WithWhatInstanceId(req.UserID).
+		LogDataChange("federated identity unlinked", logharbour.ChangeInfo{
+			Entity:    "user",
+			Operation: "update",
+			Changes:   map[string]any{"federatedIdentity": map[string]any{"provider": req.Provider}},
+		})
+	utils.SecurityLog(c, lh, utils.SecurityEventIdentityUnlinked, map[string]any{"userID": req.UserID, "provider": req.Provider})
+
+	// Send success response
+	utils.SendSuccessResponse(c, nil)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of removeFederatedIdentity", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// HandleUserFederatedIdentityListRequest is a Handler function for listing the external identities linked to a user in keyclock
+func HandleUserFederatedIdentityListRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("list federated identities request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	userID := c.Query("userID")
+	if userID == "" {
+		lh.Debug0().LogDebug("Missing userID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "userID"))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	identities, err := client.GetUserFederatedIdentities(ctx, token, realm, userID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching federated identities:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "user_not_found"), ""))
+		return
+	}
+
+	response := make([]FederatedIdentity, 0, len(identities))
+	for _, identity := range identities {
+		if identity == nil {
+			continue
+		}
+		response = append(response, FederatedIdentity{
+			Provider:         gocloak.PString(identity.IdentityProvider),
+			ExternalUserID:   gocloak.PString(identity.UserID),
+			ExternalUsername: gocloak.PString(identity.UserName),
+		})
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of listFederatedIdentities", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForFederatedIdentityAddError returns a slice of strings to be used as vals for a validation error.
+func (req *FederatedIdentityAddRequest) getValsForFederatedIdentityAddError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "UserID":
+		vals = append(vals, "userID is required")
+	case "Provider":
+		vals = append(vals, "provider is required")
+	case "ExternalUserID":
+		vals = append(vals, "externalUserId is required")
+	case "ExternalUsername":
+		vals = append(vals, "externalUsername is required")
+	}
+	return vals
+}
+
+// getValsForFederatedIdentityRemoveError returns a slice of strings to be used as vals for a validation error.
+func (req *FederatedIdentityRemoveRequest) getValsForFederatedIdentityRemoveError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "UserID":
+		vals = append(vals, "userID is required")
+	case "Provider":
+		vals = append(vals, "provider is required")
+	}
+	return vals
+}
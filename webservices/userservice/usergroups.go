@@ -0,0 +1,173 @@
+package userservice
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// UserGroup represents a single group membership of a user. Direct is false for groups the
+// user belongs to only through one of their sub groups, which are then listed in Via.
+// DisplayName is the group's display name in the language the request asks for, or its name,
+// always the latter in brief listings.
+type UserGroup struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	DisplayName string               `json:"displayName"`
+	Path        string               `json:"path"`
+	Direct      bool                 `json:"direct"`
+	Via         []string             `json:"via,omitempty"`
+	Attributes  *map[string][]string `json:"attributes,omitempty"`
+}
+
+// userGroupSortFields lists the fields user groups can be sorted by.
+var userGroupSortFields = []string{"name", "path"}
+
+// HandleUserGroupsRequest is a Handler function for fetching the groups a user belongs to in keyclock,
+// both directly and through the parents of their groups
+func HandleUserGroupsRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("user groups request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	userID := c.Query("userID")
+	if userID == "" {
+		lh.Debug0().LogDebug("Missing userID", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "userID"))
+		return
+	}
+
+	brief, ok := utils.GetBriefParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid brief parameter", logharbour.DebugInfo{Variables: map[string]any{"brief": c.Query("brief")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	sortField, desc, ok := utils.GetSortParams(c, userGroupSortFields...)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid sort parameters", logharbour.DebugInfo{Variables: map[string]any{"sort": c.Query("sort"), "order": c.Query("order")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_sort", "sort", strings.Join(userGroupSortFields, ", ")))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Make sure the user exists, as keycloak returns an empty group list for unknown users
+	if _, err := client.GetUserByID(ctx, token, realm, userID); err != nil {
+		lh.Debug0().LogDebug("Error while fetching user:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": userID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	groups, err := utils.CollectPages(utils.MaxPageSize, 0, func(first, max int) ([]*gocloak.Group, error) {
+		return client.GetUserGroups(ctx, token, realm, userID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(max),
+			BriefRepresentation: gocloak.BoolP(brief),
+		})
+	})
+	if err != nil {
+		lh.LogActivity("Error while fetching user groups:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	// Record direct memberships first, so that a group that is both direct and an ancestor
+	// of another direct group is reported as direct
+	memberships := map[string]*UserGroup{}
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		membership := &UserGroup{
+			ID:     gocloak.PString(group.ID),
+			Name:   gocloak.PString(group.Name),
+			Path:   gocloak.PString(group.Path),
+			Direct: true,
+		}
+		if !brief {
+			membership.Attributes = group.Attributes
+		}
+		memberships[membership.Path] = membership
+	}
+
+	// Add every ancestor of a direct group as an inherited membership
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		path := gocloak.PString(group.Path)
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		for i := 1; i < len(segments); i++ {
+			ancestorPath := "/" + strings.Join(segments[:i], "/")
+			if membership, ok := memberships[ancestorPath]; ok {
+				if !membership.Direct {
+					membership.Via = append(membership.Via, path)
+				}
+				continue
+			}
+			ancestor, err := client.GetGroupByPath(ctx, token, realm, ancestorPath)
+			if err != nil {
+				lh.Debug0().LogDebug("Error while fetching parent group:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "path": ancestorPath}})
+				utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+				return
+			}
+			membership := &UserGroup{
+				ID:   gocloak.PString(ancestor.ID),
+				Name: gocloak.PString(ancestor.Name),
+				Path: ancestorPath,
+				Via:  []string{path},
+			}
+			if !brief {
+				membership.Attributes = ancestor.Attributes
+			}
+			memberships[ancestorPath] = membership
+		}
+	}
+
+	langs := utils.RequestLanguages(c)
+	response := make([]UserGroup, 0, len(memberships))
+	for _, membership := range memberships {
+		sort.Strings(membership.Via)
+		membership.DisplayName = utils.DisplayName(langs, membership.Name, membership.Attributes)
+		response = append(response, *membership)
+	}
+	// Groups are ordered by path unless sorted by name, in which case groups of the same name stay in path order
+	sort.Slice(response, func(i, j int) bool {
+		a, b := response[i], response[j]
+		if desc {
+			a, b = b, a
+		}
+		if sortField == "name" && a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Path < b.Path
+	})
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of userGroups", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
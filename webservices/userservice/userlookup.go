@@ -0,0 +1,129 @@
+package userservice
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// UserLookupResponse represents the structure for outgoing user lookup responses.
+type UserLookupResponse struct {
+	ID            string               `json:"id"`
+	Username      string               `json:"username"`
+	Email         string               `json:"email"`
+	FirstName     string               `json:"firstName"`
+	LastName      string               `json:"lastName"`
+	Enabled       bool                 `json:"enabled"`
+	EmailVerified bool                 `json:"emailVerified"`
+	Attributes    *map[string][]string `json:"attributes,omitempty"`
+}
+
+// HandleUserLookupRequest is a Handler function for finding the single user in keyclock with exactly the given
+// username or email, e.g. /user-lookup?email=jane@example.com. keyclock's user search matches partially, so its
+// results are narrowed down to exact, case insensitive, matches.
+func HandleUserLookupRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("user lookup request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Exactly one of username and email names the user
+	username, email := c.Query("username"), c.Query("email")
+	if username == "" && email == "" {
+		lh.Debug0().LogDebug("Missing username and email", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "username"))
+		return
+	}
+	if username != "" && email != "" {
+		lh.Debug0().LogDebug("Both username and email given", logharbour.DebugInfo{Variables: map[string]any{"username": username, "email": email}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "email"))
+		return
+	}
+
+	raw, ok := utils.GetRawParam(c)
+	if !ok {
+		lh.Debug0().LogDebug("Invalid raw parameter", logharbour.DebugInfo{Variables: map[string]any{"raw": c.Query("raw")}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", ""))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	params := gocloak.GetUsersParams{Exact: gocloak.BoolP(true), BriefRepresentation: gocloak.BoolP(false)}
+	field, value := "username", username
+	if email != "" {
+		field, value = "email", email
+		params.Email = gocloak.StringP(email)
+	} else {
+		params.Username = gocloak.StringP(username)
+	}
+	users, err := client.GetUsers(ctx, token, realm, params)
+	if err != nil {
+		lh.LogActivity("Error while searching users:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+		return
+	}
+
+	// Older keyclock versions ignore exact, so every result is checked again
+	var matches []*gocloak.User
+	for _, user := range users {
+		if user == nil {
+			continue
+		}
+		candidate := gocloak.PString(user.Username)
+		if field == "email" {
+			candidate = gocloak.PString(user.Email)
+		}
+		if strings.EqualFold(candidate, value) {
+			matches = append(matches, user)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		lh.Debug0().LogDebug("No user matches exactly", logharbour.DebugInfo{Variables: map[string]any{field: value}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("user_not_found", field, value))
+		return
+	case len(matches) > 1:
+		lh.Debug0().LogDebug("Several users match exactly", logharbour.DebugInfo{Variables: map[string]any{field: value, "matches": len(matches)}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("multiple_matches", field, value))
+		return
+	}
+	user := matches[0]
+
+	// Send success response, with keycloak's own representation if asked for
+	var data any = UserLookupResponse{
+		ID:            gocloak.PString(user.ID),
+		Username:      gocloak.PString(user.Username),
+		Email:         gocloak.PString(user.Email),
+		FirstName:     gocloak.PString(user.FirstName),
+		LastName:      gocloak.PString(user.LastName),
+		Enabled:       gocloak.PBool(user.Enabled),
+		EmailVerified: gocloak.PBool(user.EmailVerified),
+		Attributes:    user.Attributes,
+	}
+	if raw {
+		data = user
+	}
+	utils.SendSuccessResponse(c, data)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of userLookup", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
@@ -0,0 +1,197 @@
+package userservice
+
+import (
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+const (
+	// defaultOnboardLinkLifespan is how long an onboarding link stays valid unless configured otherwise.
+	defaultOnboardLinkLifespan = 12 * time.Hour
+)
+
+// defaultOnboardActions are the actions an invited user completes through the onboarding link
+// unless configured otherwise.
+var defaultOnboardActions = []string{"VERIFY_EMAIL", "UPDATE_PASSWORD"}
+
+// OnboardingConfig configures the onboarding links sent to invited users. Zero values are
+// replaced by defaults.
+type OnboardingConfig struct {
+	// ClientID is the client the user is sent on to once the actions are done. Keycloak's
+	// account console is used when empty.
+	ClientID string `json:"client_id"`
+	// RedirectURI is where the user lands once the actions are done; it needs ClientID.
+	RedirectURI string `json:"redirect_uri"`
+	// LifespanSeconds is how long a link stays valid, 12 hours by default.
+	LifespanSeconds int `json:"lifespan_seconds"`
+	// Actions are the required actions the user completes through the link, by default
+	// VERIFY_EMAIL and UPDATE_PASSWORD.
+	Actions []string `json:"actions"`
+}
+
+// UserOnboardLinkRequest represents the structure for incoming user onboarding link requests.
+type UserOnboardLinkRequest struct {
+	Username  string `json:"username" validate:"required"`
+	Email     string `json:"email" validate:"required,email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// UserOnboardLinkResponse represents the structure for outgoing user onboarding link responses.
+// DefaultGroupsFailed lists the default groups the user could not be added to.
+type UserOnboardLinkResponse struct {
+	UserID              string    `json:"userID"`
+	Username            string    `json:"username"`
+	Email               string    `json:"email"`
+	Actions             []string  `json:"actions"`
+	ExpiresAt           time.Time `json:"expiresAt"`
+	DefaultGroups       []string  `json:"defaultGroups,omitempty"`
+	DefaultGroupsFailed []string  `json:"defaultGroupsFailed,omitempty"`
+}
+
+// HandleUserOnboardLinkRequest is a Handler function for inviting a user: the user is created in keyclock with
+// the configured required actions and keyclock emails them a one-time link through which to complete those
+// actions. keyclock does not hand the link's action token out, so the link only ever reaches the user's mailbox.
+// If the email cannot be sent the user is deleted again, so that the invitation can simply be retried.
+func HandleUserOnboardLinkRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("user onboard link request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into UserOnboardLinkRequest struct
+	var req UserOnboardLinkRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForUserOnboardLinkError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+	config := s.Dependencies["onboarding"].(OnboardingConfig)
+	lifespan := defaultOnboardLinkLifespan
+	if config.LifespanSeconds > 0 {
+		lifespan = time.Duration(config.LifespanSeconds) * time.Second
+	}
+	actions := config.Actions
+	if len(actions) == 0 {
+		actions = defaultOnboardActions
+	}
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	// Look up the default groups before creating anything
+	groupIDs, err := utils.ResolveDefaultGroups(ctx, client, token, realm)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching default groups:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "group_not_found"), ""))
+		return
+	}
+
+	userID, err := client.CreateUser(ctx, token, realm, gocloak.User{
+		Username:        gocloak.StringP(req.Username),
+		Email:           gocloak.StringP(req.Email),
+		FirstName:       gocloak.StringP(req.FirstName),
+		LastName:        gocloak.StringP(req.LastName),
+		Enabled:         gocloak.BoolP(true),
+		EmailVerified:   gocloak.BoolP(false),
+		RequiredActions: &actions,
+	})
+	if err != nil {
+		lh.LogActivity("Error while creating user:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	params := gocloak.ExecuteActionsEmail{
+		UserID:   gocloak.StringP(userID),
+		Lifespan: gocloak.IntP(int(lifespan.Seconds())),
+		Actions:  &actions,
+	}
+	if config.ClientID != "" {
+		params.ClientID = gocloak.StringP(config.ClientID)
+		if config.RedirectURI != "" {
+			params.RedirectURI = gocloak.StringP(config.RedirectURI)
+		}
+	}
+	if err := client.ExecuteActionsEmail(ctx, token, realm, params); err != nil {
+		lh.LogActivity("Error while sending onboarding email:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "userID": userID}})
+		if err := client.DeleteUser(ctx, token, realm, userID); err != nil {
+			lh.Warn().LogActivity("Could not delete user whose onboarding email failed", map[string]any{"error": err.Error(), "userID": userID})
+		}
+		utils.SendErrorResponse(c, utils.ErrorResponse("email_not_sent", "email", req.Email))
+		return
+	}
+	expiresAt := time.Now().UTC().Add(lifespan)
+
+	response := UserOnboardLinkResponse{UserID: userID, Username: req.Username, Email: req.Email, Actions: actions, ExpiresAt: expiresAt}
+	for _, path := range utils.DefaultGroups(realm) {
+		if err := client.AddUserToGroup(ctx, token, realm, userID, groupIDs[path]); err != nil {
+			response.DefaultGroupsFailed = append(response.DefaultGroupsFailed, path)
+			continue
+		}
+		utils.GroupMembershipChanged(realm, groupIDs[path])
+		response.DefaultGroups = append(response.DefaultGroups, path)
+	}
+
+	// Audit the invitation along with who sent it
+	lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("user").WithWhatInstanceId(userID).
+		LogDataChange("user onboarding link sent", logharbour.ChangeInfo{
+			Entity:    "user",
+			Operation: "create",
+			Changes: map[string]any{
+				"username":  req.Username,
+				"email":     req.Email,
+				"actions":   actions,
+				"clientId":  config.ClientID,
+				"expiresAt": expiresAt,
+			},
+		})
+
+	// Let any configured webhooks know about the new user
+	s.Dependencies["webhooks"].(*utils.WebhookNotifier).Notify("user", "created", userID, realm, utils.SubjectFromToken(token))
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of userOnboardLink", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// getValsForUserOnboardLinkError returns a slice of strings to be used as vals for a validation error.
+func (req *UserOnboardLinkRequest) getValsForUserOnboardLinkError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "Username":
+		vals = append(vals, "username is required")
+	case "Email":
+		vals = append(vals, "email must be an email address, to which the link is sent")
+	}
+	return vals
+}
@@ -0,0 +1,133 @@
+package userservice
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// ClearRequiredActionsRequest represents the structure for incoming requests to clear a user's required actions.
+// When Actions is empty, every required action is cleared.
+type ClearRequiredActionsRequest struct {
+	UserID  string   `json:"userID" validate:"required"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+// ClearRequiredActionsResponse represents the structure for outgoing clear required actions responses.
+type ClearRequiredActionsResponse struct {
+	UserID          string   `json:"userID"`
+	Cleared         []string `json:"cleared"`
+	RequiredActions []string `json:"requiredActions"`
+}
+
+// HandleUserClearRequiredActionsRequest is a Handler function for removing required actions from a user in keyclock
+func HandleUserClearRequiredActionsRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("clear required actions request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	// Unmarshal JSON request into ClearRequiredActionsRequest struct
+	var req ClearRequiredActionsRequest
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		lh.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]interface{}{"Error": err.Error()}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("invalid_json", ""))
+		return
+	}
+
+	// Validate incoming request
+	validationErrors := wscutils.WscValidate(req, req.getValsForClearRequiredActionsError)
+	if len(validationErrors) > 0 {
+		lh.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
+		utils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	user, err := client.GetUserByID(ctx, token, realm, req.UserID)
+	if err != nil {
+		lh.Debug0().LogDebug("Error while fetching user:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "userID": req.UserID}})
+		utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+		return
+	}
+
+	var current []string
+	if user.RequiredActions != nil {
+		current = *user.RequiredActions
+	}
+	remaining, cleared := removeRequiredActions(current, req.Actions)
+
+	if len(cleared) > 0 {
+		user.RequiredActions = &remaining
+		if err := client.UpdateUser(ctx, token, realm, *user); err != nil {
+			lh.LogActivity("Error while updating user:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(userErrorCode(err), ""))
+			return
+		}
+
+		// Audit the change along with who made it
+		lh.WithWho(utils.SubjectFromToken(token)).WithWhatClass("user").WithWhatInstanceId(req.UserID).
+			LogDataChange("required actions cleared", logharbour.ChangeInfo{
+				Entity:    "user",
+				Operation: "update",
+				Changes:   map[string]any{"requiredActions": map[string]any{"old": current, "new": remaining}},
+			})
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, ClearRequiredActionsResponse{
+		UserID:          req.UserID,
+		Cleared:         cleared,
+		RequiredActions: remaining,
+	})
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of clearRequiredActions", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// removeRequiredActions removes the given actions from current, or all of them if actions
+// is empty. It returns the remaining actions and those actually removed.
+func removeRequiredActions(current, actions []string) (remaining, cleared []string) {
+	remove := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		remove[action] = true
+	}
+	remaining, cleared = []string{}, []string{}
+	for _, action := range current {
+		if len(actions) == 0 || remove[action] {
+			cleared = append(cleared, action)
+		} else {
+			remaining = append(remaining, action)
+		}
+	}
+	return remaining, cleared
+}
+
+// getValsForClearRequiredActionsError returns a slice of strings to be used as vals for a validation error.
+func (req *ClearRequiredActionsRequest) getValsForClearRequiredActionsError(err validator.FieldError) []string {
+	var vals []string
+	switch err.Field() {
+	case "UserID":
+		vals = append(vals, "userID is required")
+	}
+	return vals
+}
@@ -0,0 +1,147 @@
+package userservice
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxMissingAttributeScan is the largest number of users scanned for a missing attribute.
+const maxMissingAttributeScan = 50000
+
+// MissingAttributeUser represents a single user lacking the attribute looked for.
+type MissingAttributeUser struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// UsersMissingAttributeResponse represents the structure for outgoing users missing attribute responses.
+// Scanned is the number of users looked at. Truncated is set when the scan stopped before reaching the
+// last user of the realm, because max users were found or maxMissingAttributeScan users were scanned.
+type UsersMissingAttributeResponse struct {
+	Key       string                 `json:"key"`
+	Users     []MissingAttributeUser `json:"users"`
+	Scanned   int                    `json:"scanned"`
+	Truncated bool                   `json:"truncated"`
+}
+
+// HandleUsersMissingAttributeRequest is a Handler function for finding the users in keyclock lacking an attribute,
+// e.g. /users-missing-attribute?key=employee_id, for data quality audits. Users holding the attribute with only
+// empty values count as lacking it. keyclock cannot search for a missing attribute, so the users of the realm
+// are scanned a page at a time, which costs a keyclock call per 1000 users.
+func HandleUsersMissingAttributeRequest(c *gin.Context, s *service.Service) {
+	lh := s.LogHarbour
+	lh.Log("users missing attribute request received")
+
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		// Log and respond to token extraction/validation error
+		lh.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.SendErrorResponse(c, utils.ErrorResponse("token_missing", ""))
+		return
+	}
+
+	key := c.Query("key")
+	if key == "" {
+		lh.Debug0().LogDebug("Missing attribute key", logharbour.DebugInfo{})
+		utils.SendErrorResponse(c, utils.ErrorResponse("missing", "key"))
+		return
+	}
+
+	max := utils.DefaultPageSize
+	if v := c.Query("max"); v != "" {
+		if max, err = strconv.Atoi(v); err != nil || max <= 0 {
+			lh.Debug0().LogDebug("Invalid max parameter", logharbour.DebugInfo{Variables: map[string]any{"max": v}})
+			utils.SendErrorResponse(c, utils.ErrorResponse("invalid_request", "max"))
+			return
+		}
+	}
+	if max > utils.MaxPageSize {
+		max = utils.MaxPageSize
+	}
+
+	// Extracting the GoCloak client from the service dependencies and the realm from the request
+	client := s.Dependencies["goclock"].(utils.KeycloakClient)
+	realm := utils.GetRealm(c)
+
+	// Create a context with the timeout configured for this route
+	ctx, cancel := utils.RequestContext(c)
+	defer cancel()
+
+	response := UsersMissingAttributeResponse{Key: key, Users: []MissingAttributeUser{}}
+	for first := 0; ; first += utils.MaxPageSize {
+		if first >= maxMissingAttributeScan {
+			response.Truncated = true
+			break
+		}
+		users, err := client.GetUsers(ctx, token, realm, gocloak.GetUsersParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(utils.MaxPageSize),
+			BriefRepresentation: gocloak.BoolP(false),
+		})
+		if err != nil {
+			lh.LogActivity("Error while fetching users:", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err, "first": first}})
+			utils.SendErrorResponse(c, utils.ErrorResponse(utils.KeycloakErrorCode(err, "realm_not_found"), ""))
+			return
+		}
+		for i, user := range users {
+			if user == nil || hasAttribute(user.Attributes, key) {
+				continue
+			}
+			if len(response.Users) == max {
+				// Another user lacks the attribute, beyond those to be returned
+				response.Truncated = true
+				response.Scanned = first + i
+				break
+			}
+			response.Users = append(response.Users, MissingAttributeUser{
+				ID:        gocloak.PString(user.ID),
+				Username:  gocloak.PString(user.Username),
+				Email:     gocloak.PString(user.Email),
+				FirstName: gocloak.PString(user.FirstName),
+				LastName:  gocloak.PString(user.LastName),
+				Enabled:   gocloak.PBool(user.Enabled),
+			})
+		}
+		if response.Truncated {
+			break
+		}
+		response.Scanned = first + len(users)
+		if len(users) < utils.MaxPageSize {
+			break
+		}
+	}
+	if response.Truncated {
+		lh.Warn().LogActivity("Users missing attribute scan stopped early", map[string]any{"key": key, "scanned": response.Scanned, "found": len(response.Users)})
+	}
+
+	// Send success response
+	utils.SendSuccessResponse(c, response)
+
+	// Log the completion of execution
+	lh.LogActivity("Finished execution of usersMissingAttribute", map[string]string{"Timestamp": time.Now().Format("2006-01-02 15:04:05")})
+}
+
+// hasAttribute reports whether attributes hold key with at least one non blank value.
+func hasAttribute(attributes *map[string][]string, key string) bool {
+	if attributes == nil {
+		return false
+	}
+	for _, value := range (*attributes)[key] {
+		if strings.TrimSpace(value) != "" {
+			return true
+		}
+	}
+	return false
+}